@@ -0,0 +1,549 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrCartEmpty        = errors.New("cart is empty")
+	ErrCartItemNotFound = errors.New("cart item not found")
+	ErrNotOnMenu        = errors.New("not on the menu")
+	ErrInvalidQuantity  = errors.New("quantity must be at least 1")
+)
+
+// CartLine is what a customer puts in their cart: a pizza in a size and crust with its modifiers,
+// or an extra item. A size or crust of 0 is the default one.
+type CartLine struct {
+	Type      string          `json:"type"` // "pizza" or "extra"
+	ID        int             `json:"id"`
+	SizeID    int             `json:"size_id"`
+	CrustID   int             `json:"crust_id"`
+	Quantity  int             `json:"quantity"`
+	Modifiers []PizzaModifier `json:"modifiers"`
+}
+
+// CartItem is a line of the cart priced with the current menu. A line that can't be ordered as it is
+// anymore, because its recipe or toppings changed, is not Available and Problem says why.
+type CartItem struct {
+	ID        int             `json:"id"`
+	Type      string          `json:"type"`
+	ItemID    int             `json:"item_id"`
+	Name      string          `json:"name"`
+	SizeID    int             `json:"size_id"`
+	CrustID   int             `json:"crust_id"`
+	Modifiers []PizzaModifier `json:"modifiers"`
+	Quantity  int             `json:"quantity"`
+	UnitPrice float64         `json:"unit_price"`
+	LineTotal float64         `json:"line_total"`
+	Available bool            `json:"available"`
+	// The kitchen is out of an ingredient of the pizza, checkout refuses it until it is restocked
+	OutOfStock bool      `json:"out_of_stock"`
+	Problem    string    `json:"problem,omitempty"`
+	AddedAt    time.Time `json:"added_at"`
+}
+
+// Cart is a customer's cart as it would cost now, before promotions, discounts and delivery.
+// QuoteCart prices it the way checkout does.
+type Cart struct {
+	Items []CartItem `json:"items"`
+	// Pizzas and extra items in the cart
+	Count     int        `json:"count"`
+	Subtotal  float64    `json:"subtotal"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// cartRow is a line as the cart_item table has it.
+type cartRow struct {
+	id          int
+	pizzaID     sql.NullInt64
+	sizeID      sql.NullInt64
+	crustID     sql.NullInt64
+	extraItemID sql.NullInt64
+	quantity    int
+	addedAt     time.Time
+	modifiers   []PizzaModifier
+}
+
+func (r cartRow) isPizza() bool {
+	return r.pizzaID.Valid
+}
+
+// GetCart returns the customer's cart priced with the current menu, an empty cart when they have none.
+func GetCart(customerID int) (Cart, error) {
+	cart := Cart{Items: []CartItem{}}
+	var cartID int
+	var updatedAt time.Time
+	err := DATABASE.QueryRow(`SELECT id, updated_at FROM cart WHERE customer_id = ?`, customerID).Scan(&cartID, &updatedAt)
+	if err == sql.ErrNoRows {
+		return cart, nil
+	}
+	if err != nil {
+		return Cart{}, err
+	}
+	cart.UpdatedAt = &updatedAt
+
+	rows, err := getCartRows(DATABASE, cartID)
+	if err != nil {
+		return Cart{}, err
+	}
+	cfg, err := getPricingConfig(DATABASE)
+	if err != nil {
+		return Cart{}, err
+	}
+	outOfStock, err := unavailablePizzaIDs(DATABASE)
+	if err != nil {
+		return Cart{}, err
+	}
+
+	subtotal := decimal.Zero
+	for _, row := range rows {
+		item, lineTotal, err := priceCartRow(cfg, outOfStock, row)
+		if err != nil {
+			return Cart{}, err
+		}
+		cart.Items = append(cart.Items, item)
+		cart.Count += item.Quantity
+		if item.Available {
+			subtotal = subtotal.Add(lineTotal)
+		}
+	}
+	cart.Subtotal, _ = subtotal.Float64()
+	return cart, nil
+}
+
+// priceCartRow prices a line with the current menu, the errors a menu change causes make it unavailable.
+func priceCartRow(cfg PricingConfig, outOfStock map[int]bool, row cartRow) (CartItem, decimal.Decimal, error) {
+	item := CartItem{ID: row.id, Quantity: row.quantity, Modifiers: row.modifiers, AddedAt: row.addedAt, Available: true}
+	var unitPrice decimal.Decimal
+	if !row.isPizza() {
+		item.Type = "extra"
+		item.ItemID = int(row.extraItemID.Int64)
+		item.Modifiers = []PizzaModifier{}
+		var priceStr string
+		err := DATABASE.QueryRow(`SELECT name, price FROM extra_item WHERE id = ?`, item.ItemID).Scan(&item.Name, &priceStr)
+		if err != nil {
+			return CartItem{}, decimal.Zero, err
+		}
+		if unitPrice, err = decimal.NewFromString(priceStr); err != nil {
+			return CartItem{}, decimal.Zero, err
+		}
+	} else {
+		item.Type = "pizza"
+		item.ItemID = int(row.pizzaID.Int64)
+		item.SizeID = int(row.sizeID.Int64)
+		item.CrustID = int(row.crustID.Int64)
+		variant, err := getPizzaVariant(DATABASE, item.SizeID, item.CrustID)
+		if err != nil {
+			return CartItem{}, decimal.Zero, err
+		}
+		var pizzaName string
+		if err := DATABASE.QueryRow(`SELECT name FROM pizza WHERE id = ?`, item.ItemID).Scan(&pizzaName); err != nil {
+			return CartItem{}, decimal.Zero, err
+		}
+		item.Name = describePizza(fmt.Sprintf("%s (%s, %s)", pizzaName, variant.Size.Name, variant.Crust.Name), row.modifiers)
+
+		priced, err := pricePizza(DATABASE, cfg, item.ItemID, variant, row.modifiers)
+		switch {
+		case errors.Is(err, ErrInvalidModifier):
+			item.Available = false
+			item.Problem = "The recipe changed, please take this pizza out and customize it again"
+			return item, decimal.Zero, nil
+		case errors.Is(err, ErrEmptyPizza):
+			item.Available = false
+			item.Problem = "This pizza has no toppings left, please take it out and add at least one"
+			return item, decimal.Zero, nil
+		case err != nil:
+			return CartItem{}, decimal.Zero, err
+		}
+		unitPrice = priced.UnitPrice
+		if outOfStock[item.ItemID] {
+			item.OutOfStock = true
+			item.Problem = "We are out of an ingredient of this pizza right now"
+		}
+	}
+
+	lineTotal := unitPrice.Mul(decimal.NewFromInt(int64(row.quantity)))
+	item.UnitPrice, _ = unitPrice.Float64()
+	item.LineTotal, _ = lineTotal.Float64()
+	return item, lineTotal, nil
+}
+
+// AddToCart puts a line in the customer's cart and returns the ID of its cart line. A pizza that is
+// already in the cart in the same size, crust and toppings, or the same extra item, adds to that line.
+// The line is checked against the menu as it is now, with the errors checkout would give.
+func AddToCart(customerID int, line CartLine) (int, error) {
+	if line.Quantity < 1 {
+		return 0, ErrInvalidQuantity
+	}
+	tx, err := DATABASE.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := lockCustomer(tx, customerID); err != nil {
+		return 0, err
+	}
+	if line, err = checkCartLine(tx, line); err != nil {
+		return 0, err
+	}
+	cartID, err := getOrCreateCart(tx, customerID)
+	if err != nil {
+		return 0, err
+	}
+	itemID, err := addCartLine(tx, cartID, line)
+	if err != nil {
+		return 0, err
+	}
+	return itemID, tx.Commit()
+}
+
+// AddLinesToCart puts lines, which have to be checked already, in the customer's cart in one go. Like
+// AddToCart a line that is in the cart already adds to its quantity, nothing is taken out.
+func AddLinesToCart(customerID int, lines []CartLine) error {
+	tx, err := DATABASE.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockCustomer(tx, customerID); err != nil {
+		return err
+	}
+	cartID, err := getOrCreateCart(tx, customerID)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if _, err := addCartLine(tx, cartID, line); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// checkCartLine makes sure the pizza or extra item is on the menu and the pizza can be made the way the
+// line asks, and fills in the default size and crust.
+func checkCartLine(q queryer, line CartLine) (CartLine, error) {
+	var exists int
+	if line.Type == "extra" {
+		err := q.QueryRow(`SELECT 1 FROM extra_item WHERE id = ?`, line.ID).Scan(&exists)
+		if err == sql.ErrNoRows {
+			return line, ErrNotOnMenu
+		}
+		line.SizeID, line.CrustID, line.Modifiers = 0, 0, nil
+		return line, err
+	}
+	if line.Type != "pizza" {
+		return line, fmt.Errorf("unknown cart item type %q", line.Type)
+	}
+
+	err := q.QueryRow(`SELECT 1 FROM pizza WHERE id = ?`, line.ID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return line, ErrNotOnMenu
+	}
+	if err != nil {
+		return line, err
+	}
+	variant, err := getPizzaVariant(q, line.SizeID, line.CrustID)
+	if err != nil {
+		return line, err
+	}
+	cfg, err := getPricingConfig(q)
+	if err != nil {
+		return line, err
+	}
+	if _, err := pricePizza(q, cfg, line.ID, variant, line.Modifiers); err != nil {
+		return line, err
+	}
+	line.SizeID, line.CrustID = variant.Size.ID, variant.Crust.ID
+	return line, nil
+}
+
+// getOrCreateCart returns the ID of the customer's cart, creating it the first time, and marks it updated.
+func getOrCreateCart(q queryer, customerID int) (int, error) {
+	now := time.Now()
+	var cartID int
+	err := q.QueryRow(`SELECT id FROM cart WHERE customer_id = ?`, customerID).Scan(&cartID)
+	if err == sql.ErrNoRows {
+		res, err := q.Exec(`INSERT INTO cart (customer_id, updated_at) VALUES (?, ?)`, customerID, now)
+		if err != nil {
+			return 0, err
+		}
+		id, err := res.LastInsertId()
+		return int(id), err
+	}
+	if err != nil {
+		return 0, err
+	}
+	_, err = q.Exec(`UPDATE cart SET updated_at = ? WHERE id = ?`, now, cartID)
+	return cartID, err
+}
+
+// addCartLine adds a checked line to the cart, to the quantity of the same line when there is one.
+func addCartLine(q queryer, cartID int, line CartLine) (int, error) {
+	rows, err := getCartRows(q, cartID)
+	if err != nil {
+		return 0, err
+	}
+	for _, row := range rows {
+		if sameCartLine(row, line) {
+			_, err := q.Exec(`UPDATE cart_item SET quantity = quantity + ? WHERE id = ?`, line.Quantity, row.id)
+			return row.id, err
+		}
+	}
+
+	var res sql.Result
+	if line.Type == "extra" {
+		res, err = q.Exec(`INSERT INTO cart_item (cart_id, extra_item_id, quantity, added_at) VALUES (?, ?, ?, ?)`,
+			cartID, line.ID, line.Quantity, time.Now())
+	} else {
+		res, err = q.Exec(`INSERT INTO cart_item (cart_id, pizza_id, size_id, crust_id, quantity, added_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			cartID, line.ID, line.SizeID, line.CrustID, line.Quantity, time.Now())
+	}
+	if err != nil {
+		return 0, err
+	}
+	itemID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range line.Modifiers {
+		_, err := q.Exec(`INSERT INTO cart_item_modifier (cart_item_id, ingredient_id, action) VALUES (?, ?, ?)`, itemID, m.IngredientID, m.Action)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return int(itemID), nil
+}
+
+// sameCartLine tells whether line is the same pizza or extra item as the row, with the same toppings in any order.
+func sameCartLine(row cartRow, line CartLine) bool {
+	if line.Type == "extra" {
+		return !row.isPizza() && int(row.extraItemID.Int64) == line.ID
+	}
+	if !row.isPizza() || int(row.pizzaID.Int64) != line.ID || int(row.sizeID.Int64) != line.SizeID || int(row.crustID.Int64) != line.CrustID {
+		return false
+	}
+	return maps.Equal(modifierActions(row.modifiers), modifierActions(line.Modifiers))
+}
+
+func modifierActions(modifiers []PizzaModifier) map[int]ModifierAction {
+	actions := make(map[int]ModifierAction, len(modifiers))
+	for _, m := range modifiers {
+		actions[m.IngredientID] = m.Action
+	}
+	return actions
+}
+
+// getCartRows loads the lines of a cart with their modifiers, oldest first.
+func getCartRows(q queryer, cartID int) ([]cartRow, error) {
+	rows, err := q.Query(`
+		SELECT id, pizza_id, size_id, crust_id, extra_item_id, quantity, added_at
+		FROM cart_item
+		WHERE cart_id = ?
+		ORDER BY id
+	`, cartID)
+	if err != nil {
+		return nil, err
+	}
+	var lines []cartRow
+	for rows.Next() {
+		var r cartRow
+		if err := rows.Scan(&r.id, &r.pizzaID, &r.sizeID, &r.crustID, &r.extraItemID, &r.quantity, &r.addedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		lines = append(lines, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range lines {
+		if !lines[i].isPizza() {
+			continue
+		}
+		if lines[i].modifiers, err = getCartItemModifiers(q, lines[i].id); err != nil {
+			return nil, err
+		}
+	}
+	return lines, nil
+}
+
+// getCartItemModifiers loads the modifiers of one pizza line, removals first like getOrderPizzaModifiers.
+func getCartItemModifiers(q queryer, cartItemID int) ([]PizzaModifier, error) {
+	rows, err := q.Query(`
+		SELECT m.ingredient_id, i.name, m.action
+		FROM cart_item_modifier m
+		JOIN ingredient i ON m.ingredient_id = i.id
+		WHERE m.cart_item_id = ?
+		ORDER BY m.action DESC, i.name
+	`, cartItemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	modifiers := []PizzaModifier{}
+	for rows.Next() {
+		var m PizzaModifier
+		if err := rows.Scan(&m.IngredientID, &m.IngredientName, &m.Action); err != nil {
+			return nil, err
+		}
+		modifiers = append(modifiers, m)
+	}
+	return modifiers, rows.Err()
+}
+
+// UpdateCartItemQuantity sets the quantity of a line of the customer's cart, 0 takes it out.
+func UpdateCartItemQuantity(customerID, itemID, quantity int) error {
+	if quantity < 0 {
+		return ErrInvalidQuantity
+	}
+	if quantity == 0 {
+		return RemoveFromCart(customerID, itemID)
+	}
+	return changeCartItem(customerID, `
+		UPDATE cart_item SET quantity = ?
+		WHERE id = ? AND cart_id IN (SELECT id FROM cart WHERE customer_id = ?)
+	`, quantity, itemID, customerID)
+}
+
+// RemoveFromCart takes a line out of the customer's cart.
+func RemoveFromCart(customerID, itemID int) error {
+	return changeCartItem(customerID, `
+		DELETE FROM cart_item
+		WHERE id = ? AND cart_id IN (SELECT id FROM cart WHERE customer_id = ?)
+	`, itemID, customerID)
+}
+
+// changeCartItem runs a change to one line of the customer's cart and marks the cart updated, ErrCartItemNotFound
+// when the line isn't in their cart. Like every change to a cart it waits for a checkout of the cart to finish.
+func changeCartItem(customerID int, query string, args ...any) error {
+	tx, err := DATABASE.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockCustomer(tx, customerID); err != nil {
+		return err
+	}
+	res, err := tx.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	changed, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if changed == 0 {
+		return ErrCartItemNotFound
+	}
+	if _, err := tx.Exec(`UPDATE cart SET updated_at = ? WHERE customer_id = ?`, time.Now(), customerID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ClearCart takes everything out of the customer's cart.
+func ClearCart(customerID int) error {
+	tx, err := DATABASE.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockCustomer(tx, customerID); err != nil {
+		return err
+	}
+	if err := clearCart(tx, customerID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func clearCart(q queryer, customerID int) error {
+	_, err := q.Exec(`DELETE FROM cart_item WHERE cart_id IN (SELECT id FROM cart WHERE customer_id = ?)`, customerID)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(`UPDATE cart SET updated_at = ? WHERE customer_id = ?`, time.Now(), customerID)
+	return err
+}
+
+// cartOrderItems turns the customer's cart into the items the order functions want, ErrCartEmpty
+// when there is nothing in it.
+func cartOrderItems(q queryer, customerID int) ([]PizzaOrderItem, []ExtraOrderItem, error) {
+	var pizzaItems []PizzaOrderItem
+	var extraItems []ExtraOrderItem
+
+	var cartID int
+	err := q.QueryRow(`SELECT id FROM cart WHERE customer_id = ?`, customerID).Scan(&cartID)
+	if err == sql.ErrNoRows {
+		return nil, nil, ErrCartEmpty
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := getCartRows(q, cartID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil, ErrCartEmpty
+	}
+
+	for _, row := range rows {
+		if !row.isPizza() {
+			extraItems = append(extraItems, ExtraOrderItem{ExtraItemID: int(row.extraItemID.Int64), Quantity: row.quantity})
+			continue
+		}
+		pizzaItems = append(pizzaItems, PizzaOrderItem{PizzaID: int(row.pizzaID.Int64), SizeID: int(row.sizeID.Int64), CrustID: int(row.crustID.Int64), Quantity: row.quantity, Modifiers: row.modifiers})
+	}
+	return pizzaItems, extraItems, nil
+}
+
+// QuoteCart prices the customer's cart exactly the way CheckoutCart will, see QuoteOrder.
+func QuoteCart(customerID, userID int, postalCode string, discountCode *string) (PriceBreakdown, error) {
+	pizzaItems, extraItems, err := cartOrderItems(DATABASE, customerID)
+	if err != nil {
+		return PriceBreakdown{}, err
+	}
+	return QuoteOrder(userID, postalCode, pizzaItems, extraItems, discountCode)
+}
+
+// CheckoutCart places an order for what is in the customer's cart and empties it, in one transaction.
+// The customer stays locked from reading the cart until the order is placed, so a change made meanwhile
+// in another browser waits for the checkout and goes into the next cart.
+func CheckoutCart(customerID, userID int, deliveryAddress, postalCode string, discountCode *string) (int, error) {
+	tx, err := DATABASE.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := lockCustomer(tx, customerID); err != nil {
+		return 0, err
+	}
+	pizzaItems, extraItems, err := cartOrderItems(tx, customerID)
+	if err != nil {
+		return 0, err
+	}
+	orderID, err := createOrder(tx, customerID, userID, deliveryAddress, postalCode, pizzaItems, extraItems, discountCode)
+	if err != nil {
+		return 0, err
+	}
+	if err := clearCart(tx, customerID); err != nil {
+		return 0, err
+	}
+	return orderID, tx.Commit()
+}
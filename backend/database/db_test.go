@@ -0,0 +1,38 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openTestDB points DATABASE at a new, empty SQLite database for the test.
+func openTestDB(t *testing.T) {
+	t.Helper()
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+	Connect()
+	t.Cleanup(Close)
+}
+
+// migrateTestDB opens a test database with every migration applied.
+func migrateTestDB(t *testing.T) {
+	t.Helper()
+	openTestDB(t)
+	if _, err := MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLiteTimestampsAreText(t *testing.T) {
+	migrateTestDB(t)
+	placeTestOrders(t)
+
+	var stored string
+	if err := DATABASE.QueryRow(`SELECT CAST(timestamp AS TEXT) FROM orders LIMIT 1`).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := time.Parse("2006-01-02 15:04:05.999999999-07:00", stored); err != nil {
+		t.Errorf("order timestamp stored as %q: %v", stored, err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"log"
+	"strings"
 	"time"
 )
 
@@ -13,6 +14,8 @@ var (
 	ErrDeliveryPersonUnavailable = errors.New("delivery person is unavailable")
 	ErrDeliveryPersonBusy        = errors.New("delivery person already has an active delivery")
 	ErrInvalidStatus             = errors.New("invalid status")
+	ErrNotYourDelivery           = errors.New("order is not assigned to this delivery person")
+	ErrDeliveryPersonNotFound    = errors.New("delivery person not found")
 )
 
 type DeliveryPerson struct {
@@ -71,39 +74,88 @@ func TryAddDeliveryPerson(
 
 // Admin functions for delivery person management
 
+// GetAllDeliveryPersons returns every courier by name, for the dropdowns that pick one.
 func GetAllDeliveryPersons() ([]map[string]interface{}, error) {
-	query := `
-		SELECT u.id, u.username, dp.name, dp.vehicle_type
-		FROM user u
-		INNER JOIN delivery_person dp ON u.id = dp.user_id
-		WHERE u.role = 'DELIVERY'
-		ORDER BY dp.name
-	`
-	rows, err := DATABASE.Query(query)
+	deliveryPersons, _, err := ListDeliveryPersons(DeliveryPersonFilter{})
+	return deliveryPersons, err
+}
+
+// DeliveryPersonFilter narrows down and pages the admin courier list. Blank fields don't filter.
+type DeliveryPersonFilter struct {
+	// Usernames or names containing it
+	Search      string
+	VehicleType string
+	// Couriers that deliver in the zone
+	ZoneID int
+	ListOptions
+}
+
+var deliveryPersonSorts = sortColumns{
+	"id":           "u.id",
+	"username":     "u.username",
+	"name":         "dp.name",
+	"vehicle_type": "dp.vehicle_type",
+}
+
+// ListDeliveryPersons returns a page of the couriers matching the filter, by name unless it sorts them
+// otherwise, and how many match across all pages. The id is their user id, delivery_person_id the
+// one orders refer to.
+func ListDeliveryPersons(filter DeliveryPersonFilter) ([]map[string]interface{}, int, error) {
+	conditions := []string{"u.role = 'DELIVERY'"}
+	var args []any
+	if filter.Search != "" {
+		conditions = append(conditions, "(u.username LIKE ? OR dp.name LIKE ?)")
+		search := "%" + filter.Search + "%"
+		args = append(args, search, search)
+	}
+	if filter.VehicleType != "" {
+		conditions = append(conditions, "dp.vehicle_type = ?")
+		args = append(args, filter.VehicleType)
+	}
+	if filter.ZoneID != 0 {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM delivery_person_zone dpz WHERE dpz.delivery_person_id = dp.id AND dpz.delivery_zone_id = ?)")
+		args = append(args, filter.ZoneID)
+	}
+	where := whereClause(conditions)
+
+	orderBy, err := filter.orderBy(deliveryPersonSorts, "dp.name, u.id", "u.id")
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	from := "user u INNER JOIN delivery_person dp ON u.id = dp.user_id"
+	total, err := countRows(from, where, args)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	page, pageArgs := filter.page()
+	rows, err := DATABASE.Query(`SELECT u.id, dp.id, u.username, dp.name, dp.vehicle_type FROM `+from+where+orderBy+page,
+		append(args, pageArgs...)...)
+	if err != nil {
+		return nil, 0, err
 	}
 	defer rows.Close()
 
 	var deliveryPersons []map[string]interface{}
 	for rows.Next() {
-		var id int
+		var id, deliveryPersonID int
 		var username, name, vehicleType string
-		err := rows.Scan(&id, &username, &name, &vehicleType)
+		err := rows.Scan(&id, &deliveryPersonID, &username, &name, &vehicleType)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 
 		person := map[string]interface{}{
-			"id":           id,
-			"username":     username,
-			"name":         name,
-			"vehicle_type": vehicleType,
+			"id":                 id,
+			"delivery_person_id": deliveryPersonID,
+			"username":           username,
+			"name":               name,
+			"vehicle_type":       vehicleType,
 		}
 		deliveryPersons = append(deliveryPersons, person)
 	}
 
-	return deliveryPersons, nil
+	return deliveryPersons, total, rows.Err()
 }
 
 func DeleteDeliveryPerson(userID int) error {
@@ -137,69 +189,69 @@ func GetDeliveryPersonIDFromUserID(userID int) (int, error) {
 	return id, nil
 }
 
-// IsDeliveryPersonAvailable returns true if delivery person is not in cooldown and has no active deliveries
+// IsDeliveryPersonAvailable returns true if delivery person is not in cooldown and can carry another order
 func IsDeliveryPersonAvailable(deliveryPersonID int) (bool, error) {
 	var unavailableUntil sql.NullTime
 	err := DATABASE.QueryRow("SELECT unavailable_until FROM delivery_person WHERE id = ?", deliveryPersonID).Scan(&unavailableUntil)
 	if err != nil {
 		return false, err
 	}
-	if unavailableUntil.Valid {
-		var now time.Time
-		if err := DATABASE.QueryRow("SELECT NOW()").Scan(&now); err == nil {
-			if unavailableUntil.Time.After(now) {
-				return false, nil
-			}
-		}
+	if unavailableUntil.Valid && unavailableUntil.Time.After(time.Now()) {
+		return false, nil
 	}
 	var activeCount int
-	err = DATABASE.QueryRow("SELECT COUNT(*) FROM orders WHERE delivery_person_id = ? AND status IN ('IN_PROGRESS','OUT_FOR_DELIVERY')", deliveryPersonID).Scan(&activeCount)
+	err = DATABASE.QueryRow("SELECT COUNT(*) FROM orders WHERE delivery_person_id = ? AND status NOT IN ('DELIVERED','FAILED','CANCELLED')", deliveryPersonID).Scan(&activeCount)
 	if err != nil {
 		return false, err
 	}
-	if activeCount > 0 {
-		return false, nil
+	policy, err := GetDispatchPolicy()
+	if err != nil {
+		return false, err
 	}
-	return true, nil
+	return activeCount < policy.MaxBatchSize, nil
 }
 
-func GetAvailableDeliveries() ([]Order, error) {
+// GetAvailableDeliveries returns the orders ready to be picked up. With zoneIDs only those going to one of
+// these zones, nil is every zone.
+func GetAvailableDeliveries(zoneIDs []int) ([]Order, error) {
 	query := `
-		SELECT o.id, o.customer_id, c.name, o.timestamp, o.status, o.postal_code, o.delivery_address
+		SELECT o.id, o.customer_id, c.name, o.timestamp, o.status, o.postal_code, o.delivery_address, z.name
 		FROM orders o
 		JOIN customer c ON o.customer_id = c.id
-		WHERE o.status = 'IN_PROGRESS'
+		LEFT JOIN delivery_zone z ON o.delivery_zone_id = z.id
+		WHERE o.status = 'READY'
 		AND o.delivery_person_id IS NULL
-		ORDER BY o.timestamp ASC
+		AND NOT EXISTS (
+			SELECT 1 FROM order_pizza op
+			WHERE op.order_id = o.id AND op.kitchen_status <> 'FINISHED'
+		)
 	`
-	rows, err := DATABASE.Query(query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var orders []Order
-	for rows.Next() {
-		var order Order
-		err := rows.Scan(&order.ID, &order.CustomerID, &order.CustomerName, &order.Timestamp, &order.Status, &order.PostalCode, &order.DeliveryAddress)
-		if err != nil {
-			return nil, err
+	var args []any
+	if zoneIDs != nil {
+		if len(zoneIDs) == 0 {
+			return []Order{}, nil
+		}
+		query += ` AND o.delivery_zone_id IN (?` + strings.Repeat(", ?", len(zoneIDs)-1) + `)`
+		for _, id := range zoneIDs {
+			args = append(args, id)
 		}
-		orders = append(orders, order)
 	}
-	return orders, nil
+	return queryDeliveries(query+` ORDER BY o.timestamp ASC`, args...)
 }
 
 func GetAssignedDeliveries(deliveryPersonID int) ([]Order, error) {
-	query := `
-		SELECT o.id, o.customer_id, c.name, o.timestamp, o.status, o.postal_code, o.delivery_address
+	return queryDeliveries(`
+		SELECT o.id, o.customer_id, c.name, o.timestamp, o.status, o.postal_code, o.delivery_address, z.name
 		FROM orders o
 		JOIN customer c ON o.customer_id = c.id
+		LEFT JOIN delivery_zone z ON o.delivery_zone_id = z.id
 		WHERE o.delivery_person_id = ?
-		AND o.status IN ('IN_PROGRESS', 'OUT_FOR_DELIVERY', 'DELIVERED', 'FAILED')
 		ORDER BY o.timestamp DESC
-	`
-	rows, err := DATABASE.Query(query, deliveryPersonID)
+	`, deliveryPersonID)
+}
+
+func queryDeliveries(query string, args ...any) ([]Order, error) {
+	rows, err := DATABASE.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -208,16 +260,33 @@ func GetAssignedDeliveries(deliveryPersonID int) ([]Order, error) {
 	var orders []Order
 	for rows.Next() {
 		var order Order
-		err := rows.Scan(&order.ID, &order.CustomerID, &order.CustomerName, &order.Timestamp, &order.Status, &order.PostalCode, &order.DeliveryAddress)
+		var zone sql.NullString
+		err := rows.Scan(&order.ID, &order.CustomerID, &order.CustomerName, &order.Timestamp, &order.Status, &order.PostalCode, &order.DeliveryAddress, &zone)
 		if err != nil {
 			return nil, err
 		}
+		if zone.Valid {
+			order.DeliveryZone = &zone.String
+		}
 		orders = append(orders, order)
 	}
 	return orders, nil
 }
 
+// AssignDelivery is a courier picking up a ready order, the status history records them.
 func AssignDelivery(orderID, deliveryPersonID int) error {
+	return assignDelivery(orderID, deliveryPersonID, 0)
+}
+
+// SetOrderDeliveryPerson is an admin handing a ready order to a courier. It takes the same checks as
+// AssignDelivery, the status history records the admin.
+func SetOrderDeliveryPerson(orderID, deliveryPersonID, adminUserID int) error {
+	return assignDelivery(orderID, deliveryPersonID, adminUserID)
+}
+
+// assignDelivery moves a ready order out for delivery with the courier, if the courier can take it now.
+// actorUserID is who assigned it, 0 for the courier themselves.
+func assignDelivery(orderID, deliveryPersonID, actorUserID int) error {
 	tx, err := DATABASE.Begin()
 	if err != nil {
 		return err
@@ -226,17 +295,27 @@ func AssignDelivery(orderID, deliveryPersonID int) error {
 
 	// Check if order is available
 	var status string
-	err = tx.QueryRow("SELECT status FROM orders WHERE id = ?", orderID).Scan(&status)
+	err = tx.QueryRow("SELECT status FROM orders WHERE id = ?"+currentDialect.forUpdate, orderID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return ErrOrderNotFound
+	}
 	if err != nil {
 		return err
 	}
-	if status != "IN_PROGRESS" {
+	if status != string(OrderReady) {
+		return ErrOrderNotAvailable
+	}
+	unbaked, err := countUnbakedPizzas(tx, orderID)
+	if err != nil {
+		return err
+	}
+	if unbaked > 0 {
 		return ErrOrderNotAvailable
 	}
 
 	// Check if order is already assigned (orders.delivery_person_id)
-	var existingAssigned sql.NullInt64
-	err = tx.QueryRow("SELECT delivery_person_id FROM orders WHERE id = ?", orderID).Scan(&existingAssigned)
+	var existingAssigned, zoneID sql.NullInt64
+	err = tx.QueryRow("SELECT delivery_person_id, delivery_zone_id FROM orders WHERE id = ?", orderID).Scan(&existingAssigned, &zoneID)
 	if err != nil {
 		return err
 	}
@@ -244,37 +323,39 @@ func AssignDelivery(orderID, deliveryPersonID int) error {
 		return ErrOrderAlreadyAssigned
 	}
 
-	// Check if delivery person is currently unavailable or already has an active assignment
+	// Check if delivery person is currently unavailable or can't carry this order too
+	var deliveryUserID int
 	var unavailableUntil sql.NullTime
-	err = tx.QueryRow("SELECT unavailable_until FROM delivery_person WHERE id = ?", deliveryPersonID).Scan(&unavailableUntil)
+	err = tx.QueryRow("SELECT user_id, unavailable_until FROM delivery_person WHERE id = ?"+currentDialect.forUpdate, deliveryPersonID).Scan(&deliveryUserID, &unavailableUntil)
+	if err == sql.ErrNoRows {
+		return ErrDeliveryPersonNotFound
+	}
 	if err != nil {
 		return err
 	}
-	if unavailableUntil.Valid {
-		// if unavailable_until > now, they are not available
-		var now time.Time
-		err = tx.QueryRow("SELECT NOW()").Scan(&now)
-		if err == nil && unavailableUntil.Time.After(now) {
-			return ErrDeliveryPersonUnavailable
-		}
+	if actorUserID == 0 {
+		actorUserID = deliveryUserID
+	}
+	// if unavailable_until > now, they are not available
+	if unavailableUntil.Valid && unavailableUntil.Time.After(time.Now()) {
+		return ErrDeliveryPersonUnavailable
 	}
 
-	// Check if delivery person already has an IN_PROGRESS or OUT_FOR_DELIVERY order assigned
-	var activeCount int
-	err = tx.QueryRow("SELECT COUNT(*) FROM orders WHERE delivery_person_id = ? AND status IN ('IN_PROGRESS','OUT_FOR_DELIVERY')", deliveryPersonID).Scan(&activeCount)
+	// The dispatch policy says how many orders a courier carries at once, and that they go to one zone
+	policy, err := getDispatchPolicy(tx)
 	if err != nil {
 		return err
 	}
-	if activeCount > 0 {
-		return ErrDeliveryPersonBusy
+	if err := checkBatch(tx, policy, deliveryPersonID, zoneID); err != nil {
+		return err
 	}
 
 	// Assign delivery by updating orders.delivery_person_id and status
-	_, err = tx.Exec(
-		"UPDATE orders SET delivery_person_id = ?, status = 'OUT_FOR_DELIVERY' WHERE id = ?",
-		deliveryPersonID,
-		orderID,
-	)
+	_, err = tx.Exec("UPDATE orders SET delivery_person_id = ? WHERE id = ?", deliveryPersonID, orderID)
+	if err != nil {
+		return err
+	}
+	err = transitionOrder(tx, orderID, OrderOutForDelivery, actorUserID)
 	if err != nil {
 		return err
 	}
@@ -282,8 +363,10 @@ func AssignDelivery(orderID, deliveryPersonID int) error {
 	return tx.Commit()
 }
 
-func UpdateDeliveryStatus(orderID int, status string) error {
-	if status != "DELIVERED" && status != "FAILED" {
+// UpdateDeliveryStatus is the courier with this user ID reporting an order DELIVERED or FAILED.
+// Only the courier the order is assigned to can, for anyone else it is ErrNotYourDelivery.
+func UpdateDeliveryStatus(orderID, userID int, status string) error {
+	if status != string(OrderDelivered) && status != string(OrderFailed) {
 		return ErrInvalidStatus
 	}
 
@@ -293,41 +376,46 @@ func UpdateDeliveryStatus(orderID int, status string) error {
 	}
 	defer tx.Rollback()
 
-	// Update order status
-	_, err = tx.Exec("UPDATE orders SET status = ? WHERE id = ?", status, orderID)
+	var dpID, deliveryUserID sql.NullInt64
+	err = tx.QueryRow(`
+		SELECT o.delivery_person_id, dp.user_id FROM orders o
+		LEFT JOIN delivery_person dp ON o.delivery_person_id = dp.id
+		WHERE o.id = ?
+	`+currentDialect.forUpdate, orderID).Scan(&dpID, &deliveryUserID)
+	if err == sql.ErrNoRows {
+		return ErrOrderNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !deliveryUserID.Valid || int(deliveryUserID.Int64) != userID {
+		return ErrNotYourDelivery
+	}
+
+	// The status history records the courier who reported it as the one who changed it
+	err = transitionOrder(tx, orderID, OrderStatus(status), userID)
 	if err != nil {
 		return err
 	}
 
-	// If delivered, set delivery_person.unavailable_until = NOW() + 30 minutes
+	// If delivered, set delivery_person.unavailable_until = now + the policy's cooldown
 	if status == "DELIVERED" {
-		// find delivery_person_id for this order
-		var dpID sql.NullInt64
-		err = tx.QueryRow("SELECT delivery_person_id FROM orders WHERE id = ?", orderID).Scan(&dpID)
+		policy, err := getDispatchPolicy(tx)
 		if err != nil {
 			return err
 		}
-		if dpID.Valid {
-			_, err = tx.Exec("UPDATE delivery_person SET unavailable_until = DATE_ADD(NOW(), INTERVAL 30 MINUTE) WHERE id = ?", dpID.Int64)
-			if err != nil {
-				return err
-			}
+		_, err = tx.Exec("UPDATE delivery_person SET unavailable_until = ? WHERE id = ?", time.Now().Add(policy.cooldown()), dpID.Int64)
+		if err != nil {
+			return err
 		}
 	}
 
 	// If failed, clear unavailable_until so they can be available immediately
 	if status == "FAILED" {
-		var dpID sql.NullInt64
-		err = tx.QueryRow("SELECT delivery_person_id FROM orders WHERE id = ?", orderID).Scan(&dpID)
+		_, err = tx.Exec("UPDATE delivery_person SET unavailable_until = NULL WHERE id = ?", dpID.Int64)
 		if err != nil {
 			return err
 		}
-		if dpID.Valid {
-			_, err = tx.Exec("UPDATE delivery_person SET unavailable_until = NULL WHERE id = ?", dpID.Int64)
-			if err != nil {
-				return err
-			}
-		}
 	}
 
 	return tx.Commit()
@@ -0,0 +1,321 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Why an order can't be delivered, quotes and checkout give the same reasons.
+var (
+	ErrNoDeliveryZone        = errors.New("no delivery zone covers this postal code")
+	ErrDeliveryMinimumNotMet = errors.New("order is below the minimum value of the delivery zone")
+)
+
+var (
+	ErrDeliveryZoneNotFound = errors.New("delivery zone not found")
+	ErrInvalidDeliveryZone  = errors.New("a delivery zone needs a name, a postal code prefix or a range whose from and to " +
+		"have the same length with from before to, a fee and minimum order of at least 0, and an estimated time above 0")
+)
+
+// DeliveryRejectedError is an order to a postal code we can't deliver to. Err is one of the reasons above,
+// Zone is nil when no zone covers the postal code.
+type DeliveryRejectedError struct {
+	PostalCode string
+	Zone       *DeliveryZone
+	Err        error
+}
+
+func (e *DeliveryRejectedError) Error() string {
+	return fmt.Sprintf("delivery to %q: %v", e.PostalCode, e.Err)
+}
+
+func (e *DeliveryRejectedError) Unwrap() error {
+	return e.Err
+}
+
+// DeliveryZone covers the postal codes starting with PostalCodePrefix, or those whose first characters are
+// between PostalCodeFrom and PostalCodeTo. An empty prefix covers every postal code.
+type DeliveryZone struct {
+	ID               int             `json:"id"`
+	Name             string          `json:"name"`
+	PostalCodePrefix *string         `json:"postal_code_prefix"`
+	PostalCodeFrom   *string         `json:"postal_code_from"`
+	PostalCodeTo     *string         `json:"postal_code_to"`
+	DeliveryFee      decimal.Decimal `json:"delivery_fee"`
+	MinOrderValue    decimal.Decimal `json:"min_order_value"`
+	EstimatedMinutes int             `json:"estimated_minutes"`
+	IsActive         bool            `json:"is_active"`
+}
+
+// NormalizePostalCode makes "6211 ab" and "6211AB" the same postal code.
+func NormalizePostalCode(postalCode string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(postalCode), " ", ""))
+}
+
+// covers reports whether the zone delivers to a normalized postal code.
+func (z DeliveryZone) covers(postalCode string) bool {
+	if z.PostalCodePrefix != nil {
+		return strings.HasPrefix(postalCode, *z.PostalCodePrefix)
+	}
+	if z.PostalCodeFrom == nil || z.PostalCodeTo == nil {
+		return false
+	}
+	// "6211AB" is in the range 6200 to 6299, only as many characters as the bounds have are compared
+	head := postalCode[:min(len(postalCode), len(*z.PostalCodeFrom))]
+	return head >= *z.PostalCodeFrom && head <= *z.PostalCodeTo
+}
+
+// specificity is how many characters of a postal code the zone looks at, the most specific zone wins.
+func (z DeliveryZone) specificity() int {
+	if z.PostalCodePrefix != nil {
+		return len(*z.PostalCodePrefix)
+	}
+	if z.PostalCodeFrom != nil {
+		return len(*z.PostalCodeFrom)
+	}
+	return 0
+}
+
+// Covers describes the postal codes of the zone, e.g. "62*" or "6200-6299".
+func (z DeliveryZone) Covers() string {
+	if z.PostalCodePrefix != nil {
+		if *z.PostalCodePrefix == "" {
+			return "all"
+		}
+		return *z.PostalCodePrefix + "*"
+	}
+	if z.PostalCodeFrom != nil && z.PostalCodeTo != nil {
+		return *z.PostalCodeFrom + "-" + *z.PostalCodeTo
+	}
+	return "-"
+}
+
+const deliveryZoneColumns = `id, name, postal_code_prefix, postal_code_from, postal_code_to, delivery_fee, min_order_value, estimated_minutes, is_active`
+
+func scanDeliveryZone(row interface{ Scan(...any) error }) (DeliveryZone, error) {
+	var z DeliveryZone
+	var prefix, from, to sql.NullString
+	var fee, minOrderValue string
+	if err := row.Scan(&z.ID, &z.Name, &prefix, &from, &to, &fee, &minOrderValue, &z.EstimatedMinutes, &z.IsActive); err != nil {
+		return DeliveryZone{}, err
+	}
+	var err error
+	if z.DeliveryFee, err = decimal.NewFromString(fee); err != nil {
+		return DeliveryZone{}, fmt.Errorf("invalid delivery fee in database: %s", fee)
+	}
+	if z.MinOrderValue, err = decimal.NewFromString(minOrderValue); err != nil {
+		return DeliveryZone{}, fmt.Errorf("invalid minimum order value in database: %s", minOrderValue)
+	}
+	if prefix.Valid {
+		z.PostalCodePrefix = &prefix.String
+	}
+	if from.Valid {
+		z.PostalCodeFrom = &from.String
+	}
+	if to.Valid {
+		z.PostalCodeTo = &to.String
+	}
+	return z, nil
+}
+
+func getDeliveryZones(q queryer, activeOnly bool) ([]DeliveryZone, error) {
+	query := `SELECT ` + deliveryZoneColumns + ` FROM delivery_zone`
+	if activeOnly {
+		query += ` WHERE is_active`
+	}
+	rows, err := q.Query(query + ` ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	zones := []DeliveryZone{}
+	for rows.Next() {
+		z, err := scanDeliveryZone(rows)
+		if err != nil {
+			return nil, err
+		}
+		zones = append(zones, z)
+	}
+	return zones, rows.Err()
+}
+
+func GetDeliveryZones() ([]DeliveryZone, error) {
+	return getDeliveryZones(DATABASE, false)
+}
+
+// findDeliveryZone returns the active zone that delivers to the postal code. When zones overlap the one
+// that looks at most characters wins, e.g. 621* over 62*.
+func findDeliveryZone(q queryer, postalCode string) (DeliveryZone, error) {
+	postalCode = NormalizePostalCode(postalCode)
+	zones, err := getDeliveryZones(q, true)
+	if err != nil {
+		return DeliveryZone{}, err
+	}
+	var best *DeliveryZone
+	for i, z := range zones {
+		if z.covers(postalCode) && (best == nil || z.specificity() > best.specificity()) {
+			best = &zones[i]
+		}
+	}
+	if best == nil {
+		return DeliveryZone{}, &DeliveryRejectedError{PostalCode: postalCode, Err: ErrNoDeliveryZone}
+	}
+	return *best, nil
+}
+
+// applyDeliveryZone charges the zone's fee, if the items are worth its minimum after freebies and rewards.
+func applyDeliveryZone(cfg PricingConfig, priced *pricedOrder, zone DeliveryZone) error {
+	itemsValue := decimal.Zero
+	for _, line := range priced.lines() {
+		itemsValue = itemsValue.Add(line.paid())
+	}
+	if itemsValue.LessThan(zone.MinOrderValue) {
+		return &DeliveryRejectedError{PostalCode: priced.PostalCode, Zone: &zone, Err: ErrDeliveryMinimumNotMet}
+	}
+	priced.DeliveryZone = &zone
+	// Delivery is part of selling the pizzas, so the fee has their VAT rate
+	priced.Delivery = PriceLine{Quantity: 1, UnitPrice: zone.DeliveryFee, VATRate: cfg.PizzaVATRate}
+	return nil
+}
+
+func validateDeliveryZone(z DeliveryZone) error {
+	switch {
+	case z.Name == "":
+		return ErrInvalidDeliveryZone
+	case z.PostalCodePrefix != nil && (z.PostalCodeFrom != nil || z.PostalCodeTo != nil):
+		return ErrInvalidDeliveryZone
+	case z.PostalCodePrefix == nil && (z.PostalCodeFrom == nil || z.PostalCodeTo == nil):
+		return ErrInvalidDeliveryZone
+	case z.PostalCodePrefix == nil && (*z.PostalCodeFrom == "" || len(*z.PostalCodeFrom) != len(*z.PostalCodeTo) || *z.PostalCodeFrom > *z.PostalCodeTo):
+		return ErrInvalidDeliveryZone
+	case z.DeliveryFee.IsNegative(), z.MinOrderValue.IsNegative():
+		return ErrInvalidDeliveryZone
+	case z.EstimatedMinutes < 1:
+		return ErrInvalidDeliveryZone
+	}
+	return nil
+}
+
+// normalizeDeliveryZone stores postal codes the way NormalizePostalCode gives them, so they compare.
+func normalizeDeliveryZone(z DeliveryZone) DeliveryZone {
+	for _, postalCode := range []**string{&z.PostalCodePrefix, &z.PostalCodeFrom, &z.PostalCodeTo} {
+		if *postalCode != nil {
+			normalized := NormalizePostalCode(**postalCode)
+			*postalCode = &normalized
+		}
+	}
+	z.Name = strings.TrimSpace(z.Name)
+	return z
+}
+
+// deliveryZoneValues are the columns CreateDeliveryZone and UpdateDeliveryZone write, in that order.
+func deliveryZoneValues(z DeliveryZone) []any {
+	return []any{z.Name, z.PostalCodePrefix, z.PostalCodeFrom, z.PostalCodeTo,
+		z.DeliveryFee.StringFixed(2), z.MinOrderValue.StringFixed(2), z.EstimatedMinutes, z.IsActive}
+}
+
+func CreateDeliveryZone(z DeliveryZone) (int, error) {
+	z = normalizeDeliveryZone(z)
+	if err := validateDeliveryZone(z); err != nil {
+		return 0, err
+	}
+	res, err := DATABASE.Exec(`
+		INSERT INTO delivery_zone (name, postal_code_prefix, postal_code_from, postal_code_to, delivery_fee, min_order_value, estimated_minutes, is_active)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, deliveryZoneValues(z)...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// UpdateDeliveryZone changes a zone. Placed orders keep the fee they paid.
+func UpdateDeliveryZone(id int, z DeliveryZone) error {
+	z = normalizeDeliveryZone(z)
+	if err := validateDeliveryZone(z); err != nil {
+		return err
+	}
+
+	tx, err := DATABASE.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var existing int
+	if err := tx.QueryRow(`SELECT id FROM delivery_zone WHERE id = ?`, id).Scan(&existing); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrDeliveryZoneNotFound
+		}
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE delivery_zone
+		SET name = ?, postal_code_prefix = ?, postal_code_from = ?, postal_code_to = ?, delivery_fee = ?, min_order_value = ?,
+		    estimated_minutes = ?, is_active = ?
+		WHERE id = ?
+	`, append(deliveryZoneValues(z), id)...)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteDeliveryZone removes a zone, orders to it keep their fee but lose the zone.
+func DeleteDeliveryZone(id int) error {
+	_, err := DATABASE.Exec(`DELETE FROM delivery_zone WHERE id = ?`, id)
+	return err
+}
+
+// GetDeliveryPersonZoneIDs returns the zones a courier delivers in.
+func GetDeliveryPersonZoneIDs(deliveryPersonID int) ([]int, error) {
+	rows, err := DATABASE.Query(`SELECT delivery_zone_id FROM delivery_person_zone WHERE delivery_person_id = ? ORDER BY delivery_zone_id`, deliveryPersonID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	zoneIDs := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		zoneIDs = append(zoneIDs, id)
+	}
+	return zoneIDs, rows.Err()
+}
+
+// SetDeliveryPersonZones replaces the zones a courier delivers in.
+func SetDeliveryPersonZones(deliveryPersonID int, zoneIDs []int) error {
+	tx, err := DATABASE.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM delivery_person_zone WHERE delivery_person_id = ?`, deliveryPersonID); err != nil {
+		return err
+	}
+	slices.Sort(zoneIDs)
+	for _, zoneID := range slices.Compact(zoneIDs) {
+		var existing int
+		if err := tx.QueryRow(`SELECT id FROM delivery_zone WHERE id = ?`, zoneID).Scan(&existing); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrDeliveryZoneNotFound
+			}
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO delivery_person_zone (delivery_person_id, delivery_zone_id) VALUES (?, ?)`, deliveryPersonID, zoneID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// dialect covers the bits of SQL that differ between MySQL and SQLite.
+// Timestamps are passed in from Go (time.Now()) instead of NOW(), so queries stay portable.
+type dialect struct {
+	name string
+	// Appended to SELECTs whose rows get updated later in the same transaction.
+	// SQLite has no row locks, an IMMEDIATE transaction already holds the write lock.
+	forUpdate string
+	// SQL expression for the age in whole years of a DATE column.
+	ageInYears func(column string) string
+	// SQL expression for the day (YYYY-MM-DD) of a TIMESTAMP column.
+	dateOf func(column string) string
+	// Rewrites the MySQL flavoured migrations for this database.
+	translateDDL func(statement string) string
+	// Query counting the tables with the name given as its argument.
+	countTables string
+}
+
+var currentDialect = mysqlDialect
+
+var mysqlDialect = dialect{
+	name:      "mysql",
+	forUpdate: " FOR UPDATE",
+	ageInYears: func(column string) string {
+		return fmt.Sprintf("TIMESTAMPDIFF(YEAR, %s, CURDATE())", column)
+	},
+	dateOf: func(column string) string {
+		return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-%%d')", column)
+	},
+	translateDDL: func(statement string) string {
+		return statement
+	},
+	countTables: `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?`,
+}
+
+var sqliteDialect = dialect{
+	name:      "sqlite",
+	forUpdate: "",
+	ageInYears: func(column string) string {
+		return fmt.Sprintf("CAST((julianday('now') - julianday(%s)) / 365.25 AS INTEGER)", column)
+	},
+	// Timestamps are stored as "2006-01-02 15:04:05.999999999-07:00" (see _time_format in Connect), the day
+	// is the start of it. SQLite's date() would move it to UTC, MySQL gives the local day too.
+	dateOf: func(column string) string {
+		return fmt.Sprintf("substr(%s, 1, 10)", column)
+	},
+	translateDDL: translateDDLToSQLite,
+	countTables:  `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`,
+}
+
+var (
+	autoIncrementPK = regexp.MustCompile(`(?i)\b(?:BIG)?INT\s+AUTO_INCREMENT\s+PRIMARY\s+KEY`)
+	enumColumn      = regexp.MustCompile(`(?i)(\w+)\s+ENUM\s*\(([^)]*)\)`)
+	uniqueKey       = regexp.MustCompile(`(?i)UNIQUE\s+KEY\s+\w+\s*\(`)
+	afterColumn     = regexp.MustCompile(`(?i)\s+AFTER\s+\w+`)
+)
+
+// translateDDLToSQLite handles what our migrations use: AUTO_INCREMENT keys, ENUM columns,
+// named UNIQUE KEYs and ADD COLUMN ... AFTER. Anything else needs a NNNN_name.sqlite.up.sql file.
+func translateDDLToSQLite(statement string) string {
+	statement = autoIncrementPK.ReplaceAllString(statement, "INTEGER PRIMARY KEY AUTOINCREMENT")
+	statement = enumColumn.ReplaceAllString(statement, "$1 TEXT CHECK ($1 IN ($2))")
+	statement = uniqueKey.ReplaceAllString(statement, "UNIQUE (")
+	if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(statement)), "ALTER TABLE") {
+		statement = afterColumn.ReplaceAllString(statement, "")
+	}
+	return statement
+}
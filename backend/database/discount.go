@@ -0,0 +1,439 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Why a discount code is rejected, Validate and checkout give the same reasons.
+var (
+	ErrDiscountCodeNotFound  = errors.New("discount code not found")
+	ErrDiscountInactive      = errors.New("discount code is not active")
+	ErrDiscountNotStarted    = errors.New("discount code is not valid yet")
+	ErrDiscountExpired       = errors.New("discount code has expired")
+	ErrDiscountUsedUp        = errors.New("discount code has been used the maximum number of times")
+	ErrDiscountAlreadyUsed   = errors.New("discount code already used")
+	ErrDiscountMinimumNotMet = errors.New("order is below the minimum value of the discount code")
+	ErrDiscountNotApplicable = errors.New("discount code doesn't apply to anything in the order")
+)
+
+var ErrInvalidDiscountCode = errors.New("a discount code needs a code, a percentage between 1 and 100 or an amount above 0, " +
+	"limits of at least 1, a minimum order of at least 0, a known scope, and a valid from before its valid until")
+
+// DiscountRejectedError is a code that can't be used on this order. Err is one of the ErrDiscount reasons above,
+// or ErrPromotionConditionsNotMet with the Condition that doesn't hold.
+type DiscountRejectedError struct {
+	Code      string
+	Discount  DiscountCode
+	Err       error
+	Condition *PromotionCondition
+}
+
+func (e *DiscountRejectedError) Error() string {
+	return fmt.Sprintf("discount code %q: %v", e.Code, e.Err)
+}
+
+func (e *DiscountRejectedError) Unwrap() error {
+	return e.Err
+}
+
+// Reason is the rejection as a constant, e.g. EXPIRED, for clients to switch on.
+func (e *DiscountRejectedError) Reason() string {
+	switch e.Err {
+	case ErrDiscountCodeNotFound:
+		return "NOT_FOUND"
+	case ErrDiscountInactive:
+		return "INACTIVE"
+	case ErrDiscountNotStarted:
+		return "NOT_STARTED"
+	case ErrDiscountExpired:
+		return "EXPIRED"
+	case ErrDiscountUsedUp:
+		return "USED_UP"
+	case ErrDiscountAlreadyUsed:
+		return "ALREADY_USED"
+	case ErrDiscountMinimumNotMet:
+		return "MINIMUM_NOT_MET"
+	case ErrDiscountNotApplicable:
+		return "NOT_APPLICABLE"
+	case ErrPromotionConditionsNotMet:
+		return "CONDITIONS_NOT_MET"
+	}
+	return "INVALID"
+}
+
+// DiscountType is whether a code takes a percentage or a fixed amount off.
+type DiscountType string
+
+const (
+	PercentageDiscount DiscountType = "PERCENTAGE"
+	FixedDiscount      DiscountType = "FIXED"
+)
+
+// DiscountScope is what a code takes money off.
+type DiscountScope string
+
+const (
+	ScopeOrder    DiscountScope = "ORDER"
+	ScopePizzas   DiscountScope = "PIZZAS"
+	ScopeDrinks   DiscountScope = "DRINKS"
+	ScopeDesserts DiscountScope = "DESSERTS"
+	// ScopeItems is the pizzas and extra items listed on the code
+	ScopeItems DiscountScope = "ITEMS"
+)
+
+// DiscountScopes lists every scope, e.g. for dropdowns.
+var DiscountScopes = []DiscountScope{ScopeOrder, ScopePizzas, ScopeDrinks, ScopeDesserts, ScopeItems}
+
+type DiscountCode struct {
+	ID                 int             `json:"id"`
+	Code               string          `json:"code"`
+	Type               DiscountType    `json:"discount_type"`
+	DiscountPercentage int             `json:"discount_percentage"`
+	DiscountAmount     decimal.Decimal `json:"discount_amount"`
+	IsActive           bool            `json:"is_active"`
+	// Limits, nil means there is none
+	ValidFrom          *time.Time `json:"valid_from"`
+	ValidUntil         *time.Time `json:"valid_until"`
+	MaxUses            *int       `json:"max_uses"`
+	MaxUsesPerCustomer *int       `json:"max_uses_per_customer"`
+
+	MinOrderValue decimal.Decimal `json:"min_order_value"`
+	Scope         DiscountScope   `json:"scope"`
+	PizzaIDs      []int           `json:"pizza_ids"`
+	ExtraItemIDs  []int           `json:"extra_item_ids"`
+	TimesUsed     int             `json:"times_used"`
+}
+
+const discountCodeColumns = `dc.id, dc.code, dc.discount_type, dc.discount_percentage, dc.discount_amount, dc.is_active,
+	dc.valid_from, dc.valid_until, dc.max_uses, dc.max_uses_per_customer, dc.min_order_value, dc.scope,
+	(SELECT COUNT(*) FROM discount_usage du WHERE du.discount_code_id = dc.id)`
+
+func scanDiscountCode(row interface{ Scan(...any) error }) (DiscountCode, error) {
+	var dc DiscountCode
+	var amount, minOrderValue string
+	var validFrom, validUntil sql.NullTime
+	var maxUses, maxUsesPerCustomer sql.NullInt64
+	err := row.Scan(&dc.ID, &dc.Code, &dc.Type, &dc.DiscountPercentage, &amount, &dc.IsActive,
+		&validFrom, &validUntil, &maxUses, &maxUsesPerCustomer, &minOrderValue, &dc.Scope, &dc.TimesUsed)
+	if err != nil {
+		return DiscountCode{}, err
+	}
+	if dc.DiscountAmount, err = decimal.NewFromString(amount); err != nil {
+		return DiscountCode{}, fmt.Errorf("invalid discount amount in database: %s", amount)
+	}
+	if dc.MinOrderValue, err = decimal.NewFromString(minOrderValue); err != nil {
+		return DiscountCode{}, fmt.Errorf("invalid minimum order value in database: %s", minOrderValue)
+	}
+	if validFrom.Valid {
+		dc.ValidFrom = &validFrom.Time
+	}
+	if validUntil.Valid {
+		dc.ValidUntil = &validUntil.Time
+	}
+	if maxUses.Valid {
+		n := int(maxUses.Int64)
+		dc.MaxUses = &n
+	}
+	if maxUsesPerCustomer.Valid {
+		n := int(maxUsesPerCustomer.Int64)
+		dc.MaxUsesPerCustomer = &n
+	}
+	return dc, nil
+}
+
+// loadDiscountCodeItems fills in the pizzas and extra items an ITEMS code applies to.
+func loadDiscountCodeItems(q queryer, dc *DiscountCode) error {
+	dc.PizzaIDs = []int{}
+	dc.ExtraItemIDs = []int{}
+	rows, err := q.Query(`SELECT pizza_id, extra_item_id FROM discount_code_item WHERE discount_code_id = ? ORDER BY id`, dc.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pizzaID, extraItemID sql.NullInt64
+		if err := rows.Scan(&pizzaID, &extraItemID); err != nil {
+			return err
+		}
+		if pizzaID.Valid {
+			dc.PizzaIDs = append(dc.PizzaIDs, int(pizzaID.Int64))
+		}
+		if extraItemID.Valid {
+			dc.ExtraItemIDs = append(dc.ExtraItemIDs, int(extraItemID.Int64))
+		}
+	}
+	return rows.Err()
+}
+
+// GetAllDiscountCodes returns the codes made one at a time, generated vouchers are listed by campaign.
+func GetAllDiscountCodes() ([]DiscountCode, error) {
+	rows, err := DATABASE.Query(`SELECT ` + discountCodeColumns + ` FROM discount_code dc WHERE dc.campaign_id IS NULL ORDER BY dc.code`)
+	if err != nil {
+		return nil, err
+	}
+
+	var codes []DiscountCode
+	for rows.Next() {
+		dc, err := scanDiscountCode(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		codes = append(codes, dc)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range codes {
+		if err := loadDiscountCodeItems(DATABASE, &codes[i]); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+func GetDiscountCodeByCode(code string) (DiscountCode, error) {
+	return getDiscountCodeByCode(DATABASE, code)
+}
+
+// getDiscountCodeByCode loads a code and locks it, so its usage limits hold when two orders use it at once.
+func getDiscountCodeByCode(q queryer, code string) (DiscountCode, error) {
+	dc, err := scanDiscountCode(q.QueryRow(`SELECT `+discountCodeColumns+` FROM discount_code dc WHERE dc.code = ?`+currentDialect.forUpdate, code))
+	if err == sql.ErrNoRows {
+		return DiscountCode{}, ErrDiscountCodeNotFound
+	}
+	if err != nil {
+		return DiscountCode{}, err
+	}
+	return dc, loadDiscountCodeItems(q, &dc)
+}
+
+func HasUserUsedDiscount(userID int, discountCodeID int) (bool, error) {
+	uses, err := countUserDiscountUses(DATABASE, userID, discountCodeID)
+	return uses > 0, err
+}
+
+func countUserDiscountUses(q queryer, userID int, discountCodeID int) (int, error) {
+	var uses int
+	err := q.QueryRow(`SELECT COUNT(*) FROM discount_usage WHERE user_id = ? AND discount_code_id = ?`, userID, discountCodeID).Scan(&uses)
+	return uses, err
+}
+
+// checkDiscountCode applies the rules of a code that don't depend on the order: active, valid now, and uses left.
+func checkDiscountCode(q queryer, userID int, dc DiscountCode, now time.Time) error {
+	reject := func(reason error) error {
+		return &DiscountRejectedError{Code: dc.Code, Discount: dc, Err: reason}
+	}
+	switch {
+	case !dc.IsActive:
+		return reject(ErrDiscountInactive)
+	case dc.ValidFrom != nil && now.Before(*dc.ValidFrom):
+		return reject(ErrDiscountNotStarted)
+	case dc.ValidUntil != nil && now.After(*dc.ValidUntil):
+		return reject(ErrDiscountExpired)
+	case dc.MaxUses != nil && dc.TimesUsed >= *dc.MaxUses:
+		return reject(ErrDiscountUsedUp)
+	}
+	if dc.MaxUsesPerCustomer != nil {
+		uses, err := countUserDiscountUses(q, userID, dc.ID)
+		if err != nil {
+			return err
+		}
+		if uses >= *dc.MaxUsesPerCustomer {
+			return reject(ErrDiscountAlreadyUsed)
+		}
+	}
+	return nil
+}
+
+// appliesTo reports whether the code takes money off a pizza (category "") or an extra item.
+func (dc DiscountCode) appliesTo(id int, category string) bool {
+	switch dc.Scope {
+	case ScopePizzas:
+		return category == ""
+	case ScopeDrinks:
+		return category == "drink"
+	case ScopeDesserts:
+		return category == "dessert"
+	case ScopeItems:
+		if category == "" {
+			return slices.Contains(dc.PizzaIDs, id)
+		}
+		return slices.Contains(dc.ExtraItemIDs, id)
+	default:
+		return true
+	}
+}
+
+// applyDiscountCode applies the rules of a code that depend on the order, and marks the lines it takes money off.
+func applyDiscountCode(priced *pricedOrder, dc DiscountCode) error {
+	orderValue := decimal.Zero
+	scopeValue := decimal.Zero
+	for i := range priced.Pizzas {
+		p := &priced.Pizzas[i]
+		p.Discountable = dc.appliesTo(p.ID, "")
+		orderValue = orderValue.Add(p.paid())
+		if p.Discountable {
+			scopeValue = scopeValue.Add(p.paid())
+		}
+	}
+	for i := range priced.ExtraItems {
+		e := &priced.ExtraItems[i]
+		e.Discountable = dc.appliesTo(e.ID, e.Category)
+		orderValue = orderValue.Add(e.paid())
+		if e.Discountable {
+			scopeValue = scopeValue.Add(e.paid())
+		}
+	}
+
+	if orderValue.LessThan(dc.MinOrderValue) {
+		return &DiscountRejectedError{Code: dc.Code, Discount: dc, Err: ErrDiscountMinimumNotMet}
+	}
+	if !scopeValue.IsPositive() {
+		return &DiscountRejectedError{Code: dc.Code, Discount: dc, Err: ErrDiscountNotApplicable}
+	}
+
+	priced.DiscountPercentage, priced.DiscountAmount = 0, decimal.Zero
+	if dc.Type == FixedDiscount {
+		priced.DiscountAmount = dc.DiscountAmount
+	} else {
+		priced.DiscountPercentage = dc.DiscountPercentage
+	}
+	return nil
+}
+
+func validateDiscountCode(dc DiscountCode) error {
+	switch {
+	case strings.TrimSpace(dc.Code) == "":
+		return ErrInvalidDiscountCode
+	case dc.Type == PercentageDiscount && (dc.DiscountPercentage < 1 || dc.DiscountPercentage > 100):
+		return ErrInvalidDiscountCode
+	case dc.Type == FixedDiscount && !dc.DiscountAmount.IsPositive():
+		return ErrInvalidDiscountCode
+	case dc.Type != PercentageDiscount && dc.Type != FixedDiscount:
+		return ErrInvalidDiscountCode
+	case dc.MaxUses != nil && *dc.MaxUses < 1, dc.MaxUsesPerCustomer != nil && *dc.MaxUsesPerCustomer < 1:
+		return ErrInvalidDiscountCode
+	case dc.MinOrderValue.IsNegative():
+		return ErrInvalidDiscountCode
+	case dc.ValidFrom != nil && dc.ValidUntil != nil && !dc.ValidFrom.Before(*dc.ValidUntil):
+		return ErrInvalidDiscountCode
+	}
+	for _, scope := range DiscountScopes {
+		if dc.Scope == scope {
+			return nil
+		}
+	}
+	return ErrInvalidDiscountCode
+}
+
+// discountCodeValues are the columns CreateDiscountCode and UpdateDiscountCode write, in that order.
+func discountCodeValues(dc DiscountCode) []any {
+	percentage, amount := dc.DiscountPercentage, dc.DiscountAmount
+	if dc.Type == FixedDiscount {
+		percentage = 0
+	} else {
+		amount = decimal.Zero
+	}
+	return []any{dc.Code, dc.Type, percentage, amount.StringFixed(2), dc.IsActive,
+		dc.ValidFrom, dc.ValidUntil, dc.MaxUses, dc.MaxUsesPerCustomer, dc.MinOrderValue.StringFixed(2), dc.Scope}
+}
+
+// setDiscountCodeItems replaces the pizzas and extra items of the code. Only ITEMS codes keep any.
+func setDiscountCodeItems(q queryer, dc DiscountCode, id int) error {
+	if _, err := q.Exec(`DELETE FROM discount_code_item WHERE discount_code_id = ?`, id); err != nil {
+		return err
+	}
+	if dc.Scope != ScopeItems {
+		return nil
+	}
+	for _, pizzaID := range dc.PizzaIDs {
+		if _, err := q.Exec(`INSERT INTO discount_code_item (discount_code_id, pizza_id) VALUES (?, ?)`, id, pizzaID); err != nil {
+			return err
+		}
+	}
+	for _, extraItemID := range dc.ExtraItemIDs {
+		if _, err := q.Exec(`INSERT INTO discount_code_item (discount_code_id, extra_item_id) VALUES (?, ?)`, id, extraItemID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func CreateDiscountCode(dc DiscountCode) (int, error) {
+	if err := validateDiscountCode(dc); err != nil {
+		return 0, err
+	}
+
+	tx, err := DATABASE.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		INSERT INTO discount_code (code, discount_type, discount_percentage, discount_amount, is_active,
+			valid_from, valid_until, max_uses, max_uses_per_customer, min_order_value, scope)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, discountCodeValues(dc)...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := setDiscountCodeItems(tx, dc, int(id)); err != nil {
+		return 0, err
+	}
+	return int(id), tx.Commit()
+}
+
+// UpdateDiscountCode changes a code. Orders that used it keep the discount they got.
+func UpdateDiscountCode(id int, dc DiscountCode) error {
+	if err := validateDiscountCode(dc); err != nil {
+		return err
+	}
+
+	tx, err := DATABASE.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var existing int
+	if err := tx.QueryRow(`SELECT id FROM discount_code WHERE id = ?`, id).Scan(&existing); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrDiscountCodeNotFound
+		}
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE discount_code
+		SET code = ?, discount_type = ?, discount_percentage = ?, discount_amount = ?, is_active = ?,
+		    valid_from = ?, valid_until = ?, max_uses = ?, max_uses_per_customer = ?, min_order_value = ?, scope = ?
+		WHERE id = ?
+	`, append(discountCodeValues(dc), id)...)
+	if err != nil {
+		return err
+	}
+	if err := setDiscountCodeItems(tx, dc, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func DeleteDiscountCode(id int) error {
+	_, err := DATABASE.Exec(`DELETE FROM discount_code WHERE id = ?`, id)
+	return err
+}
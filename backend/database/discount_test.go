@@ -0,0 +1,187 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// discountTestShop seeds the menu and returns the IDs of the Margherita and the Tiramisu.
+func discountTestShop(t *testing.T) (margheritaID, tiramisuID int) {
+	t.Helper()
+	SeedDevData()
+	if err := DATABASE.QueryRow(`SELECT id FROM pizza WHERE name = 'Margherita'`).Scan(&margheritaID); err != nil {
+		t.Fatal(err)
+	}
+	if err := DATABASE.QueryRow(`SELECT id FROM extra_item WHERE name = 'Tiramisu'`).Scan(&tiramisuID); err != nil {
+		t.Fatal(err)
+	}
+	return margheritaID, tiramisuID
+}
+
+// discountTestCustomer creates a customer with two Margheritas and a Tiramisu in their cart.
+// It returns the customer and user IDs.
+func discountTestCustomer(t *testing.T, username string, margheritaID, tiramisuID int) (customerID, userID int) {
+	t.Helper()
+	customerID = createTestCustomer(t, username)
+	if err := DATABASE.QueryRow(`SELECT user_id FROM customer WHERE id = ?`, customerID).Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []CartLine{{Type: "pizza", ID: margheritaID, Quantity: 2}, {Type: "extra", ID: tiramisuID, Quantity: 1}} {
+		if _, err := AddToCart(customerID, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return customerID, userID
+}
+
+func createTestDiscountCode(t *testing.T, dc DiscountCode) {
+	t.Helper()
+	if dc.Type == "" {
+		dc.Type = PercentageDiscount
+		dc.DiscountPercentage = 10
+	}
+	if dc.Scope == "" {
+		dc.Scope = ScopeOrder
+	}
+	if _, err := CreateDiscountCode(dc); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// rejectionReason is the Reason of a DiscountRejectedError, "" for anything else.
+func rejectionReason(err error) string {
+	var rejected *DiscountRejectedError
+	if errors.As(err, &rejected) {
+		return rejected.Reason()
+	}
+	return ""
+}
+
+// checkoutWithCode quotes the customer's cart with the code, then checks it out. Both have to agree:
+// they refuse the code for the same reason, or the order costs what the quote said.
+func checkoutWithCode(t *testing.T, customerID, userID int, code string) (PriceBreakdown, string) {
+	t.Helper()
+	quote, quoteErr := QuoteCart(customerID, userID, "87104", &code)
+	orderID, checkoutErr := CheckoutCart(customerID, userID, "Main St 1", "87104", &code)
+	quoteReason, checkoutReason := rejectionReason(quoteErr), rejectionReason(checkoutErr)
+	if quoteReason != checkoutReason {
+		t.Fatalf("code %s: the quote says %q (%v), checkout %q (%v)", code, quoteReason, quoteErr, checkoutReason, checkoutErr)
+	}
+	if quoteReason != "" {
+		return quote, quoteReason
+	}
+	if quoteErr != nil || checkoutErr != nil {
+		t.Fatalf("code %s: %v, %v", code, quoteErr, checkoutErr)
+	}
+
+	placed, err := GetOrderBreakdown(orderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if placed.Discount != quote.Discount || placed.Total != quote.Total {
+		t.Errorf("code %s: quoted %.2f off for %.2f, the order got %.2f off for %.2f", code, quote.Discount, quote.Total, placed.Discount, placed.Total)
+	}
+	return placed, ""
+}
+
+func TestDiscountCodeRejections(t *testing.T) {
+	migrateTestDB(t)
+	margheritaID, tiramisuID := discountTestShop(t)
+	customerID, userID := discountTestCustomer(t, "shopper", margheritaID, tiramisuID)
+
+	hourAgo, inAnHour := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	createTestDiscountCode(t, DiscountCode{Code: "INACTIVE"})
+	createTestDiscountCode(t, DiscountCode{Code: "SOON", IsActive: true, ValidFrom: &inAnHour})
+	createTestDiscountCode(t, DiscountCode{Code: "OVER", IsActive: true, ValidUntil: &hourAgo})
+	createTestDiscountCode(t, DiscountCode{Code: "BIGSPENDER", IsActive: true, MinOrderValue: decimal.NewFromInt(1000)})
+	createTestDiscountCode(t, DiscountCode{Code: "THIRSTY", IsActive: true, Scope: ScopeDrinks})
+
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"NOPE", "NOT_FOUND"},
+		{"INACTIVE", "INACTIVE"},
+		{"SOON", "NOT_STARTED"},
+		{"OVER", "EXPIRED"},
+		{"BIGSPENDER", "MINIMUM_NOT_MET"},
+		{"THIRSTY", "NOT_APPLICABLE"},
+		// Seeded with the birthday promotion, the customer has no birth date
+		{"BIRTHDAY", "CONDITIONS_NOT_MET"},
+	}
+	for _, test := range tests {
+		if _, reason := checkoutWithCode(t, customerID, userID, test.code); reason != test.want {
+			t.Errorf("code %s is refused with %q, want %q", test.code, reason, test.want)
+		}
+	}
+}
+
+func TestDiscountCodeUseLimits(t *testing.T) {
+	migrateTestDB(t)
+	margheritaID, tiramisuID := discountTestShop(t)
+	oneForAll, oneEach := 1, 1
+	createTestDiscountCode(t, DiscountCode{Code: "ONCE", IsActive: true, MaxUses: &oneForAll})
+	createTestDiscountCode(t, DiscountCode{Code: "ONCEEACH", IsActive: true, MaxUsesPerCustomer: &oneEach})
+
+	alice, aliceUser := discountTestCustomer(t, "alice", margheritaID, tiramisuID)
+	bob, bobUser := discountTestCustomer(t, "bob", margheritaID, tiramisuID)
+	for _, code := range []string{"ONCE", "ONCEEACH"} {
+		if _, reason := checkoutWithCode(t, alice, aliceUser, code); reason != "" {
+			t.Fatalf("alice's first %s is refused with %s", code, reason)
+		}
+		// Checkout emptied the cart
+		if _, err := AddToCart(alice, CartLine{Type: "pizza", ID: margheritaID, Quantity: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, reason := checkoutWithCode(t, bob, bobUser, "ONCE"); reason != "USED_UP" {
+		t.Errorf("bob's ONCE is refused with %q, want USED_UP", reason)
+	}
+	if _, reason := checkoutWithCode(t, alice, aliceUser, "ONCEEACH"); reason != "ALREADY_USED" {
+		t.Errorf("alice's second ONCEEACH is refused with %q, want ALREADY_USED", reason)
+	}
+	if _, reason := checkoutWithCode(t, bob, bobUser, "ONCEEACH"); reason != "" {
+		t.Errorf("bob's first ONCEEACH is refused with %q", reason)
+	}
+}
+
+func TestDiscountCodeScopes(t *testing.T) {
+	migrateTestDB(t)
+	margheritaID, tiramisuID := discountTestShop(t)
+	createTestDiscountCode(t, DiscountCode{Code: "DESSERT", IsActive: true, Type: FixedDiscount, DiscountAmount: decimal.NewFromInt(100), Scope: ScopeDesserts})
+	createTestDiscountCode(t, DiscountCode{Code: "MARGHERITA", IsActive: true, Type: PercentageDiscount, DiscountPercentage: 50, Scope: ScopeItems, PizzaIDs: []int{margheritaID}})
+
+	var margheritaPrice float64
+	customerID, userID := discountTestCustomer(t, "shopper", margheritaID, tiramisuID)
+	cart, err := GetCart(customerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range cart.Items {
+		if item.Type == "pizza" {
+			margheritaPrice = item.UnitPrice
+		}
+	}
+
+	// A fixed amount takes off at most what the lines in its scope cost
+	breakdown, reason := checkoutWithCode(t, customerID, userID, "DESSERT")
+	if reason != "" {
+		t.Fatalf("DESSERT is refused with %s", reason)
+	}
+	if breakdown.Discount != 5.50 {
+		t.Errorf("DESSERT takes %.2f off, want the Tiramisu's 5.50", breakdown.Discount)
+	}
+
+	customerID, userID = discountTestCustomer(t, "shopper2", margheritaID, tiramisuID)
+	breakdown, reason = checkoutWithCode(t, customerID, userID, "MARGHERITA")
+	if reason != "" {
+		t.Fatalf("MARGHERITA is refused with %s", reason)
+	}
+	if !sameAmount(breakdown.Discount, margheritaPrice) {
+		t.Errorf("MARGHERITA takes %.2f off, want half of two Margheritas, %.2f", breakdown.Discount, margheritaPrice)
+	}
+}
@@ -0,0 +1,276 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInvalidDispatchPolicy = errors.New("the batch size must be between 1 and 10 and the cooldown at least 0 minutes")
+	ErrDeliveryZoneMismatch  = errors.New("order goes to another delivery zone than the courier's other orders")
+)
+
+// MaxBatchSize is the most orders a courier can be given at once.
+const MaxBatchSize = 10
+
+// DispatchPolicy is how ready orders are handed to couriers, the dispatch_policy row (id 1).
+type DispatchPolicy struct {
+	// The server assigns ready orders itself, see DispatchReadyOrders
+	AutoDispatch bool `json:"auto_dispatch"`
+	// A courier carries up to this many orders at once, all going to the same delivery zone.
+	// 1 is one order at a time.
+	MaxBatchSize int `json:"max_batch_size"`
+	// How long a courier is away after a delivery before they can take new orders
+	CooldownMinutes int        `json:"cooldown_minutes"`
+	UpdatedAt       *time.Time `json:"updated_at"`
+	UpdatedBy       *string    `json:"updated_by"`
+}
+
+func (p DispatchPolicy) cooldown() time.Duration {
+	return time.Duration(p.CooldownMinutes) * time.Minute
+}
+
+func validateDispatchPolicy(p DispatchPolicy) error {
+	if p.MaxBatchSize < 1 || p.MaxBatchSize > MaxBatchSize || p.CooldownMinutes < 0 {
+		return ErrInvalidDispatchPolicy
+	}
+	return nil
+}
+
+// GetDispatchPolicy loads the current dispatch rules.
+func GetDispatchPolicy() (DispatchPolicy, error) {
+	return getDispatchPolicy(DATABASE)
+}
+
+func getDispatchPolicy(q queryer) (DispatchPolicy, error) {
+	var p DispatchPolicy
+	var updatedAt sql.NullTime
+	var updatedBy sql.NullString
+	err := q.QueryRow(`
+		SELECT dp.auto_dispatch, dp.max_batch_size, dp.cooldown_minutes, dp.updated_at, u.username
+		FROM dispatch_policy dp
+		LEFT JOIN user u ON dp.updated_by = u.id
+		WHERE dp.id = 1
+	`).Scan(&p.AutoDispatch, &p.MaxBatchSize, &p.CooldownMinutes, &updatedAt, &updatedBy)
+	if err != nil {
+		return DispatchPolicy{}, fmt.Errorf("failed to load dispatch policy: %w", err)
+	}
+	if updatedAt.Valid {
+		p.UpdatedAt = &updatedAt.Time
+	}
+	if updatedBy.Valid {
+		p.UpdatedBy = &updatedBy.String
+	}
+	return p, nil
+}
+
+// UpdateDispatchPolicy replaces the dispatch rules. Orders couriers already carry stay with them.
+func UpdateDispatchPolicy(p DispatchPolicy, actorUserID int) error {
+	if err := validateDispatchPolicy(p); err != nil {
+		return err
+	}
+	_, err := DATABASE.Exec(`
+		UPDATE dispatch_policy
+		SET auto_dispatch = ?, max_batch_size = ?, cooldown_minutes = ?, updated_at = ?, updated_by = ?
+		WHERE id = 1
+	`, p.AutoDispatch, p.MaxBatchSize, p.CooldownMinutes, time.Now(), nullableUserID(actorUserID))
+	return err
+}
+
+// checkBatch returns why the courier can't take one more order to zoneID, nil if they can.
+// Their orders on the way all have to go to the same zone, orders without a zone aren't batched.
+func checkBatch(q queryer, policy DispatchPolicy, deliveryPersonID int, zoneID sql.NullInt64) error {
+	rows, err := q.Query(`
+		SELECT delivery_zone_id FROM orders
+		WHERE delivery_person_id = ? AND status NOT IN ('DELIVERED','FAILED','CANCELLED')
+	`, deliveryPersonID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	active := 0
+	sameZone := true
+	for rows.Next() {
+		var activeZoneID sql.NullInt64
+		if err := rows.Scan(&activeZoneID); err != nil {
+			return err
+		}
+		active++
+		if !zoneID.Valid || !activeZoneID.Valid || activeZoneID.Int64 != zoneID.Int64 {
+			sameZone = false
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	switch {
+	case active >= policy.MaxBatchSize:
+		return ErrDeliveryPersonBusy
+	case active > 0 && !sameZone:
+		return ErrDeliveryZoneMismatch
+	}
+	return nil
+}
+
+// readyOrder is an order waiting for a courier, and where it goes.
+type readyOrder struct {
+	id     int
+	zoneID sql.NullInt64
+}
+
+// idleCourier is a courier back from their last trip.
+type idleCourier struct {
+	id      int
+	zoneIDs map[int64]bool
+}
+
+// delivers is true when the courier delivers in the zone, couriers without zones deliver everywhere.
+func (c idleCourier) delivers(zoneID sql.NullInt64) bool {
+	return len(c.zoneIDs) == 0 || !zoneID.Valid || c.zoneIDs[zoneID.Int64]
+}
+
+// DispatchReadyOrders assigns ready orders to idle couriers, oldest order first. A courier gets the oldest
+// order in one of their zones and up to max_batch_size - 1 more going to the same zone. It returns how
+// many orders were assigned, none when the policy turns automatic dispatch off. actorUserID is the admin
+// who asked for the round, 0 for the dispatcher.
+func DispatchReadyOrders(actorUserID int) (int, error) {
+	tx, err := DATABASE.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	policy, err := getDispatchPolicy(tx)
+	if err != nil {
+		return 0, err
+	}
+	if !policy.AutoDispatch {
+		return 0, nil
+	}
+
+	orders, err := getReadyOrders(tx)
+	if err != nil || len(orders) == 0 {
+		return 0, err
+	}
+	couriers, err := getIdleCouriers(tx, time.Now())
+	if err != nil || len(couriers) == 0 {
+		return 0, err
+	}
+
+	assigned := map[int]bool{}
+	for _, courier := range couriers {
+		var batch []readyOrder
+		for _, o := range orders {
+			if assigned[o.id] || !courier.delivers(o.zoneID) {
+				continue
+			}
+			// The first order decides the zone, only orders to the same one join it
+			if len(batch) > 0 && (!o.zoneID.Valid || !batch[0].zoneID.Valid || o.zoneID.Int64 != batch[0].zoneID.Int64) {
+				continue
+			}
+			batch = append(batch, o)
+			if len(batch) == policy.MaxBatchSize {
+				break
+			}
+		}
+
+		for _, o := range batch {
+			if _, err := tx.Exec("UPDATE orders SET delivery_person_id = ? WHERE id = ?", courier.id, o.id); err != nil {
+				return 0, err
+			}
+			if err := transitionOrder(tx, o.id, OrderOutForDelivery, actorUserID); err != nil {
+				return 0, err
+			}
+			assigned[o.id] = true
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(assigned), nil
+}
+
+// getReadyOrders returns the orders that wait for a courier, oldest first, and locks them.
+func getReadyOrders(q queryer) ([]readyOrder, error) {
+	rows, err := q.Query(`
+		SELECT o.id, o.delivery_zone_id
+		FROM orders o
+		WHERE o.status = 'READY'
+		AND o.delivery_person_id IS NULL
+		AND NOT EXISTS (
+			SELECT 1 FROM order_pizza op
+			WHERE op.order_id = o.id AND op.kitchen_status <> 'FINISHED'
+		)
+		ORDER BY o.timestamp ASC, o.id ASC` + currentDialect.forUpdate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []readyOrder
+	for rows.Next() {
+		var o readyOrder
+		if err := rows.Scan(&o.id, &o.zoneID); err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	return orders, rows.Err()
+}
+
+// getIdleCouriers returns the couriers without orders on the way and past their cooldown, the one
+// that has waited longest first, and locks them.
+func getIdleCouriers(q queryer, now time.Time) ([]idleCourier, error) {
+	rows, err := q.Query(`
+		SELECT dp.id, dp.unavailable_until
+		FROM delivery_person dp
+		WHERE NOT EXISTS (
+			SELECT 1 FROM orders o
+			WHERE o.delivery_person_id = dp.id AND o.status NOT IN ('DELIVERED','FAILED','CANCELLED')
+		)
+		ORDER BY dp.unavailable_until IS NOT NULL, dp.unavailable_until, dp.id` + currentDialect.forUpdate)
+	if err != nil {
+		return nil, err
+	}
+	var couriers []idleCourier
+	byID := map[int]int{}
+	for rows.Next() {
+		c := idleCourier{zoneIDs: map[int64]bool{}}
+		var unavailableUntil sql.NullTime
+		if err := rows.Scan(&c.id, &unavailableUntil); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if unavailableUntil.Valid && unavailableUntil.Time.After(now) {
+			continue
+		}
+		byID[c.id] = len(couriers)
+		couriers = append(couriers, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = q.Query(`SELECT delivery_person_id, delivery_zone_id FROM delivery_person_zone`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var deliveryPersonID int
+		var zoneID int64
+		if err := rows.Scan(&deliveryPersonID, &zoneID); err != nil {
+			return nil, err
+		}
+		if i, ok := byID[deliveryPersonID]; ok {
+			couriers[i].zoneIDs[zoneID] = true
+		}
+	}
+	return couriers, rows.Err()
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+// readyTestOrder places the test orders, makes the first one ready for delivery and adds a courier.
+// It returns the ready order, the admin's user ID and the courier's delivery person ID.
+func readyTestOrder(t *testing.T) (orderID, adminID, deliveryPersonID int) {
+	t.Helper()
+	customerID := placeTestOrders(t)
+
+	if err := DATABASE.QueryRow(`SELECT MIN(id) FROM orders WHERE customer_id = ?`, customerID).Scan(&orderID); err != nil {
+		t.Fatal(err)
+	}
+	if err := DATABASE.QueryRow(`SELECT id FROM user WHERE username = 'admin'`).Scan(&adminID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DATABASE.Exec(`UPDATE orders SET status = 'READY' WHERE id = ?`, orderID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DATABASE.Exec(`UPDATE order_pizza SET kitchen_status = 'FINISHED' WHERE order_id = ?`, orderID); err != nil {
+		t.Fatal(err)
+	}
+	if ok, msg := TryAddDeliveryPerson(DeliveryPerson{Username: "courier", Password: "courier", Name: "Courier"}); !ok {
+		t.Fatal(msg)
+	}
+	err := DATABASE.QueryRow(`SELECT dp.id FROM delivery_person dp JOIN user u ON dp.user_id = u.id WHERE u.username = 'courier'`).Scan(&deliveryPersonID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return orderID, adminID, deliveryPersonID
+}
+
+// outForDeliveryBy returns who moved the order out for delivery in its status history.
+func outForDeliveryBy(t *testing.T, orderID int) int {
+	t.Helper()
+	var changedBy int
+	err := DATABASE.QueryRow(`SELECT changed_by FROM order_status_history WHERE order_id = ? AND to_status = 'OUT_FOR_DELIVERY'`, orderID).Scan(&changedBy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return changedBy
+}
+
+func TestDispatchReadyOrdersRecordsTheAdmin(t *testing.T) {
+	migrateTestDB(t)
+	orderID, adminID, _ := readyTestOrder(t)
+
+	assigned, err := DispatchReadyOrders(adminID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assigned != 1 {
+		t.Fatalf("dispatched %d orders, want 1", assigned)
+	}
+	if changedBy := outForDeliveryBy(t, orderID); changedBy != adminID {
+		t.Errorf("the dispatch was changed by user %d, want the admin %d", changedBy, adminID)
+	}
+}
+
+func TestSetOrderDeliveryPerson(t *testing.T) {
+	migrateTestDB(t)
+	orderID, adminID, deliveryPersonID := readyTestOrder(t)
+
+	if err := SetOrderDeliveryPerson(orderID+1, deliveryPersonID, adminID); !errors.Is(err, ErrOrderNotAvailable) {
+		t.Errorf("assigning an order that isn't ready: %v, want ErrOrderNotAvailable", err)
+	}
+	if err := SetOrderDeliveryPerson(orderID, deliveryPersonID+1, adminID); !errors.Is(err, ErrDeliveryPersonNotFound) {
+		t.Errorf("assigning to a missing courier: %v, want ErrDeliveryPersonNotFound", err)
+	}
+
+	if err := SetOrderDeliveryPerson(orderID, deliveryPersonID, adminID); err != nil {
+		t.Fatal(err)
+	}
+	order, err := GetOrderByID(orderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != string(OrderOutForDelivery) {
+		t.Errorf("the assigned order is %s, want %s", order.Status, OrderOutForDelivery)
+	}
+	if changedBy := outForDeliveryBy(t, orderID); changedBy != adminID {
+		t.Errorf("the assignment was changed by user %d, want the admin %d", changedBy, adminID)
+	}
+
+	// The courier delivers it like an order they picked up themselves
+	var courierUserID int
+	if err := DATABASE.QueryRow(`SELECT user_id FROM delivery_person WHERE id = ?`, deliveryPersonID).Scan(&courierUserID); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateDeliveryStatus(orderID, courierUserID, string(OrderDelivered)); err != nil {
+		t.Error(err)
+	}
+}
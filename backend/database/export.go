@@ -0,0 +1,281 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ExportFilter limits an export to the orders placed from From up to, not including, To. Nil doesn't limit.
+type ExportFilter struct {
+	From *time.Time
+	To   *time.Time
+}
+
+// where adds the filter on the order timestamp column to a query's conditions.
+func (f ExportFilter) where(column string, conditions []string, args []any) ([]string, []any) {
+	if f.From != nil {
+		conditions = append(conditions, column+" >= ?")
+		args = append(args, *f.From)
+	}
+	if f.To != nil {
+		conditions = append(conditions, column+" < ?")
+		args = append(args, *f.To)
+	}
+	return conditions, args
+}
+
+// OrderExportLine is one line item of an order, with the order it belongs to.
+type OrderExportLine struct {
+	OrderID      int       `json:"order_id"`
+	Timestamp    time.Time `json:"timestamp"`
+	Status       string    `json:"status"`
+	CustomerID   int       `json:"customer_id"`
+	CustomerName string    `json:"customer_name"`
+	PostalCode   string    `json:"postal_code"`
+	DiscountCode *string   `json:"discount_code"`
+	// The order's price breakdown. Prices include VAT, so
+	// subtotal - promotion_discount - loyalty_discount - discount + delivery_fee = order_total
+	Subtotal           float64 `json:"subtotal"`
+	PromotionDiscount  float64 `json:"promotion_discount"`
+	LoyaltyDiscount    float64 `json:"loyalty_discount"`
+	DiscountPercentage int     `json:"discount_percentage"`
+	Discount           float64 `json:"discount"`
+	VAT                float64 `json:"vat"`
+	DeliveryFee        float64 `json:"delivery_fee"`
+	OrderTotal         float64 `json:"order_total"`
+	// "pizza" or "extra", Item is the pizza with its size and crust or the dessert or drink
+	ItemType       string  `json:"item_type"`
+	Item           string  `json:"item"`
+	Size           *string `json:"size"`
+	Crust          *string `json:"crust"`
+	Quantity       int     `json:"quantity"`
+	FreeQuantity   int     `json:"free_quantity"`
+	RewardQuantity int     `json:"reward_quantity"`
+	UnitPrice      float64 `json:"unit_price"`
+	VATRate        float64 `json:"vat_rate"`
+}
+
+// CustomerExport is a customer with what they ordered in the export's window.
+type CustomerExport struct {
+	CustomerID     int     `json:"customer_id"`
+	Username       string  `json:"username"`
+	Name           string  `json:"name"`
+	Gender         string  `json:"gender"`
+	BirthDate      string  `json:"birth_date"`
+	Address        string  `json:"address"`
+	PostalCode     string  `json:"postal_code"`
+	PizzaCounter   int     `json:"pizza_counter"`
+	LoyaltyRewards int     `json:"loyalty_rewards"`
+	Orders         int     `json:"orders"`
+	TotalSpent     float64 `json:"total_spent"`
+}
+
+// DailySales adds up the price breakdowns of the orders of one day. Discounts are those of promotions,
+// loyalty rewards and discount codes together, so subtotal - discounts + delivery_fees = revenue.
+type DailySales struct {
+	Date         string  `json:"date"`
+	Orders       int     `json:"orders"`
+	Customers    int     `json:"customers"`
+	Subtotal     float64 `json:"subtotal"`
+	Discounts    float64 `json:"discounts"`
+	VAT          float64 `json:"vat"`
+	DeliveryFees float64 `json:"delivery_fees"`
+	Revenue      float64 `json:"revenue"`
+}
+
+// ExportOrders calls fn with every line item of the orders placed in the window, oldest order first.
+// Rows are read from the database one at a time, so the export never holds the whole table in memory.
+// Returning an error from fn stops the export.
+func ExportOrders(filter ExportFilter, fn func(OrderExportLine) error) error {
+	conditions, args := filter.where("o.timestamp", []string{"1 = 1"}, nil)
+	where := strings.Join(conditions, " AND ")
+	// The pizzas and the extras get the same columns, so both come out of one query in order
+	query := `
+		SELECT o.id, o.timestamp, o.status, o.customer_id, c.name, o.postal_code, dc.code,
+		       o.total_price, 'pizza', p.name, ps.name, ct.name,
+		       op.quantity, op.free_quantity, op.reward_quantity, op.unit_price, op.vat_rate, op.id
+		FROM orders o
+		JOIN customer c ON o.customer_id = c.id
+		LEFT JOIN discount_code dc ON o.discount_code_id = dc.id
+		JOIN order_pizza op ON op.order_id = o.id
+		JOIN pizza p ON op.pizza_id = p.id
+		LEFT JOIN pizza_size ps ON op.size_id = ps.id
+		LEFT JOIN crust_type ct ON op.crust_id = ct.id
+		WHERE ` + where + `
+		UNION ALL
+		SELECT o.id, o.timestamp, o.status, o.customer_id, c.name, o.postal_code, dc.code,
+		       o.total_price, 'extra', e.name, NULL, NULL,
+		       oe.quantity, oe.free_quantity, 0, oe.unit_price, oe.vat_rate, oe.id
+		FROM orders o
+		JOIN customer c ON o.customer_id = c.id
+		LEFT JOIN discount_code dc ON o.discount_code_id = dc.id
+		JOIN order_extra_item oe ON oe.order_id = o.id
+		JOIN extra_item e ON oe.extra_item_id = e.id
+		WHERE ` + where + `
+		ORDER BY 1, 9 DESC, 18` // by order, its pizzas before its extras
+	rows, err := DATABASE.Query(query, append(args, args...)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var breakdown PriceBreakdown
+	breakdownOrderID := 0
+	for rows.Next() {
+		var line OrderExportLine
+		var discountCode, size, crust sql.NullString
+		var lineID int
+		err := rows.Scan(&line.OrderID, &line.Timestamp, &line.Status, &line.CustomerID, &line.CustomerName, &line.PostalCode,
+			&discountCode, &line.OrderTotal, &line.ItemType, &line.Item, &size, &crust,
+			&line.Quantity, &line.FreeQuantity, &line.RewardQuantity, &line.UnitPrice, &line.VATRate, &lineID)
+		if err != nil {
+			return err
+		}
+		// The lines of an order come one after the other, its breakdown is worked out at the first
+		if line.OrderID != breakdownOrderID {
+			if breakdown, err = getOrderBreakdown(DATABASE, line.OrderID); err != nil {
+				return err
+			}
+			breakdownOrderID = line.OrderID
+		}
+		line.Subtotal = breakdown.Subtotal
+		line.PromotionDiscount = breakdown.PromotionDiscount
+		line.LoyaltyDiscount = breakdown.LoyaltyDiscount
+		line.DiscountPercentage = breakdown.DiscountPercentage
+		line.Discount = breakdown.Discount
+		line.VAT = breakdown.VAT
+		line.DeliveryFee = breakdown.DeliveryFee
+		if discountCode.Valid {
+			line.DiscountCode = &discountCode.String
+		}
+		if size.Valid {
+			line.Size = &size.String
+		}
+		if crust.Valid {
+			line.Crust = &crust.String
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ExportCustomers calls fn with every customer and what they spent in the window, by customer id. With a window
+// only the customers that ordered in it are exported. Cancelled orders and failed deliveries don't count.
+func ExportCustomers(filter ExportFilter, fn func(CustomerExport) error) error {
+	conditions, args := filter.where("o.timestamp", []string{"o.customer_id = c.id", reportedOrders}, nil)
+	query := `
+		SELECT c.id, u.username, c.name, c.gender, COALESCE(c.birth_date, '') as birth_date, c.address, c.postal_code,
+		       c.pizza_counter, c.loyalty_rewards, COUNT(o.id), ROUND(COALESCE(SUM(o.total_price), 0), 2)
+		FROM customer c
+		JOIN user u ON c.user_id = u.id
+		LEFT JOIN orders o ON ` + strings.Join(conditions, " AND ") + `
+		GROUP BY c.id, u.username, c.name, c.gender, c.birth_date, c.address, c.postal_code, c.pizza_counter, c.loyalty_rewards`
+	if filter.From != nil || filter.To != nil {
+		query += ` HAVING COUNT(o.id) > 0`
+	}
+	query += ` ORDER BY c.id`
+	rows, err := DATABASE.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c CustomerExport
+		err := rows.Scan(&c.CustomerID, &c.Username, &c.Name, &c.Gender, &c.BirthDate, &c.Address, &c.PostalCode,
+			&c.PizzaCounter, &c.LoyaltyRewards, &c.Orders, &c.TotalSpent)
+		if err != nil {
+			return err
+		}
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ExportDailySales calls fn with the sales of every day in the window that had orders, oldest day first.
+// Cancelled orders and failed deliveries don't count.
+func ExportDailySales(filter ExportFilter, fn func(DailySales) error) error {
+	conditions, args := filter.where("o.timestamp", []string{reportedOrders}, nil)
+	rows, err := DATABASE.Query(`
+		SELECT `+currentDialect.dateOf("o.timestamp")+`, o.id, o.customer_id, o.total_price
+		FROM orders o
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY o.timestamp, o.id`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// The orders come by day, a day is done when the next one starts
+	var day *salesDay
+	for rows.Next() {
+		var date, total string
+		var orderID, customerID int
+		if err := rows.Scan(&date, &orderID, &customerID, &total); err != nil {
+			return err
+		}
+		if day != nil && day.date != date {
+			if err := fn(day.sales()); err != nil {
+				return err
+			}
+			day = nil
+		}
+		if day == nil {
+			day = &salesDay{date: date, customers: map[int]bool{}}
+		}
+		breakdown, err := getOrderBreakdown(DATABASE, orderID)
+		if err != nil {
+			return err
+		}
+		if err := day.add(customerID, breakdown, total); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if day != nil {
+		return fn(day.sales())
+	}
+	return nil
+}
+
+// salesDay adds up the orders of a day for ExportDailySales.
+type salesDay struct {
+	date                                    string
+	orders                                  int
+	customers                               map[int]bool
+	subtotal, discounts, vat, fees, revenue decimal.Decimal
+}
+
+func (d *salesDay) add(customerID int, b PriceBreakdown, total string) error {
+	paid, err := decimal.NewFromString(total)
+	if err != nil {
+		return err
+	}
+	d.orders++
+	d.customers[customerID] = true
+	d.subtotal = d.subtotal.Add(decimal.NewFromFloat(b.Subtotal))
+	d.discounts = d.discounts.Add(decimal.NewFromFloat(b.PromotionDiscount)).Add(decimal.NewFromFloat(b.LoyaltyDiscount)).Add(decimal.NewFromFloat(b.Discount))
+	d.vat = d.vat.Add(decimal.NewFromFloat(b.VAT))
+	d.fees = d.fees.Add(decimal.NewFromFloat(b.DeliveryFee))
+	d.revenue = d.revenue.Add(paid)
+	return nil
+}
+
+func (d *salesDay) sales() DailySales {
+	s := DailySales{Date: d.date, Orders: d.orders, Customers: len(d.customers)}
+	s.Subtotal, _ = d.subtotal.Round(2).Float64()
+	s.Discounts, _ = d.discounts.Round(2).Float64()
+	s.VAT, _ = d.vat.Round(2).Float64()
+	s.DeliveryFees, _ = d.fees.Round(2).Float64()
+	s.Revenue, _ = d.revenue.Round(2).Float64()
+	return s
+}
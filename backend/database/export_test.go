@@ -0,0 +1,111 @@
+package database
+
+import (
+	"math"
+	"testing"
+)
+
+// placeTestOrders orders two Margheritas and a Tiramisu three times as the seeded customer, whose ID it
+// returns: with the SAVE10 code, then with the loyalty reward the first order earned, then without
+// anything off. Deliveries cost 2.50.
+func placeTestOrders(t *testing.T) int {
+	t.Helper()
+	SeedDevData()
+	if _, err := DATABASE.Exec(`UPDATE delivery_zone SET delivery_fee = 2.50`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DATABASE.Exec(`UPDATE pricing_config SET loyalty_pizzas_per_reward = 2`); err != nil {
+		t.Fatal(err)
+	}
+
+	var customerID, userID, margheritaID, tiramisuID int
+	err := DATABASE.QueryRow(`SELECT c.id, c.user_id FROM customer c JOIN user u ON c.user_id = u.id WHERE u.username = 'walta'`).Scan(&customerID, &userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := DATABASE.QueryRow(`SELECT id FROM pizza WHERE name = 'Margherita'`).Scan(&margheritaID); err != nil {
+		t.Fatal(err)
+	}
+	if err := DATABASE.QueryRow(`SELECT id FROM extra_item WHERE name = 'Tiramisu'`).Scan(&tiramisuID); err != nil {
+		t.Fatal(err)
+	}
+
+	pizzas := []PizzaOrderItem{{PizzaID: margheritaID, Quantity: 2}}
+	extras := []ExtraOrderItem{{ExtraItemID: tiramisuID, Quantity: 1}}
+	code := "SAVE10"
+	for _, discountCode := range []*string{&code, nil, nil} {
+		if _, err := CreateOrderWithTransaction(customerID, userID, "Main St 1", "87104", pizzas, extras, discountCode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return customerID
+}
+
+func sameAmount(a, b float64) bool {
+	return math.Abs(a-b) < 0.005
+}
+
+func TestExportOrdersReconcile(t *testing.T) {
+	migrateTestDB(t)
+	placeTestOrders(t)
+
+	var codeDiscount, loyaltyDiscount float64
+	lines := 0
+	err := ExportOrders(ExportFilter{}, func(l OrderExportLine) error {
+		lines++
+		// Prices include VAT, it is part of the subtotal already
+		total := l.Subtotal - l.PromotionDiscount - l.LoyaltyDiscount - l.Discount + l.DeliveryFee
+		if !sameAmount(total, l.OrderTotal) {
+			t.Errorf("order %d: %.2f - %.2f - %.2f - %.2f + %.2f = %.2f, order_total %.2f", l.OrderID, l.Subtotal,
+				l.PromotionDiscount, l.LoyaltyDiscount, l.Discount, l.DeliveryFee, total, l.OrderTotal)
+		}
+		if l.VAT <= 0 || l.VAT >= l.OrderTotal {
+			t.Errorf("order %d: vat %.2f of %.2f", l.OrderID, l.VAT, l.OrderTotal)
+		}
+		codeDiscount += l.Discount
+		loyaltyDiscount += l.LoyaltyDiscount
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines != 6 {
+		t.Errorf("exported %d lines, want 6", lines)
+	}
+	if codeDiscount <= 0 {
+		t.Error("the SAVE10 discount is missing from the export")
+	}
+	if loyaltyDiscount <= 0 {
+		t.Error("the loyalty reward is missing from the export")
+	}
+}
+
+func TestExportDailySalesReconcile(t *testing.T) {
+	migrateTestDB(t)
+	placeTestOrders(t)
+
+	var days []DailySales
+	err := ExportDailySales(ExportFilter{}, func(d DailySales) error {
+		days = append(days, d)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 1 {
+		t.Fatalf("exported %d days, want 1", len(days))
+	}
+	d := days[0]
+	if d.Orders != 3 || d.Customers != 1 {
+		t.Errorf("%d orders by %d customers, want 3 by 1", d.Orders, d.Customers)
+	}
+	if d.Discounts <= 0 {
+		t.Error("the discounts are missing from the export")
+	}
+	if total := d.Subtotal - d.Discounts + d.DeliveryFees; !sameAmount(total, d.Revenue) {
+		t.Errorf("%.2f - %.2f + %.2f = %.2f, revenue %.2f", d.Subtotal, d.Discounts, d.DeliveryFees, total, d.Revenue)
+	}
+	if !sameAmount(d.DeliveryFees, 7.50) {
+		t.Errorf("delivery fees %.2f, want 7.50", d.DeliveryFees)
+	}
+}
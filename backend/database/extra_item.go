@@ -0,0 +1,47 @@
+package database
+
+type ExtraItem struct {
+	ID       int     `json:"id"`
+	Name     string  `json:"name"`
+	Category string  `json:"category"`
+	Price    float64 `json:"price"`
+}
+
+func GetAllExtraItems() ([]ExtraItem, error) {
+	rows, err := DATABASE.Query(`SELECT id, name, category, price FROM extra_item ORDER BY category, name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []ExtraItem
+	for rows.Next() {
+		var item ExtraItem
+		if err := rows.Scan(&item.ID, &item.Name, &item.Category, &item.Price); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func CreateExtraItem(name string, category string, price float64) (int, error) {
+	query := `INSERT INTO extra_item (name, category, price) VALUES (?, ?, ?)`
+	result, err := DATABASE.Exec(query, name, category, price)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+func UpdateExtraItem(id int, name string, category string, price float64) error {
+	query := `UPDATE extra_item SET name = ?, category = ?, price = ? WHERE id = ?`
+	_, err := DATABASE.Exec(query, name, category, price, id)
+	return err
+}
+
+func DeleteExtraItem(id int) error {
+	_, err := DATABASE.Exec(`DELETE FROM extra_item WHERE id = ?`, id)
+	return err
+}
@@ -48,9 +48,58 @@ func CreateIngredient(ingr Ingredient) (IngredientWithID, error) {
 }
 
 func GetAllIngredients() ([]IngredientWithID, error) {
-	rows, err := DATABASE.Query("SELECT id, name, cost, has_meat, has_animal_products FROM ingredient")
+	ingredients, _, err := ListIngredients(IngredientFilter{})
+	return ingredients, err
+}
+
+// IngredientFilter narrows down and pages the admin ingredient list. Nil and blank fields don't filter.
+type IngredientFilter struct {
+	// Names containing it
+	Search            string
+	HasMeat           *bool
+	HasAnimalProducts *bool
+	ListOptions
+}
+
+var ingredientSorts = sortColumns{
+	"id":   "id",
+	"name": "name",
+	"cost": "cost",
+}
+
+// ListIngredients returns a page of the ingredients matching the filter, by id unless it sorts them
+// otherwise, and how many match across all pages.
+func ListIngredients(filter IngredientFilter) ([]IngredientWithID, int, error) {
+	var conditions []string
+	var args []any
+	if filter.Search != "" {
+		conditions = append(conditions, "name LIKE ?")
+		args = append(args, "%"+filter.Search+"%")
+	}
+	if filter.HasMeat != nil {
+		conditions = append(conditions, "has_meat = ?")
+		args = append(args, *filter.HasMeat)
+	}
+	if filter.HasAnimalProducts != nil {
+		conditions = append(conditions, "has_animal_products = ?")
+		args = append(args, *filter.HasAnimalProducts)
+	}
+	where := whereClause(conditions)
+
+	orderBy, err := filter.orderBy(ingredientSorts, "id", "id")
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := countRows("ingredient", where, args)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	page, pageArgs := filter.page()
+	rows, err := DATABASE.Query("SELECT id, name, cost, has_meat, has_animal_products FROM ingredient"+where+orderBy+page,
+		append(args, pageArgs...)...)
+	if err != nil {
+		return nil, 0, err
 	}
 	defer rows.Close()
 
@@ -75,7 +124,7 @@ func GetAllIngredients() ([]IngredientWithID, error) {
 		ingredients = append(ingredients, ingr)
 	}
 
-	return ingredients, nil
+	return ingredients, total, rows.Err()
 }
 
 func GetIngredient(ingredientName string) (IngredientWithID, error) {
@@ -106,3 +155,9 @@ func DeleteIngredient(id int) error {
 	_, err := DATABASE.Exec("DELETE FROM ingredient WHERE id = ?", id)
 	return err
 }
+
+func UpdateIngredient(id int, ingr Ingredient) error {
+	query := "UPDATE ingredient SET name = ?, cost = ?, has_meat = ?, has_animal_products = ? WHERE id = ?"
+	_, err := DATABASE.Exec(query, ingr.Name, ingr.Cost.String(), ingr.HasMeat, ingr.HasAnimalProducts, id)
+	return err
+}
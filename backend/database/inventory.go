@@ -0,0 +1,242 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrIngredientNotFound = errors.New("ingredient not found")
+	ErrInvalidStockAmount = errors.New("stock amounts must be positive")
+)
+
+// OutOfStockError is returned when an order needs more of some ingredients than there is in stock.
+type OutOfStockError struct {
+	Ingredients []string
+}
+
+func (e *OutOfStockError) Error() string {
+	return fmt.Sprintf("not enough stock of %s", strings.Join(e.Ingredients, ", "))
+}
+
+type StockLevel struct {
+	IngredientID      int     `json:"ingredient_id"`
+	Name              string  `json:"name"`
+	Unit              string  `json:"unit"`
+	Stock             float64 `json:"stock"`
+	LowStockThreshold float64 `json:"low_stock_threshold"`
+	IsLow             bool    `json:"is_low"`
+	// What a customer adding it to a pizza gets
+	Portion float64 `json:"portion"`
+	// Pizzas on the menu that can't be made anymore until this ingredient is restocked
+	UnavailablePizzas int `json:"unavailable_pizzas"`
+}
+
+// stockNeeded adds up how much of every ingredient the pizza lines use, modifiers included, scaled by their size and crust.
+func stockNeeded(pizzas []pricedItem) map[int]decimal.Decimal {
+	needed := map[int]decimal.Decimal{}
+	for _, item := range pizzas {
+		for _, p := range item.Portions {
+			amount := p.Amount.Mul(item.Variant.ingredientMultiplier())
+			needed[p.IngredientID] = needed[p.IngredientID].Add(amount.Mul(decimal.NewFromInt(int64(item.Quantity))))
+		}
+	}
+	return needed
+}
+
+// takeStock removes what the pizza lines use from stock. The check and the decrement are one UPDATE,
+// so two orders can't both take the last of an ingredient. Ingredients are updated in id order,
+// which keeps concurrent orders from locking each other. On a shortfall it returns an *OutOfStockError
+// naming every missing ingredient, the caller's rollback puts back what was already taken.
+func takeStock(q queryer, pizzas []pricedItem) error {
+	needed := stockNeeded(pizzas)
+
+	ids := make([]int, 0, len(needed))
+	for id := range needed {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	var missing []string
+	for _, id := range ids {
+		amount := needed[id].String()
+		res, err := q.Exec(`UPDATE ingredient SET stock = stock - ? WHERE id = ? AND stock >= ?`, amount, id, amount)
+		if err != nil {
+			return err
+		}
+		updated, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if updated == 0 {
+			var name string
+			if err := q.QueryRow(`SELECT name FROM ingredient WHERE id = ?`, id).Scan(&name); err != nil {
+				return err
+			}
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return &OutOfStockError{Ingredients: missing}
+	}
+	return nil
+}
+
+// returnStock puts back the ingredients of the order's pizzas the kitchen hasn't started on, e.g. when it is cancelled.
+// It uses the current amounts per pizza, which are the ones taken unless the recipe changed in between.
+func returnStock(q queryer, orderID int) error {
+	rows, err := q.Query(`SELECT id, pizza_id, size_id, crust_id, quantity FROM order_pizza WHERE order_id = ? AND kitchen_status = 'QUEUED'`, orderID)
+	if err != nil {
+		return err
+	}
+	var orderPizzaIDs []int
+	var pizzas []pricedItem
+	for rows.Next() {
+		var orderPizzaID int
+		var item pricedItem
+		if err := rows.Scan(&orderPizzaID, &item.ID, &item.Variant.Size.ID, &item.Variant.Crust.ID, &item.Quantity); err != nil {
+			rows.Close()
+			return err
+		}
+		orderPizzaIDs = append(orderPizzaIDs, orderPizzaID)
+		pizzas = append(pizzas, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	// Load the multipliers and ingredients once the rows are closed, a transaction runs one query at a time
+	for i := range pizzas {
+		pizzas[i].Variant, err = getPizzaVariant(q, pizzas[i].Variant.Size.ID, pizzas[i].Variant.Crust.ID)
+		if err != nil {
+			return err
+		}
+		modifiers, err := getOrderPizzaModifiers(q, orderPizzaIDs[i])
+		if err != nil {
+			return err
+		}
+		pizzas[i].Portions, err = getPizzaPortions(q, pizzas[i].ID, modifiers)
+		if err != nil {
+			return err
+		}
+	}
+
+	for id, amount := range stockNeeded(pizzas) {
+		if _, err := q.Exec(`UPDATE ingredient SET stock = stock + ? WHERE id = ?`, amount.String(), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestockIngredient adds a delivery of amount, in the ingredient's unit, to its stock.
+func RestockIngredient(ingredientID int, amount decimal.Decimal) error {
+	if !amount.IsPositive() {
+		return ErrInvalidStockAmount
+	}
+	res, err := DATABASE.Exec(`UPDATE ingredient SET stock = stock + ? WHERE id = ?`, amount.String(), ingredientID)
+	if err != nil {
+		return err
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrIngredientNotFound
+	}
+	return nil
+}
+
+// UpdateStockSettings sets the unit stock is counted in, the level below which the ingredient counts as low
+// and the portion that goes on a pizza when a customer adds it.
+func UpdateStockSettings(ingredientID int, unit string, lowStockThreshold, portion decimal.Decimal) error {
+	if unit == "" || lowStockThreshold.IsNegative() || !portion.IsPositive() {
+		return ErrInvalidStockAmount
+	}
+	// MySQL doesn't count rows that already had the new values as affected, so check first
+	var count int
+	if err := DATABASE.QueryRow(`SELECT COUNT(*) FROM ingredient WHERE id = ?`, ingredientID).Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrIngredientNotFound
+	}
+	_, err := DATABASE.Exec(`UPDATE ingredient SET unit = ?, low_stock_threshold = ?, portion = ? WHERE id = ?`, unit, lowStockThreshold.String(), portion.String(), ingredientID)
+	return err
+}
+
+// SetPizzaIngredientAmount sets how much of an ingredient, in the ingredient's unit, goes on one pizza.
+func SetPizzaIngredientAmount(pizzaID, ingredientID int, amount decimal.Decimal) error {
+	if !amount.IsPositive() {
+		return ErrInvalidStockAmount
+	}
+	var count int
+	err := DATABASE.QueryRow(`SELECT COUNT(*) FROM pizza_ingredient WHERE pizza_id = ? AND ingredient_id = ?`, pizzaID, ingredientID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrIngredientNotFound
+	}
+	_, err = DATABASE.Exec(`UPDATE pizza_ingredient SET amount = ? WHERE pizza_id = ? AND ingredient_id = ?`, amount.String(), pizzaID, ingredientID)
+	return err
+}
+
+// GetStockLevels lists the stock of every ingredient, lowest stock relative to its threshold first.
+// With onlyLow it only returns the ingredients at or below their threshold.
+func GetStockLevels(onlyLow bool) ([]StockLevel, error) {
+	query := `
+		SELECT i.id, i.name, i.unit, i.stock, i.low_stock_threshold, i.portion,
+		       (SELECT COUNT(*) FROM pizza_ingredient pi WHERE pi.ingredient_id = i.id AND pi.amount > i.stock)
+		FROM ingredient i`
+	if onlyLow {
+		query += ` WHERE i.stock <= i.low_stock_threshold`
+	}
+	query += ` ORDER BY i.stock - i.low_stock_threshold ASC, i.name ASC`
+
+	rows, err := DATABASE.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	levels := []StockLevel{}
+	for rows.Next() {
+		var level StockLevel
+		if err := rows.Scan(&level.IngredientID, &level.Name, &level.Unit, &level.Stock, &level.LowStockThreshold, &level.Portion, &level.UnavailablePizzas); err != nil {
+			return nil, err
+		}
+		level.IsLow = level.Stock <= level.LowStockThreshold
+		levels = append(levels, level)
+	}
+	return levels, rows.Err()
+}
+
+// unavailablePizzaIDs returns the pizzas that have an ingredient with less stock than one pizza needs.
+func unavailablePizzaIDs(q queryer) (map[int]bool, error) {
+	rows, err := q.Query(`
+		SELECT DISTINCT pi.pizza_id
+		FROM pizza_ingredient pi
+		JOIN ingredient i ON pi.ingredient_id = i.id
+		WHERE i.stock < pi.amount
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	unavailable := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		unavailable[id] = true
+	}
+	return unavailable, rows.Err()
+}
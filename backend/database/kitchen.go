@@ -0,0 +1,191 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+)
+
+var (
+	ErrKitchenItemNotFound = errors.New("pizza not found in any order")
+	ErrKitchenItemState    = errors.New("pizza can't be marked that way in its current state")
+	ErrPizzasNotBaked      = errors.New("not all pizzas of the order are baked yet")
+)
+
+// KitchenStatus is how far the kitchen got with one pizza line of an order.
+type KitchenStatus string
+
+const (
+	KitchenQueued   KitchenStatus = "QUEUED"
+	KitchenStarted  KitchenStatus = "STARTED"
+	KitchenFinished KitchenStatus = "FINISHED"
+)
+
+// kitchenStatuses are the order statuses the kitchen still has work for.
+var kitchenStatuses = []OrderStatus{OrderPlaced, OrderConfirmed, OrderInKitchen, OrderBaking}
+
+// advanceOrderTo walks an order forward through the lifecycle until it reaches target, recording each step.
+// It never moves an order backwards or off the main path, e.g. out of CANCELLED.
+func advanceOrderTo(q queryer, orderID int, target OrderStatus, actorUserID int) error {
+	for {
+		var current OrderStatus
+		err := q.QueryRow("SELECT status FROM orders WHERE id = ?"+currentDialect.forUpdate, orderID).Scan(&current)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrOrderNotFound
+			}
+			return err
+		}
+		if current == target {
+			return nil
+		}
+
+		next := current.NextStatuses()
+		if len(next) == 0 || slices.Index(OrderStatuses, current) > slices.Index(OrderStatuses, target) {
+			return &IllegalTransitionError{OrderID: orderID, From: current, To: target}
+		}
+		if err := transitionOrder(q, orderID, next[0], actorUserID); err != nil {
+			return err
+		}
+	}
+}
+
+// GetKitchenQueue lists the orders the kitchen still has to make, oldest first, with their pizzas and extras.
+func GetKitchenQueue() ([]OrderDetails, error) {
+	rows, err := DATABASE.Query(`
+		SELECT id FROM orders
+		WHERE status IN ('PLACED', 'CONFIRMED', 'IN_KITCHEN', 'BAKING')
+		ORDER BY timestamp ASC, id ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	var orderIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		orderIDs = append(orderIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	queue := []OrderDetails{}
+	for _, id := range orderIDs {
+		details, err := GetOrderDetails(id)
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, *details)
+	}
+	return queue, nil
+}
+
+// getKitchenItem locks a pizza line and its order for a kitchen update.
+func getKitchenItem(q queryer, orderPizzaID int) (orderID int, status KitchenStatus, orderStatus OrderStatus, err error) {
+	err = q.QueryRow(`
+		SELECT op.order_id, op.kitchen_status, o.status
+		FROM order_pizza op
+		JOIN orders o ON op.order_id = o.id
+		WHERE op.id = ?`+currentDialect.forUpdate, orderPizzaID).Scan(&orderID, &status, &orderStatus)
+	if err == sql.ErrNoRows {
+		err = ErrKitchenItemNotFound
+	}
+	return orderID, status, orderStatus, err
+}
+
+// StartOrderPizza marks a pizza line as in the oven. The order moves to BAKING with it.
+func StartOrderPizza(orderPizzaID int, actorUserID int) error {
+	tx, err := DATABASE.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	orderID, status, orderStatus, err := getKitchenItem(tx, orderPizzaID)
+	if err != nil {
+		return err
+	}
+	if status != KitchenQueued {
+		return ErrKitchenItemState
+	}
+	if !slices.Contains(kitchenStatuses, orderStatus) {
+		return &IllegalTransitionError{OrderID: orderID, From: orderStatus, To: OrderBaking}
+	}
+
+	_, err = tx.Exec(`UPDATE order_pizza SET kitchen_status = ?, started_at = ? WHERE id = ?`, KitchenStarted, time.Now(), orderPizzaID)
+	if err != nil {
+		return err
+	}
+	if err := advanceOrderTo(tx, orderID, OrderBaking, actorUserID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// FinishOrderPizza marks a pizza line as baked. Once every pizza of the order is, the order is READY for delivery.
+func FinishOrderPizza(orderPizzaID int, actorUserID int) error {
+	tx, err := DATABASE.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	orderID, status, _, err := getKitchenItem(tx, orderPizzaID)
+	if err != nil {
+		return err
+	}
+	if status != KitchenStarted {
+		return ErrKitchenItemState
+	}
+
+	_, err = tx.Exec(`UPDATE order_pizza SET kitchen_status = ?, finished_at = ? WHERE id = ?`, KitchenFinished, time.Now(), orderPizzaID)
+	if err != nil {
+		return err
+	}
+
+	unbaked, err := countUnbakedPizzas(tx, orderID)
+	if err != nil {
+		return err
+	}
+	if unbaked == 0 {
+		if err := advanceOrderTo(tx, orderID, OrderReady, actorUserID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// MarkOrderReady hands an order over to delivery. Needed for orders without pizzas, e.g. only drinks,
+// orders with pizzas become READY by themselves when the last one is finished.
+func MarkOrderReady(orderID int, actorUserID int) error {
+	tx, err := DATABASE.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	unbaked, err := countUnbakedPizzas(tx, orderID)
+	if err != nil {
+		return err
+	}
+	if unbaked > 0 {
+		return ErrPizzasNotBaked
+	}
+	if err := advanceOrderTo(tx, orderID, OrderReady, actorUserID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func countUnbakedPizzas(q queryer, orderID int) (int, error) {
+	var count int
+	err := q.QueryRow(`SELECT COUNT(*) FROM order_pizza WHERE order_id = ? AND kitchen_status <> 'FINISHED'`, orderID).Scan(&count)
+	return count, err
+}
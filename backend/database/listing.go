@@ -0,0 +1,78 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidSort = errors.New("unknown sort column")
+
+// DefaultListLimit and MaxListLimit bound a page of the admin lists.
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 500
+)
+
+// ListOptions pages and sorts a list. The zero value lists every row in the list's default order.
+type ListOptions struct {
+	// Rows per page, 0 lists them all
+	Limit  int
+	Offset int
+	// One of the list's sort keys, blank keeps the default order. ErrInvalidSort names the others.
+	Sort string
+	Desc bool
+}
+
+// sortColumns maps the sort keys of a list to the columns they sort on.
+type sortColumns map[string]string
+
+func (s sortColumns) keys() []string {
+	keys := make([]string, 0, len(s))
+	for key := range s {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// orderBy is the ORDER BY of a page. Sorting on a column adds the id after it, so rows with the same
+// value don't move between pages, defaultOrder has to end on the id itself.
+func (o ListOptions) orderBy(columns sortColumns, defaultOrder, id string) (string, error) {
+	if o.Sort == "" {
+		return " ORDER BY " + defaultOrder, nil
+	}
+	column, ok := columns[o.Sort]
+	if !ok {
+		return "", fmt.Errorf("%w %q, use one of %s", ErrInvalidSort, o.Sort, strings.Join(columns.keys(), ", "))
+	}
+	direction := " ASC"
+	if o.Desc {
+		direction = " DESC"
+	}
+	return " ORDER BY " + column + direction + ", " + id + direction, nil
+}
+
+// page is the LIMIT of a page, blank when the list isn't paged.
+func (o ListOptions) page() (string, []any) {
+	if o.Limit <= 0 {
+		return "", nil
+	}
+	return " LIMIT ? OFFSET ?", []any{o.Limit, max(o.Offset, 0)}
+}
+
+// whereClause joins the conditions of a list, blank when there are none.
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// countRows returns how many rows the list has across all pages.
+func countRows(from, where string, args []any) (int, error) {
+	var total int
+	err := DATABASE.QueryRow("SELECT COUNT(*) FROM "+from+where, args...).Scan(&total)
+	return total, err
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+)
+
+var ErrCustomerNotFound = errors.New("customer not found")
+
+// LoyaltyProgress is how far a customer is towards their next free pizza.
+type LoyaltyProgress struct {
+	Enabled            bool `json:"enabled"`
+	PizzasPerReward    int  `json:"pizzas_per_reward"`
+	PizzaCounter       int  `json:"pizza_counter"`
+	PizzasToNextReward int  `json:"pizzas_to_next_reward"`
+	RewardsAvailable   int  `json:"rewards_available"`
+}
+
+// GetLoyaltyProgress returns the loyalty progress of the customer with this user ID.
+func GetLoyaltyProgress(userID int) (LoyaltyProgress, error) {
+	cfg, err := getPricingConfig(DATABASE)
+	if err != nil {
+		return LoyaltyProgress{}, err
+	}
+
+	var p LoyaltyProgress
+	err = DATABASE.QueryRow(`SELECT pizza_counter, loyalty_rewards FROM customer WHERE user_id = ?`, userID).Scan(&p.PizzaCounter, &p.RewardsAvailable)
+	if err == sql.ErrNoRows {
+		return LoyaltyProgress{}, ErrCustomerNotFound
+	}
+	if err != nil {
+		return LoyaltyProgress{}, err
+	}
+
+	p.PizzasPerReward = cfg.LoyaltyPizzasPerReward
+	p.Enabled = p.PizzasPerReward > 0
+	if p.Enabled {
+		p.PizzasToNextReward = max(p.PizzasPerReward-p.PizzaCounter, 0)
+	}
+	return p, nil
+}
+
+// getLoyaltyRewards is the number of free pizzas the user has earned and not used yet, 0 for non-customers.
+func getLoyaltyRewards(q queryer, userID int) (int, error) {
+	var rewards int
+	err := q.QueryRow(`SELECT loyalty_rewards FROM customer WHERE user_id = ?`, userID).Scan(&rewards)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return rewards, err
+}
+
+// applyLoyaltyReward gives away one unit of the cheapest pizza that isn't free already. One reward is used per order.
+func applyLoyaltyReward(priced *pricedOrder) {
+	cheapestIdx := -1
+	for i, p := range priced.Pizzas {
+		if p.Quantity-p.FreeQuantity <= 0 {
+			continue
+		}
+		if cheapestIdx == -1 || p.UnitPrice.LessThan(priced.Pizzas[cheapestIdx].UnitPrice) {
+			cheapestIdx = i
+		}
+	}
+	if cheapestIdx != -1 {
+		priced.Pizzas[cheapestIdx].RewardQuantity = 1
+		priced.LoyaltyRewardsUsed = 1
+	}
+}
+
+// paidPizzas counts the pizzas the customer pays for, those are what earn loyalty.
+func (o pricedOrder) paidPizzas() int {
+	paid := 0
+	for _, p := range o.Pizzas {
+		paid += p.Quantity - p.FreeQuantity - p.RewardQuantity
+	}
+	return paid
+}
+
+// updateCustomerLoyalty adds pizzas to the customer's counter, turning every pizzasPerReward of them into a reward,
+// and takes off the rewards the order used. Negative pizzas take them back off the counter, and take back rewards
+// that haven't been used yet when the counter runs out. With loyalty off (pizzasPerReward 0) the counter only
+// goes down. Lock the customer row first.
+func updateCustomerLoyalty(q queryer, customerID, pizzas, rewardsUsed, pizzasPerReward int) error {
+	var counter, rewards int
+	err := q.QueryRow(`SELECT pizza_counter, loyalty_rewards FROM customer WHERE id = ?`, customerID).Scan(&counter, &rewards)
+	if err != nil {
+		return err
+	}
+
+	rewards -= rewardsUsed
+	if pizzasPerReward > 0 {
+		counter += pizzas
+		rewards += counter / pizzasPerReward
+		counter %= pizzasPerReward
+		for counter < 0 && rewards > 0 {
+			counter += pizzasPerReward
+			rewards--
+		}
+	} else if pizzas < 0 {
+		// With loyalty off nothing counts towards a reward, but an order that counted before still comes off
+		counter += pizzas
+	}
+	// A reward that is used already can't be taken back, the customer keeps it
+	counter = max(counter, 0)
+	rewards = max(rewards, 0)
+
+	_, err = q.Exec(`UPDATE customer SET pizza_counter = ?, loyalty_rewards = ? WHERE id = ?`, counter, rewards, customerID)
+	return err
+}
+
+// rollbackLoyalty undoes what an order did to the customer's loyalty, when it is cancelled or fails.
+// The pizzas it counted come off the counter and the reward it used is given back.
+func rollbackLoyalty(q queryer, orderID int) error {
+	var customerID, pizzas, rewardsUsed int
+	err := q.QueryRow(`SELECT customer_id, loyalty_pizzas, loyalty_rewards_used FROM orders WHERE id = ?`, orderID).Scan(&customerID, &pizzas, &rewardsUsed)
+	if err != nil {
+		return err
+	}
+	if pizzas == 0 && rewardsUsed == 0 {
+		return nil
+	}
+
+	cfg, err := getPricingConfig(q)
+	if err != nil {
+		return err
+	}
+	var id int
+	if err := q.QueryRow(`SELECT id FROM customer WHERE id = ?`+currentDialect.forUpdate, customerID).Scan(&id); err != nil {
+		return err
+	}
+	if err := updateCustomerLoyalty(q, customerID, -pizzas, -rewardsUsed, cfg.LoyaltyPizzasPerReward); err != nil {
+		return err
+	}
+	_, err = q.Exec(`UPDATE orders SET loyalty_pizzas = 0, loyalty_rewards_used = 0 WHERE id = ?`, orderID)
+	return err
+}
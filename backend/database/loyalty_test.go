@@ -0,0 +1,52 @@
+package database
+
+import "testing"
+
+func createTestCustomer(t *testing.T, username string) int {
+	t.Helper()
+	res, err := DATABASE.Exec(`INSERT INTO user (username, password_hash, salt, role) VALUES (?, 'x', 'x', 'CUSTOMER')`, username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, _ := res.LastInsertId()
+	res, err = DATABASE.Exec(`INSERT INTO customer (user_id, name, gender, address, postal_code) VALUES (?, ?, 'X', 'Main St 1', '1234AB')`, userID, username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	customerID, _ := res.LastInsertId()
+	return int(customerID)
+}
+
+func TestUpdateCustomerLoyalty(t *testing.T) {
+	migrateTestDB(t)
+	customerID := createTestCustomer(t, "loyal")
+
+	check := func(wantCounter, wantRewards int) {
+		t.Helper()
+		var counter, rewards int
+		err := DATABASE.QueryRow(`SELECT pizza_counter, loyalty_rewards FROM customer WHERE id = ?`, customerID).Scan(&counter, &rewards)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if counter != wantCounter || rewards != wantRewards {
+			t.Errorf("counter %d, rewards %d, want %d and %d", counter, rewards, wantCounter, wantRewards)
+		}
+	}
+	update := func(pizzas, rewardsUsed, pizzasPerReward int) {
+		t.Helper()
+		if err := updateCustomerLoyalty(DATABASE, customerID, pizzas, rewardsUsed, pizzasPerReward); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	update(23, 0, 10)
+	check(3, 2)
+	update(-5, 0, 10)
+	check(8, 1)
+
+	// Loyalty off, new pizzas don't count but cancelled ones still come off
+	update(200, 0, 0)
+	check(8, 1)
+	update(-3, 1, 0)
+	check(5, 0)
+}
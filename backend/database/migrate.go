@@ -0,0 +1,308 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrations live in migrations/ as NNNN_name.up.sql / NNNN_name.down.sql, written for MySQL.
+// For SQLite they go through the dialect's translateDDL, and when that isn't enough a
+// NNNN_name.sqlite.up.sql / .down.sql next to them is used instead.
+// Never edit a migration that has been applied somewhere, add a new one instead.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+
+	upOverride   bool
+	downOverride bool
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// loadMigrations reads the embedded migrations, sorted by version.
+func loadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		fileName := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("unexpected migration file %s", fileName)
+		}
+
+		base := strings.TrimSuffix(fileName, "."+direction+".sql")
+		dialectOverride := false
+		if before, variant, found := strings.Cut(base, "."); found {
+			if variant != currentDialect.name {
+				continue
+			}
+			base = before
+			dialectOverride = true
+		}
+		versionStr, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration file %s is not named NNNN_name", fileName)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("migration file %s has a bad version: %w", fileName, err)
+		}
+
+		content, err := migrationFiles.ReadFile("migrations/" + fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, name)
+		}
+		script := string(content)
+		if !dialectOverride {
+			if direction == "up" && m.upOverride || direction == "down" && m.downOverride {
+				continue
+			}
+		}
+		if direction == "up" {
+			m.Up = script
+			m.upOverride = dialectOverride
+		} else {
+			m.Down = script
+			m.downOverride = dialectOverride
+		}
+	}
+
+	var migrations []Migration
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func ensureMigrationsTable() error {
+	_, err := DATABASE.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	return err
+}
+
+func tableExists(name string) (bool, error) {
+	var count int
+	err := DATABASE.QueryRow(currentDialect.countTables, name).Scan(&count)
+	return count > 0, err
+}
+
+// baselineLegacySchema records 0001 as applied on databases made by the old InitDatabaseDev, which created
+// the same tables but had no schema_migrations. Running 0001 there would fail on the existing tables.
+func baselineLegacySchema() error {
+	tracked, err := tableExists("schema_migrations")
+	if err != nil || tracked {
+		return err
+	}
+	legacy, err := tableExists("pizza")
+	if err != nil || !legacy {
+		return err
+	}
+	if err := ensureMigrationsTable(); err != nil {
+		return err
+	}
+	log.Printf("Found a database without schema_migrations, recording 0001_initial_schema as applied")
+	_, err = DATABASE.Exec(`INSERT INTO schema_migrations (version, name) VALUES (1, 'initial_schema')`)
+	return err
+}
+
+func appliedMigrations() (map[int]time.Time, error) {
+	if err := baselineLegacySchema(); err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := DATABASE.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// splitStatements splits a migration file into single statements, since the driver runs one at a time.
+// Statements end with a ; at the end of a line, so keep semicolons inside strings off line endings.
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
+
+// runMigrationScript runs the whole script on one connection, so per-connection settings
+// such as SQLite's PRAGMA foreign_keys stay in effect between its statements.
+func runMigrationScript(script string, isOverrideScript bool) error {
+	ctx := context.Background()
+	conn, err := DATABASE.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, statement := range splitStatements(script) {
+		if !isOverrideScript {
+			statement = currentDialect.translateDDL(statement)
+		}
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("%w\nin statement:\n%s", err, statement)
+		}
+	}
+	return nil
+}
+
+// MigrateUp applies every pending migration in order. It returns how many were applied.
+func MigrateUp() (int, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		log.Printf("Applying migration %04d_%s", m.Version, m.Name)
+		if err := runMigrationScript(m.Up, m.upOverride); err != nil {
+			return count, fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+		_, err := DATABASE.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.Version, m.Name)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// MigrateDown rolls back the last `steps` applied migrations, newest first.
+func MigrateDown(steps int) (int, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return count, fmt.Errorf("migration %04d_%s can't be rolled back, it has no down file", m.Version, m.Name)
+		}
+		log.Printf("Rolling back migration %04d_%s", m.Version, m.Name)
+		if err := runMigrationScript(m.Down, m.downOverride); err != nil {
+			return count, fmt.Errorf("rollback of %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+		_, err := DATABASE.Exec(`DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// GetMigrationStatus lists every known migration and whether it has been applied.
+func GetMigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if appliedAt, ok := applied[m.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
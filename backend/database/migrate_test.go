@@ -0,0 +1,60 @@
+package database
+
+import "testing"
+
+func TestMigrateUpOnLegacySchema(t *testing.T) {
+	openTestDB(t)
+
+	// 0001 holds the tables InitDatabaseDev used to create, without schema_migrations
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runMigrationScript(migrations[0].Up, migrations[0].upOverride); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DATABASE.Exec(`INSERT INTO pizza (name) VALUES ('Margherita')`); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := MigrateUp()
+	if err != nil {
+		t.Fatalf("MigrateUp on a legacy database: %v", err)
+	}
+	if applied != len(migrations)-1 {
+		t.Errorf("applied %d migrations, want %d", applied, len(migrations)-1)
+	}
+
+	var name string
+	if err := DATABASE.QueryRow(`SELECT name FROM pizza`).Scan(&name); err != nil || name != "Margherita" {
+		t.Errorf("existing pizza = %q, %v, want Margherita", name, err)
+	}
+	statuses, err := GetMigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if !status.Applied {
+			t.Errorf("migration %04d_%s is not applied", status.Version, status.Name)
+		}
+	}
+}
+
+func TestMigrateUpOnEmptyDatabase(t *testing.T) {
+	openTestDB(t)
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err := MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != len(migrations) {
+		t.Errorf("applied %d migrations, want %d", applied, len(migrations))
+	}
+	if applied, err := MigrateUp(); err != nil || applied != 0 {
+		t.Errorf("second MigrateUp applied %d, %v, want 0", applied, err)
+	}
+}
@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS discount_usage;
+DROP TABLE IF EXISTS order_extra_item;
+DROP TABLE IF EXISTS order_pizza;
+DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS delivery_person;
+DROP TABLE IF EXISTS discount_code;
+DROP TABLE IF EXISTS extra_item;
+DROP TABLE IF EXISTS customer;
+DROP TABLE IF EXISTS user;
+DROP TABLE IF EXISTS pizza_ingredient;
+DROP TABLE IF EXISTS ingredient;
+DROP TABLE IF EXISTS pizza;
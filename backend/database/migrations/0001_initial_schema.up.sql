@@ -0,0 +1,129 @@
+CREATE TABLE pizza (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	name VARCHAR(255) NOT NULL UNIQUE
+);
+
+CREATE TABLE ingredient(
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	name VARCHAR(255) NOT NULL UNIQUE,
+	cost DECIMAL(10, 2) NOT NULL CHECK (cost > 0),
+	has_meat BOOLEAN NOT NULL,
+	has_animal_products BOOLEAN NOT NULL
+);
+
+CREATE TABLE pizza_ingredient(
+	pizza_id INT NOT NULL,
+	ingredient_id INT NOT NULL,
+
+	PRIMARY KEY (pizza_id, ingredient_id),
+	FOREIGN KEY (pizza_id) REFERENCES pizza(id)
+		ON DELETE CASCADE,
+	FOREIGN KEY (ingredient_id) REFERENCES ingredient(id)
+		ON DELETE CASCADE
+);
+
+CREATE TABLE user(
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	username VARCHAR(100) NOT NULL UNIQUE,
+	password_hash VARCHAR(256) NOT NULL,
+	salt VARCHAR(256) NOT NULL,
+	role ENUM('ADMIN', 'DELIVERY', 'CUSTOMER') NOT NULL
+);
+
+CREATE TABLE customer(
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	name VARCHAR(100) NOT NULL,
+	gender VARCHAR(50) NOT NULL,
+	birth_date DATE,
+	address VARCHAR(256) NOT NULL,
+	postal_code VARCHAR(10) NOT NULL,
+	pizza_counter TINYINT NOT NULL DEFAULT 0,
+
+	FOREIGN KEY (user_id) REFERENCES user(id)
+);
+
+CREATE TABLE discount_code (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	code VARCHAR(50) NOT NULL UNIQUE,
+	discount_percentage INT NOT NULL CHECK (discount_percentage > 0 AND discount_percentage <= 100),
+	is_active BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+CREATE TABLE delivery_person(
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	name VARCHAR(100) NOT NULL,
+	user_id BIGINT NOT NULL,
+	vehicle_type VARCHAR(50) DEFAULT 'bike',
+	unavailable_until TIMESTAMP NULL DEFAULT NULL,
+
+	FOREIGN KEY (user_id) REFERENCES user(id)
+);
+
+CREATE TABLE orders(
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	customer_id BIGINT NOT NULL,
+	timestamp TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	status ENUM('IN_PROGRESS', 'OUT_FOR_DELIVERY', 'DELIVERED', 'FAILED') NOT NULL,
+	postal_code VARCHAR(10) NOT NULL,
+	delivery_address VARCHAR(256) NOT NULL,
+	discount_code_id INT DEFAULT NULL,
+	delivery_person_id BIGINT DEFAULT NULL,
+	discount_percentage INT NOT NULL DEFAULT 0,
+	total_price DECIMAL(10, 2) NOT NULL DEFAULT 0,
+
+	FOREIGN KEY (customer_id) REFERENCES customer(id),
+	FOREIGN KEY (discount_code_id) REFERENCES discount_code(id),
+	FOREIGN KEY (delivery_person_id) REFERENCES delivery_person(id)
+);
+
+CREATE TABLE order_pizza (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	order_id BIGINT NOT NULL,
+	pizza_id INT NOT NULL,
+	quantity INT NOT NULL CHECK (quantity > 0),
+	free_quantity INT NOT NULL DEFAULT 0,
+	unit_price DECIMAL(10, 2) NOT NULL,
+	margin_rate DECIMAL(5, 4) NOT NULL,
+	vat_rate DECIMAL(5, 4) NOT NULL,
+	FOREIGN KEY (order_id) REFERENCES orders(id),
+	FOREIGN KEY (pizza_id) REFERENCES pizza(id)
+);
+
+CREATE TABLE extra_item (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	category ENUM('dessert', 'drink') NOT NULL,
+	price DECIMAL(10, 2) NOT NULL CHECK (price >= 0)
+);
+
+CREATE TABLE order_extra_item (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	order_id BIGINT NOT NULL,
+	extra_item_id INT NOT NULL,
+	quantity INT NOT NULL CHECK (quantity > 0),
+	free_quantity INT NOT NULL DEFAULT 0,
+	unit_price DECIMAL(10, 2) NOT NULL,
+	vat_rate DECIMAL(5, 4) NOT NULL,
+	FOREIGN KEY (order_id) REFERENCES orders(id),
+	FOREIGN KEY (extra_item_id) REFERENCES extra_item(id)
+);
+
+CREATE TABLE discount_usage (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	discount_code_id INT NOT NULL,
+	used_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES user(id),
+	FOREIGN KEY (discount_code_id) REFERENCES discount_code(id),
+	UNIQUE KEY unique_user_discount (user_id, discount_code_id)
+);
+
+CREATE TABLE sessions (
+	token_hash CHAR(64) PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES user(id)
+		ON DELETE CASCADE
+);
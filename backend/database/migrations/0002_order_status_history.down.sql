@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS order_status_history;
+
+ALTER TABLE orders MODIFY status ENUM('IN_PROGRESS', 'PLACED', 'CONFIRMED', 'IN_KITCHEN', 'BAKING', 'READY', 'OUT_FOR_DELIVERY', 'DELIVERED', 'FAILED', 'CANCELLED') NOT NULL;
+
+UPDATE orders SET status = 'IN_PROGRESS' WHERE status IN ('PLACED', 'CONFIRMED', 'IN_KITCHEN', 'BAKING', 'READY');
+UPDATE orders SET status = 'FAILED' WHERE status = 'CANCELLED';
+
+ALTER TABLE orders MODIFY status ENUM('IN_PROGRESS', 'OUT_FOR_DELIVERY', 'DELIVERED', 'FAILED') NOT NULL;
@@ -0,0 +1,34 @@
+DROP TABLE IF EXISTS order_status_history;
+
+PRAGMA foreign_keys = OFF;
+
+CREATE TABLE orders_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	customer_id BIGINT NOT NULL,
+	timestamp TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	status TEXT CHECK (status IN ('IN_PROGRESS', 'OUT_FOR_DELIVERY', 'DELIVERED', 'FAILED')) NOT NULL,
+	postal_code VARCHAR(10) NOT NULL,
+	delivery_address VARCHAR(256) NOT NULL,
+	discount_code_id INT DEFAULT NULL,
+	delivery_person_id BIGINT DEFAULT NULL,
+	discount_percentage INT NOT NULL DEFAULT 0,
+	total_price DECIMAL(10, 2) NOT NULL DEFAULT 0,
+
+	FOREIGN KEY (customer_id) REFERENCES customer(id),
+	FOREIGN KEY (discount_code_id) REFERENCES discount_code(id),
+	FOREIGN KEY (delivery_person_id) REFERENCES delivery_person(id)
+);
+
+INSERT INTO orders_old (id, customer_id, timestamp, status, postal_code, delivery_address, discount_code_id, delivery_person_id, discount_percentage, total_price)
+SELECT id, customer_id, timestamp,
+       CASE WHEN status IN ('PLACED', 'CONFIRMED', 'IN_KITCHEN', 'BAKING', 'READY') THEN 'IN_PROGRESS'
+            WHEN status = 'CANCELLED' THEN 'FAILED'
+            ELSE status END,
+       postal_code, delivery_address, discount_code_id, delivery_person_id, discount_percentage, total_price
+FROM orders;
+
+DROP TABLE orders;
+
+ALTER TABLE orders_old RENAME TO orders;
+
+PRAGMA foreign_keys = ON;
@@ -0,0 +1,44 @@
+-- SQLite can't change a CHECK constraint in place, so the orders table is rebuilt.
+PRAGMA foreign_keys = OFF;
+
+CREATE TABLE orders_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	customer_id BIGINT NOT NULL,
+	timestamp TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	status TEXT CHECK (status IN ('PLACED', 'CONFIRMED', 'IN_KITCHEN', 'BAKING', 'READY', 'OUT_FOR_DELIVERY', 'DELIVERED', 'FAILED', 'CANCELLED')) NOT NULL,
+	postal_code VARCHAR(10) NOT NULL,
+	delivery_address VARCHAR(256) NOT NULL,
+	discount_code_id INT DEFAULT NULL,
+	delivery_person_id BIGINT DEFAULT NULL,
+	discount_percentage INT NOT NULL DEFAULT 0,
+	total_price DECIMAL(10, 2) NOT NULL DEFAULT 0,
+
+	FOREIGN KEY (customer_id) REFERENCES customer(id),
+	FOREIGN KEY (discount_code_id) REFERENCES discount_code(id),
+	FOREIGN KEY (delivery_person_id) REFERENCES delivery_person(id)
+);
+
+INSERT INTO orders_new (id, customer_id, timestamp, status, postal_code, delivery_address, discount_code_id, delivery_person_id, discount_percentage, total_price)
+SELECT id, customer_id, timestamp, CASE status WHEN 'IN_PROGRESS' THEN 'READY' ELSE status END,
+       postal_code, delivery_address, discount_code_id, delivery_person_id, discount_percentage, total_price
+FROM orders;
+
+DROP TABLE orders;
+
+ALTER TABLE orders_new RENAME TO orders;
+
+PRAGMA foreign_keys = ON;
+
+CREATE TABLE order_status_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	order_id BIGINT NOT NULL,
+	from_status VARCHAR(32) DEFAULT NULL,
+	to_status VARCHAR(32) NOT NULL,
+	changed_by BIGINT DEFAULT NULL,
+	changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+	FOREIGN KEY (order_id) REFERENCES orders(id)
+		ON DELETE CASCADE,
+	FOREIGN KEY (changed_by) REFERENCES user(id)
+		ON DELETE SET NULL
+);
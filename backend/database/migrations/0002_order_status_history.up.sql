@@ -0,0 +1,20 @@
+-- Orders follow a real lifecycle now. IN_PROGRESS orders were waiting for a courier, so they become READY.
+ALTER TABLE orders MODIFY status ENUM('IN_PROGRESS', 'PLACED', 'CONFIRMED', 'IN_KITCHEN', 'BAKING', 'READY', 'OUT_FOR_DELIVERY', 'DELIVERED', 'FAILED', 'CANCELLED') NOT NULL;
+
+UPDATE orders SET status = 'READY' WHERE status = 'IN_PROGRESS';
+
+ALTER TABLE orders MODIFY status ENUM('PLACED', 'CONFIRMED', 'IN_KITCHEN', 'BAKING', 'READY', 'OUT_FOR_DELIVERY', 'DELIVERED', 'FAILED', 'CANCELLED') NOT NULL;
+
+CREATE TABLE order_status_history (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	order_id BIGINT NOT NULL,
+	from_status VARCHAR(32) DEFAULT NULL,
+	to_status VARCHAR(32) NOT NULL,
+	changed_by BIGINT DEFAULT NULL,
+	changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+	FOREIGN KEY (order_id) REFERENCES orders(id)
+		ON DELETE CASCADE,
+	FOREIGN KEY (changed_by) REFERENCES user(id)
+		ON DELETE SET NULL
+);
@@ -0,0 +1,2 @@
+-- Why a status change happened, e.g. the reason an admin gave for cancelling an order.
+ALTER TABLE order_status_history ADD COLUMN reason VARCHAR(255) DEFAULT NULL;
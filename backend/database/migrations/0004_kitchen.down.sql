@@ -0,0 +1,6 @@
+ALTER TABLE order_pizza DROP COLUMN finished_at;
+ALTER TABLE order_pizza DROP COLUMN started_at;
+ALTER TABLE order_pizza DROP COLUMN kitchen_status;
+
+DELETE FROM user WHERE role = 'KITCHEN';
+ALTER TABLE user MODIFY role ENUM('ADMIN', 'DELIVERY', 'CUSTOMER') NOT NULL;
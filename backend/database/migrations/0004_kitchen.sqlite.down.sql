@@ -0,0 +1,24 @@
+ALTER TABLE order_pizza DROP COLUMN finished_at;
+ALTER TABLE order_pizza DROP COLUMN started_at;
+ALTER TABLE order_pizza DROP COLUMN kitchen_status;
+
+DELETE FROM user WHERE role = 'KITCHEN';
+
+PRAGMA foreign_keys = OFF;
+
+CREATE TABLE user_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username VARCHAR(100) NOT NULL UNIQUE,
+	password_hash VARCHAR(256) NOT NULL,
+	salt VARCHAR(256) NOT NULL,
+	role TEXT CHECK (role IN ('ADMIN', 'DELIVERY', 'CUSTOMER')) NOT NULL
+);
+
+INSERT INTO user_old (id, username, password_hash, salt, role)
+SELECT id, username, password_hash, salt, role FROM user;
+
+DROP TABLE user;
+
+ALTER TABLE user_old RENAME TO user;
+
+PRAGMA foreign_keys = ON;
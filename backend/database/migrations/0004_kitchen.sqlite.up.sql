@@ -0,0 +1,28 @@
+-- SQLite can't change a CHECK constraint in place, so the user table is rebuilt.
+PRAGMA foreign_keys = OFF;
+
+CREATE TABLE user_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username VARCHAR(100) NOT NULL UNIQUE,
+	password_hash VARCHAR(256) NOT NULL,
+	salt VARCHAR(256) NOT NULL,
+	role TEXT CHECK (role IN ('ADMIN', 'DELIVERY', 'CUSTOMER', 'KITCHEN')) NOT NULL
+);
+
+INSERT INTO user_new (id, username, password_hash, salt, role)
+SELECT id, username, password_hash, salt, role FROM user;
+
+DROP TABLE user;
+
+ALTER TABLE user_new RENAME TO user;
+
+PRAGMA foreign_keys = ON;
+
+-- Kitchen progress of every pizza line
+ALTER TABLE order_pizza ADD COLUMN kitchen_status TEXT CHECK (kitchen_status IN ('QUEUED', 'STARTED', 'FINISHED')) NOT NULL DEFAULT 'QUEUED';
+ALTER TABLE order_pizza ADD COLUMN started_at TIMESTAMP NULL DEFAULT NULL;
+ALTER TABLE order_pizza ADD COLUMN finished_at TIMESTAMP NULL DEFAULT NULL;
+
+-- Orders that already left the kitchen count as baked
+UPDATE order_pizza SET kitchen_status = 'FINISHED'
+WHERE order_id IN (SELECT id FROM orders WHERE status IN ('READY', 'OUT_FOR_DELIVERY', 'DELIVERED', 'FAILED'));
@@ -0,0 +1,10 @@
+ALTER TABLE user MODIFY role ENUM('ADMIN', 'DELIVERY', 'CUSTOMER', 'KITCHEN') NOT NULL;
+
+-- Kitchen progress of every pizza line
+ALTER TABLE order_pizza ADD COLUMN kitchen_status ENUM('QUEUED', 'STARTED', 'FINISHED') NOT NULL DEFAULT 'QUEUED';
+ALTER TABLE order_pizza ADD COLUMN started_at TIMESTAMP NULL DEFAULT NULL;
+ALTER TABLE order_pizza ADD COLUMN finished_at TIMESTAMP NULL DEFAULT NULL;
+
+-- Orders that already left the kitchen count as baked
+UPDATE order_pizza SET kitchen_status = 'FINISHED'
+WHERE order_id IN (SELECT id FROM orders WHERE status IN ('READY', 'OUT_FOR_DELIVERY', 'DELIVERED', 'FAILED'));
@@ -0,0 +1,5 @@
+ALTER TABLE pizza_ingredient DROP COLUMN amount;
+
+ALTER TABLE ingredient DROP COLUMN low_stock_threshold;
+ALTER TABLE ingredient DROP COLUMN stock;
+ALTER TABLE ingredient DROP COLUMN unit;
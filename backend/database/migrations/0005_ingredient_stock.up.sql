@@ -0,0 +1,10 @@
+-- Stock per ingredient, counted in its unit. Below low_stock_threshold it shows up as low in the admin stock view.
+ALTER TABLE ingredient ADD COLUMN unit VARCHAR(20) NOT NULL DEFAULT 'g';
+ALTER TABLE ingredient ADD COLUMN stock DECIMAL(10,2) NOT NULL DEFAULT 0;
+ALTER TABLE ingredient ADD COLUMN low_stock_threshold DECIMAL(10,2) NOT NULL DEFAULT 0;
+
+-- How much of the ingredient, in its unit, goes on one pizza
+ALTER TABLE pizza_ingredient ADD COLUMN amount DECIMAL(10,2) NOT NULL DEFAULT 100;
+
+-- Existing ingredients start stocked, so the menu doesn't empty out on upgrade. Count and correct them afterwards.
+UPDATE ingredient SET stock = 10000, low_stock_threshold = 1000;
@@ -0,0 +1,7 @@
+ALTER TABLE order_pizza DROP FOREIGN KEY fk_order_pizza_crust;
+ALTER TABLE order_pizza DROP FOREIGN KEY fk_order_pizza_size;
+ALTER TABLE order_pizza DROP COLUMN crust_id;
+ALTER TABLE order_pizza DROP COLUMN size_id;
+
+DROP TABLE crust_type;
+DROP TABLE pizza_size;
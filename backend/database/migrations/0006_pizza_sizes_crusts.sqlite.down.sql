@@ -0,0 +1,5 @@
+ALTER TABLE order_pizza DROP COLUMN crust_id;
+ALTER TABLE order_pizza DROP COLUMN size_id;
+
+DROP TABLE crust_type;
+DROP TABLE pizza_size;
@@ -0,0 +1,41 @@
+-- Sizes and crusts each add their dough cost and scale the ingredients (cost and stock used) by their multiplier.
+-- The default ones are what a pizza costs when no size or crust is picked.
+CREATE TABLE pizza_size (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name VARCHAR(50) NOT NULL UNIQUE,
+	dough_cost DECIMAL(10, 2) NOT NULL CHECK (dough_cost >= 0),
+	ingredient_multiplier DECIMAL(5, 2) NOT NULL CHECK (ingredient_multiplier > 0),
+	is_default BOOLEAN NOT NULL DEFAULT FALSE,
+	sort_order INT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE crust_type (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name VARCHAR(50) NOT NULL UNIQUE,
+	dough_cost DECIMAL(10, 2) NOT NULL CHECK (dough_cost >= 0),
+	ingredient_multiplier DECIMAL(5, 2) NOT NULL CHECK (ingredient_multiplier > 0),
+	is_default BOOLEAN NOT NULL DEFAULT FALSE,
+	sort_order INT NOT NULL DEFAULT 0
+);
+
+-- Medium with a classic crust costs what every pizza cost before
+INSERT INTO pizza_size (name, dough_cost, ingredient_multiplier, is_default, sort_order) VALUES
+	('Small', 4.00, 0.75, FALSE, 1),
+	('Medium', 5.00, 1.00, TRUE, 2),
+	('Large', 6.50, 1.30, FALSE, 3),
+	('Family', 9.00, 2.00, FALSE, 4);
+
+INSERT INTO crust_type (name, dough_cost, ingredient_multiplier, is_default, sort_order) VALUES
+	('Classic', 0.00, 1.00, TRUE, 1),
+	('Thin', 0.00, 0.90, FALSE, 2),
+	('Stuffed', 2.00, 1.10, FALSE, 3),
+	('Gluten free', 1.50, 1.00, FALSE, 4);
+
+-- The variant every pizza line was made in. SQLite can't add a constraint to an existing table,
+-- so unlike on MySQL the columns stay nullable, the code always fills them.
+ALTER TABLE order_pizza ADD COLUMN size_id INTEGER REFERENCES pizza_size(id);
+ALTER TABLE order_pizza ADD COLUMN crust_id INTEGER REFERENCES crust_type(id);
+
+UPDATE order_pizza SET
+	size_id = (SELECT id FROM pizza_size WHERE name = 'Medium'),
+	crust_id = (SELECT id FROM crust_type WHERE name = 'Classic');
@@ -0,0 +1,9 @@
+-- The base stays if it has been ordered, order_pizza still refers to it
+DELETE FROM pizza WHERE name = 'Build your own' AND id NOT IN (SELECT pizza_id FROM order_pizza);
+
+ALTER TABLE order_pizza DROP COLUMN is_vegan;
+ALTER TABLE order_pizza DROP COLUMN is_vegetarian;
+
+ALTER TABLE ingredient DROP COLUMN portion;
+
+DROP TABLE order_pizza_modifier;
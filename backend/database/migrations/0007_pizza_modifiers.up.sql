@@ -0,0 +1,32 @@
+-- Toppings a customer added to or took off one pizza line. Adding one the recipe already has means extra of it.
+CREATE TABLE order_pizza_modifier (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	order_pizza_id BIGINT NOT NULL,
+	ingredient_id INT NOT NULL,
+	action ENUM('ADD', 'REMOVE') NOT NULL,
+	UNIQUE KEY uq_order_pizza_ingredient (order_pizza_id, ingredient_id),
+	FOREIGN KEY (order_pizza_id) REFERENCES order_pizza(id) ON DELETE CASCADE,
+	FOREIGN KEY (ingredient_id) REFERENCES ingredient(id)
+);
+
+-- How much of an ingredient, in its unit, goes on a pizza when a customer adds it
+ALTER TABLE ingredient ADD COLUMN portion DECIMAL(10,2) NOT NULL DEFAULT 100;
+
+-- The diet of every pizza line as it was made, modifiers included
+ALTER TABLE order_pizza ADD COLUMN is_vegetarian BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE order_pizza ADD COLUMN is_vegan BOOLEAN NOT NULL DEFAULT TRUE;
+
+UPDATE order_pizza SET
+	is_vegetarian = NOT EXISTS (
+		SELECT 1 FROM pizza_ingredient pi JOIN ingredient i ON pi.ingredient_id = i.id
+		WHERE pi.pizza_id = order_pizza.pizza_id AND i.has_meat
+	),
+	is_vegan = NOT EXISTS (
+		SELECT 1 FROM pizza_ingredient pi JOIN ingredient i ON pi.ingredient_id = i.id
+		WHERE pi.pizza_id = order_pizza.pizza_id AND (i.has_meat OR i.has_animal_products)
+	);
+
+-- An empty base to build a pizza from scratch on. Rolling back keeps it once it has been ordered.
+INSERT INTO pizza (name)
+SELECT 'Build your own' FROM (SELECT 1 AS one) AS base
+WHERE NOT EXISTS (SELECT 1 FROM pizza WHERE name = 'Build your own');
@@ -0,0 +1,2 @@
+DROP TABLE pricing_config_history;
+DROP TABLE pricing_config;
@@ -0,0 +1,32 @@
+-- The pricing rules, a single row. Extra items have a fixed price that includes VAT, their VAT rate only splits it out.
+-- Dough costs are per size and crust (pizza_size, crust_type).
+CREATE TABLE pricing_config (
+	id INT PRIMARY KEY,
+	pizza_margin_rate DECIMAL(5, 4) NOT NULL CHECK (pizza_margin_rate >= 0),
+	pizza_vat_rate DECIMAL(5, 4) NOT NULL CHECK (pizza_vat_rate >= 0),
+	dessert_vat_rate DECIMAL(5, 4) NOT NULL CHECK (dessert_vat_rate >= 0),
+	drink_vat_rate DECIMAL(5, 4) NOT NULL CHECK (drink_vat_rate >= 0),
+	rounding_mode ENUM('HALF_UP', 'HALF_EVEN', 'UP', 'DOWN') NOT NULL DEFAULT 'HALF_UP',
+	updated_at TIMESTAMP NULL DEFAULT NULL,
+	updated_by BIGINT DEFAULT NULL,
+
+	FOREIGN KEY (updated_by) REFERENCES user(id)
+		ON DELETE SET NULL
+);
+
+-- What was hardcoded until now
+INSERT INTO pricing_config (id, pizza_margin_rate, pizza_vat_rate, dessert_vat_rate, drink_vat_rate, rounding_mode)
+VALUES (1, 0.40, 0.09, 0.09, 0.09, 'HALF_UP');
+
+-- Every change to a setting, with who made it
+CREATE TABLE pricing_config_history (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	setting VARCHAR(50) NOT NULL,
+	old_value VARCHAR(20) NOT NULL,
+	new_value VARCHAR(20) NOT NULL,
+	changed_by BIGINT DEFAULT NULL,
+	changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+	FOREIGN KEY (changed_by) REFERENCES user(id)
+		ON DELETE SET NULL
+);
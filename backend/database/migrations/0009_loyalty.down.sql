@@ -0,0 +1,8 @@
+ALTER TABLE order_pizza DROP COLUMN reward_quantity;
+
+ALTER TABLE orders DROP COLUMN loyalty_rewards_used;
+ALTER TABLE orders DROP COLUMN loyalty_pizzas;
+
+ALTER TABLE customer DROP COLUMN loyalty_rewards;
+
+ALTER TABLE pricing_config DROP COLUMN loyalty_pizzas_per_reward;
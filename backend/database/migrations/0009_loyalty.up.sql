@@ -0,0 +1,13 @@
+-- Every N paid pizzas earn a free pizza, 0 turns the loyalty program off
+ALTER TABLE pricing_config ADD COLUMN loyalty_pizzas_per_reward TINYINT NOT NULL DEFAULT 10;
+
+-- customer.pizza_counter counts the paid pizzas towards the next reward, loyalty_rewards are earned but not used yet.
+-- Orders placed before this migration don't count.
+ALTER TABLE customer ADD COLUMN loyalty_rewards INT NOT NULL DEFAULT 0;
+
+-- What the order added to and took from the customer's loyalty, so cancelling it can give it back
+ALTER TABLE orders ADD COLUMN loyalty_pizzas INT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN loyalty_rewards_used INT NOT NULL DEFAULT 0;
+
+-- Units of the pizza line given away as a loyalty reward, like free_quantity is for birthday freebies
+ALTER TABLE order_pizza ADD COLUMN reward_quantity INT NOT NULL DEFAULT 0;
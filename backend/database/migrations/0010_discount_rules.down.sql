@@ -0,0 +1,28 @@
+ALTER TABLE order_extra_item DROP COLUMN discounted;
+ALTER TABLE order_pizza DROP COLUMN discounted;
+ALTER TABLE orders DROP COLUMN discount_amount;
+
+-- Back to one use per customer and code
+DELETE FROM discount_usage WHERE id NOT IN (
+	SELECT id FROM (SELECT MIN(id) AS id FROM discount_usage GROUP BY user_id, discount_code_id) AS first_use
+);
+ALTER TABLE discount_usage DROP FOREIGN KEY fk_discount_usage_order;
+ALTER TABLE discount_usage DROP COLUMN order_id;
+ALTER TABLE discount_usage ADD UNIQUE KEY unique_user_discount (user_id, discount_code_id);
+ALTER TABLE discount_usage DROP INDEX idx_discount_usage_user;
+
+DROP TABLE discount_code_item;
+
+ALTER TABLE discount_code DROP COLUMN scope;
+ALTER TABLE discount_code DROP COLUMN min_order_value;
+ALTER TABLE discount_code DROP COLUMN max_uses_per_customer;
+ALTER TABLE discount_code DROP COLUMN max_uses;
+ALTER TABLE discount_code DROP COLUMN valid_until;
+ALTER TABLE discount_code DROP COLUMN valid_from;
+ALTER TABLE discount_code DROP COLUMN discount_amount;
+ALTER TABLE discount_code DROP COLUMN discount_type;
+
+-- Fixed amount codes can't be expressed anymore, they are turned off
+UPDATE discount_code SET discount_percentage = 1, is_active = FALSE WHERE discount_percentage = 0;
+ALTER TABLE discount_code DROP CHECK chk_discount_percentage;
+ALTER TABLE discount_code ADD CONSTRAINT discount_code_chk_1 CHECK (discount_percentage > 0 AND discount_percentage <= 100);
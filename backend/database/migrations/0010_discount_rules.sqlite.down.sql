@@ -0,0 +1,48 @@
+ALTER TABLE order_extra_item DROP COLUMN discounted;
+ALTER TABLE order_pizza DROP COLUMN discounted;
+ALTER TABLE orders DROP COLUMN discount_amount;
+
+DROP TABLE discount_code_item;
+
+-- Back to one use per customer and code
+DELETE FROM discount_usage WHERE id NOT IN (
+	SELECT MIN(id) FROM discount_usage GROUP BY user_id, discount_code_id
+);
+
+-- Fixed amount codes can't be expressed anymore, they are turned off
+UPDATE discount_code SET discount_percentage = 1, is_active = FALSE WHERE discount_percentage = 0;
+
+PRAGMA foreign_keys = OFF;
+
+CREATE TABLE discount_usage_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id BIGINT NOT NULL,
+	discount_code_id INT NOT NULL,
+	used_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES user(id),
+	FOREIGN KEY (discount_code_id) REFERENCES discount_code(id),
+	UNIQUE (user_id, discount_code_id)
+);
+
+INSERT INTO discount_usage_old (id, user_id, discount_code_id, used_at)
+SELECT id, user_id, discount_code_id, used_at FROM discount_usage;
+
+DROP TABLE discount_usage;
+
+ALTER TABLE discount_usage_old RENAME TO discount_usage;
+
+CREATE TABLE discount_code_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	code VARCHAR(50) NOT NULL UNIQUE,
+	discount_percentage INT NOT NULL CHECK (discount_percentage > 0 AND discount_percentage <= 100),
+	is_active BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+INSERT INTO discount_code_old (id, code, discount_percentage, is_active)
+SELECT id, code, discount_percentage, is_active FROM discount_code;
+
+DROP TABLE discount_code;
+
+ALTER TABLE discount_code_old RENAME TO discount_code;
+
+PRAGMA foreign_keys = ON;
@@ -0,0 +1,73 @@
+-- SQLite can't change a CHECK constraint or drop a UNIQUE one in place,
+-- so discount_code and discount_usage are rebuilt.
+PRAGMA foreign_keys = OFF;
+
+CREATE TABLE discount_code_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	code VARCHAR(50) NOT NULL UNIQUE,
+	discount_percentage INT NOT NULL CHECK (discount_percentage >= 0 AND discount_percentage <= 100),
+	is_active BOOLEAN NOT NULL DEFAULT TRUE,
+	discount_type TEXT CHECK (discount_type IN ('PERCENTAGE', 'FIXED')) NOT NULL DEFAULT 'PERCENTAGE',
+	discount_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+	-- NULL means no limit
+	valid_from TIMESTAMP NULL DEFAULT NULL,
+	valid_until TIMESTAMP NULL DEFAULT NULL,
+	max_uses INT DEFAULT NULL,
+	max_uses_per_customer INT DEFAULT 1,
+	-- What the order has to be worth after freebies, before the code
+	min_order_value DECIMAL(10, 2) NOT NULL DEFAULT 0,
+	-- What the code takes money off, ITEMS means the pizzas and extra items in discount_code_item
+	scope TEXT CHECK (scope IN ('ORDER', 'PIZZAS', 'DRINKS', 'DESSERTS', 'ITEMS')) NOT NULL DEFAULT 'ORDER'
+);
+
+INSERT INTO discount_code_new (id, code, discount_percentage, is_active)
+SELECT id, code, discount_percentage, is_active FROM discount_code;
+
+DROP TABLE discount_code;
+
+ALTER TABLE discount_code_new RENAME TO discount_code;
+
+-- A customer can use a code more than once, every use belongs to an order
+CREATE TABLE discount_usage_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id BIGINT NOT NULL,
+	discount_code_id INT NOT NULL,
+	used_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	order_id BIGINT DEFAULT NULL,
+	FOREIGN KEY (user_id) REFERENCES user(id),
+	FOREIGN KEY (discount_code_id) REFERENCES discount_code(id),
+	FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE
+);
+
+INSERT INTO discount_usage_new (id, user_id, discount_code_id, used_at)
+SELECT id, user_id, discount_code_id, used_at FROM discount_usage;
+
+DROP TABLE discount_usage;
+
+ALTER TABLE discount_usage_new RENAME TO discount_usage;
+
+CREATE INDEX idx_discount_usage_user ON discount_usage (user_id, discount_code_id);
+
+PRAGMA foreign_keys = ON;
+
+UPDATE discount_usage SET order_id = (
+	SELECT MIN(o.id) FROM orders o
+	JOIN customer c ON o.customer_id = c.id
+	WHERE c.user_id = discount_usage.user_id AND o.discount_code_id = discount_usage.discount_code_id
+);
+
+CREATE TABLE discount_code_item (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	discount_code_id INT NOT NULL,
+	pizza_id INT DEFAULT NULL,
+	extra_item_id INT DEFAULT NULL,
+	CHECK ((pizza_id IS NULL) <> (extra_item_id IS NULL)),
+	FOREIGN KEY (discount_code_id) REFERENCES discount_code(id) ON DELETE CASCADE,
+	FOREIGN KEY (pizza_id) REFERENCES pizza(id) ON DELETE CASCADE,
+	FOREIGN KEY (extra_item_id) REFERENCES extra_item(id) ON DELETE CASCADE
+);
+
+-- The fixed amount the order's code took off, and which lines the code applied to
+ALTER TABLE orders ADD COLUMN discount_amount DECIMAL(10, 2) NOT NULL DEFAULT 0;
+ALTER TABLE order_pizza ADD COLUMN discounted BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE order_extra_item ADD COLUMN discounted BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,45 @@
+-- A code takes a percentage or a fixed amount off, so the percentage can be 0 now.
+-- MySQL names the unnamed column CHECK of the first migration discount_code_chk_1.
+ALTER TABLE discount_code DROP CHECK discount_code_chk_1;
+ALTER TABLE discount_code ADD CONSTRAINT chk_discount_percentage CHECK (discount_percentage >= 0 AND discount_percentage <= 100);
+
+ALTER TABLE discount_code ADD COLUMN discount_type ENUM('PERCENTAGE', 'FIXED') NOT NULL DEFAULT 'PERCENTAGE';
+ALTER TABLE discount_code ADD COLUMN discount_amount DECIMAL(10, 2) NOT NULL DEFAULT 0;
+-- NULL means no limit
+ALTER TABLE discount_code ADD COLUMN valid_from TIMESTAMP NULL DEFAULT NULL;
+ALTER TABLE discount_code ADD COLUMN valid_until TIMESTAMP NULL DEFAULT NULL;
+ALTER TABLE discount_code ADD COLUMN max_uses INT DEFAULT NULL;
+ALTER TABLE discount_code ADD COLUMN max_uses_per_customer INT DEFAULT 1;
+-- What the order has to be worth after freebies, before the code
+ALTER TABLE discount_code ADD COLUMN min_order_value DECIMAL(10, 2) NOT NULL DEFAULT 0;
+-- What the code takes money off, ITEMS means the pizzas and extra items in discount_code_item
+ALTER TABLE discount_code ADD COLUMN scope ENUM('ORDER', 'PIZZAS', 'DRINKS', 'DESSERTS', 'ITEMS') NOT NULL DEFAULT 'ORDER';
+
+CREATE TABLE discount_code_item (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	discount_code_id INT NOT NULL,
+	pizza_id INT DEFAULT NULL,
+	extra_item_id INT DEFAULT NULL,
+	CHECK ((pizza_id IS NULL) <> (extra_item_id IS NULL)),
+	FOREIGN KEY (discount_code_id) REFERENCES discount_code(id) ON DELETE CASCADE,
+	FOREIGN KEY (pizza_id) REFERENCES pizza(id) ON DELETE CASCADE,
+	FOREIGN KEY (extra_item_id) REFERENCES extra_item(id) ON DELETE CASCADE
+);
+
+-- A customer can use a code more than once, every use belongs to an order.
+-- The foreign key on user_id needs an index of its own before the unique one can go.
+ALTER TABLE discount_usage ADD INDEX idx_discount_usage_user (user_id, discount_code_id);
+ALTER TABLE discount_usage DROP INDEX unique_user_discount;
+ALTER TABLE discount_usage ADD COLUMN order_id BIGINT DEFAULT NULL;
+ALTER TABLE discount_usage ADD CONSTRAINT fk_discount_usage_order FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE;
+
+UPDATE discount_usage SET order_id = (
+	SELECT MIN(o.id) FROM orders o
+	JOIN customer c ON o.customer_id = c.id
+	WHERE c.user_id = discount_usage.user_id AND o.discount_code_id = discount_usage.discount_code_id
+);
+
+-- The fixed amount the order's code took off, and which lines the code applied to
+ALTER TABLE orders ADD COLUMN discount_amount DECIMAL(10, 2) NOT NULL DEFAULT 0;
+ALTER TABLE order_pizza ADD COLUMN discounted BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE order_extra_item ADD COLUMN discounted BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,4 @@
+DROP TABLE order_promotion;
+DROP TABLE promotion_effect;
+DROP TABLE promotion_condition;
+DROP TABLE promotion;
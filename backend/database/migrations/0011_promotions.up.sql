@@ -0,0 +1,58 @@
+-- Promotions are deals stored as data: conditions that must all hold, and effects applied when they do.
+-- With a discount_code_id the customer enters that code to get it, instead of the code's own discount,
+-- without one it applies to every order that meets the conditions.
+CREATE TABLE promotion (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	name VARCHAR(100) NOT NULL UNIQUE,
+	description VARCHAR(255) NOT NULL DEFAULT '',
+	discount_code_id INT DEFAULT NULL UNIQUE,
+	is_active BOOLEAN NOT NULL DEFAULT TRUE,
+	FOREIGN KEY (discount_code_id) REFERENCES discount_code(id) ON DELETE CASCADE
+);
+
+-- BIRTHDAY: it is the customer's birthday, by their birth_date.
+-- DAY_OF_WEEK: today is day_of_week, 0 is Sunday.
+-- CART_CONTAINS: the cart has at least quantity items of category (pizza, drink or dessert).
+CREATE TABLE promotion_condition (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	promotion_id INT NOT NULL,
+	kind ENUM('BIRTHDAY', 'DAY_OF_WEEK', 'CART_CONTAINS') NOT NULL,
+	day_of_week TINYINT DEFAULT NULL,
+	category VARCHAR(50) DEFAULT NULL,
+	quantity INT DEFAULT NULL,
+	FOREIGN KEY (promotion_id) REFERENCES promotion(id) ON DELETE CASCADE
+);
+
+-- FREE_CHEAPEST: one of the cheapest item of category in the cart is free.
+-- ADD_FREE_ITEM: adds extra_item_id, or the cheapest extra item of category, for free.
+-- PERCENT_OFF: percentage off the items of category, or the whole order without one. Not on top of a discount code.
+CREATE TABLE promotion_effect (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	promotion_id INT NOT NULL,
+	kind ENUM('FREE_CHEAPEST', 'ADD_FREE_ITEM', 'PERCENT_OFF') NOT NULL,
+	category VARCHAR(50) DEFAULT NULL,
+	extra_item_id INT DEFAULT NULL,
+	percentage INT DEFAULT NULL,
+	CHECK (percentage IS NULL OR (percentage >= 1 AND percentage <= 100)),
+	FOREIGN KEY (promotion_id) REFERENCES promotion(id) ON DELETE CASCADE,
+	FOREIGN KEY (extra_item_id) REFERENCES extra_item(id) ON DELETE CASCADE
+);
+
+-- The promotions an order got
+CREATE TABLE order_promotion (
+	order_id BIGINT NOT NULL,
+	promotion_id INT NOT NULL,
+	PRIMARY KEY (order_id, promotion_id),
+	FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE,
+	FOREIGN KEY (promotion_id) REFERENCES promotion(id) ON DELETE CASCADE
+);
+
+-- The birthday deal the code used to be hardcoded for, now checked against the customer's birth date
+INSERT INTO promotion (name, description, discount_code_id, is_active)
+SELECT 'Birthday', 'Birthday Special: Free cheapest pizza + free drink!', id, TRUE FROM discount_code WHERE code = 'BIRTHDAY';
+INSERT INTO promotion_condition (promotion_id, kind)
+SELECT id, 'BIRTHDAY' FROM promotion WHERE name = 'Birthday';
+INSERT INTO promotion_effect (promotion_id, kind, category)
+SELECT id, 'FREE_CHEAPEST', 'pizza' FROM promotion WHERE name = 'Birthday';
+INSERT INTO promotion_effect (promotion_id, kind, category)
+SELECT id, 'ADD_FREE_ITEM', 'drink' FROM promotion WHERE name = 'Birthday';
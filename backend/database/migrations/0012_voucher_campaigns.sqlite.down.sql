@@ -0,0 +1,8 @@
+-- The generated vouchers go with their campaign, unless an order used them
+DELETE FROM discount_code WHERE campaign_id IS NOT NULL AND id NOT IN (
+	SELECT discount_code_id FROM orders WHERE discount_code_id IS NOT NULL
+);
+
+ALTER TABLE discount_code DROP COLUMN campaign_id;
+
+DROP TABLE voucher_campaign;
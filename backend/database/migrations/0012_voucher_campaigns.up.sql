@@ -0,0 +1,18 @@
+-- A campaign is a batch of single-use voucher codes generated at once, sharing a prefix, percentage and expiry.
+CREATE TABLE voucher_campaign (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	name VARCHAR(100) NOT NULL UNIQUE,
+	prefix VARCHAR(20) NOT NULL,
+	discount_percentage INT NOT NULL,
+	valid_until TIMESTAMP NULL DEFAULT NULL,
+	created_by BIGINT DEFAULT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	CHECK (discount_percentage >= 1 AND discount_percentage <= 100),
+
+	FOREIGN KEY (created_by) REFERENCES user(id)
+		ON DELETE SET NULL
+);
+
+-- The campaign a voucher code was generated for, NULL for codes made one at a time
+ALTER TABLE discount_code ADD COLUMN campaign_id INT NULL;
+ALTER TABLE discount_code ADD CONSTRAINT fk_discount_code_campaign FOREIGN KEY (campaign_id) REFERENCES voucher_campaign(id);
@@ -0,0 +1,7 @@
+ALTER TABLE orders DROP COLUMN delivery_vat_rate;
+ALTER TABLE orders DROP COLUMN delivery_fee;
+ALTER TABLE orders DROP FOREIGN KEY fk_orders_delivery_zone;
+ALTER TABLE orders DROP COLUMN delivery_zone_id;
+
+DROP TABLE delivery_person_zone;
+DROP TABLE delivery_zone;
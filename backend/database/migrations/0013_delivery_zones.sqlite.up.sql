@@ -0,0 +1,39 @@
+-- A zone covers the postal codes starting with postal_code_prefix, or those whose first characters are
+-- between postal_code_from and postal_code_to. Orders to it pay delivery_fee, need at least min_order_value
+-- of items and take about estimated_minutes to arrive.
+CREATE TABLE delivery_zone (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name VARCHAR(100) NOT NULL UNIQUE,
+	postal_code_prefix VARCHAR(10) DEFAULT NULL,
+	postal_code_from VARCHAR(10) DEFAULT NULL,
+	postal_code_to VARCHAR(10) DEFAULT NULL,
+	delivery_fee DECIMAL(10, 2) NOT NULL DEFAULT 0,
+	min_order_value DECIMAL(10, 2) NOT NULL DEFAULT 0,
+	estimated_minutes INT NOT NULL DEFAULT 30,
+	is_active BOOLEAN NOT NULL DEFAULT TRUE,
+	CHECK (delivery_fee >= 0),
+	CHECK (min_order_value >= 0),
+	CHECK (estimated_minutes > 0),
+	CHECK ((postal_code_prefix IS NULL) <> (postal_code_from IS NULL AND postal_code_to IS NULL))
+);
+
+-- What was delivered before: every postal code, for free. An empty prefix matches all of them.
+INSERT INTO delivery_zone (name, postal_code_prefix, delivery_fee, min_order_value, estimated_minutes)
+VALUES ('Everywhere', '', 0, 0, 45);
+
+-- The zones a courier delivers in
+CREATE TABLE delivery_person_zone (
+	delivery_person_id BIGINT NOT NULL,
+	delivery_zone_id INT NOT NULL,
+	PRIMARY KEY (delivery_person_id, delivery_zone_id),
+	FOREIGN KEY (delivery_person_id) REFERENCES delivery_person(id) ON DELETE CASCADE,
+	FOREIGN KEY (delivery_zone_id) REFERENCES delivery_zone(id) ON DELETE CASCADE
+);
+
+-- The zone the order was delivered to and the fee it paid, including VAT at delivery_vat_rate
+ALTER TABLE orders ADD COLUMN delivery_zone_id INTEGER REFERENCES delivery_zone(id) ON DELETE SET NULL;
+ALTER TABLE orders ADD COLUMN delivery_fee DECIMAL(10, 2) NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN delivery_vat_rate DECIMAL(5, 4) NOT NULL DEFAULT 0;
+
+-- Orders placed so far were delivered under the Everywhere rules
+UPDATE orders SET delivery_zone_id = (SELECT id FROM delivery_zone WHERE name = 'Everywhere');
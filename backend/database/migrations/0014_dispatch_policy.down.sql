@@ -0,0 +1 @@
+DROP TABLE dispatch_policy;
@@ -0,0 +1,18 @@
+-- How ready orders are handed to couriers, a single row. A courier carries up to max_batch_size orders at once,
+-- all going to the same delivery zone, and waits cooldown_minutes after a delivery before taking the next ones.
+-- With auto_dispatch the server assigns ready orders itself, couriers can still pick them up by hand.
+CREATE TABLE dispatch_policy (
+	id INT PRIMARY KEY,
+	auto_dispatch BOOLEAN NOT NULL DEFAULT TRUE,
+	max_batch_size INT NOT NULL DEFAULT 1 CHECK (max_batch_size BETWEEN 1 AND 10),
+	cooldown_minutes INT NOT NULL DEFAULT 30 CHECK (cooldown_minutes >= 0),
+	updated_at TIMESTAMP NULL DEFAULT NULL,
+	updated_by BIGINT DEFAULT NULL,
+
+	FOREIGN KEY (updated_by) REFERENCES user(id)
+		ON DELETE SET NULL
+);
+
+-- The cooldown that was hardcoded until now, with up to three orders per trip
+INSERT INTO dispatch_policy (id, auto_dispatch, max_batch_size, cooldown_minutes)
+VALUES (1, TRUE, 3, 30);
@@ -0,0 +1,3 @@
+DROP TABLE cart_item_modifier;
+DROP TABLE cart_item;
+DROP TABLE cart;
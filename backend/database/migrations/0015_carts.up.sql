@@ -0,0 +1,39 @@
+-- A customer's cart, kept on the server so it follows them across devices and sessions.
+-- Lines hold what the customer picked, prices are worked out again every time the cart is shown.
+CREATE TABLE cart (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	customer_id BIGINT NOT NULL,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE KEY uq_cart_customer (customer_id),
+	FOREIGN KEY (customer_id) REFERENCES customer(id) ON DELETE CASCADE
+);
+
+-- A pizza in a size and crust, or an extra item. A line whose pizza, size, crust or extra item
+-- is taken off the menu leaves the cart with it.
+CREATE TABLE cart_item (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	cart_id BIGINT NOT NULL,
+	pizza_id INT NULL,
+	size_id INT NULL,
+	crust_id INT NULL,
+	extra_item_id INT NULL,
+	quantity INT NOT NULL CHECK (quantity > 0),
+	added_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	CHECK ((pizza_id IS NULL) <> (extra_item_id IS NULL)),
+	CHECK ((pizza_id IS NULL) = (size_id IS NULL) AND (pizza_id IS NULL) = (crust_id IS NULL)),
+	FOREIGN KEY (cart_id) REFERENCES cart(id) ON DELETE CASCADE,
+	FOREIGN KEY (pizza_id) REFERENCES pizza(id) ON DELETE CASCADE,
+	FOREIGN KEY (size_id) REFERENCES pizza_size(id) ON DELETE CASCADE,
+	FOREIGN KEY (crust_id) REFERENCES crust_type(id) ON DELETE CASCADE,
+	FOREIGN KEY (extra_item_id) REFERENCES extra_item(id) ON DELETE CASCADE
+);
+
+-- Toppings added to or taken off a pizza line, like order_pizza_modifier
+CREATE TABLE cart_item_modifier (
+	cart_item_id BIGINT NOT NULL,
+	ingredient_id INT NOT NULL,
+	action ENUM('ADD', 'REMOVE') NOT NULL,
+	PRIMARY KEY (cart_item_id, ingredient_id),
+	FOREIGN KEY (cart_item_id) REFERENCES cart_item(id) ON DELETE CASCADE,
+	FOREIGN KEY (ingredient_id) REFERENCES ingredient(id) ON DELETE CASCADE
+);
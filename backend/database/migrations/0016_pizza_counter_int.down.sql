@@ -0,0 +1 @@
+ALTER TABLE customer MODIFY pizza_counter TINYINT NOT NULL DEFAULT 0;
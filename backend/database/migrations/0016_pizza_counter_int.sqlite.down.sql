@@ -0,0 +1,2 @@
+-- SQLite stores TINYINT and INT columns the same way, there is nothing to widen.
+SELECT 1;
@@ -0,0 +1,2 @@
+-- customer.pizza_counter was a TINYINT from before the loyalty program, too small for a counter
+ALTER TABLE customer MODIFY pizza_counter INT NOT NULL DEFAULT 0;
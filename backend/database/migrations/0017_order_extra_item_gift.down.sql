@@ -0,0 +1 @@
+ALTER TABLE order_extra_item DROP COLUMN is_gift;
@@ -0,0 +1,11 @@
+-- Extra item lines a promotion added for free (ADD_FREE_ITEM), the customer didn't pick them
+ALTER TABLE order_extra_item ADD COLUMN is_gift BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Older orders: a free line of one item on an order that got a promotion adding one
+UPDATE order_extra_item SET is_gift = TRUE
+WHERE quantity = 1 AND free_quantity = 1
+AND EXISTS (
+	SELECT 1 FROM order_promotion op
+	JOIN promotion_effect pe ON pe.promotion_id = op.promotion_id
+	WHERE op.order_id = order_extra_item.order_id AND pe.kind = 'ADD_FREE_ITEM'
+);
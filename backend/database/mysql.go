@@ -4,29 +4,92 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 
 	_ "github.com/go-sql-driver/mysql"
+	_ "modernc.org/sqlite"
 )
 
 var DATABASE *sql.DB
 var PASSWORD_HASH_PEPPER []byte
 
+// queryer is implemented by both *sql.DB and *sql.Tx, so helpers can run inside or outside a transaction.
+type queryer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// Init connects to the database and brings the schema up to date.
 func Init() {
+	Connect()
+
+	// Control DB reset with env var. If DB_RESET=true/1, roll back everything and reseed.
+	if envFlag("DB_RESET") {
+		if _, err := MigrateDown(math.MaxInt); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	applied, err := MigrateUp()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if applied > 0 {
+		log.Printf("Applied %d migration(s)", applied)
+	}
+
+	if envFlag("DB_RESET") || envFlag("DB_SEED") {
+		SeedDevData()
+	}
+}
+
+// Connect only opens the connection, without touching the schema.
+// DB_DRIVER picks the database: "mysql" (default) or "sqlite", which uses the file at DB_PATH.
+func Connect() {
 	_ = godotenv.Load()
 
-	user := os.Getenv("DB_USER")
-	pass := os.Getenv("DB_PASS")
-	fmt.Println(pass)
 	PASSWORD_HASH_PEPPER = []byte(os.Getenv("DB_PEPPER"))
 
-	dsn := fmt.Sprintf("%s:%s@tcp(127.0.0.1:3306)/pizza_shop?parseTime=true&loc=Local", user, pass)
+	if window := os.Getenv("ORDER_CANCEL_WINDOW"); window != "" {
+		parsed, err := time.ParseDuration(window)
+		if err != nil {
+			log.Fatalf("Invalid ORDER_CANCEL_WINDOW %q: %v", window, err)
+		}
+		CancelWindow = parsed
+	}
 
 	var err error
-	DATABASE, err = sql.Open("mysql", dsn)
+	switch driver := strings.ToLower(os.Getenv("DB_DRIVER")); driver {
+	case "", "mysql":
+		user := os.Getenv("DB_USER")
+		pass := os.Getenv("DB_PASS")
+		dsn := fmt.Sprintf("%s:%s@tcp(127.0.0.1:3306)/pizza_shop?parseTime=true&loc=Local", user, pass)
+
+		DATABASE, err = sql.Open("mysql", dsn)
+		currentDialect = mysqlDialect
+
+	case "sqlite":
+		path := os.Getenv("DB_PATH")
+		if path == "" {
+			path = "pizza_shop.db"
+		}
+		// Immediate transactions take the write lock up front, so two writers wait on
+		// busy_timeout instead of failing halfway through. Times are written as SQLite's own
+		// "2006-01-02 15:04:05.999999999-07:00", which compares and sorts as text.
+		dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate&_time_format=sqlite"
+
+		DATABASE, err = sql.Open("sqlite", dsn)
+		currentDialect = sqliteDialect
+
+	default:
+		log.Fatalf("Unknown DB_DRIVER %q, use mysql or sqlite", driver)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -35,13 +98,11 @@ func Init() {
 		log.Fatal(err)
 	}
 
-	fmt.Println("Connected to MySQL!")
+	fmt.Printf("Connected to %s!\n", currentDialect.name)
+}
 
-	// Control DB reset with env var. If DB_RESET=true/1, drop and reseed.
-	reset := strings.EqualFold(os.Getenv("DB_RESET"), "true") || os.Getenv("DB_RESET") == "1"
-	if reset {
-		InitDatabaseDev()
-	}
+func envFlag(name string) bool {
+	return strings.EqualFold(os.Getenv(name), "true") || os.Getenv(name) == "1"
 }
 
 func Close() {
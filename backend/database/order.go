@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"fmt"
 	"time"
+
+	"github.com/shopspring/decimal"
 )
 
 type Order struct {
@@ -17,17 +19,42 @@ type Order struct {
 	DiscountCodeID     *int      `json:"discount_code_id"`
 	DiscountCode       *string   `json:"discount_code"`
 	DiscountPercentage *int      `json:"discount_percentage"`
+	DiscountAmount     float64   `json:"discount_amount"`
 	DeliveryPersonID   *int      `json:"delivery_person_id"`
 	DeliveryPersonName *string   `json:"delivery_person_name"`
+	DeliveryZone       *string   `json:"delivery_zone"`
+	TotalPrice         float64   `json:"total_price"`
 }
 
+// Price, MarginRate and VATRate are what was charged at checkout, not the current menu price.
 type OrderPizza struct {
-	ID        int     `json:"id"`
-	OrderID   int     `json:"order_id"`
-	PizzaID   int     `json:"pizza_id"`
-	PizzaName string  `json:"pizza_name"`
-	Quantity  int     `json:"quantity"`
-	Price     float64 `json:"price"`
+	ID             int     `json:"id"`
+	OrderID        int     `json:"order_id"`
+	PizzaID        int     `json:"pizza_id"`
+	PizzaName      string  `json:"pizza_name"`
+	Quantity       int     `json:"quantity"`
+	FreeQuantity   int     `json:"free_quantity"`
+	RewardQuantity int     `json:"reward_quantity"` // loyalty reward
+	Price          float64 `json:"price"`
+	MarginRate     float64 `json:"margin_rate"`
+	VATRate        float64 `json:"vat_rate"`
+	SizeID         int     `json:"size_id"`
+	SizeName       string  `json:"size_name"`
+	CrustID        int     `json:"crust_id"`
+	CrustName      string  `json:"crust_name"`
+	// Diet of the pizza as it was made, with the modifiers
+	IsVegetarian bool            `json:"is_vegetarian"`
+	IsVegan      bool            `json:"is_vegan"`
+	Modifiers    []PizzaModifier `json:"modifiers"`
+
+	KitchenStatus KitchenStatus `json:"kitchen_status"`
+	StartedAt     *time.Time    `json:"started_at"`
+	FinishedAt    *time.Time    `json:"finished_at"`
+}
+
+// Description is the pizza name with what the customer changed, e.g. "Margherita (no Mozzarella, + Mushrooms)".
+func (op OrderPizza) Description() string {
+	return describePizza(op.PizzaName, op.Modifiers)
 }
 
 type OrderExtraItem struct {
@@ -37,116 +64,90 @@ type OrderExtraItem struct {
 	ExtraItemName string  `json:"extra_item_name"`
 	Category      string  `json:"category"`
 	Price         float64 `json:"price"`
+	VATRate       float64 `json:"vat_rate"`
 	Quantity      int     `json:"quantity"`
+	FreeQuantity  int     `json:"free_quantity"`
 }
 
 type OrderDetails struct {
-	Order      Order            `json:"order"`
-	Pizzas     []OrderPizza     `json:"pizzas"`
-	ExtraItems []OrderExtraItem `json:"extra_items"`
-	TotalPrice float64          `json:"total_price"`
+	Order         Order               `json:"order"`
+	Pizzas        []OrderPizza        `json:"pizzas"`
+	ExtraItems    []OrderExtraItem    `json:"extra_items"`
+	Breakdown     PriceBreakdown      `json:"breakdown"`
+	TotalPrice    float64             `json:"total_price"`
+	StatusHistory []OrderStatusChange `json:"status_history"`
+}
+
+// PizzaOrderItem is a pizza to order. A size or crust of 0 is the default one.
+type PizzaOrderItem struct {
+	PizzaID   int
+	SizeID    int
+	CrustID   int
+	Quantity  int
+	Modifiers []PizzaModifier
 }
 
-func CreateOrderWithTransaction(customerID int, userID int, deliveryAddress, postalCode string, pizzaItems []struct {
-	PizzaID  int
-	Quantity int
-}, extraItems []struct {
+// ExtraOrderItem is a dessert or drink to order.
+type ExtraOrderItem struct {
 	ExtraItemID int
 	Quantity    int
-}, discountCode *string) (int, error) {
+}
+
+func CreateOrderWithTransaction(customerID int, userID int, deliveryAddress, postalCode string, pizzaItems []PizzaOrderItem, extraItems []ExtraOrderItem, discountCode *string) (int, error) {
 	tx, err := DATABASE.Begin()
 	if err != nil {
 		return 0, err
 	}
+	defer tx.Rollback()
 
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
-
-	// Get discount code ID if provided
-	var discountCodeID *int
-	var isBirthdayDiscount bool
-	if discountCode != nil && *discountCode != "" {
-		var id int
-		var isActive bool
-		var code string
-		err = tx.QueryRow(`SELECT id, code, is_active FROM discount_code WHERE code = ?`, *discountCode).Scan(&id, &code, &isActive)
-		if err == nil && isActive {
-			discountCodeID = &id
-			isBirthdayDiscount = (code == "BIRTHDAY")
-
-			// Check if user already used this discount
-			var usageCount int
-			err = tx.QueryRow(`SELECT COUNT(*) FROM discount_usage WHERE user_id = ? AND discount_code_id = ?`, userID, id).Scan(&usageCount)
-			if err != nil {
-				return 0, err
-			}
-			if usageCount > 0 {
-				return 0, fmt.Errorf("discount code already used")
-			}
-		}
-		// If discount code not found or inactive, we just ignore it (don't fail the order)
-	}
-
-	// Handle birthday discount: free cheapest pizza + 1 free drink
-	if isBirthdayDiscount {
-		// Find cheapest pizza in the order
-		if len(pizzaItems) > 0 {
-			cheapestIdx := -1
-			var cheapestPrice float64
-
-			for i, item := range pizzaItems {
-				var price float64
-				err = tx.QueryRow(`
-					SELECT ROUND(SUM(i.cost) * 1.4 * 1.09, 4)
-					FROM pizza_ingredient pi
-					JOIN ingredient i ON pi.ingredient_id = i.id
-					WHERE pi.pizza_id = ?
-				`, item.PizzaID).Scan(&price)
-
-				if err == nil {
-					if cheapestIdx == -1 || price < cheapestPrice {
-						cheapestIdx = i
-						cheapestPrice = price
-					}
-				}
-			}
-
-			// Remove one quantity from cheapest pizza (make it free)
-			if cheapestIdx != -1 && pizzaItems[cheapestIdx].Quantity > 0 {
-				pizzaItems[cheapestIdx].Quantity--
-				// If quantity becomes 0, we'll skip it when inserting
-			}
-		}
+	if err := lockCustomer(tx, customerID); err != nil {
+		return 0, err
+	}
+	orderID, err := createOrder(tx, customerID, userID, deliveryAddress, postalCode, pizzaItems, extraItems, discountCode)
+	if err != nil {
+		return 0, err
+	}
+	return orderID, tx.Commit()
+}
 
-		// Add 1 free drink (find cheapest drink)
-		var cheapestDrinkID int
-		err = tx.QueryRow(`
-			SELECT id FROM extra_item 
-			WHERE category = 'drink' 
-			ORDER BY price ASC 
-			LIMIT 1
-		`).Scan(&cheapestDrinkID)
-
-		if err == nil {
-			// Add free drink to extras
-			extraItems = append(extraItems, struct {
-				ExtraItemID int
-				Quantity    int
-			}{
-				ExtraItemID: cheapestDrinkID,
-				Quantity:    1,
-			})
-		}
+// lockCustomer locks the customer row until the transaction ends, so two orders at once can't both use
+// the same loyalty reward and a cart can't change while it is checked out.
+func lockCustomer(q queryer, customerID int) error {
+	var lockedID int
+	return q.QueryRow(`SELECT id FROM customer WHERE id = ?`+currentDialect.forUpdate, customerID).Scan(&lockedID)
+}
+
+// createOrder places the order in the transaction, which has to hold the lock of lockCustomer.
+func createOrder(q queryer, customerID int, userID int, deliveryAddress, postalCode string, pizzaItems []PizzaOrderItem, extraItems []ExtraOrderItem, discountCode *string) (int, error) {
+	// Snapshot the prices as they are right now, so later ingredient or menu
+	// changes never alter what this order cost.
+	priced, err := priceOrder(q, userID, &postalCode, pizzaItems, extraItems, discountCode)
+	if err != nil {
+		return 0, err
+	}
+
+	// Refuse the whole order if the kitchen can't make it
+	if err := takeStock(q, priced.Pizzas); err != nil {
+		return 0, err
+	}
+
+	cfg, err := getPricingConfig(q)
+	if err != nil {
+		return 0, err
+	}
+	loyaltyPizzas := 0
+	if cfg.LoyaltyPizzasPerReward > 0 {
+		loyaltyPizzas = priced.paidPizzas()
 	}
 
 	query := `
-		INSERT INTO orders (customer_id, delivery_address, postal_code, status, timestamp, discount_code_id)
-		VALUES (?, ?, ?, 'IN_PROGRESS', NOW(), ?)
+		INSERT INTO orders (customer_id, delivery_address, postal_code, status, timestamp, discount_code_id, discount_percentage, discount_amount, total_price,
+			loyalty_pizzas, loyalty_rewards_used, delivery_zone_id, delivery_fee, delivery_vat_rate)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	result, err := tx.Exec(query, customerID, deliveryAddress, postalCode, discountCodeID)
+	result, err := q.Exec(query, customerID, deliveryAddress, priced.PostalCode, OrderPlaced, time.Now(), priced.DiscountCodeID, priced.DiscountPercentage,
+		priced.DiscountAmount.StringFixed(2), priced.Breakdown.Total, loyaltyPizzas, priced.LoyaltyRewardsUsed,
+		priced.DeliveryZone.ID, priced.Delivery.UnitPrice.StringFixed(2), priced.Delivery.VATRate.String())
 	if err != nil {
 		return 0, err
 	}
@@ -156,35 +157,39 @@ func CreateOrderWithTransaction(customerID int, userID int, deliveryAddress, pos
 		return 0, err
 	}
 
-	pizzaQuery := `INSERT INTO order_pizza (order_id, pizza_id, quantity) VALUES (?, ?, ?)`
-	for _, item := range pizzaItems {
-		if item.Quantity > 0 { // Only insert if quantity > 0
-			_, err = tx.Exec(pizzaQuery, orderID, item.PizzaID, item.Quantity)
-			if err != nil {
-				return 0, err
-			}
+	err = recordOrderStatus(q, int(orderID), nil, OrderPlaced, userID, "")
+	if err != nil {
+		return 0, err
+	}
+
+	for _, item := range priced.Pizzas {
+		err = insertOrderPizza(q, int(orderID), item)
+		if err != nil {
+			return 0, err
 		}
 	}
 
-	if len(extraItems) > 0 {
-		extraQuery := `INSERT INTO order_extra_item (order_id, extra_item_id, quantity) VALUES (?, ?, ?)`
-		for _, item := range extraItems {
-			_, err = tx.Exec(extraQuery, orderID, item.ExtraItemID, item.Quantity)
-			if err != nil {
-				return 0, err
-			}
+	for _, item := range priced.ExtraItems {
+		err = insertOrderExtraItem(q, int(orderID), item)
+		if err != nil {
+			return 0, err
 		}
 	}
 
 	// Record discount usage
-	if discountCodeID != nil {
-		_, err = tx.Exec(`INSERT INTO discount_usage (user_id, discount_code_id, used_at) VALUES (?, ?, NOW())`, userID, *discountCodeID)
+	if priced.DiscountCodeID != nil {
+		_, err = q.Exec(`INSERT INTO discount_usage (user_id, discount_code_id, order_id, used_at) VALUES (?, ?, ?, ?)`, userID, *priced.DiscountCodeID, orderID, time.Now())
 		if err != nil {
 			return 0, err
 		}
 	}
 
-	err = tx.Commit()
+	if err := insertOrderPromotions(q, int(orderID), priced.Promotions); err != nil {
+		return 0, err
+	}
+
+	// Count the pizzas towards the next reward and use up the one this order got
+	err = updateCustomerLoyalty(q, customerID, loyaltyPizzas, priced.LoyaltyRewardsUsed, cfg.LoyaltyPizzasPerReward)
 	if err != nil {
 		return 0, err
 	}
@@ -192,12 +197,48 @@ func CreateOrderWithTransaction(customerID int, userID int, deliveryAddress, pos
 	return int(orderID), nil
 }
 
+func insertOrderPizza(q queryer, orderID int, item pricedItem) error {
+	query := `INSERT INTO order_pizza (order_id, pizza_id, size_id, crust_id, quantity, free_quantity, reward_quantity, unit_price, margin_rate, vat_rate, discounted, is_vegetarian, is_vegan) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	res, err := q.Exec(query, orderID, item.ID, item.Variant.Size.ID, item.Variant.Crust.ID, item.Quantity, item.FreeQuantity, item.RewardQuantity, item.UnitPrice.StringFixed(2), item.MarginRate.String(), item.VATRate.String(), item.Discountable, item.IsVegetarian, item.IsVegan)
+	if err != nil {
+		return err
+	}
+	if len(item.Modifiers) == 0 {
+		return nil
+	}
+	orderPizzaID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	return insertOrderPizzaModifiers(q, int(orderPizzaID), item.Modifiers)
+}
+
+func insertOrderExtraItem(q queryer, orderID int, item pricedItem) error {
+	query := `INSERT INTO order_extra_item (order_id, extra_item_id, quantity, free_quantity, unit_price, vat_rate, discounted, is_gift) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := q.Exec(query, orderID, item.ID, item.Quantity, item.FreeQuantity, item.UnitPrice.StringFixed(2), item.VATRate.String(), item.Discountable, item.Gift)
+	return err
+}
+
+// getExtraItemPrice returns the price of an extra item and its category, which decides its VAT rate.
+func getExtraItemPrice(q queryer, extraItemID int) (decimal.Decimal, string, error) {
+	var priceStr, category string
+	err := q.QueryRow(`SELECT price, category FROM extra_item WHERE id = ?`, extraItemID).Scan(&priceStr, &category)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return decimal.Zero, "", fmt.Errorf("extra item not found: %d", extraItemID)
+		}
+		return decimal.Zero, "", err
+	}
+	price, err := decimal.NewFromString(priceStr)
+	return price, category, err
+}
+
 func CreateOrder(customerID int, deliveryAddress, postalCode string) (int, error) {
 	query := `
 		INSERT INTO ` + "`order`" + ` (customer_id, delivery_address, postal_code, status, timestamp)
-		VALUES (?, ?, ?, 'pending', NOW())
+		VALUES (?, ?, ?, 'pending', ?)
 	`
-	result, err := DATABASE.Exec(query, customerID, deliveryAddress, postalCode)
+	result, err := DATABASE.Exec(query, customerID, deliveryAddress, postalCode, time.Now())
 	if err != nil {
 		return 0, err
 	}
@@ -210,21 +251,132 @@ func CreateOrder(customerID int, deliveryAddress, postalCode string) (int, error
 	return int(orderID), nil
 }
 
+// AddPizzaToOrder adds a pizza in the default size and crust.
 func AddPizzaToOrder(orderID, pizzaID, quantity int) error {
-	query := `INSERT INTO order_pizza (order_id, pizza_id, quantity) VALUES (?, ?, ?)`
-	_, err := DATABASE.Exec(query, orderID, pizzaID, quantity)
-	return err
+	cfg, err := getPricingConfig(DATABASE)
+	if err != nil {
+		return err
+	}
+	variant, err := getPizzaVariant(DATABASE, 0, 0)
+	if err != nil {
+		return err
+	}
+	item, err := pricePizza(DATABASE, cfg, pizzaID, variant, nil)
+	if err != nil {
+		return err
+	}
+	item.Quantity = quantity
+	// The order's discount applies to it, like to every line of an order without a scoped code
+	item.Discountable = true
+	if err := insertOrderPizza(DATABASE, orderID, item); err != nil {
+		return err
+	}
+	return refreshOrderTotal(DATABASE, orderID)
 }
 
 func AddExtraItemToOrder(orderID, extraItemID, quantity int) error {
-	query := `INSERT INTO order_extra_item (order_id, extra_item_id, quantity) VALUES (?, ?, ?)`
-	_, err := DATABASE.Exec(query, orderID, extraItemID, quantity)
+	cfg, err := getPricingConfig(DATABASE)
+	if err != nil {
+		return err
+	}
+	price, category, err := getExtraItemPrice(DATABASE, extraItemID)
+	if err != nil {
+		return err
+	}
+	item := pricedItem{ID: extraItemID, Quantity: quantity, UnitPrice: price, VATRate: cfg.extraVATRate(category), Category: category, Discountable: true}
+	if err := insertOrderExtraItem(DATABASE, orderID, item); err != nil {
+		return err
+	}
+	return refreshOrderTotal(DATABASE, orderID)
+}
+
+// refreshOrderTotal reruns the pricing pipeline over the snapshotted lines and stores the new total.
+func refreshOrderTotal(q queryer, orderID int) error {
+	breakdown, err := getOrderBreakdown(q, orderID)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(`UPDATE orders SET total_price = ? WHERE id = ?`, breakdown.Total, orderID)
 	return err
 }
 
+// GetOrderBreakdown prices a placed order from its snapshotted lines,
+// which gives the same numbers the customer saw at checkout.
+func GetOrderBreakdown(orderID int) (PriceBreakdown, error) {
+	return getOrderBreakdown(DATABASE, orderID)
+}
+
+func getOrderBreakdown(q queryer, orderID int) (PriceBreakdown, error) {
+	var discountPercentage int
+	var discountAmountStr, deliveryFee, deliveryVATRate string
+	var zoneName sql.NullString
+	var estimatedMinutes sql.NullInt64
+	err := q.QueryRow(`
+		SELECT o.discount_percentage, o.discount_amount, o.delivery_fee, o.delivery_vat_rate, z.name, z.estimated_minutes
+		FROM orders o
+		LEFT JOIN delivery_zone z ON o.delivery_zone_id = z.id
+		WHERE o.id = ?
+	`, orderID).Scan(&discountPercentage, &discountAmountStr, &deliveryFee, &deliveryVATRate, &zoneName, &estimatedMinutes)
+	if err != nil {
+		return PriceBreakdown{}, err
+	}
+	discountAmount, err := decimal.NewFromString(discountAmountStr)
+	if err != nil {
+		return PriceBreakdown{}, err
+	}
+	delivery := PriceLine{Quantity: 1}
+	if delivery.UnitPrice, err = decimal.NewFromString(deliveryFee); err != nil {
+		return PriceBreakdown{}, err
+	}
+	if delivery.VATRate, err = decimal.NewFromString(deliveryVATRate); err != nil {
+		return PriceBreakdown{}, err
+	}
+
+	rows, err := q.Query(`
+		SELECT quantity, free_quantity, reward_quantity, unit_price, vat_rate, discounted FROM order_pizza WHERE order_id = ?
+		UNION ALL
+		SELECT quantity, free_quantity, 0, unit_price, vat_rate, discounted FROM order_extra_item WHERE order_id = ?
+	`, orderID, orderID)
+	if err != nil {
+		return PriceBreakdown{}, err
+	}
+
+	var lines []PriceLine
+	for rows.Next() {
+		var line PriceLine
+		var unitPrice, vatRate string
+		if err := rows.Scan(&line.Quantity, &line.FreeQuantity, &line.RewardQuantity, &unitPrice, &vatRate, &line.Discountable); err != nil {
+			rows.Close()
+			return PriceBreakdown{}, err
+		}
+		if line.UnitPrice, err = decimal.NewFromString(unitPrice); err != nil {
+			rows.Close()
+			return PriceBreakdown{}, err
+		}
+		if line.VATRate, err = decimal.NewFromString(vatRate); err != nil {
+			rows.Close()
+			return PriceBreakdown{}, err
+		}
+		lines = append(lines, line)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return PriceBreakdown{}, err
+	}
+
+	breakdown := CalculatePriceBreakdown(lines, discountPercentage, discountAmount, delivery)
+	if breakdown.Promotions, err = getOrderPromotionNames(q, orderID); err != nil {
+		return PriceBreakdown{}, err
+	}
+	// The zone as it is now, the fee is what the order paid
+	breakdown.DeliveryZone = zoneName.String
+	breakdown.EstimatedMinutes = int(estimatedMinutes.Int64)
+	return breakdown, nil
+}
+
 func GetOrdersByCustomer(customerID int) ([]Order, error) {
 	query := `
-		SELECT id, customer_id, timestamp, status, postal_code, delivery_address
+		SELECT id, customer_id, timestamp, status, postal_code, delivery_address, total_price
 		FROM orders
 		WHERE customer_id = ?
 		ORDER BY timestamp DESC
@@ -238,7 +390,7 @@ func GetOrdersByCustomer(customerID int) ([]Order, error) {
 	var orders []Order
 	for rows.Next() {
 		var order Order
-		err := rows.Scan(&order.ID, &order.CustomerID, &order.Timestamp, &order.Status, &order.PostalCode, &order.DeliveryAddress)
+		err := rows.Scan(&order.ID, &order.CustomerID, &order.Timestamp, &order.Status, &order.PostalCode, &order.DeliveryAddress, &order.TotalPrice)
 		if err != nil {
 			return nil, err
 		}
@@ -274,12 +426,15 @@ func GetOrderDetails(orderID int) (*OrderDetails, error) {
 	var details OrderDetails
 
 	query := `
-		SELECT o.id, o.customer_id, c.name, o.timestamp, o.status, o.postal_code, o.delivery_address
+		SELECT o.id, o.customer_id, c.name, o.timestamp, o.status, o.postal_code, o.delivery_address, o.delivery_person_id,
+		       o.discount_percentage, o.discount_amount, o.total_price
 		FROM orders o
 		LEFT JOIN customer c ON o.customer_id = c.id
 		WHERE o.id = ?
 	`
 	var customerName sql.NullString
+	var deliveryPersonID sql.NullInt64
+	var discountPercentage int
 	err := DATABASE.QueryRow(query, orderID).Scan(
 		&details.Order.ID,
 		&details.Order.CustomerID,
@@ -288,11 +443,27 @@ func GetOrderDetails(orderID int) (*OrderDetails, error) {
 		&details.Order.Status,
 		&details.Order.PostalCode,
 		&details.Order.DeliveryAddress,
+		&deliveryPersonID,
+		&discountPercentage,
+		&details.Order.DiscountAmount,
+		&details.Order.TotalPrice,
 	)
+	if err == sql.ErrNoRows {
+		return nil, ErrOrderNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	if discountPercentage > 0 {
+		details.Order.DiscountPercentage = &discountPercentage
+	}
+
+	if deliveryPersonID.Valid {
+		dpID := int(deliveryPersonID.Int64)
+		details.Order.DeliveryPersonID = &dpID
+	}
+
 	if customerName.Valid {
 		details.Order.CustomerName = customerName.String
 	} else {
@@ -300,10 +471,14 @@ func GetOrderDetails(orderID int) (*OrderDetails, error) {
 	}
 
 	pizzaQuery := `
-		SELECT op.id, op.order_id, op.pizza_id, p.name, op.quantity 
+		SELECT op.id, op.order_id, op.pizza_id, p.name, op.quantity, op.free_quantity, op.reward_quantity, op.unit_price, op.margin_rate, op.vat_rate,
+		       op.size_id, s.name, op.crust_id, c.name, op.is_vegetarian, op.is_vegan, op.kitchen_status, op.started_at, op.finished_at
 		FROM order_pizza op
 		JOIN pizza p ON op.pizza_id = p.id
+		JOIN pizza_size s ON op.size_id = s.id
+		JOIN crust_type c ON op.crust_id = c.id
 		WHERE op.order_id = ?
+		ORDER BY op.id
 	`
 	pizzaRows, err := DATABASE.Query(pizzaQuery, orderID)
 	if err != nil {
@@ -313,23 +488,35 @@ func GetOrderDetails(orderID int) (*OrderDetails, error) {
 
 	for pizzaRows.Next() {
 		var op OrderPizza
-		err := pizzaRows.Scan(&op.ID, &op.OrderID, &op.PizzaID, &op.PizzaName, &op.Quantity)
+		var startedAt, finishedAt sql.NullTime
+		err := pizzaRows.Scan(&op.ID, &op.OrderID, &op.PizzaID, &op.PizzaName, &op.Quantity, &op.FreeQuantity, &op.RewardQuantity, &op.Price, &op.MarginRate, &op.VATRate,
+			&op.SizeID, &op.SizeName, &op.CrustID, &op.CrustName, &op.IsVegetarian, &op.IsVegan, &op.KitchenStatus, &startedAt, &finishedAt)
 		if err != nil {
 			return nil, err
 		}
+		if startedAt.Valid {
+			op.StartedAt = &startedAt.Time
+		}
+		if finishedAt.Valid {
+			op.FinishedAt = &finishedAt.Time
+		}
 
-		info, err := GetPizzaInformation(op.PizzaName)
+		details.Pizzas = append(details.Pizzas, op)
+	}
+	pizzaRows.Close()
+	if err := pizzaRows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range details.Pizzas {
+		details.Pizzas[i].Modifiers, err = getOrderPizzaModifiers(DATABASE, details.Pizzas[i].ID)
 		if err != nil {
 			return nil, err
 		}
-		priceFloat, _ := info.Cost.Float64()
-		op.Price = priceFloat
-
-		details.Pizzas = append(details.Pizzas, op)
 	}
 
 	extraQuery := `
-		SELECT oei.id, oei.order_id, oei.extra_item_id, ei.name, ei.category, ei.price, oei.quantity 
+		SELECT oei.id, oei.order_id, oei.extra_item_id, ei.name, ei.category, oei.unit_price, oei.vat_rate, oei.quantity, oei.free_quantity
 		FROM order_extra_item oei
 		JOIN extra_item ei ON oei.extra_item_id = ei.id
 		WHERE oei.order_id = ?
@@ -342,48 +529,25 @@ func GetOrderDetails(orderID int) (*OrderDetails, error) {
 
 	for extraRows.Next() {
 		var oe OrderExtraItem
-		err := extraRows.Scan(&oe.ID, &oe.OrderID, &oe.ExtraItemID, &oe.ExtraItemName, &oe.Category, &oe.Price, &oe.Quantity)
+		err := extraRows.Scan(&oe.ID, &oe.OrderID, &oe.ExtraItemID, &oe.ExtraItemName, &oe.Category, &oe.Price, &oe.VATRate, &oe.Quantity, &oe.FreeQuantity)
 		if err != nil {
 			return nil, err
 		}
 		details.ExtraItems = append(details.ExtraItems, oe)
 	}
 
-	details.TotalPrice, err = calculateOrderTotal(&details)
+	details.Breakdown, err = GetOrderBreakdown(orderID)
 	if err != nil {
 		return nil, err
 	}
+	details.TotalPrice = details.Breakdown.Total
 
-	return &details, nil
-}
-
-func calculateOrderTotal(details *OrderDetails) (float64, error) {
-	total := 0.0
-
-	for _, op := range details.Pizzas {
-		pizza, err := GetPizzaByID(op.PizzaID)
-		if err != nil {
-			return 0, err
-		}
-		info, err := GetPizzaInformation(pizza.Name)
-		if err != nil {
-			return 0, err
-		}
-		priceFloat, _ := info.Cost.Float64()
-		total += priceFloat * float64(op.Quantity)
-	}
-
-	for _, oe := range details.ExtraItems {
-		total += oe.Price * float64(oe.Quantity)
+	details.StatusHistory, err = GetOrderStatusHistory(orderID)
+	if err != nil {
+		return nil, err
 	}
 
-	return total, nil
-}
-
-func UpdateOrderStatus(orderID int, status string) error {
-	query := `UPDATE orders SET status = ? WHERE id = ?`
-	_, err := DATABASE.Exec(query, status, orderID)
-	return err
+	return &details, nil
 }
 
 func DeleteOrder(orderID int) error {
@@ -392,19 +556,87 @@ func DeleteOrder(orderID int) error {
 	return err
 }
 
-func GetAllOrders() ([]Order, error) {
+// OrderFilter narrows down and pages the admin order list. Blank fields don't filter.
+type OrderFilter struct {
+	Status OrderStatus
+	// Placed from From up to, not including, To
+	From *time.Time
+	To   *time.Time
+	// CustomerID matches one customer, Customer any whose name contains it
+	CustomerID int
+	Customer   string
+	// The delivery_person id, not their user id
+	DeliveryPersonID int
+	// Postal codes starting with it
+	PostalCode string
+	ListOptions
+}
+
+var orderSorts = sortColumns{
+	"id":          "o.id",
+	"timestamp":   "o.timestamp",
+	"status":      "o.status",
+	"customer":    "c.name",
+	"postal_code": "o.postal_code",
+	"total":       "o.total_price",
+}
+
+// ListOrders returns a page of the orders matching the filter, newest first unless it sorts them
+// otherwise, and how many match across all pages.
+func ListOrders(filter OrderFilter) ([]Order, int, error) {
+	var conditions []string
+	var args []any
+	if filter.Status != "" {
+		conditions = append(conditions, "o.status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.From != nil {
+		conditions = append(conditions, "o.timestamp >= ?")
+		args = append(args, *filter.From)
+	}
+	if filter.To != nil {
+		conditions = append(conditions, "o.timestamp < ?")
+		args = append(args, *filter.To)
+	}
+	if filter.CustomerID != 0 {
+		conditions = append(conditions, "o.customer_id = ?")
+		args = append(args, filter.CustomerID)
+	}
+	if filter.Customer != "" {
+		conditions = append(conditions, "c.name LIKE ?")
+		args = append(args, "%"+filter.Customer+"%")
+	}
+	if filter.DeliveryPersonID != 0 {
+		conditions = append(conditions, "o.delivery_person_id = ?")
+		args = append(args, filter.DeliveryPersonID)
+	}
+	if filter.PostalCode != "" {
+		conditions = append(conditions, "o.postal_code LIKE ?")
+		args = append(args, filter.PostalCode+"%")
+	}
+	where := whereClause(conditions)
+
+	orderBy, err := filter.orderBy(orderSorts, "o.timestamp DESC, o.id DESC", "o.id")
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := countRows("orders o LEFT JOIN customer c ON o.customer_id = c.id", where, args)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	page, pageArgs := filter.page()
 	query := `
 		SELECT o.id, o.customer_id, c.name as customer_name, o.timestamp, o.status, o.postal_code, o.delivery_address,
-		       o.discount_code_id, dc.code, dc.discount_percentage, o.delivery_person_id, dp.name as delivery_person_name
+		       o.discount_code_id, dc.code, o.discount_percentage, o.discount_amount, o.delivery_person_id, dp.name as delivery_person_name,
+		       o.total_price
 		FROM orders o
 		LEFT JOIN customer c ON o.customer_id = c.id
 		LEFT JOIN discount_code dc ON o.discount_code_id = dc.id
-		LEFT JOIN delivery_person dp ON o.delivery_person_id = dp.id
-		ORDER BY o.timestamp DESC
-	`
-	rows, err := DATABASE.Query(query)
+		LEFT JOIN delivery_person dp ON o.delivery_person_id = dp.id` + where + orderBy + page
+	rows, err := DATABASE.Query(query, append(args, pageArgs...)...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
@@ -416,9 +648,9 @@ func GetAllOrders() ([]Order, error) {
 
 		err := rows.Scan(&order.ID, &order.CustomerID, &customerName, &order.Timestamp, &order.Status,
 			&order.PostalCode, &order.DeliveryAddress, &discountCodeID, &discountCode, &discountPercentage,
-			&deliveryPersonID, &deliveryPersonName)
+			&order.DiscountAmount, &deliveryPersonID, &deliveryPersonName, &order.TotalPrice)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 
 		if customerName.Valid {
@@ -435,7 +667,7 @@ func GetAllOrders() ([]Order, error) {
 			code := discountCode.String
 			order.DiscountCode = &code
 		}
-		if discountPercentage.Valid {
+		if discountPercentage.Valid && discountPercentage.Int64 > 0 {
 			pct := int(discountPercentage.Int64)
 			order.DiscountPercentage = &pct
 		}
@@ -451,5 +683,5 @@ func GetAllOrders() ([]Order, error) {
 		orders = append(orders, order)
 	}
 
-	return orders, nil
+	return orders, total, rows.Err()
 }
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrCancelWindowPassed     = errors.New("the cancellation window for this order has passed")
+	ErrOrderAlreadyDispatched = errors.New("order already has a delivery person")
+	ErrCancelReasonRequired   = errors.New("a reason is required to cancel an order")
+)
+
+// CancelWindow is how long after placing an order the customer can still cancel it.
+// Set with ORDER_CANCEL_WINDOW, e.g. "5m".
+var CancelWindow = 5 * time.Minute
+
+type cancellableOrder struct {
+	Status           OrderStatus
+	CustomerID       int
+	Timestamp        time.Time
+	DeliveryPersonID sql.NullInt64
+}
+
+func getOrderForCancel(q queryer, orderID int) (cancellableOrder, error) {
+	var o cancellableOrder
+	err := q.QueryRow(
+		"SELECT status, customer_id, timestamp, delivery_person_id FROM orders WHERE id = ?"+currentDialect.forUpdate,
+		orderID,
+	).Scan(&o.Status, &o.CustomerID, &o.Timestamp, &o.DeliveryPersonID)
+	if err == sql.ErrNoRows {
+		return o, ErrOrderNotFound
+	}
+	return o, err
+}
+
+// releaseDiscountUsage gives back the use of a discount code the order made, towards both its limits.
+func releaseDiscountUsage(q queryer, orderID int) error {
+	_, err := q.Exec(`DELETE FROM discount_usage WHERE order_id = ?`, orderID)
+	return err
+}
+
+// CancelOrderByCustomer cancels one of the customer's own orders. That is only possible within
+// CancelWindow of placing it, while it is still in the kitchen and before a courier has it.
+func CancelOrderByCustomer(orderID, customerID, userID int) error {
+	tx, err := DATABASE.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	o, err := getOrderForCancel(tx, orderID)
+	if err != nil {
+		return err
+	}
+	// Someone else's order looks the same as a missing one
+	if o.CustomerID != customerID {
+		return ErrOrderNotFound
+	}
+	if time.Since(o.Timestamp) > CancelWindow {
+		return ErrCancelWindowPassed
+	}
+	if o.DeliveryPersonID.Valid {
+		return ErrOrderAlreadyDispatched
+	}
+
+	err = transitionOrder(tx, orderID, OrderCancelled, userID)
+	if err != nil {
+		return err
+	}
+	if err := releaseDiscountUsage(tx, orderID); err != nil {
+		return err
+	}
+	if err := returnStock(tx, orderID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CancelOrderByAdmin cancels any order that isn't finished yet, also once it left the kitchen.
+func CancelOrderByAdmin(orderID, adminUserID int, reason string) error {
+	if reason == "" {
+		return ErrCancelReasonRequired
+	}
+
+	tx, err := DATABASE.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	o, err := getOrderForCancel(tx, orderID)
+	if err != nil {
+		return err
+	}
+	if o.Status.IsFinal() {
+		return &IllegalTransitionError{OrderID: orderID, From: o.Status, To: OrderCancelled}
+	}
+
+	_, err = tx.Exec("UPDATE orders SET status = ? WHERE id = ?", OrderCancelled, orderID)
+	if err != nil {
+		return err
+	}
+	err = recordOrderStatus(tx, orderID, &o.Status, OrderCancelled, adminUserID, reason)
+	if err != nil {
+		return err
+	}
+	if err := releaseDiscountUsage(tx, orderID); err != nil {
+		return err
+	}
+	if err := rollbackLoyalty(tx, orderID); err != nil {
+		return err
+	}
+	if err := returnStock(tx, orderID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
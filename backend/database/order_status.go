@@ -0,0 +1,197 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrOrderNotFound = errors.New("order not found")
+
+type OrderStatus string
+
+const (
+	OrderPlaced         OrderStatus = "PLACED"
+	OrderConfirmed      OrderStatus = "CONFIRMED"
+	OrderInKitchen      OrderStatus = "IN_KITCHEN"
+	OrderBaking         OrderStatus = "BAKING"
+	OrderReady          OrderStatus = "READY"
+	OrderOutForDelivery OrderStatus = "OUT_FOR_DELIVERY"
+	OrderDelivered      OrderStatus = "DELIVERED"
+	OrderFailed         OrderStatus = "FAILED"
+	OrderCancelled      OrderStatus = "CANCELLED"
+)
+
+// OrderStatuses lists every status in lifecycle order, e.g. for dropdowns.
+var OrderStatuses = []OrderStatus{
+	OrderPlaced, OrderConfirmed, OrderInKitchen, OrderBaking, OrderReady,
+	OrderOutForDelivery, OrderDelivered, OrderFailed, OrderCancelled,
+}
+
+// orderTransitions is the order lifecycle. DELIVERED, FAILED and CANCELLED are final.
+// Orders can be cancelled while they are still in the kitchen, after that only an admin can (see CancelOrderByAdmin).
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderPlaced:         {OrderConfirmed, OrderCancelled},
+	OrderConfirmed:      {OrderInKitchen, OrderCancelled},
+	OrderInKitchen:      {OrderBaking, OrderCancelled},
+	OrderBaking:         {OrderReady, OrderCancelled},
+	OrderReady:          {OrderOutForDelivery},
+	OrderOutForDelivery: {OrderDelivered, OrderFailed},
+}
+
+func ParseOrderStatus(status string) (OrderStatus, error) {
+	for _, s := range OrderStatuses {
+		if string(s) == status {
+			return s, nil
+		}
+	}
+	return "", ErrInvalidStatus
+}
+
+// CanTransition reports whether an order may go straight from one status to the other.
+func (s OrderStatus) CanTransition(to OrderStatus) bool {
+	for _, next := range orderTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// NextStatuses returns the statuses an order in this status can move to.
+func (s OrderStatus) NextStatuses() []OrderStatus {
+	return orderTransitions[s]
+}
+
+// IsFinal reports whether the order is done, nothing can change its status anymore.
+func (s OrderStatus) IsFinal() bool {
+	return len(orderTransitions[s]) == 0
+}
+
+// IllegalTransitionError is returned when an order is asked to skip or go back in its lifecycle.
+type IllegalTransitionError struct {
+	OrderID int
+	From    OrderStatus
+	To      OrderStatus
+}
+
+func (e *IllegalTransitionError) Error() string {
+	return fmt.Sprintf("order %d can't go from %s to %s", e.OrderID, e.From, e.To)
+}
+
+type OrderStatusChange struct {
+	FromStatus *OrderStatus `json:"from_status"`
+	ToStatus   OrderStatus  `json:"to_status"`
+	ChangedBy  *int         `json:"changed_by"`
+	Username   *string      `json:"username"`
+	Reason     *string      `json:"reason"`
+	ChangedAt  time.Time    `json:"changed_at"`
+}
+
+// nullableUserID maps the "no actor" user ID 0 (system, generator) to NULL.
+func nullableUserID(userID int) any {
+	if userID == 0 {
+		return nil
+	}
+	return userID
+}
+
+// recordOrderStatus writes one row of order_status_history. from is nil when the order was just placed.
+func recordOrderStatus(q queryer, orderID int, from *OrderStatus, to OrderStatus, actorUserID int, reason string) error {
+	var nullableReason *string
+	if reason != "" {
+		nullableReason = &reason
+	}
+	_, err := q.Exec(
+		`INSERT INTO order_status_history (order_id, from_status, to_status, changed_by, reason, changed_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		orderID, from, to, nullableUserID(actorUserID), nullableReason, time.Now(),
+	)
+	return err
+}
+
+// transitionOrder moves an order to a new status if the lifecycle allows it, and records who did it.
+// Run it inside a transaction, so the check and the update can't interleave with another change.
+func transitionOrder(q queryer, orderID int, to OrderStatus, actorUserID int) error {
+	var from OrderStatus
+	err := q.QueryRow("SELECT status FROM orders WHERE id = ?"+currentDialect.forUpdate, orderID).Scan(&from)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrOrderNotFound
+		}
+		return err
+	}
+
+	if !from.CanTransition(to) {
+		return &IllegalTransitionError{OrderID: orderID, From: from, To: to}
+	}
+
+	_, err = q.Exec("UPDATE orders SET status = ? WHERE id = ?", to, orderID)
+	if err != nil {
+		return err
+	}
+	// The customer didn't get the pizzas, so they don't count for loyalty
+	if to == OrderCancelled || to == OrderFailed {
+		if err := rollbackLoyalty(q, orderID); err != nil {
+			return err
+		}
+	}
+	return recordOrderStatus(q, orderID, &from, to, actorUserID, "")
+}
+
+// UpdateOrderStatus moves an order along its lifecycle. actorUserID is who asked for it, 0 for the system.
+func UpdateOrderStatus(orderID int, status OrderStatus, actorUserID int) error {
+	tx, err := DATABASE.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := transitionOrder(tx, orderID, status, actorUserID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetOrderStatusHistory returns every status change of an order, oldest first.
+func GetOrderStatusHistory(orderID int) ([]OrderStatusChange, error) {
+	rows, err := DATABASE.Query(`
+		SELECT h.from_status, h.to_status, h.changed_by, u.username, h.reason, h.changed_at
+		FROM order_status_history h
+		LEFT JOIN user u ON h.changed_by = u.id
+		WHERE h.order_id = ?
+		ORDER BY h.changed_at ASC, h.id ASC
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []OrderStatusChange{}
+	for rows.Next() {
+		var change OrderStatusChange
+		var from sql.NullString
+		var changedBy sql.NullInt64
+		var username sql.NullString
+		var reason sql.NullString
+		if err := rows.Scan(&from, &change.ToStatus, &changedBy, &username, &reason, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		if from.Valid {
+			s := OrderStatus(from.String)
+			change.FromStatus = &s
+		}
+		if changedBy.Valid {
+			id := int(changedBy.Int64)
+			change.ChangedBy = &id
+		}
+		if username.Valid {
+			change.Username = &username.String
+		}
+		if reason.Valid {
+			change.Reason = &reason.String
+		}
+		history = append(history, change)
+	}
+	return history, rows.Err()
+}
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOrderStatusCanTransition(t *testing.T) {
+	legal := map[[2]OrderStatus]bool{
+		{OrderPlaced, OrderConfirmed}:         true,
+		{OrderPlaced, OrderCancelled}:         true,
+		{OrderConfirmed, OrderInKitchen}:      true,
+		{OrderConfirmed, OrderCancelled}:      true,
+		{OrderInKitchen, OrderBaking}:         true,
+		{OrderInKitchen, OrderCancelled}:      true,
+		{OrderBaking, OrderReady}:             true,
+		{OrderBaking, OrderCancelled}:         true,
+		{OrderReady, OrderOutForDelivery}:     true,
+		{OrderOutForDelivery, OrderDelivered}: true,
+		{OrderOutForDelivery, OrderFailed}:    true,
+	}
+	for _, from := range OrderStatuses {
+		for _, to := range OrderStatuses {
+			if got := from.CanTransition(to); got != legal[[2]OrderStatus{from, to}] {
+				t.Errorf("%s.CanTransition(%s) = %v", from, to, got)
+			}
+		}
+	}
+	for _, status := range []OrderStatus{OrderDelivered, OrderFailed, OrderCancelled} {
+		if !status.IsFinal() {
+			t.Errorf("%s isn't final", status)
+		}
+	}
+}
+
+// placeLoyaltyTestOrder places an order of two Margheritas for the customer placeTestOrders made.
+func placeLoyaltyTestOrder(t *testing.T, customerID int) int {
+	t.Helper()
+	var userID, margheritaID int
+	if err := DATABASE.QueryRow(`SELECT user_id FROM customer WHERE id = ?`, customerID).Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	if err := DATABASE.QueryRow(`SELECT id FROM pizza WHERE name = 'Margherita'`).Scan(&margheritaID); err != nil {
+		t.Fatal(err)
+	}
+	orderID, err := CreateOrderWithTransaction(customerID, userID, "Main St 1", "87104", []PizzaOrderItem{{PizzaID: margheritaID, Quantity: 2}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return orderID
+}
+
+func TestUpdateOrderStatus(t *testing.T) {
+	migrateTestDB(t)
+	customerID := placeTestOrders(t)
+	orderID := placeLoyaltyTestOrder(t, customerID)
+	var adminID int
+	if err := DATABASE.QueryRow(`SELECT id FROM user WHERE username = 'admin'`).Scan(&adminID); err != nil {
+		t.Fatal(err)
+	}
+
+	var illegal *IllegalTransitionError
+	err := UpdateOrderStatus(orderID, OrderReady, adminID)
+	if !errors.As(err, &illegal) || illegal.From != OrderPlaced || illegal.To != OrderReady {
+		t.Errorf("skipping to READY: %v, want an IllegalTransitionError", err)
+	}
+	if err := UpdateOrderStatus(orderID+100, OrderConfirmed, adminID); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("moving a missing order: %v, want ErrOrderNotFound", err)
+	}
+
+	for _, status := range []OrderStatus{OrderConfirmed, OrderInKitchen} {
+		if err := UpdateOrderStatus(orderID, status, adminID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := UpdateOrderStatus(orderID, OrderPlaced, adminID); !errors.As(err, &illegal) {
+		t.Errorf("going back to PLACED: %v, want an IllegalTransitionError", err)
+	}
+
+	history, err := GetOrderStatusHistory(orderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []OrderStatus{OrderPlaced, OrderConfirmed, OrderInKitchen}
+	if len(history) != len(want) {
+		t.Fatalf("history has %d changes, want %d", len(history), len(want))
+	}
+	for i, change := range history {
+		if change.ToStatus != want[i] {
+			t.Errorf("change %d is to %s, want %s", i, change.ToStatus, want[i])
+		}
+		if i == 0 {
+			continue
+		}
+		if change.FromStatus == nil || *change.FromStatus != want[i-1] {
+			t.Errorf("change %d is from %v, want %s", i, change.FromStatus, want[i-1])
+		}
+		if change.ChangedBy == nil || *change.ChangedBy != adminID {
+			t.Errorf("change %d is by %v, want the admin %d", i, change.ChangedBy, adminID)
+		}
+	}
+}
+
+func TestUpdateOrderStatusRollsBackLoyalty(t *testing.T) {
+	tests := []struct {
+		name string
+		path []OrderStatus
+	}{
+		{"cancelled", []OrderStatus{OrderConfirmed, OrderCancelled}},
+		{"failed", []OrderStatus{OrderConfirmed, OrderInKitchen, OrderBaking, OrderReady, OrderOutForDelivery, OrderFailed}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			migrateTestDB(t)
+			customerID := placeTestOrders(t)
+			loyalty := func() (counter, rewards int) {
+				t.Helper()
+				err := DATABASE.QueryRow(`SELECT pizza_counter, loyalty_rewards FROM customer WHERE id = ?`, customerID).Scan(&counter, &rewards)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return counter, rewards
+			}
+
+			counter, rewards := loyalty()
+			orderID := placeLoyaltyTestOrder(t, customerID)
+			if c, r := loyalty(); c == counter && r == rewards {
+				t.Fatal("the order didn't change the customer's loyalty")
+			}
+			for _, status := range test.path {
+				if err := UpdateOrderStatus(orderID, status, 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if c, r := loyalty(); c != counter || r != rewards {
+				t.Errorf("counter %d, rewards %d, want %d and %d from before the order", c, r, counter, rewards)
+			}
+			var pizzas, rewardsUsed int
+			err := DATABASE.QueryRow(`SELECT loyalty_pizzas, loyalty_rewards_used FROM orders WHERE id = ?`, orderID).Scan(&pizzas, &rewardsUsed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pizzas != 0 || rewardsUsed != 0 {
+				t.Errorf("the order still has %d loyalty pizzas and %d rewards used", pizzas, rewardsUsed)
+			}
+		})
+	}
+}
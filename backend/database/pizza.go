@@ -21,6 +21,10 @@ type PizzaWithPrice struct {
 	Price        float64            `json:"price"`
 	IsVegan      bool               `json:"is_vegan"`
 	IsVegetarian bool               `json:"is_vegetarian"`
+	// False when an ingredient has less stock than one pizza needs
+	Available bool `json:"available"`
+	// Price is the default size and crust, Variants has every combination
+	Variants []VariantPrice `json:"variants"`
 }
 
 func (p Pizza) String() string {
@@ -200,7 +204,8 @@ type PizzaInformation struct {
 	IsVegan      bool
 }
 
-func GetPizzaInformation(pizzaName string) (PizzaInformation, error) {
+// GetPizzaInformation prices a pizza in the given size and crust, 0 picks the default one.
+func GetPizzaInformation(pizzaName string, sizeID, crustID int) (PizzaInformation, error) {
 	var pizzaID int
 
 	err := DATABASE.QueryRow("SELECT id FROM pizza WHERE name = ?", pizzaName).Scan(&pizzaID)
@@ -211,65 +216,47 @@ func GetPizzaInformation(pizzaName string) (PizzaInformation, error) {
 		return PizzaInformation{}, err
 	}
 
-	rows, err := DATABASE.Query(`
-		SELECT cost, has_meat, has_animal_products
-		FROM ingredient i
-		JOIN pizza_ingredient pi ON pi.ingredient_id = i.id
-		WHERE pi.pizza_id = ?
-	`, pizzaID)
+	variant, err := getPizzaVariant(DATABASE, sizeID, crustID)
 	if err != nil {
 		return PizzaInformation{}, err
 	}
-	defer rows.Close()
-
-	ingredientsCost := getPizzaDoughCost()
-	isVegetarian := true
-	isVegan := true
-
-	for rows.Next() {
-		var costStr string
-		var hasMeat bool
-		var hasAnimalProducts bool
-
-		err := rows.Scan(&costStr, &hasMeat, &hasAnimalProducts)
-		if err != nil {
-			return PizzaInformation{}, err
-		}
-
-		cost, err := decimal.NewFromString(costStr)
-		if err != nil {
-			return PizzaInformation{}, fmt.Errorf("invalid cost in database: %s", costStr)
-		}
-
-		ingredientsCost = ingredientsCost.Add(cost)
+	return getPizzaInformationByID(DATABASE, pizzaID, variant)
+}
 
-		if hasMeat {
-			isVegetarian = false
-			isVegan = false
-		} else if hasAnimalProducts {
-			isVegan = false
-		}
+func getPizzaInformationByID(q queryer, pizzaID int, variant PizzaVariant) (PizzaInformation, error) {
+	cfg, err := getPricingConfig(q)
+	if err != nil {
+		return PizzaInformation{}, err
 	}
+	info, ingredientsCost, err := getPizzaIngredientInfo(q, pizzaID)
+	if err != nil {
+		return PizzaInformation{}, err
+	}
+	info.Cost = getPizzaVariantCost(cfg, ingredientsCost, variant)
+	return info, nil
+}
 
-	totalCost := getPizzaFinalCost(ingredientsCost)
-
-	return PizzaInformation{
-		Cost:         totalCost,
-		IsVegetarian: isVegetarian,
-		IsVegan:      isVegan,
-	}, nil
+// getPizzaIngredientInfo sums up the ingredients of a pizza and works out its diet. The returned info has no Cost yet.
+func getPizzaIngredientInfo(q queryer, pizzaID int) (PizzaInformation, decimal.Decimal, error) {
+	portions, err := getRecipePortions(q, pizzaID)
+	if err != nil {
+		return PizzaInformation{}, decimal.Zero, err
+	}
+	info, ingredientsCost := summarizePortions(portions)
+	return info, ingredientsCost, nil
 }
 
-func getPizzaDoughCost() decimal.Decimal {
-	return decimal.NewFromFloat(5.0)
+// getPizzaVariantCost is the menu price of a pizza in a size and crust: their dough plus the scaled ingredients.
+func getPizzaVariantCost(cfg PricingConfig, ingredientsCost decimal.Decimal, variant PizzaVariant) decimal.Decimal {
+	return getPizzaFinalCost(cfg, variant.doughCost().Add(ingredientsCost.Mul(variant.ingredientMultiplier())))
 }
 
-func getPizzaFinalCost(ingredientsCost decimal.Decimal) decimal.Decimal {
-	// Add 40% margin :)
-	totalCost := ingredientsCost.Mul(decimal.NewFromFloat(1.4))
-	// Add 9% VAT (stupid)
-	totalCost = totalCost.Mul(decimal.NewFromFloat(1.09))
-	return totalCost
+// getPizzaFinalCost puts the configured margin and VAT on top of what a pizza costs to make, rounded to cents.
+func getPizzaFinalCost(cfg PricingConfig, cost decimal.Decimal) decimal.Decimal {
+	one := decimal.NewFromInt(1)
+	totalCost := cost.Mul(one.Add(cfg.PizzaMarginRate))
+	totalCost = totalCost.Mul(one.Add(cfg.PizzaVATRate))
+	return cfg.round(totalCost)
 }
 
 func GetAllPizzasWithPrice() ([]PizzaWithPrice, error) {
@@ -278,14 +265,51 @@ func GetAllPizzasWithPrice() ([]PizzaWithPrice, error) {
 		return nil, err
 	}
 
+	unavailable, err := unavailablePizzaIDs(DATABASE)
+	if err != nil {
+		return nil, err
+	}
+
+	sizes, err := getPizzaOptions(DATABASE, SizeOption)
+	if err != nil {
+		return nil, err
+	}
+	crusts, err := getPizzaOptions(DATABASE, CrustOption)
+	if err != nil {
+		return nil, err
+	}
+	defaultVariant, err := getPizzaVariant(DATABASE, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := getPricingConfig(DATABASE)
+	if err != nil {
+		return nil, err
+	}
+
 	pizzasWithPrice := make([]PizzaWithPrice, len(pizzas))
 	for i, pizza := range pizzas {
-		info, err := GetPizzaInformation(pizza.Name)
+		info, ingredientsCost, err := getPizzaIngredientInfo(DATABASE, pizza.ID)
 		if err != nil {
 			return nil, err
 		}
 
-		priceFloat, _ := info.Cost.Float64()
+		variants := []VariantPrice{}
+		for _, size := range sizes {
+			for _, crust := range crusts {
+				price, _ := getPizzaVariantCost(cfg, ingredientsCost, PizzaVariant{Size: size, Crust: crust}).Float64()
+				variants = append(variants, VariantPrice{
+					SizeID:    size.ID,
+					SizeName:  size.Name,
+					CrustID:   crust.ID,
+					CrustName: crust.Name,
+					Price:     price,
+					IsDefault: size.ID == defaultVariant.Size.ID && crust.ID == defaultVariant.Crust.ID,
+				})
+			}
+		}
+
+		priceFloat, _ := getPizzaVariantCost(cfg, ingredientsCost, defaultVariant).Float64()
 
 		pizzasWithPrice[i] = PizzaWithPrice{
 			ID:           pizza.ID,
@@ -294,6 +318,8 @@ func GetAllPizzasWithPrice() ([]PizzaWithPrice, error) {
 			Price:        priceFloat,
 			IsVegan:      info.IsVegan,
 			IsVegetarian: info.IsVegetarian,
+			Available:    !unavailable[pizza.ID],
+			Variants:     variants,
 		}
 	}
 
@@ -0,0 +1,223 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrInvalidModifier = errors.New("a topping can only be added, or removed when the pizza has it, once per pizza")
+	ErrEmptyPizza      = errors.New("a pizza needs at least one ingredient")
+)
+
+// ModifierAction is what a PizzaModifier does to the recipe.
+type ModifierAction string
+
+const (
+	AddIngredient    ModifierAction = "ADD"
+	RemoveIngredient ModifierAction = "REMOVE"
+)
+
+// PizzaModifier adds an ingredient to one pizza line or takes it off.
+// Adding an ingredient the recipe already has puts on an extra portion.
+type PizzaModifier struct {
+	IngredientID   int            `json:"ingredient_id"`
+	IngredientName string         `json:"ingredient_name"`
+	Action         ModifierAction `json:"action"`
+}
+
+func (m PizzaModifier) String() string {
+	if m.Action == RemoveIngredient {
+		return "no " + m.IngredientName
+	}
+	return "+ " + m.IngredientName
+}
+
+// describePizza is the pizza name followed by its modifiers, e.g. "Margherita (no Mozzarella, + Mushrooms)".
+func describePizza(name string, modifiers []PizzaModifier) string {
+	if len(modifiers) == 0 {
+		return name
+	}
+	changes := make([]string, len(modifiers))
+	for i, m := range modifiers {
+		changes[i] = m.String()
+	}
+	return fmt.Sprintf("%s (%s)", name, strings.Join(changes, ", "))
+}
+
+// pizzaPortion is one ingredient as it goes on a pizza, before the size and crust scale it.
+type pizzaPortion struct {
+	IngredientID      int
+	Cost              decimal.Decimal
+	Amount            decimal.Decimal
+	HasMeat           bool
+	HasAnimalProducts bool
+}
+
+func scanPizzaPortion(row interface{ Scan(...any) error }) (pizzaPortion, error) {
+	var p pizzaPortion
+	var costStr, amountStr string
+	if err := row.Scan(&p.IngredientID, &costStr, &amountStr, &p.HasMeat, &p.HasAnimalProducts); err != nil {
+		return pizzaPortion{}, err
+	}
+	var err error
+	if p.Cost, err = decimal.NewFromString(costStr); err != nil {
+		return pizzaPortion{}, fmt.Errorf("invalid cost in database: %s", costStr)
+	}
+	if p.Amount, err = decimal.NewFromString(amountStr); err != nil {
+		return pizzaPortion{}, fmt.Errorf("invalid amount in database: %s", amountStr)
+	}
+	return p, nil
+}
+
+// getRecipePortions loads the ingredients of a pizza as the menu has it.
+func getRecipePortions(q queryer, pizzaID int) ([]pizzaPortion, error) {
+	rows, err := q.Query(`
+		SELECT i.id, i.cost, pi.amount, i.has_meat, i.has_animal_products
+		FROM ingredient i
+		JOIN pizza_ingredient pi ON pi.ingredient_id = i.id
+		WHERE pi.pizza_id = ?
+	`, pizzaID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var portions []pizzaPortion
+	for rows.Next() {
+		p, err := scanPizzaPortion(rows)
+		if err != nil {
+			return nil, err
+		}
+		portions = append(portions, p)
+	}
+	return portions, rows.Err()
+}
+
+// getPizzaPortions loads the ingredients of a pizza with the modifiers applied.
+// Removing an ingredient the recipe doesn't have (anymore) does nothing, validateModifiers catches that for new orders.
+func getPizzaPortions(q queryer, pizzaID int, modifiers []PizzaModifier) ([]pizzaPortion, error) {
+	portions, err := getRecipePortions(q, pizzaID)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range modifiers {
+		switch m.Action {
+		case RemoveIngredient:
+			portions = slices.DeleteFunc(portions, func(p pizzaPortion) bool { return p.IngredientID == m.IngredientID })
+		case AddIngredient:
+			p, err := scanPizzaPortion(q.QueryRow(`SELECT id, cost, portion, has_meat, has_animal_products FROM ingredient WHERE id = ?`, m.IngredientID))
+			if err == sql.ErrNoRows {
+				return nil, ErrIngredientNotFound
+			}
+			if err != nil {
+				return nil, err
+			}
+			portions = append(portions, p)
+		}
+	}
+	return portions, nil
+}
+
+// validateModifiers checks the modifiers of a new pizza line against the current recipe.
+func validateModifiers(q queryer, pizzaID int, modifiers []PizzaModifier) error {
+	if len(modifiers) == 0 {
+		return nil
+	}
+	recipe, err := getRecipePortions(q, pizzaID)
+	if err != nil {
+		return err
+	}
+	seen := map[int]bool{}
+	for _, m := range modifiers {
+		if seen[m.IngredientID] {
+			return ErrInvalidModifier
+		}
+		seen[m.IngredientID] = true
+
+		switch m.Action {
+		case AddIngredient:
+		case RemoveIngredient:
+			onRecipe := slices.ContainsFunc(recipe, func(p pizzaPortion) bool { return p.IngredientID == m.IngredientID })
+			if !onRecipe {
+				return ErrInvalidModifier
+			}
+		default:
+			return ErrInvalidModifier
+		}
+	}
+	return nil
+}
+
+// summarizePortions adds up the cost of the ingredients and works out the diet. The returned info has no Cost yet.
+func summarizePortions(portions []pizzaPortion) (PizzaInformation, decimal.Decimal) {
+	ingredientsCost := decimal.Zero
+	info := PizzaInformation{IsVegetarian: true, IsVegan: true}
+	for _, p := range portions {
+		ingredientsCost = ingredientsCost.Add(p.Cost)
+		if p.HasMeat {
+			info.IsVegetarian = false
+			info.IsVegan = false
+		} else if p.HasAnimalProducts {
+			info.IsVegan = false
+		}
+	}
+	return info, ingredientsCost
+}
+
+// PriceCustomPizza prices a pizza with modifiers in the given size and crust, 0 picks the default one.
+func PriceCustomPizza(pizzaID, sizeID, crustID int, modifiers []PizzaModifier) (PizzaInformation, error) {
+	variant, err := getPizzaVariant(DATABASE, sizeID, crustID)
+	if err != nil {
+		return PizzaInformation{}, err
+	}
+	cfg, err := getPricingConfig(DATABASE)
+	if err != nil {
+		return PizzaInformation{}, err
+	}
+	item, err := pricePizza(DATABASE, cfg, pizzaID, variant, modifiers)
+	if err != nil {
+		return PizzaInformation{}, err
+	}
+	return PizzaInformation{Cost: item.UnitPrice, IsVegetarian: item.IsVegetarian, IsVegan: item.IsVegan}, nil
+}
+
+func insertOrderPizzaModifiers(q queryer, orderPizzaID int, modifiers []PizzaModifier) error {
+	for _, m := range modifiers {
+		_, err := q.Exec(`INSERT INTO order_pizza_modifier (order_pizza_id, ingredient_id, action) VALUES (?, ?, ?)`, orderPizzaID, m.IngredientID, m.Action)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getOrderPizzaModifiers loads the modifiers of one pizza line, removals first.
+func getOrderPizzaModifiers(q queryer, orderPizzaID int) ([]PizzaModifier, error) {
+	rows, err := q.Query(`
+		SELECT m.ingredient_id, i.name, m.action
+		FROM order_pizza_modifier m
+		JOIN ingredient i ON m.ingredient_id = i.id
+		WHERE m.order_pizza_id = ?
+		ORDER BY m.action DESC, i.name
+	`, orderPizzaID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	modifiers := []PizzaModifier{}
+	for rows.Next() {
+		var m PizzaModifier
+		if err := rows.Scan(&m.IngredientID, &m.IngredientName, &m.Action); err != nil {
+			return nil, err
+		}
+		modifiers = append(modifiers, m)
+	}
+	return modifiers, rows.Err()
+}
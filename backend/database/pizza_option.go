@@ -0,0 +1,224 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrPizzaOptionNotFound = errors.New("pizza size or crust not found")
+	ErrInvalidPizzaOption  = errors.New("a size or crust needs a name, a dough cost of at least 0 and a multiplier above 0")
+)
+
+// PizzaOptionKind is what a PizzaOption is: a size or a crust.
+type PizzaOptionKind string
+
+const (
+	SizeOption  PizzaOptionKind = "size"
+	CrustOption PizzaOptionKind = "crust"
+)
+
+func ParsePizzaOptionKind(kind string) (PizzaOptionKind, error) {
+	switch PizzaOptionKind(kind) {
+	case SizeOption, CrustOption:
+		return PizzaOptionKind(kind), nil
+	}
+	return "", fmt.Errorf("unknown pizza option %q, must be %q or %q", kind, SizeOption, CrustOption)
+}
+
+func (k PizzaOptionKind) table() string {
+	if k == CrustOption {
+		return "crust_type"
+	}
+	return "pizza_size"
+}
+
+// PizzaOption is a size or a crust. Its dough cost is added to the pizza, the ingredients
+// (their cost and the stock they use) are scaled by IngredientMultiplier.
+type PizzaOption struct {
+	ID                   int             `json:"id"`
+	Name                 string          `json:"name"`
+	DoughCost            decimal.Decimal `json:"dough_cost"`
+	IngredientMultiplier decimal.Decimal `json:"ingredient_multiplier"`
+	IsDefault            bool            `json:"is_default"`
+	SortOrder            int             `json:"sort_order"`
+}
+
+// PizzaVariant is the size and crust a pizza is made in.
+type PizzaVariant struct {
+	Size  PizzaOption
+	Crust PizzaOption
+}
+
+func (v PizzaVariant) doughCost() decimal.Decimal {
+	return v.Size.DoughCost.Add(v.Crust.DoughCost)
+}
+
+func (v PizzaVariant) ingredientMultiplier() decimal.Decimal {
+	return v.Size.IngredientMultiplier.Mul(v.Crust.IngredientMultiplier)
+}
+
+// VariantPrice is the price of a pizza in one size and crust.
+type VariantPrice struct {
+	SizeID    int     `json:"size_id"`
+	SizeName  string  `json:"size_name"`
+	CrustID   int     `json:"crust_id"`
+	CrustName string  `json:"crust_name"`
+	Price     float64 `json:"price"`
+	IsDefault bool    `json:"is_default"`
+}
+
+func scanPizzaOption(row interface{ Scan(...any) error }) (PizzaOption, error) {
+	var opt PizzaOption
+	var doughCost, multiplier string
+	if err := row.Scan(&opt.ID, &opt.Name, &doughCost, &multiplier, &opt.IsDefault, &opt.SortOrder); err != nil {
+		return PizzaOption{}, err
+	}
+	var err error
+	if opt.DoughCost, err = decimal.NewFromString(doughCost); err != nil {
+		return PizzaOption{}, fmt.Errorf("invalid dough cost in database: %s", doughCost)
+	}
+	if opt.IngredientMultiplier, err = decimal.NewFromString(multiplier); err != nil {
+		return PizzaOption{}, fmt.Errorf("invalid multiplier in database: %s", multiplier)
+	}
+	return opt, nil
+}
+
+// GetPizzaOptions lists the sizes or crusts in menu order.
+func GetPizzaOptions(kind PizzaOptionKind) ([]PizzaOption, error) {
+	return getPizzaOptions(DATABASE, kind)
+}
+
+func getPizzaOptions(q queryer, kind PizzaOptionKind) ([]PizzaOption, error) {
+	rows, err := q.Query(`SELECT id, name, dough_cost, ingredient_multiplier, is_default, sort_order FROM ` + kind.table() + ` ORDER BY sort_order, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	options := []PizzaOption{}
+	for rows.Next() {
+		opt, err := scanPizzaOption(rows)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, opt)
+	}
+	return options, rows.Err()
+}
+
+// getPizzaOption loads one size or crust. ID 0 means the default one, or the first if none is marked default.
+func getPizzaOption(q queryer, kind PizzaOptionKind, id int) (PizzaOption, error) {
+	query := `SELECT id, name, dough_cost, ingredient_multiplier, is_default, sort_order FROM ` + kind.table()
+	var row *sql.Row
+	if id == 0 {
+		row = q.QueryRow(query + ` ORDER BY is_default DESC, sort_order, id LIMIT 1`)
+	} else {
+		row = q.QueryRow(query+` WHERE id = ?`, id)
+	}
+	opt, err := scanPizzaOption(row)
+	if err == sql.ErrNoRows {
+		return PizzaOption{}, ErrPizzaOptionNotFound
+	}
+	return opt, err
+}
+
+// getPizzaVariant loads a size and crust, 0 picks the default.
+func getPizzaVariant(q queryer, sizeID, crustID int) (PizzaVariant, error) {
+	size, err := getPizzaOption(q, SizeOption, sizeID)
+	if err != nil {
+		return PizzaVariant{}, err
+	}
+	crust, err := getPizzaOption(q, CrustOption, crustID)
+	if err != nil {
+		return PizzaVariant{}, err
+	}
+	return PizzaVariant{Size: size, Crust: crust}, nil
+}
+
+func validatePizzaOption(opt PizzaOption) error {
+	if opt.Name == "" || opt.DoughCost.IsNegative() || !opt.IngredientMultiplier.IsPositive() {
+		return ErrInvalidPizzaOption
+	}
+	return nil
+}
+
+// CreatePizzaOption adds a size or crust. If it is the default one, the old default stops being it.
+func CreatePizzaOption(kind PizzaOptionKind, opt PizzaOption) (int, error) {
+	if err := validatePizzaOption(opt); err != nil {
+		return 0, err
+	}
+
+	tx, err := DATABASE.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if opt.IsDefault {
+		if _, err := tx.Exec(`UPDATE ` + kind.table() + ` SET is_default = FALSE`); err != nil {
+			return 0, err
+		}
+	}
+	res, err := tx.Exec(
+		`INSERT INTO `+kind.table()+` (name, dough_cost, ingredient_multiplier, is_default, sort_order) VALUES (?, ?, ?, ?, ?)`,
+		opt.Name, opt.DoughCost.String(), opt.IngredientMultiplier.String(), opt.IsDefault, opt.SortOrder,
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), tx.Commit()
+}
+
+// UpdatePizzaOption changes a size or crust. Placed orders keep the price they were charged.
+func UpdatePizzaOption(kind PizzaOptionKind, id int, opt PizzaOption) error {
+	if err := validatePizzaOption(opt); err != nil {
+		return err
+	}
+
+	tx, err := DATABASE.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := getPizzaOption(tx, kind, id); err != nil {
+		return err
+	}
+	if opt.IsDefault {
+		if _, err := tx.Exec(`UPDATE `+kind.table()+` SET is_default = FALSE WHERE id <> ?`, id); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(
+		`UPDATE `+kind.table()+` SET name = ?, dough_cost = ?, ingredient_multiplier = ?, is_default = ?, sort_order = ? WHERE id = ?`,
+		opt.Name, opt.DoughCost.String(), opt.IngredientMultiplier.String(), opt.IsDefault, opt.SortOrder, id,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeletePizzaOption removes a size or crust. That fails once it has been ordered, since order_pizza refers to it.
+func DeletePizzaOption(kind PizzaOptionKind, id int) error {
+	res, err := DATABASE.Exec(`DELETE FROM `+kind.table()+` WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrPizzaOptionNotFound
+	}
+	return nil
+}
@@ -0,0 +1,332 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// CurrencySymbol follows the amounts the shop shows, "12.50 €" like on the menu.
+const CurrencySymbol = "€"
+
+// PriceLine is one row of an order or cart. Prices already include VAT.
+// FreeQuantity units are given away by promotions and RewardQuantity units as a loyalty reward, neither is charged.
+// The discount code, or a promotion's percentage off, only takes money off Discountable lines.
+type PriceLine struct {
+	Quantity       int
+	FreeQuantity   int
+	RewardQuantity int
+	UnitPrice      decimal.Decimal
+	VATRate        decimal.Decimal
+	Discountable   bool
+}
+
+// paid is what the line costs before the discount code.
+func (l PriceLine) paid() decimal.Decimal {
+	return l.UnitPrice.Mul(decimal.NewFromInt(int64(l.Quantity - l.FreeQuantity - l.RewardQuantity)))
+}
+
+// PriceBreakdown is what the customer gets shown, at checkout and later on.
+type PriceBreakdown struct {
+	Subtotal           float64 `json:"subtotal"`
+	PromotionDiscount  float64 `json:"promotion_discount"`
+	LoyaltyDiscount    float64 `json:"loyalty_discount"`
+	DiscountPercentage int     `json:"discount_percentage"`
+	Discount           float64 `json:"discount"`
+	VAT                float64 `json:"vat"`
+	DeliveryFee        float64 `json:"delivery_fee"`
+	Total              float64 `json:"total"`
+	// Names of the promotions the order got
+	Promotions []string `json:"promotions,omitempty"`
+	// Where the order goes, left out of quotes without a postal code
+	DeliveryZone     string `json:"delivery_zone,omitempty"`
+	EstimatedMinutes int    `json:"estimated_minutes,omitempty"`
+}
+
+// CalculatePriceBreakdown is the single pricing pipeline:
+// subtotal -> promotion freebies -> loyalty reward -> discount code -> delivery fee -> total, with the included VAT split out.
+// The code takes discountPercentage, or the fixed discountAmount, off the Discountable lines, never off the delivery fee.
+func CalculatePriceBreakdown(lines []PriceLine, discountPercentage int, discountAmount decimal.Decimal, delivery PriceLine) PriceBreakdown {
+	hundred := decimal.NewFromInt(100)
+
+	subtotal := decimal.Zero
+	freebies := decimal.Zero
+	rewards := decimal.Zero
+	discountable := decimal.Zero
+	for _, line := range lines {
+		subtotal = subtotal.Add(line.UnitPrice.Mul(decimal.NewFromInt(int64(line.Quantity))))
+		freebies = freebies.Add(line.UnitPrice.Mul(decimal.NewFromInt(int64(line.FreeQuantity))))
+		rewards = rewards.Add(line.UnitPrice.Mul(decimal.NewFromInt(int64(line.RewardQuantity))))
+		if line.Discountable {
+			discountable = discountable.Add(line.paid())
+		}
+	}
+
+	// What is left of a discountable line after the code
+	keep := decimal.NewFromInt(int64(100 - discountPercentage)).Div(hundred)
+	discount := discountable.Mul(decimal.NewFromInt(int64(discountPercentage))).Div(hundred).Round(2)
+	if discountAmount.IsPositive() {
+		// A fixed amount can't take off more than the lines it applies to cost
+		discount = decimal.Min(discountAmount, discountable)
+		keep = decimal.NewFromInt(1)
+		if discountable.IsPositive() {
+			keep = keep.Sub(discount.Div(discountable))
+		}
+	}
+
+	vat := decimal.Zero
+	for _, line := range lines {
+		// VAT is included in the price, so take it back out of what is actually paid for this line
+		paid := line.paid()
+		if line.Discountable {
+			paid = paid.Mul(keep)
+		}
+		vat = vat.Add(paid.Sub(paid.Div(decimal.NewFromInt(1).Add(line.VATRate))))
+	}
+	deliveryFee := delivery.paid()
+	vat = vat.Add(deliveryFee.Sub(deliveryFee.Div(decimal.NewFromInt(1).Add(delivery.VATRate))))
+
+	afterFreebies := subtotal.Sub(freebies).Sub(rewards)
+	total := afterFreebies.Sub(discount).Add(deliveryFee)
+
+	breakdown := PriceBreakdown{DiscountPercentage: discountPercentage}
+	breakdown.Subtotal, _ = subtotal.Round(2).Float64()
+	breakdown.PromotionDiscount, _ = freebies.Round(2).Float64()
+	breakdown.LoyaltyDiscount, _ = rewards.Round(2).Float64()
+	breakdown.Discount, _ = discount.Float64()
+	breakdown.DeliveryFee, _ = deliveryFee.Round(2).Float64()
+	breakdown.VAT, _ = vat.Round(2).Float64()
+	breakdown.Total, _ = total.Round(2).Float64()
+	return breakdown
+}
+
+type pricedItem struct {
+	ID           int
+	Quantity     int
+	FreeQuantity int
+	UnitPrice    decimal.Decimal
+	VATRate      decimal.Decimal
+	Discountable bool
+	// Only set for extra items, "dessert" or "drink"
+	Category string
+	// Only set for extra items a promotion added, the customer didn't order them
+	Gift bool
+	// Only set for pizzas
+	RewardQuantity int
+	MarginRate     decimal.Decimal
+	Variant        PizzaVariant
+	Modifiers      []PizzaModifier
+	Portions       []pizzaPortion
+	IsVegetarian   bool
+	IsVegan        bool
+}
+
+type pricedOrder struct {
+	Pizzas             []pricedItem
+	ExtraItems         []pricedItem
+	DiscountCodeID     *int
+	DiscountPercentage int
+	DiscountAmount     decimal.Decimal
+	LoyaltyRewardsUsed int
+	Promotions         []Promotion
+	// Normalized, empty when the order isn't priced for delivery yet
+	PostalCode   string
+	DeliveryZone *DeliveryZone
+	Delivery     PriceLine
+	Breakdown    PriceBreakdown
+}
+
+func (i pricedItem) line() PriceLine {
+	return PriceLine{
+		Quantity:       i.Quantity,
+		FreeQuantity:   i.FreeQuantity,
+		RewardQuantity: i.RewardQuantity,
+		UnitPrice:      i.UnitPrice,
+		VATRate:        i.VATRate,
+		Discountable:   i.Discountable,
+	}
+}
+
+func (i pricedItem) paid() decimal.Decimal {
+	return i.line().paid()
+}
+
+func (o pricedOrder) lines() []PriceLine {
+	var lines []PriceLine
+	for _, p := range o.Pizzas {
+		lines = append(lines, p.line())
+	}
+	for _, e := range o.ExtraItems {
+		lines = append(lines, e.line())
+	}
+	return lines
+}
+
+// QuoteOrder prices a cart exactly the way checkout will, without placing the order.
+// Without a postal code the delivery fee is left out, checkout always needs one.
+func QuoteOrder(userID int, postalCode string, pizzaItems []PizzaOrderItem, extraItems []ExtraOrderItem, discountCode *string) (PriceBreakdown, error) {
+	var delivery *string
+	if strings.TrimSpace(postalCode) != "" {
+		delivery = &postalCode
+	}
+	priced, err := priceOrder(DATABASE, userID, delivery, pizzaItems, extraItems, discountCode)
+	if err != nil {
+		return PriceBreakdown{}, err
+	}
+	return priced.Breakdown, nil
+}
+
+// priceOrder snapshots the current prices of every item and runs them through the pricing pipeline.
+// The order is priced for delivery to postalCode, nil leaves delivery out.
+func priceOrder(q queryer, userID int, postalCode *string, pizzaItems []PizzaOrderItem, extraItems []ExtraOrderItem, discountCode *string) (pricedOrder, error) {
+	var priced pricedOrder
+
+	cfg, err := getPricingConfig(q)
+	if err != nil {
+		return pricedOrder{}, err
+	}
+
+	// A code that can't be used fails the order with the reason, the customer can remove it and try again
+	var dc *DiscountCode
+	var codePromotion *Promotion
+	if discountCode != nil && *discountCode != "" {
+		code, err := getDiscountCodeByCode(q, *discountCode)
+		if err == ErrDiscountCodeNotFound {
+			return pricedOrder{}, &DiscountRejectedError{Code: *discountCode, Err: err}
+		}
+		if err != nil {
+			return pricedOrder{}, err
+		}
+		if err := checkDiscountCode(q, userID, code, time.Now()); err != nil {
+			return pricedOrder{}, err
+		}
+		if codePromotion, err = getCodePromotion(q, code.ID); err != nil {
+			return pricedOrder{}, err
+		}
+		dc = &code
+		priced.DiscountCodeID = &code.ID
+	}
+	automatic, err := getAutomaticPromotions(q)
+	if err != nil {
+		return pricedOrder{}, err
+	}
+	ctx, err := newPromotionContext(q, userID, time.Now())
+	if err != nil {
+		return pricedOrder{}, err
+	}
+
+	for _, item := range pizzaItems {
+		if item.Quantity <= 0 {
+			continue
+		}
+		variant, err := getPizzaVariant(q, item.SizeID, item.CrustID)
+		if err != nil {
+			return pricedOrder{}, err
+		}
+		pizza, err := pricePizza(q, cfg, item.PizzaID, variant, item.Modifiers)
+		if err != nil {
+			return pricedOrder{}, err
+		}
+		pizza.Quantity = item.Quantity
+		priced.Pizzas = append(priced.Pizzas, pizza)
+	}
+
+	for _, item := range extraItems {
+		if item.Quantity <= 0 {
+			continue
+		}
+		price, category, err := getExtraItemPrice(q, item.ExtraItemID)
+		if err != nil {
+			return pricedOrder{}, err
+		}
+		priced.ExtraItems = append(priced.ExtraItems, pricedItem{ID: item.ExtraItemID, Quantity: item.Quantity, UnitPrice: price, VATRate: cfg.extraVATRate(category), Category: category})
+	}
+
+	// Conditions are checked against the cart as the customer filled it, before any promotion adds to it
+	if codePromotion != nil {
+		if cond := codePromotion.unmetCondition(&priced, ctx); cond != nil {
+			return pricedOrder{}, &DiscountRejectedError{Code: dc.Code, Discount: *dc, Err: ErrPromotionConditionsNotMet, Condition: cond}
+		}
+	}
+	var promotions []Promotion
+	if codePromotion != nil {
+		promotions = append(promotions, *codePromotion)
+	}
+	for _, p := range automatic {
+		if p.unmetCondition(&priced, ctx) == nil {
+			promotions = append(promotions, p)
+		}
+	}
+	// A code that gives its own discount replaces the percentage off of promotions
+	codeDiscount := dc != nil && codePromotion == nil
+	for _, p := range promotions {
+		if err := applyPromotion(q, cfg, &priced, p, !codeDiscount); err != nil {
+			return pricedOrder{}, err
+		}
+	}
+
+	// A free pizza the customer earned with earlier orders
+	rewards, err := getLoyaltyRewards(q, userID)
+	if err != nil {
+		return pricedOrder{}, err
+	}
+	if rewards > 0 {
+		applyLoyaltyReward(&priced)
+	}
+
+	// A code with a promotion gives what the promotion does, every other code takes money off the lines in its scope
+	if codeDiscount {
+		if err := applyDiscountCode(&priced, *dc); err != nil {
+			return pricedOrder{}, err
+		}
+	}
+
+	if postalCode != nil {
+		priced.PostalCode = NormalizePostalCode(*postalCode)
+		zone, err := findDeliveryZone(q, priced.PostalCode)
+		if err != nil {
+			return pricedOrder{}, err
+		}
+		if err := applyDeliveryZone(cfg, &priced, zone); err != nil {
+			return pricedOrder{}, err
+		}
+	}
+
+	priced.Breakdown = CalculatePriceBreakdown(priced.lines(), priced.DiscountPercentage, priced.DiscountAmount, priced.Delivery)
+	for _, p := range priced.Promotions {
+		priced.Breakdown.Promotions = append(priced.Breakdown.Promotions, p.Name)
+	}
+	if priced.DeliveryZone != nil {
+		priced.Breakdown.DeliveryZone = priced.DeliveryZone.Name
+		priced.Breakdown.EstimatedMinutes = priced.DeliveryZone.EstimatedMinutes
+	}
+	return priced, nil
+}
+
+// pricePizza prices one pizza with its modifiers applied, with the same margin and VAT as the menu.
+// The returned item has no quantity yet.
+func pricePizza(q queryer, cfg PricingConfig, pizzaID int, variant PizzaVariant, modifiers []PizzaModifier) (pricedItem, error) {
+	if err := validateModifiers(q, pizzaID, modifiers); err != nil {
+		return pricedItem{}, err
+	}
+	portions, err := getPizzaPortions(q, pizzaID, modifiers)
+	if err != nil {
+		return pricedItem{}, err
+	}
+	if len(portions) == 0 {
+		return pricedItem{}, ErrEmptyPizza
+	}
+	info, ingredientsCost := summarizePortions(portions)
+	return pricedItem{
+		ID:           pizzaID,
+		UnitPrice:    getPizzaVariantCost(cfg, ingredientsCost, variant),
+		VATRate:      cfg.PizzaVATRate,
+		MarginRate:   cfg.PizzaMarginRate,
+		Variant:      variant,
+		Modifiers:    modifiers,
+		Portions:     portions,
+		IsVegetarian: info.IsVegetarian,
+		IsVegan:      info.IsVegan,
+	}, nil
+}
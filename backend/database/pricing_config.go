@@ -0,0 +1,225 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+var ErrInvalidPricingConfig = errors.New("rates must be between 0 and 1, the rounding mode one of HALF_UP, HALF_EVEN, UP or DOWN and the pizzas per loyalty reward between 0 and 100")
+
+// RoundingMode is how a pizza price is rounded to cents.
+type RoundingMode string
+
+const (
+	RoundHalfUp   RoundingMode = "HALF_UP"
+	RoundHalfEven RoundingMode = "HALF_EVEN"
+	RoundUp       RoundingMode = "UP"
+	RoundDown     RoundingMode = "DOWN"
+)
+
+// RoundingModes lists every rounding mode, e.g. for dropdowns.
+var RoundingModes = []RoundingMode{RoundHalfUp, RoundHalfEven, RoundUp, RoundDown}
+
+// PricingConfig holds the rates every price is computed with. It is the only place they live:
+// the Go pricing code loads it, SQL can join the pricing_config row (id 1).
+type PricingConfig struct {
+	PizzaMarginRate decimal.Decimal `json:"pizza_margin_rate"`
+	PizzaVATRate    decimal.Decimal `json:"pizza_vat_rate"`
+	DessertVATRate  decimal.Decimal `json:"dessert_vat_rate"`
+	DrinkVATRate    decimal.Decimal `json:"drink_vat_rate"`
+	RoundingMode    RoundingMode    `json:"rounding_mode"`
+	// Every this many paid pizzas earn a free one, 0 turns the loyalty program off
+	LoyaltyPizzasPerReward int        `json:"loyalty_pizzas_per_reward"`
+	UpdatedAt              *time.Time `json:"updated_at"`
+	UpdatedBy              *string    `json:"updated_by"`
+}
+
+// PricingConfigChange is one setting changed by an admin.
+type PricingConfigChange struct {
+	Setting   string    `json:"setting"`
+	OldValue  string    `json:"old_value"`
+	NewValue  string    `json:"new_value"`
+	ChangedBy *int      `json:"changed_by"`
+	Username  *string   `json:"username"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// round rounds a price to cents the configured way.
+func (c PricingConfig) round(price decimal.Decimal) decimal.Decimal {
+	switch c.RoundingMode {
+	case RoundHalfEven:
+		return price.RoundBank(2)
+	case RoundUp:
+		return price.RoundUp(2)
+	case RoundDown:
+		return price.RoundDown(2)
+	default:
+		return price.Round(2)
+	}
+}
+
+// extraVATRate is the VAT included in the price of a dessert or drink.
+func (c PricingConfig) extraVATRate(category string) decimal.Decimal {
+	if category == "drink" {
+		return c.DrinkVATRate
+	}
+	return c.DessertVATRate
+}
+
+// settings lists the editable settings by their column name, for the audit trail.
+func (c PricingConfig) settings() [][2]string {
+	return [][2]string{
+		{"pizza_margin_rate", c.PizzaMarginRate.String()},
+		{"pizza_vat_rate", c.PizzaVATRate.String()},
+		{"dessert_vat_rate", c.DessertVATRate.String()},
+		{"drink_vat_rate", c.DrinkVATRate.String()},
+		{"rounding_mode", string(c.RoundingMode)},
+		{"loyalty_pizzas_per_reward", strconv.Itoa(c.LoyaltyPizzasPerReward)},
+	}
+}
+
+func validatePricingConfig(c PricingConfig) error {
+	one := decimal.NewFromInt(1)
+	for _, rate := range []decimal.Decimal{c.PizzaMarginRate, c.PizzaVATRate, c.DessertVATRate, c.DrinkVATRate} {
+		if rate.IsNegative() || rate.GreaterThan(one) {
+			return ErrInvalidPricingConfig
+		}
+	}
+	if c.LoyaltyPizzasPerReward < 0 || c.LoyaltyPizzasPerReward > 100 {
+		return ErrInvalidPricingConfig
+	}
+	for _, mode := range RoundingModes {
+		if c.RoundingMode == mode {
+			return nil
+		}
+	}
+	return ErrInvalidPricingConfig
+}
+
+// GetPricingConfig loads the current pricing rules.
+func GetPricingConfig() (PricingConfig, error) {
+	return getPricingConfig(DATABASE)
+}
+
+func getPricingConfig(q queryer) (PricingConfig, error) {
+	var c PricingConfig
+	var margin, pizzaVAT, dessertVAT, drinkVAT string
+	var updatedAt sql.NullTime
+	var updatedBy sql.NullString
+	err := q.QueryRow(`
+		SELECT pc.pizza_margin_rate, pc.pizza_vat_rate, pc.dessert_vat_rate, pc.drink_vat_rate, pc.rounding_mode,
+		       pc.loyalty_pizzas_per_reward, pc.updated_at, u.username
+		FROM pricing_config pc
+		LEFT JOIN user u ON pc.updated_by = u.id
+		WHERE pc.id = 1
+	`).Scan(&margin, &pizzaVAT, &dessertVAT, &drinkVAT, &c.RoundingMode, &c.LoyaltyPizzasPerReward, &updatedAt, &updatedBy)
+	if err != nil {
+		return PricingConfig{}, fmt.Errorf("failed to load pricing config: %w", err)
+	}
+
+	for _, rate := range []struct {
+		value string
+		dest  *decimal.Decimal
+	}{{margin, &c.PizzaMarginRate}, {pizzaVAT, &c.PizzaVATRate}, {dessertVAT, &c.DessertVATRate}, {drinkVAT, &c.DrinkVATRate}} {
+		if *rate.dest, err = decimal.NewFromString(rate.value); err != nil {
+			return PricingConfig{}, fmt.Errorf("invalid rate in database: %s", rate.value)
+		}
+	}
+	if updatedAt.Valid {
+		c.UpdatedAt = &updatedAt.Time
+	}
+	if updatedBy.Valid {
+		c.UpdatedBy = &updatedBy.String
+	}
+	return c, nil
+}
+
+// UpdatePricingConfig replaces the pricing rules and records every setting that changed.
+// Placed orders keep the rates they were charged with.
+func UpdatePricingConfig(c PricingConfig, actorUserID int) error {
+	if err := validatePricingConfig(c); err != nil {
+		return err
+	}
+
+	tx, err := DATABASE.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the row, so two admins saving at once both end up in the history
+	var id int
+	if err := tx.QueryRow(`SELECT id FROM pricing_config WHERE id = 1` + currentDialect.forUpdate).Scan(&id); err != nil {
+		return err
+	}
+	old, err := getPricingConfig(tx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	oldSettings := old.settings()
+	for i, setting := range c.settings() {
+		if setting[1] == oldSettings[i][1] {
+			continue
+		}
+		_, err := tx.Exec(
+			`INSERT INTO pricing_config_history (setting, old_value, new_value, changed_by, changed_at) VALUES (?, ?, ?, ?, ?)`,
+			setting[0], oldSettings[i][1], setting[1], nullableUserID(actorUserID), now,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE pricing_config
+		SET pizza_margin_rate = ?, pizza_vat_rate = ?, dessert_vat_rate = ?, drink_vat_rate = ?, rounding_mode = ?,
+		    loyalty_pizzas_per_reward = ?, updated_at = ?, updated_by = ?
+		WHERE id = 1
+	`, c.PizzaMarginRate.String(), c.PizzaVATRate.String(), c.DessertVATRate.String(), c.DrinkVATRate.String(), c.RoundingMode,
+		c.LoyaltyPizzasPerReward, now, nullableUserID(actorUserID))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetPricingConfigHistory returns the latest changes to the pricing rules, newest first.
+func GetPricingConfigHistory(limit int) ([]PricingConfigChange, error) {
+	rows, err := DATABASE.Query(`
+		SELECT h.setting, h.old_value, h.new_value, h.changed_by, u.username, h.changed_at
+		FROM pricing_config_history h
+		LEFT JOIN user u ON h.changed_by = u.id
+		ORDER BY h.changed_at DESC, h.id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []PricingConfigChange{}
+	for rows.Next() {
+		var change PricingConfigChange
+		var changedBy sql.NullInt64
+		var username sql.NullString
+		if err := rows.Scan(&change.Setting, &change.OldValue, &change.NewValue, &changedBy, &username, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		if changedBy.Valid {
+			id := int(changedBy.Int64)
+			change.ChangedBy = &id
+		}
+		if username.Valid {
+			change.Username = &username.String
+		}
+		history = append(history, change)
+	}
+	return history, rows.Err()
+}
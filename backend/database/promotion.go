@@ -0,0 +1,471 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrPromotionNotFound         = errors.New("promotion not found")
+	ErrPromotionConditionsNotMet = errors.New("order doesn't meet the conditions of the promotion")
+	ErrInvalidPromotion          = errors.New("a promotion needs a name, at least one effect, and the fields every condition and effect needs: " +
+		"a day of week from 0 to 6, a category of pizza, drink or dessert, a quantity of at least 1 and a percentage between 1 and 100")
+)
+
+// ConditionKind is what a PromotionCondition checks.
+type ConditionKind string
+
+const (
+	// BirthdayCondition holds on the customer's birthday, by the birth date they registered with
+	BirthdayCondition ConditionKind = "BIRTHDAY"
+	// DayOfWeekCondition holds on DayOfWeek, 0 is Sunday
+	DayOfWeekCondition ConditionKind = "DAY_OF_WEEK"
+	// CartContainsCondition holds when the cart has at least Quantity items of Category
+	CartContainsCondition ConditionKind = "CART_CONTAINS"
+)
+
+// EffectKind is what a PromotionEffect does to the order.
+type EffectKind string
+
+const (
+	// FreeCheapestEffect gives away one of the cheapest item of Category in the cart
+	FreeCheapestEffect EffectKind = "FREE_CHEAPEST"
+	// AddFreeItemEffect adds ExtraItemID, or the cheapest extra item of Category, for free
+	AddFreeItemEffect EffectKind = "ADD_FREE_ITEM"
+	// PercentOffEffect takes Percentage off the items of Category, or off the whole order without one
+	PercentOffEffect EffectKind = "PERCENT_OFF"
+)
+
+// PromotionCategories are the categories conditions and effects work on, pizzas and the extra item categories.
+var PromotionCategories = []string{"pizza", "drink", "dessert"}
+
+type PromotionCondition struct {
+	Kind      ConditionKind `json:"kind"`
+	DayOfWeek *int          `json:"day_of_week"`
+	Category  string        `json:"category"`
+	Quantity  int           `json:"quantity"`
+}
+
+type PromotionEffect struct {
+	Kind        EffectKind `json:"kind"`
+	Category    string     `json:"category"`
+	ExtraItemID *int       `json:"extra_item_id"`
+	Percentage  int        `json:"percentage"`
+}
+
+// Promotion is a deal: when all its conditions hold, its effects apply. With a DiscountCodeID the customer
+// gets it by entering that code, instead of the code's own discount. Without one it applies to every order
+// that meets the conditions.
+type Promotion struct {
+	ID             int                  `json:"id"`
+	Name           string               `json:"name"`
+	Description    string               `json:"description"`
+	DiscountCodeID *int                 `json:"discount_code_id"`
+	DiscountCode   *string              `json:"discount_code"`
+	IsActive       bool                 `json:"is_active"`
+	Conditions     []PromotionCondition `json:"conditions"`
+	Effects        []PromotionEffect    `json:"effects"`
+}
+
+// HasCondition reports whether the promotion checks kind, e.g. to find the birthday deal.
+func (p Promotion) HasCondition(kind ConditionKind) bool {
+	return slices.ContainsFunc(p.Conditions, func(c PromotionCondition) bool { return c.Kind == kind })
+}
+
+// promotionContext is what conditions are checked against besides the cart.
+type promotionContext struct {
+	Now        time.Time
+	IsBirthday bool
+}
+
+func newPromotionContext(q queryer, userID int, now time.Time) (promotionContext, error) {
+	isBirthday, err := isCustomerBirthday(q, userID, now)
+	return promotionContext{Now: now, IsBirthday: isBirthday}, err
+}
+
+// isCustomerBirthday checks the birth date of the customer with this user ID, false for non-customers.
+func isCustomerBirthday(q queryer, userID int, now time.Time) (bool, error) {
+	var birthDate sql.NullTime
+	err := q.QueryRow(`SELECT birth_date FROM customer WHERE user_id = ?`, userID).Scan(&birthDate)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !birthDate.Valid {
+		return false, nil
+	}
+	return now.Month() == birthDate.Time.Month() && now.Day() == birthDate.Time.Day(), nil
+}
+
+// itemsIn returns the items of the order in category, every item for "".
+func (o *pricedOrder) itemsIn(category string) []*pricedItem {
+	var items []*pricedItem
+	if category == "" || category == "pizza" {
+		for i := range o.Pizzas {
+			items = append(items, &o.Pizzas[i])
+		}
+	}
+	for i := range o.ExtraItems {
+		if category == "" || o.ExtraItems[i].Category == category {
+			items = append(items, &o.ExtraItems[i])
+		}
+	}
+	return items
+}
+
+func (c PromotionCondition) holds(priced *pricedOrder, ctx promotionContext) bool {
+	switch c.Kind {
+	case BirthdayCondition:
+		return ctx.IsBirthday
+	case DayOfWeekCondition:
+		return c.DayOfWeek != nil && int(ctx.Now.Weekday()) == *c.DayOfWeek
+	case CartContainsCondition:
+		count := 0
+		for _, item := range priced.itemsIn(c.Category) {
+			count += item.Quantity
+		}
+		return count >= c.Quantity
+	default:
+		return false
+	}
+}
+
+// unmetCondition returns the first condition of the promotion that doesn't hold, nil if they all do.
+func (p Promotion) unmetCondition(priced *pricedOrder, ctx promotionContext) *PromotionCondition {
+	for i, c := range p.Conditions {
+		if !c.holds(priced, ctx) {
+			return &p.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// applyPromotion applies the effects of a promotion whose conditions hold. A percentage off doesn't stack with
+// a discount code, the code replaces it, so percentOff is false when the order has one. The promotion is only
+// recorded on the order if it gave something.
+func applyPromotion(q queryer, cfg PricingConfig, priced *pricedOrder, p Promotion, percentOff bool) error {
+	applied := false
+	for _, effect := range p.Effects {
+		switch effect.Kind {
+		case FreeCheapestEffect:
+			var cheapest *pricedItem
+			for _, item := range priced.itemsIn(effect.Category) {
+				if item.Quantity-item.FreeQuantity-item.RewardQuantity <= 0 {
+					continue
+				}
+				if cheapest == nil || item.UnitPrice.LessThan(cheapest.UnitPrice) {
+					cheapest = item
+				}
+			}
+			if cheapest != nil {
+				cheapest.FreeQuantity++
+				applied = true
+			}
+
+		case AddFreeItemEffect:
+			var id int
+			var priceStr, category string
+			var err error
+			if effect.ExtraItemID != nil {
+				err = q.QueryRow(`SELECT id, price, category FROM extra_item WHERE id = ?`, *effect.ExtraItemID).Scan(&id, &priceStr, &category)
+			} else {
+				err = q.QueryRow(`SELECT id, price, category FROM extra_item WHERE category = ? ORDER BY price ASC LIMIT 1`, effect.Category).Scan(&id, &priceStr, &category)
+			}
+			// Nothing to give away, the rest of the promotion still applies
+			if err == sql.ErrNoRows {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			price, err := decimal.NewFromString(priceStr)
+			if err != nil {
+				return err
+			}
+			priced.ExtraItems = append(priced.ExtraItems, pricedItem{ID: id, Quantity: 1, FreeQuantity: 1, UnitPrice: price, VATRate: cfg.extraVATRate(category), Category: category, Gift: true})
+			applied = true
+
+		case PercentOffEffect:
+			// One percentage per order, the first promotion to give one wins
+			items := priced.itemsIn(effect.Category)
+			if !percentOff || priced.DiscountPercentage > 0 || len(items) == 0 {
+				continue
+			}
+			for _, item := range items {
+				item.Discountable = true
+			}
+			priced.DiscountPercentage = effect.Percentage
+			applied = true
+		}
+	}
+	if applied {
+		priced.Promotions = append(priced.Promotions, p)
+	}
+	return nil
+}
+
+func validatePromotion(p Promotion) error {
+	if strings.TrimSpace(p.Name) == "" || len(p.Effects) == 0 {
+		return ErrInvalidPromotion
+	}
+	knownCategory := func(category string) bool { return slices.Contains(PromotionCategories, category) }
+	for _, c := range p.Conditions {
+		switch c.Kind {
+		case BirthdayCondition:
+		case DayOfWeekCondition:
+			if c.DayOfWeek == nil || *c.DayOfWeek < 0 || *c.DayOfWeek > 6 {
+				return ErrInvalidPromotion
+			}
+		case CartContainsCondition:
+			if !knownCategory(c.Category) || c.Quantity < 1 {
+				return ErrInvalidPromotion
+			}
+		default:
+			return ErrInvalidPromotion
+		}
+	}
+	for _, e := range p.Effects {
+		switch e.Kind {
+		case FreeCheapestEffect:
+			if !knownCategory(e.Category) {
+				return ErrInvalidPromotion
+			}
+		case AddFreeItemEffect:
+			// Pizzas are made to order, only extra items can be added
+			if e.ExtraItemID == nil && e.Category != "drink" && e.Category != "dessert" {
+				return ErrInvalidPromotion
+			}
+		case PercentOffEffect:
+			if (e.Category != "" && !knownCategory(e.Category)) || e.Percentage < 1 || e.Percentage > 100 {
+				return ErrInvalidPromotion
+			}
+		default:
+			return ErrInvalidPromotion
+		}
+	}
+	return nil
+}
+
+func nullableString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// loadPromotions loads the promotions that match where, with their conditions and effects.
+func loadPromotions(q queryer, where string, args ...any) ([]Promotion, error) {
+	rows, err := q.Query(`
+		SELECT p.id, p.name, p.description, p.discount_code_id, dc.code, p.is_active
+		FROM promotion p
+		LEFT JOIN discount_code dc ON p.discount_code_id = dc.id
+		WHERE `+where+`
+		ORDER BY p.id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	promotions := []Promotion{}
+	for rows.Next() {
+		var p Promotion
+		var discountCodeID sql.NullInt64
+		var discountCode sql.NullString
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &discountCodeID, &discountCode, &p.IsActive); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if discountCodeID.Valid {
+			id := int(discountCodeID.Int64)
+			p.DiscountCodeID = &id
+		}
+		if discountCode.Valid {
+			p.DiscountCode = &discountCode.String
+		}
+		promotions = append(promotions, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range promotions {
+		if err := loadPromotionRules(q, &promotions[i]); err != nil {
+			return nil, err
+		}
+	}
+	return promotions, nil
+}
+
+func loadPromotionRules(q queryer, p *Promotion) error {
+	p.Conditions = []PromotionCondition{}
+	p.Effects = []PromotionEffect{}
+
+	rows, err := q.Query(`SELECT kind, day_of_week, category, quantity FROM promotion_condition WHERE promotion_id = ? ORDER BY id`, p.ID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var c PromotionCondition
+		var dayOfWeek, quantity sql.NullInt64
+		var category sql.NullString
+		if err := rows.Scan(&c.Kind, &dayOfWeek, &category, &quantity); err != nil {
+			rows.Close()
+			return err
+		}
+		if dayOfWeek.Valid {
+			day := int(dayOfWeek.Int64)
+			c.DayOfWeek = &day
+		}
+		c.Category = category.String
+		c.Quantity = int(quantity.Int64)
+		p.Conditions = append(p.Conditions, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = q.Query(`SELECT kind, category, extra_item_id, percentage FROM promotion_effect WHERE promotion_id = ? ORDER BY id`, p.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e PromotionEffect
+		var category sql.NullString
+		var extraItemID, percentage sql.NullInt64
+		if err := rows.Scan(&e.Kind, &category, &extraItemID, &percentage); err != nil {
+			return err
+		}
+		e.Category = category.String
+		if extraItemID.Valid {
+			id := int(extraItemID.Int64)
+			e.ExtraItemID = &id
+		}
+		e.Percentage = int(percentage.Int64)
+		p.Effects = append(p.Effects, e)
+	}
+	return rows.Err()
+}
+
+func GetAllPromotions() ([]Promotion, error) {
+	return loadPromotions(DATABASE, "1 = 1")
+}
+
+// getAutomaticPromotions loads the active promotions that don't need a code.
+func getAutomaticPromotions(q queryer) ([]Promotion, error) {
+	return loadPromotions(q, "p.is_active AND p.discount_code_id IS NULL")
+}
+
+// getCodePromotion loads the active promotion the discount code gives, nil if it gives its own discount.
+func getCodePromotion(q queryer, discountCodeID int) (*Promotion, error) {
+	promotions, err := loadPromotions(q, "p.is_active AND p.discount_code_id = ?", discountCodeID)
+	if err != nil || len(promotions) == 0 {
+		return nil, err
+	}
+	return &promotions[0], nil
+}
+
+func CreatePromotion(p Promotion) (int, error) {
+	if err := validatePromotion(p); err != nil {
+		return 0, err
+	}
+
+	tx, err := DATABASE.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT INTO promotion (name, description, discount_code_id, is_active) VALUES (?, ?, ?, ?)`,
+		p.Name, p.Description, p.DiscountCodeID, p.IsActive)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range p.Conditions {
+		var quantity any
+		if c.Kind == CartContainsCondition {
+			quantity = c.Quantity
+		}
+		_, err := tx.Exec(`INSERT INTO promotion_condition (promotion_id, kind, day_of_week, category, quantity) VALUES (?, ?, ?, ?, ?)`,
+			id, c.Kind, c.DayOfWeek, nullableString(c.Category), quantity)
+		if err != nil {
+			return 0, err
+		}
+	}
+	for _, e := range p.Effects {
+		var percentage any
+		if e.Kind == PercentOffEffect {
+			percentage = e.Percentage
+		}
+		_, err := tx.Exec(`INSERT INTO promotion_effect (promotion_id, kind, category, extra_item_id, percentage) VALUES (?, ?, ?, ?, ?)`,
+			id, e.Kind, nullableString(e.Category), e.ExtraItemID, percentage)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return int(id), tx.Commit()
+}
+
+// SetPromotionActive switches a promotion on or off. Orders that got it keep what it gave them.
+func SetPromotionActive(id int, isActive bool) error {
+	var existing int
+	if err := DATABASE.QueryRow(`SELECT id FROM promotion WHERE id = ?`, id).Scan(&existing); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrPromotionNotFound
+		}
+		return err
+	}
+	_, err := DATABASE.Exec(`UPDATE promotion SET is_active = ? WHERE id = ?`, isActive, id)
+	return err
+}
+
+func DeletePromotion(id int) error {
+	_, err := DATABASE.Exec(`DELETE FROM promotion WHERE id = ?`, id)
+	return err
+}
+
+func insertOrderPromotions(q queryer, orderID int, promotions []Promotion) error {
+	for _, p := range promotions {
+		if _, err := q.Exec(`INSERT INTO order_promotion (order_id, promotion_id) VALUES (?, ?)`, orderID, p.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getOrderPromotionNames lists the promotions the order got, by name.
+func getOrderPromotionNames(q queryer, orderID int) ([]string, error) {
+	rows, err := q.Query(`
+		SELECT p.name FROM order_promotion op
+		JOIN promotion p ON op.promotion_id = p.id
+		WHERE op.order_id = ?
+		ORDER BY p.id
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
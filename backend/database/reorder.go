@@ -0,0 +1,235 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// ReorderProblem is why a line of a past order doesn't go back in the cart as it was.
+type ReorderProblem string
+
+const (
+	// The recipe changed so the toppings can't be changed the same way, the line is left out. Ordered pizzas,
+	// sizes, crusts, toppings and extra items can't be deleted, their order lines keep them.
+	ReorderUnavailable ReorderProblem = "UNAVAILABLE"
+	// The line costs something else now, it is in the cart at the new price
+	ReorderRepriced ReorderProblem = "REPRICED"
+	// The kitchen is out of an ingredient, the line is in the cart but checkout refuses it until restocked
+	ReorderOutOfStock ReorderProblem = "OUT_OF_STOCK"
+)
+
+// ReorderItem is a line of a past order as it goes back in the cart, priced as the menu is now.
+// The fields are the ones of a cart line.
+type ReorderItem struct {
+	Type      string          `json:"type"` // "pizza" or "extra"
+	ID        int             `json:"id"`
+	Name      string          `json:"name"`
+	Price     float64         `json:"price"`
+	Quantity  int             `json:"quantity"`
+	SizeID    int             `json:"size_id"`
+	CrustID   int             `json:"crust_id"`
+	Modifiers []PizzaModifier `json:"modifiers"`
+}
+
+type ReorderWarning struct {
+	Type    string         `json:"type"`
+	ID      int            `json:"id"`
+	Name    string         `json:"name"`
+	Problem ReorderProblem `json:"problem"`
+	Message string         `json:"message"`
+}
+
+// Reorder is a past order rebuilt as a cart, with what changed since.
+type Reorder struct {
+	OrderID  int              `json:"order_id"`
+	Items    []ReorderItem    `json:"items"`
+	Warnings []ReorderWarning `json:"warnings"`
+}
+
+// reorderPizza is a pizza line of the past order.
+type reorderPizza struct {
+	orderPizzaID int
+	pizzaID      int
+	name         string
+	sizeID       int
+	sizeName     string
+	crustID      int
+	crustName    string
+	quantity     int
+	unitPrice    string
+}
+
+// GetOrderHistory returns a page of the customer's orders with their lines, totals and status
+// timeline, the filter's customer is replaced by customerID.
+func GetOrderHistory(customerID int, filter OrderFilter) ([]OrderDetails, int, error) {
+	filter.CustomerID = customerID
+	filter.Customer = ""
+	orders, total, err := ListOrders(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	history := make([]OrderDetails, 0, len(orders))
+	for _, order := range orders {
+		details, err := GetOrderDetails(order.ID)
+		if err != nil {
+			return nil, 0, err
+		}
+		history = append(history, *details)
+	}
+	return history, total, nil
+}
+
+// GetReorder rebuilds the cart of one of the customer's orders with today's menu and prices. Pizzas whose
+// toppings can't be changed the same way anymore are left out, they and the lines that cost something else
+// now get a warning.
+// Items a promotion added for free aren't reordered, checkout adds them again when the promotion still applies.
+// Orders of other customers are ErrOrderNotFound.
+func GetReorder(orderID, customerID int) (Reorder, error) {
+	var ownerID int
+	err := DATABASE.QueryRow(`SELECT customer_id FROM orders WHERE id = ?`, orderID).Scan(&ownerID)
+	if err == sql.ErrNoRows || (err == nil && ownerID != customerID) {
+		return Reorder{}, ErrOrderNotFound
+	}
+	if err != nil {
+		return Reorder{}, err
+	}
+
+	cfg, err := getPricingConfig(DATABASE)
+	if err != nil {
+		return Reorder{}, err
+	}
+	outOfStock, err := unavailablePizzaIDs(DATABASE)
+	if err != nil {
+		return Reorder{}, err
+	}
+
+	reorder := Reorder{OrderID: orderID, Items: []ReorderItem{}, Warnings: []ReorderWarning{}}
+	warn := func(itemType string, id int, name string, problem ReorderProblem, message string) {
+		reorder.Warnings = append(reorder.Warnings, ReorderWarning{Type: itemType, ID: id, Name: name, Problem: problem, Message: message})
+	}
+
+	pizzas, err := getReorderPizzas(orderID)
+	if err != nil {
+		return Reorder{}, err
+	}
+	for _, p := range pizzas {
+		modifiers, err := getOrderPizzaModifiers(DATABASE, p.orderPizzaID)
+		if err != nil {
+			return Reorder{}, err
+		}
+		name := describePizza(fmt.Sprintf("%s (%s, %s)", p.name, p.sizeName, p.crustName), modifiers)
+
+		variant, err := getPizzaVariant(DATABASE, p.sizeID, p.crustID)
+		if err != nil {
+			return Reorder{}, err
+		}
+		item, err := pricePizza(DATABASE, cfg, p.pizzaID, variant, modifiers)
+		if err != nil {
+			if errors.Is(err, ErrInvalidModifier) || errors.Is(err, ErrEmptyPizza) {
+				warn("pizza", p.pizzaID, name, ReorderUnavailable, "The recipe changed, these toppings can't be changed the same way anymore")
+				continue
+			}
+			return Reorder{}, err
+		}
+
+		price, _ := item.UnitPrice.Float64()
+		reorder.Items = append(reorder.Items, ReorderItem{
+			Type:      "pizza",
+			ID:        p.pizzaID,
+			Name:      name,
+			Price:     price,
+			Quantity:  p.quantity,
+			SizeID:    variant.Size.ID,
+			CrustID:   variant.Crust.ID,
+			Modifiers: modifiers,
+		})
+		if message, repriced := repricedMessage(p.unitPrice, item.UnitPrice); repriced {
+			warn("pizza", p.pizzaID, name, ReorderRepriced, message)
+		}
+		if outOfStock[p.pizzaID] {
+			warn("pizza", p.pizzaID, name, ReorderOutOfStock, "We are out of an ingredient of this pizza right now")
+		}
+	}
+
+	rows, err := DATABASE.Query(`
+		SELECT oe.extra_item_id, e.name, e.price, oe.quantity, oe.unit_price
+		FROM order_extra_item oe
+		JOIN extra_item e ON oe.extra_item_id = e.id
+		WHERE oe.order_id = ? AND NOT oe.is_gift
+		ORDER BY oe.id
+	`, orderID)
+	if err != nil {
+		return Reorder{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var extraItemID, quantity int
+		var name, price, unitPrice string
+		if err := rows.Scan(&extraItemID, &name, &price, &quantity, &unitPrice); err != nil {
+			return Reorder{}, err
+		}
+		current, err := decimal.NewFromString(price)
+		if err != nil {
+			return Reorder{}, err
+		}
+		currentFloat, _ := current.Float64()
+		reorder.Items = append(reorder.Items, ReorderItem{Type: "extra", ID: extraItemID, Name: name, Price: currentFloat, Quantity: quantity, Modifiers: []PizzaModifier{}})
+		if message, repriced := repricedMessage(unitPrice, current); repriced {
+			warn("extra", extraItemID, name, ReorderRepriced, message)
+		}
+	}
+	return reorder, rows.Err()
+}
+
+// ReorderIntoCart adds what can still be ordered of one of the customer's past orders to their cart, see
+// GetReorder. What is in the cart already stays, the same lines add up.
+func ReorderIntoCart(orderID, customerID int) (Reorder, error) {
+	reorder, err := GetReorder(orderID, customerID)
+	if err != nil || len(reorder.Items) == 0 {
+		return reorder, err
+	}
+	lines := make([]CartLine, len(reorder.Items))
+	for i, item := range reorder.Items {
+		lines[i] = CartLine{Type: item.Type, ID: item.ID, SizeID: item.SizeID, CrustID: item.CrustID, Quantity: item.Quantity, Modifiers: item.Modifiers}
+	}
+	return reorder, AddLinesToCart(customerID, lines)
+}
+
+func getReorderPizzas(orderID int) ([]reorderPizza, error) {
+	rows, err := DATABASE.Query(`
+		SELECT op.id, op.pizza_id, p.name, op.size_id, s.name, op.crust_id, c.name, op.quantity, op.unit_price
+		FROM order_pizza op
+		JOIN pizza p ON op.pizza_id = p.id
+		JOIN pizza_size s ON op.size_id = s.id
+		JOIN crust_type c ON op.crust_id = c.id
+		WHERE op.order_id = ?
+		ORDER BY op.id
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pizzas []reorderPizza
+	for rows.Next() {
+		var p reorderPizza
+		err := rows.Scan(&p.orderPizzaID, &p.pizzaID, &p.name, &p.sizeID, &p.sizeName, &p.crustID, &p.crustName, &p.quantity, &p.unitPrice)
+		if err != nil {
+			return nil, err
+		}
+		pizzas = append(pizzas, p)
+	}
+	return pizzas, rows.Err()
+}
+
+// repricedMessage says what a line costs now when it's not what the order paid.
+func repricedMessage(paid string, current decimal.Decimal) (string, bool) {
+	previous, err := decimal.NewFromString(paid)
+	if err != nil || previous.Equal(current) {
+		return "", false
+	}
+	return fmt.Sprintf("Now %s %s each, was %s %s", current.StringFixed(2), CurrencySymbol, previous.StringFixed(2), CurrencySymbol), true
+}
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// cartQuantities is what is in the customer's cart, by name.
+func cartQuantities(t *testing.T, customerID int) map[string]int {
+	t.Helper()
+	cart, err := GetCart(customerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quantities := map[string]int{}
+	for _, item := range cart.Items {
+		quantities[item.Name] += item.Quantity
+	}
+	return quantities
+}
+
+func TestReorderIntoCartKeepsTheCart(t *testing.T) {
+	migrateTestDB(t)
+	customerID := placeTestOrders(t)
+
+	var marinaraID, orderID int
+	if err := DATABASE.QueryRow(`SELECT id FROM pizza WHERE name = 'Marinara'`).Scan(&marinaraID); err != nil {
+		t.Fatal(err)
+	}
+	if err := DATABASE.QueryRow(`SELECT MIN(id) FROM orders WHERE customer_id = ?`, customerID).Scan(&orderID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddToCart(customerID, CartLine{Type: "pizza", ID: marinaraID, Quantity: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := ReorderIntoCart(orderID, customerID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]int{"Marinara (Medium, Classic)": 1, "Margherita (Medium, Classic)": 4, "Tiramisu": 2}
+	got := cartQuantities(t, customerID)
+	if len(got) != len(want) {
+		t.Errorf("cart has %v, want %v", got, want)
+	}
+	for name, quantity := range want {
+		if got[name] != quantity {
+			t.Errorf("cart has %d x %s, want %d", got[name], name, quantity)
+		}
+	}
+}
+
+func TestRepricedMessage(t *testing.T) {
+	message, repriced := repricedMessage("11.00", decimal.RequireFromString("12.5"))
+	if !repriced || message != "Now 12.50 € each, was 11.00 €" {
+		t.Errorf("repricedMessage = %q, %v", message, repriced)
+	}
+	if _, repriced := repricedMessage("12.50", decimal.RequireFromString("12.5")); repriced {
+		t.Error("the same price is repriced")
+	}
+}
+
+func TestGetReorderLeavesOutPizzasWhoseRecipeChanged(t *testing.T) {
+	migrateTestDB(t)
+	customerID := placeTestOrders(t)
+
+	var userID, margheritaID, mozzarellaID, tiramisuID int
+	if err := DATABASE.QueryRow(`SELECT user_id FROM customer WHERE id = ?`, customerID).Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	if err := DATABASE.QueryRow(`SELECT id FROM pizza WHERE name = 'Margherita'`).Scan(&margheritaID); err != nil {
+		t.Fatal(err)
+	}
+	if err := DATABASE.QueryRow(`SELECT id FROM ingredient WHERE name = 'Mozzarella'`).Scan(&mozzarellaID); err != nil {
+		t.Fatal(err)
+	}
+	if err := DATABASE.QueryRow(`SELECT id FROM extra_item WHERE name = 'Tiramisu'`).Scan(&tiramisuID); err != nil {
+		t.Fatal(err)
+	}
+	pizzas := []PizzaOrderItem{
+		{PizzaID: margheritaID, Quantity: 1, Modifiers: []PizzaModifier{{IngredientID: mozzarellaID, Action: RemoveIngredient}}},
+		{PizzaID: margheritaID, Quantity: 1},
+	}
+	orderID, err := CreateOrderWithTransaction(customerID, userID, "Main St 1", "87104", pizzas, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ordered pizzas and extra items stay on the menu, their order lines keep them
+	if err := DeletePizza(margheritaID); err == nil {
+		t.Error("deleted a pizza that has been ordered")
+	}
+	if err := DeleteExtraItem(tiramisuID); err == nil {
+		t.Error("deleted an extra item that has been ordered")
+	}
+
+	if _, err := DATABASE.Exec(`DELETE FROM pizza_ingredient WHERE pizza_id = ? AND ingredient_id = ?`, margheritaID, mozzarellaID); err != nil {
+		t.Fatal(err)
+	}
+	reorder, err := GetReorder(orderID, customerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reorder.Items) != 1 || len(reorder.Items[0].Modifiers) != 0 {
+		t.Errorf("reorder has %+v, want the plain Margherita", reorder.Items)
+	}
+	unavailable := 0
+	for _, w := range reorder.Warnings {
+		if w.Problem == ReorderUnavailable {
+			unavailable++
+		}
+	}
+	if unavailable != 1 {
+		t.Errorf("reorder warns %+v, want the Margherita without mozzarella unavailable", reorder.Warnings)
+	}
+}
+
+func TestGetReorderLeavesOutPromotionGifts(t *testing.T) {
+	migrateTestDB(t)
+	customerID := placeTestOrders(t)
+
+	var userID, margheritaID, tiramisuID int
+	if err := DATABASE.QueryRow(`SELECT user_id FROM customer WHERE id = ?`, customerID).Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	if err := DATABASE.QueryRow(`SELECT id FROM pizza WHERE name = 'Margherita'`).Scan(&margheritaID); err != nil {
+		t.Fatal(err)
+	}
+	if err := DATABASE.QueryRow(`SELECT id FROM extra_item WHERE name = 'Tiramisu'`).Scan(&tiramisuID); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if _, err := DATABASE.Exec(`UPDATE customer SET birth_date = ? WHERE id = ?`, time.Date(1992, now.Month(), now.Day(), 12, 0, 0, 0, time.Local), customerID); err != nil {
+		t.Fatal(err)
+	}
+
+	code := "BIRTHDAY"
+	pizzas := []PizzaOrderItem{{PizzaID: margheritaID, Quantity: 2}}
+	extras := []ExtraOrderItem{{ExtraItemID: tiramisuID, Quantity: 1}}
+	orderID, err := CreateOrderWithTransaction(customerID, userID, "Main St 1", "87104", pizzas, extras, &code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gifts int
+	if err := DATABASE.QueryRow(`SELECT COUNT(*) FROM order_extra_item WHERE order_id = ? AND is_gift`, orderID).Scan(&gifts); err != nil {
+		t.Fatal(err)
+	}
+	if gifts != 1 {
+		t.Fatalf("the birthday order has %d gifts, want the free drink", gifts)
+	}
+
+	reorder, err := GetReorder(orderID, customerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"Margherita (Medium, Classic)": 2, "Tiramisu": 1}
+	if len(reorder.Items) != len(want) {
+		t.Errorf("reorder has %+v, want %v", reorder.Items, want)
+	}
+	for _, item := range reorder.Items {
+		if want[item.Name] != item.Quantity {
+			t.Errorf("reorder has %d x %s, want %d", item.Quantity, item.Name, want[item.Name])
+		}
+	}
+}
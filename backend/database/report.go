@@ -0,0 +1,291 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type UndeliveredOrder struct {
+	OrderID      int
+	CustomerName string
+	Address      string
+	PostalCode   string
+	Status       string
+	Timestamp    time.Time
+	Items        []string
+}
+
+// PizzaSales is how many of a pizza were sold, and what they were paid, before discount codes.
+type PizzaSales struct {
+	Name      string
+	TotalSold int
+	Revenue   float64
+}
+
+// ToppingChange is how often customers added or removed an ingredient.
+type ToppingChange struct {
+	Ingredient string
+	Action     ModifierAction
+	TotalSold  int
+}
+
+// RevenueGroup is one row of a revenue report, grouped by gender, age group or postal code.
+type RevenueGroup struct {
+	Group      string
+	OrderCount int
+	Revenue    float64
+}
+
+// EarningsGroup is what an earnings report adds up the orders by.
+type EarningsGroup string
+
+const (
+	EarningsByGender     EarningsGroup = "gender"
+	EarningsByAge        EarningsGroup = "age"
+	EarningsByPostalCode EarningsGroup = "postal"
+)
+
+// EarningsGroups lists every grouping, e.g. for dropdowns.
+var EarningsGroups = []EarningsGroup{EarningsByGender, EarningsByAge, EarningsByPostalCode}
+
+// AgeBrackets are the age groups of the earnings report, youngest first. Customers without a birth date are 'Unknown'.
+var AgeBrackets = []string{"Under 25", "25-34", "35-44", "45-54", "55+", "Unknown"}
+
+// EarningsFilter narrows down the orders an earnings report counts. Zero fields don't filter.
+type EarningsFilter struct {
+	// Orders placed from From up to, not including, To
+	From *time.Time
+	To   *time.Time
+	// Customers of this gender, in this one of AgeBrackets and whose postal code starts with PostalCode
+	Gender     string
+	AgeBracket string
+	PostalCode string
+	// The most groups to return, the biggest earners first when grouping by postal code. 0 is all of them.
+	Limit int
+}
+
+// reportedOrders leaves out orders that didn't earn anything: cancelled ones and failed deliveries.
+const reportedOrders = `o.status NOT IN ('CANCELLED', 'FAILED')`
+
+// Orders that are neither delivered, failed nor cancelled, newest first.
+func GetUndeliveredOrders() ([]UndeliveredOrder, error) {
+	rows, err := DATABASE.Query(`
+		SELECT o.id, c.name, o.delivery_address, o.postal_code, o.status, o.timestamp
+		FROM orders o
+		JOIN customer c ON o.customer_id = c.id
+		WHERE o.status NOT IN ('DELIVERED', 'FAILED', 'CANCELLED')
+		ORDER BY o.timestamp DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	var orders []UndeliveredOrder
+	for rows.Next() {
+		var o UndeliveredOrder
+		if err := rows.Scan(&o.OrderID, &o.CustomerName, &o.Address, &o.PostalCode, &o.Status, &o.Timestamp); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range orders {
+		itemRows, err := DATABASE.Query(`
+			SELECT op.id, p.name, op.quantity
+			FROM order_pizza op
+			JOIN pizza p ON op.pizza_id = p.id
+			WHERE op.order_id = ?
+		`, orders[i].OrderID)
+		if err != nil {
+			return nil, err
+		}
+		var lines []struct {
+			OrderPizzaID int
+			PizzaName    string
+			Quantity     int
+		}
+		for itemRows.Next() {
+			var line struct {
+				OrderPizzaID int
+				PizzaName    string
+				Quantity     int
+			}
+			if err := itemRows.Scan(&line.OrderPizzaID, &line.PizzaName, &line.Quantity); err != nil {
+				itemRows.Close()
+				return nil, err
+			}
+			lines = append(lines, line)
+		}
+		itemRows.Close()
+
+		for _, line := range lines {
+			modifiers, err := getOrderPizzaModifiers(DATABASE, line.OrderPizzaID)
+			if err != nil {
+				return nil, err
+			}
+			orders[i].Items = append(orders[i].Items, fmt.Sprintf("%s x%d", describePizza(line.PizzaName, modifiers), line.Quantity))
+		}
+	}
+	return orders, nil
+}
+
+// GetTopPizzas returns the best selling pizzas of the orders placed from `from` up to, not including, `to`.
+// Free and reward units don't count as sold.
+func GetTopPizzas(from, to time.Time, limit int) ([]PizzaSales, error) {
+	rows, err := DATABASE.Query(`
+		SELECT p.name, SUM(op.quantity - op.free_quantity - op.reward_quantity) as total_sold,
+		       SUM((op.quantity - op.free_quantity - op.reward_quantity) * op.unit_price) as revenue
+		FROM order_pizza op
+		JOIN pizza p ON op.pizza_id = p.id
+		JOIN orders o ON op.order_id = o.id
+		WHERE o.timestamp >= ? AND o.timestamp < ? AND `+reportedOrders+`
+		GROUP BY p.id, p.name
+		HAVING SUM(op.quantity - op.free_quantity - op.reward_quantity) > 0
+		ORDER BY total_sold DESC, revenue DESC
+		LIMIT ?
+	`, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pizzas []PizzaSales
+	for rows.Next() {
+		var p PizzaSales
+		var revenue sql.NullFloat64
+		if err := rows.Scan(&p.Name, &p.TotalSold, &revenue); err != nil {
+			return nil, err
+		}
+		p.Revenue = revenue.Float64
+		pizzas = append(pizzas, p)
+	}
+	return pizzas, rows.Err()
+}
+
+// GetTopToppingChanges returns the ingredients customers added or removed most in the last `days` days,
+// counted in pizzas.
+func GetTopToppingChanges(days int, limit int) ([]ToppingChange, error) {
+	rows, err := DATABASE.Query(`
+		SELECT i.name, m.action, SUM(op.quantity) as total_sold
+		FROM order_pizza_modifier m
+		JOIN order_pizza op ON m.order_pizza_id = op.id
+		JOIN ingredient i ON m.ingredient_id = i.id
+		JOIN orders o ON op.order_id = o.id
+		WHERE o.timestamp >= ?
+		GROUP BY i.id, i.name, m.action
+		ORDER BY total_sold DESC
+		LIMIT ?
+	`, time.Now().AddDate(0, 0, -days), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []ToppingChange
+	for rows.Next() {
+		var c ToppingChange
+		if err := rows.Scan(&c.Ingredient, &c.Action, &c.TotalSold); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// ageBracket is the SQL for the customer's one of AgeBrackets.
+func ageBracket() string {
+	age := currentDialect.ageInYears("c.birth_date")
+	return `CASE
+		WHEN c.birth_date IS NULL THEN 'Unknown'
+		WHEN ` + age + ` < 25 THEN 'Under 25'
+		WHEN ` + age + ` BETWEEN 25 AND 34 THEN '25-34'
+		WHEN ` + age + ` BETWEEN 35 AND 44 THEN '35-44'
+		WHEN ` + age + ` BETWEEN 45 AND 54 THEN '45-54'
+		ELSE '55+'
+	END`
+}
+
+// GetEarnings adds up the orders that match the filter by customer gender, age bracket or postal code.
+func GetEarnings(groupBy EarningsGroup, filter EarningsFilter) ([]RevenueGroup, error) {
+	var group, order string
+	switch groupBy {
+	case EarningsByGender:
+		group, order = "COALESCE(c.gender, 'Unknown')", "total_revenue DESC"
+	case EarningsByAge:
+		group, order = ageBracket(), "CASE earnings_group"
+		for i, bracket := range AgeBrackets {
+			order += fmt.Sprintf(" WHEN '%s' THEN %d", bracket, i)
+		}
+		order += " END"
+	case EarningsByPostalCode:
+		group, order = "c.postal_code", "total_revenue DESC"
+	default:
+		return nil, fmt.Errorf("unknown earnings group %q", groupBy)
+	}
+
+	where := []string{reportedOrders}
+	var args []any
+	if filter.From != nil {
+		where = append(where, "o.timestamp >= ?")
+		args = append(args, *filter.From)
+	}
+	if filter.To != nil {
+		where = append(where, "o.timestamp < ?")
+		args = append(args, *filter.To)
+	}
+	if filter.Gender != "" {
+		where = append(where, "c.gender = ?")
+		args = append(args, filter.Gender)
+	}
+	if filter.AgeBracket != "" {
+		where = append(where, ageBracket()+" = ?")
+		args = append(args, filter.AgeBracket)
+	}
+	if filter.PostalCode != "" {
+		where = append(where, "c.postal_code LIKE ?")
+		args = append(args, filter.PostalCode+"%")
+	}
+
+	query := `
+		SELECT ` + group + ` as earnings_group, COUNT(DISTINCT o.id) as order_count,
+		       SUM(o.total_price) as total_revenue
+		FROM orders o
+		JOIN customer c ON o.customer_id = c.id
+		WHERE ` + strings.Join(where, " AND ") + `
+		GROUP BY earnings_group
+		ORDER BY ` + order
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+	return queryRevenueGroups(query, args...)
+}
+
+func queryRevenueGroups(query string, args ...any) ([]RevenueGroup, error) {
+	rows, err := DATABASE.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []RevenueGroup
+	for rows.Next() {
+		var g RevenueGroup
+		var revenue sql.NullFloat64
+		if err := rows.Scan(&g.Group, &g.OrderCount, &revenue); err != nil {
+			return nil, err
+		}
+		if revenue.Valid {
+			g.Revenue = revenue.Float64
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"log"
+
+	"github.com/shopspring/decimal"
+)
+
+// SeedDevData fills an empty database with the menu, discount codes and a few dev accounts.
+// It is optional, the schema itself comes from the migrations. Does nothing if there is already a menu.
+func SeedDevData() {
+	// Not the pizzas, the migrations already add the empty "Build your own" base
+	var ingredientCount int
+	if err := DATABASE.QueryRow(`SELECT COUNT(*) FROM ingredient`).Scan(&ingredientCount); err != nil {
+		log.Fatal(err)
+	}
+	if ingredientCount > 0 {
+		log.Println("Database already has data, skipping seed.")
+		return
+	}
+
+	createIngredientDbg("Pepperoni", 101, true, true)
+	createIngredientDbg("Mozzarella", 60, false, true)
+	createIngredientDbg("Jalapeno", 30, false, false)
+	createIngredientDbg("Tomato sauce", 50, false, false)
+	createIngredientDbg("'Nduja", 200, true, true)
+	createIngredientDbg("Chili pepper", 30, false, false)
+	createIngredientDbg("Prosciutto", 85, true, true)
+	createIngredientDbg("Mushrooms", 35, false, false)
+	createIngredientDbg("Anchovies", 75, true, true)
+	createIngredientDbg("Gorgonzola", 40, false, true)
+	createIngredientDbg("Fontina", 40, false, true)
+	createIngredientDbg("Parmigiano Reggiano", 30, false, true)
+	createIngredientDbg("Nutella", 200, false, true)
+
+	createIngredientDbg("Lobster", 500, true, true)
+	createIngredientDbg("Caviar", 1000, false, true)
+	createIngredientDbg("Gold leaf", 1000, false, false)
+	createIngredientDbg("Foie gras", 1000, true, true)
+
+	createIngredientDbg("Old tomato sauce", 1, false, false)
+	createIngredientDbg("Weird vegan cheese", 4, false, false)
+
+	// Enough of everything for about a hundred pizzas
+	stockIngredientsDbg(10000, 1000)
+
+	createPizzaDbg("Marinara", []string{"Tomato sauce"})
+	createPizzaDbg("Margherita", []string{"Tomato sauce", "Mozzarella"})
+	createPizzaDbg("Diavola", []string{"Tomato sauce", "Mozzarella", "'Nduja", "Chili pepper"})
+	createPizzaDbg("Priosciutto e Funghi", []string{"Tomato sauce", "Mozzarella", "Prosciutto", "Mushrooms"})
+	createPizzaDbg("Napoli", []string{"Tomato sauce", "Mozzarella", "Anchovies"})
+	createPizzaDbg("Quatro Formaggi", []string{"Tomato sauce", "Mozzarella", "Gorgonzola", "Fontina", "Parmigiano Reggiano"})
+	createPizzaDbg("Nutella", []string{"Nutella"})
+	createPizzaDbg("Billionaire's dream", []string{"Tomato sauce", "Mozzarella", "Lobster", "Caviar", "Gold leaf", "Foie gras"})
+	createPizzaDbg("Student's dream", []string{"Old tomato sauce", "Weird vegan cheese"})
+
+	createExtraItemDbg("Tiramisu", "dessert", 5.50)
+	createExtraItemDbg("Panna Cotta", "dessert", 4.50)
+	createExtraItemDbg("Gelato", "dessert", 3.50)
+	createExtraItemDbg("Cannoli", "dessert", 4.00)
+	createExtraItemDbg("Chocolate Cake", "dessert", 5.00)
+	createExtraItemDbg("Coca Cola", "drink", 2.50)
+	createExtraItemDbg("Sprite", "drink", 2.50)
+	createExtraItemDbg("Fanta", "drink", 2.50)
+	createExtraItemDbg("Water", "drink", 1.50)
+	createExtraItemDbg("Orange Juice", "drink", 3.00)
+	createExtraItemDbg("Apple Juice", "drink", 3.00)
+	createExtraItemDbg("Iced Tea", "drink", 2.50)
+	createExtraItemDbg("Lemonade", "drink", 2.50)
+	createExtraItemDbg("Coffee", "drink", 2.00)
+	createExtraItemDbg("Espresso", "drink", 2.50)
+
+	// Create some discount codes
+	createDiscountCodeDbg("SAVE10", 10)
+	createDiscountCodeDbg("SAVE20", 20)
+	createDiscountCodeDbg("HALFOFF", 50)
+	createDiscountCodeDbg("STUDENT", 15)
+	birthdayCodeID := createDiscountCodeDbg("BIRTHDAY", 25)
+
+	// The birthday deal, customers get it with the BIRTHDAY code on their birthday
+	createPromotionDbg(Promotion{
+		Name:           "Birthday",
+		Description:    "Birthday Special: Free cheapest pizza + free drink!",
+		DiscountCodeID: &birthdayCodeID,
+		IsActive:       true,
+		Conditions:     []PromotionCondition{{Kind: BirthdayCondition}},
+		Effects:        []PromotionEffect{{Kind: FreeCheapestEffect, Category: "pizza"}, {Kind: AddFreeItemEffect, Category: "drink"}},
+	})
+
+	ingredients, _ := GetAllIngredients()
+	log.Println("Ingredients:")
+	for _, ingr := range ingredients {
+		log.Println(ingr)
+	}
+
+	pizzas, _ := GetAllPizzas()
+	log.Println("Pizzas:")
+	for _, pizza := range pizzas {
+		info, _ := GetPizzaInformation(pizza.Name, 0, 0)
+
+		log.Println(pizza, info)
+	}
+
+	if err := AddUser("admin", "admin", AdminRole); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := AddUser("chef", "chef", KitchenRole); err != nil {
+		log.Fatal(err)
+	}
+
+	success, msg := TryAddCustomer(Customer{
+		Username:    "walta",
+		Password:    "pasword",
+		Name:        "Walter White",
+		Gender:      "Male",
+		BirthDate:   "1958-09-07",
+		NoBirthDate: false,
+		Address:     "308 Negra Arroyo Lane, Albuquerque, New Mexico ",
+		PostCode:    "87104",
+	})
+	if !success {
+		log.Fatal(msg)
+	}
+
+	success, msg = TryAddDeliveryPerson(DeliveryPerson{
+		Username: "dexta",
+		Password: "kill",
+		Name:     "Dexter Morgan",
+	})
+	if !success {
+		log.Fatal(msg)
+	}
+
+	log.Println("Database has been seeded.")
+}
+
+func createIngredientDbg(name string, cost int64, hasMeat bool, hasMeatProducts bool) {
+	if _, err := CreateIngredient(NewIngredient(name, cost, hasMeat, hasMeatProducts)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func stockIngredientsDbg(stock int64, lowStockThreshold int64) {
+	ingredients, err := GetAllIngredients()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, ingr := range ingredients {
+		if err := RestockIngredient(ingr.ID, decimal.NewFromInt(stock)); err != nil {
+			log.Fatal(err)
+		}
+		if err := UpdateStockSettings(ingr.ID, "g", decimal.NewFromInt(lowStockThreshold), decimal.NewFromInt(100)); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func createPizzaDbg(name string, ingredients []string) {
+	if _, err := CreatePizza(name, ingredients); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func createExtraItemDbg(name string, category string, price float64) {
+	if _, err := CreateExtraItem(name, category, price); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func createDiscountCodeDbg(code string, percentage int) int {
+	once := 1
+	dc := DiscountCode{Code: code, Type: PercentageDiscount, DiscountPercentage: percentage, IsActive: true, MaxUsesPerCustomer: &once, Scope: ScopeOrder}
+	id, err := CreateDiscountCode(dc)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return id
+}
+
+func createPromotionDbg(p Promotion) {
+	if _, err := CreatePromotion(p); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// How long a session stays valid after login.
+const SessionDuration = 24 * time.Hour
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionExpired  = errors.New("session expired")
+)
+
+type Session struct {
+	Token     string
+	UserID    int
+	Username  string
+	Role      UserRole
+	ExpiresAt time.Time
+}
+
+// CreateSession issues a new opaque token for an already authenticated user.
+// Only the SHA-256 of the token is stored, so a leaked table can't be replayed.
+func CreateSession(username string) (Session, error) {
+	var session Session
+	var role string
+	err := DATABASE.QueryRow("SELECT id, username, role FROM user WHERE username = ?", username).Scan(&session.UserID, &session.Username, &role)
+	if err != nil {
+		return Session{}, err
+	}
+	session.Role, err = ParseUserRole(role)
+	if err != nil {
+		return Session{}, err
+	}
+
+	token, err := generateSessionToken()
+	if err != nil {
+		return Session{}, err
+	}
+	session.Token = token
+	session.ExpiresAt = time.Now().Add(SessionDuration)
+
+	_, err = DATABASE.Exec(
+		"INSERT INTO sessions (token_hash, user_id, expires_at) VALUES (?, ?, ?)",
+		hashSessionToken(token),
+		session.UserID,
+		session.ExpiresAt,
+	)
+	if err != nil {
+		return Session{}, err
+	}
+	return session, nil
+}
+
+// GetSession resolves a token to the user it belongs to.
+func GetSession(token string) (Session, error) {
+	if token == "" {
+		return Session{}, ErrSessionNotFound
+	}
+
+	var session Session
+	var role string
+	err := DATABASE.QueryRow(`
+		SELECT u.id, u.username, u.role, s.expires_at
+		FROM sessions s
+		JOIN user u ON s.user_id = u.id
+		WHERE s.token_hash = ?
+	`, hashSessionToken(token)).Scan(&session.UserID, &session.Username, &role, &session.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Session{}, ErrSessionNotFound
+		}
+		return Session{}, err
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		DeleteSession(token)
+		return Session{}, ErrSessionExpired
+	}
+
+	session.Role, err = ParseUserRole(role)
+	if err != nil {
+		return Session{}, err
+	}
+	session.Token = token
+	return session, nil
+}
+
+func DeleteSession(token string) error {
+	_, err := DATABASE.Exec("DELETE FROM sessions WHERE token_hash = ?", hashSessionToken(token))
+	return err
+}
+
+func DeleteUserSessions(userID int) error {
+	_, err := DATABASE.Exec("DELETE FROM sessions WHERE user_id = ?", userID)
+	return err
+}
+
+func DeleteExpiredSessions() error {
+	_, err := DATABASE.Exec("DELETE FROM sessions WHERE expires_at < ?", time.Now())
+	return err
+}
+
+func generateSessionToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+func hashSessionToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
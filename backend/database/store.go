@@ -0,0 +1,162 @@
+package database
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// The stores are what the handlers depend on, instead of calling the package functions directly.
+// SQLStore implements all of them, tests can swap in in-memory fakes.
+
+type PizzaStore interface {
+	CreatePizza(pizzaName string, ingredientNames []string) (Pizza, error)
+	GetAllPizzas() ([]Pizza, error)
+	GetAllPizzasWithPrice() ([]PizzaWithPrice, error)
+	GetPizzaByID(pizzaID int) (*Pizza, error)
+	GetPizzaInformation(pizzaName string, sizeID, crustID int) (PizzaInformation, error)
+	PriceCustomPizza(pizzaID, sizeID, crustID int, modifiers []PizzaModifier) (PizzaInformation, error)
+	DeletePizza(pizzaID int) error
+
+	GetPizzaOptions(kind PizzaOptionKind) ([]PizzaOption, error)
+	CreatePizzaOption(kind PizzaOptionKind, opt PizzaOption) (int, error)
+	UpdatePizzaOption(kind PizzaOptionKind, id int, opt PizzaOption) error
+	DeletePizzaOption(kind PizzaOptionKind, id int) error
+}
+
+type IngredientStore interface {
+	CreateIngredient(ingr Ingredient) (IngredientWithID, error)
+	GetAllIngredients() ([]IngredientWithID, error)
+	ListIngredients(filter IngredientFilter) ([]IngredientWithID, int, error)
+	GetIngredient(ingredientName string) (IngredientWithID, error)
+	UpdateIngredient(id int, ingr Ingredient) error
+	DeleteIngredient(id int) error
+
+	GetStockLevels(onlyLow bool) ([]StockLevel, error)
+	RestockIngredient(ingredientID int, amount decimal.Decimal) error
+	UpdateStockSettings(ingredientID int, unit string, lowStockThreshold, portion decimal.Decimal) error
+	SetPizzaIngredientAmount(pizzaID, ingredientID int, amount decimal.Decimal) error
+}
+
+type ExtraItemStore interface {
+	GetAllExtraItems() ([]ExtraItem, error)
+	CreateExtraItem(name string, category string, price float64) (int, error)
+	UpdateExtraItem(id int, name string, category string, price float64) error
+	DeleteExtraItem(id int) error
+}
+
+type OrderStore interface {
+	CreateOrderWithTransaction(customerID int, userID int, deliveryAddress, postalCode string, pizzaItems []PizzaOrderItem, extraItems []ExtraOrderItem, discountCode *string) (int, error)
+	QuoteOrder(userID int, postalCode string, pizzaItems []PizzaOrderItem, extraItems []ExtraOrderItem, discountCode *string) (PriceBreakdown, error)
+	GetOrderByID(orderID int) (*Order, error)
+	GetOrderDetails(orderID int) (*OrderDetails, error)
+	GetOrdersByCustomer(customerID int) ([]Order, error)
+	ListOrders(filter OrderFilter) ([]Order, int, error)
+	GetOrderHistory(customerID int, filter OrderFilter) ([]OrderDetails, int, error)
+	ReorderIntoCart(orderID, customerID int) (Reorder, error)
+	UpdateOrderStatus(orderID int, status OrderStatus, actorUserID int) error
+	GetOrderStatusHistory(orderID int) ([]OrderStatusChange, error)
+	CancelOrderByCustomer(orderID, customerID, userID int) error
+	CancelOrderByAdmin(orderID, adminUserID int, reason string) error
+	DeleteOrder(orderID int) error
+
+	GetUndeliveredOrders() ([]UndeliveredOrder, error)
+	GetTopPizzas(from, to time.Time, limit int) ([]PizzaSales, error)
+	GetTopToppingChanges(days int, limit int) ([]ToppingChange, error)
+	GetEarnings(groupBy EarningsGroup, filter EarningsFilter) ([]RevenueGroup, error)
+}
+
+type CartStore interface {
+	GetCart(customerID int) (Cart, error)
+	AddToCart(customerID int, line CartLine) (int, error)
+	UpdateCartItemQuantity(customerID, itemID, quantity int) error
+	RemoveFromCart(customerID, itemID int) error
+	ClearCart(customerID int) error
+	QuoteCart(customerID, userID int, postalCode string, discountCode *string) (PriceBreakdown, error)
+	CheckoutCart(customerID, userID int, deliveryAddress, postalCode string, discountCode *string) (int, error)
+}
+
+type UserStore interface {
+	AddUser(username string, password string, role UserRole) error
+	TryAddCustomer(customer Customer) (bool, string)
+	TryLogin(username string, password string) (bool, string)
+	GetUserIDFromUsername(username string) (int, error)
+	GetCustomerIDFromUserID(userID int) (int, error)
+	GetCustomerDetails(username string) (Customer, error)
+	ListUsers(filter UserFilter) ([]map[string]interface{}, int, error)
+	DeleteUser(userID int) error
+	CheckCustomerBirthday(userID int64) (bool, error)
+	GetLoyaltyProgress(userID int) (LoyaltyProgress, error)
+
+	CreateSession(username string) (Session, error)
+	GetSession(token string) (Session, error)
+	DeleteSession(token string) error
+	DeleteExpiredSessions() error
+}
+
+type DeliveryStore interface {
+	TryAddDeliveryPerson(person DeliveryPerson) (bool, string)
+	GetAllDeliveryPersons() ([]map[string]interface{}, error)
+	ListDeliveryPersons(filter DeliveryPersonFilter) ([]map[string]interface{}, int, error)
+	DeleteDeliveryPerson(userID int) error
+	GetDeliveryPersonIDFromUserID(userID int) (int, error)
+	GetAvailableDeliveries(zoneIDs []int) ([]Order, error)
+	GetAssignedDeliveries(deliveryPersonID int) ([]Order, error)
+	AssignDelivery(orderID, deliveryPersonID int) error
+	SetOrderDeliveryPerson(orderID, deliveryPersonID, adminUserID int) error
+	UpdateDeliveryStatus(orderID, userID int, status string) error
+
+	GetDeliveryZones() ([]DeliveryZone, error)
+	CreateDeliveryZone(z DeliveryZone) (int, error)
+	UpdateDeliveryZone(id int, z DeliveryZone) error
+	DeleteDeliveryZone(id int) error
+	GetDeliveryPersonZoneIDs(deliveryPersonID int) ([]int, error)
+	SetDeliveryPersonZones(deliveryPersonID int, zoneIDs []int) error
+
+	GetDispatchPolicy() (DispatchPolicy, error)
+	UpdateDispatchPolicy(p DispatchPolicy, actorUserID int) error
+	DispatchReadyOrders(actorUserID int) (int, error)
+}
+
+type KitchenStore interface {
+	GetKitchenQueue() ([]OrderDetails, error)
+	StartOrderPizza(orderPizzaID int, actorUserID int) error
+	FinishOrderPizza(orderPizzaID int, actorUserID int) error
+	MarkOrderReady(orderID int, actorUserID int) error
+}
+
+type DiscountStore interface {
+	GetAllDiscountCodes() ([]DiscountCode, error)
+	GetDiscountCodeByCode(code string) (DiscountCode, error)
+	HasUserUsedDiscount(userID int, discountCodeID int) (bool, error)
+	CreateDiscountCode(dc DiscountCode) (int, error)
+	UpdateDiscountCode(id int, dc DiscountCode) error
+	DeleteDiscountCode(id int) error
+}
+
+type PromotionStore interface {
+	GetAllPromotions() ([]Promotion, error)
+	CreatePromotion(p Promotion) (int, error)
+	SetPromotionActive(id int, isActive bool) error
+	DeletePromotion(id int) error
+}
+
+type VoucherStore interface {
+	CreateVoucherCampaign(c VoucherCampaign, count int, actorUserID int) (int, error)
+	GetVoucherCampaigns() ([]VoucherCampaign, error)
+	GetVoucherCampaign(id int) (VoucherCampaign, error)
+	GetVoucherCodes(campaignID int) ([]Voucher, error)
+}
+
+type PricingStore interface {
+	GetPricingConfig() (PricingConfig, error)
+	UpdatePricingConfig(cfg PricingConfig, actorUserID int) error
+	GetPricingConfigHistory(limit int) ([]PricingConfigChange, error)
+}
+
+// ExportStore streams rows to fn one at a time, for exports too big to load at once.
+type ExportStore interface {
+	ExportOrders(filter ExportFilter, fn func(OrderExportLine) error) error
+	ExportCustomers(filter ExportFilter, fn func(CustomerExport) error) error
+	ExportDailySales(filter ExportFilter, fn func(DailySales) error) error
+}
@@ -0,0 +1,478 @@
+package database
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// SQLStore implements every store on top of the connection opened by Init / Connect, MySQL or SQLite.
+type SQLStore struct{}
+
+func NewSQLStore() *SQLStore {
+	return &SQLStore{}
+}
+
+var (
+	_ PizzaStore      = (*SQLStore)(nil)
+	_ IngredientStore = (*SQLStore)(nil)
+	_ ExtraItemStore  = (*SQLStore)(nil)
+	_ OrderStore      = (*SQLStore)(nil)
+	_ CartStore       = (*SQLStore)(nil)
+	_ UserStore       = (*SQLStore)(nil)
+	_ DeliveryStore   = (*SQLStore)(nil)
+	_ DiscountStore   = (*SQLStore)(nil)
+	_ PromotionStore  = (*SQLStore)(nil)
+	_ VoucherStore    = (*SQLStore)(nil)
+	_ KitchenStore    = (*SQLStore)(nil)
+	_ PricingStore    = (*SQLStore)(nil)
+	_ ExportStore     = (*SQLStore)(nil)
+)
+
+// PizzaStore
+
+func (SQLStore) CreatePizza(pizzaName string, ingredientNames []string) (Pizza, error) {
+	return CreatePizza(pizzaName, ingredientNames)
+}
+
+func (SQLStore) GetAllPizzas() ([]Pizza, error) {
+	return GetAllPizzas()
+}
+
+func (SQLStore) GetAllPizzasWithPrice() ([]PizzaWithPrice, error) {
+	return GetAllPizzasWithPrice()
+}
+
+func (SQLStore) GetPizzaByID(pizzaID int) (*Pizza, error) {
+	return GetPizzaByID(pizzaID)
+}
+
+func (SQLStore) GetPizzaInformation(pizzaName string, sizeID, crustID int) (PizzaInformation, error) {
+	return GetPizzaInformation(pizzaName, sizeID, crustID)
+}
+
+func (SQLStore) PriceCustomPizza(pizzaID, sizeID, crustID int, modifiers []PizzaModifier) (PizzaInformation, error) {
+	return PriceCustomPizza(pizzaID, sizeID, crustID, modifiers)
+}
+
+func (SQLStore) DeletePizza(pizzaID int) error {
+	return DeletePizza(pizzaID)
+}
+
+func (SQLStore) GetPizzaOptions(kind PizzaOptionKind) ([]PizzaOption, error) {
+	return GetPizzaOptions(kind)
+}
+
+func (SQLStore) CreatePizzaOption(kind PizzaOptionKind, opt PizzaOption) (int, error) {
+	return CreatePizzaOption(kind, opt)
+}
+
+func (SQLStore) UpdatePizzaOption(kind PizzaOptionKind, id int, opt PizzaOption) error {
+	return UpdatePizzaOption(kind, id, opt)
+}
+
+func (SQLStore) DeletePizzaOption(kind PizzaOptionKind, id int) error {
+	return DeletePizzaOption(kind, id)
+}
+
+// IngredientStore
+
+func (SQLStore) CreateIngredient(ingr Ingredient) (IngredientWithID, error) {
+	return CreateIngredient(ingr)
+}
+
+func (SQLStore) GetAllIngredients() ([]IngredientWithID, error) {
+	return GetAllIngredients()
+}
+
+func (SQLStore) ListIngredients(filter IngredientFilter) ([]IngredientWithID, int, error) {
+	return ListIngredients(filter)
+}
+
+func (SQLStore) GetIngredient(ingredientName string) (IngredientWithID, error) {
+	return GetIngredient(ingredientName)
+}
+
+func (SQLStore) UpdateIngredient(id int, ingr Ingredient) error {
+	return UpdateIngredient(id, ingr)
+}
+
+func (SQLStore) DeleteIngredient(id int) error {
+	return DeleteIngredient(id)
+}
+
+func (SQLStore) GetStockLevels(onlyLow bool) ([]StockLevel, error) {
+	return GetStockLevels(onlyLow)
+}
+
+func (SQLStore) RestockIngredient(ingredientID int, amount decimal.Decimal) error {
+	return RestockIngredient(ingredientID, amount)
+}
+
+func (SQLStore) UpdateStockSettings(ingredientID int, unit string, lowStockThreshold, portion decimal.Decimal) error {
+	return UpdateStockSettings(ingredientID, unit, lowStockThreshold, portion)
+}
+
+func (SQLStore) SetPizzaIngredientAmount(pizzaID, ingredientID int, amount decimal.Decimal) error {
+	return SetPizzaIngredientAmount(pizzaID, ingredientID, amount)
+}
+
+// ExtraItemStore
+
+func (SQLStore) GetAllExtraItems() ([]ExtraItem, error) {
+	return GetAllExtraItems()
+}
+
+func (SQLStore) CreateExtraItem(name string, category string, price float64) (int, error) {
+	return CreateExtraItem(name, category, price)
+}
+
+func (SQLStore) UpdateExtraItem(id int, name string, category string, price float64) error {
+	return UpdateExtraItem(id, name, category, price)
+}
+
+func (SQLStore) DeleteExtraItem(id int) error {
+	return DeleteExtraItem(id)
+}
+
+// OrderStore
+func (SQLStore) CreateOrderWithTransaction(customerID int, userID int, deliveryAddress, postalCode string, pizzaItems []PizzaOrderItem, extraItems []ExtraOrderItem, discountCode *string) (int, error) {
+	return CreateOrderWithTransaction(customerID, userID, deliveryAddress, postalCode, pizzaItems, extraItems, discountCode)
+}
+
+func (SQLStore) QuoteOrder(userID int, postalCode string, pizzaItems []PizzaOrderItem, extraItems []ExtraOrderItem, discountCode *string) (PriceBreakdown, error) {
+	return QuoteOrder(userID, postalCode, pizzaItems, extraItems, discountCode)
+}
+
+func (SQLStore) GetOrderByID(orderID int) (*Order, error) {
+	return GetOrderByID(orderID)
+}
+
+func (SQLStore) GetOrderDetails(orderID int) (*OrderDetails, error) {
+	return GetOrderDetails(orderID)
+}
+
+func (SQLStore) GetOrdersByCustomer(customerID int) ([]Order, error) {
+	return GetOrdersByCustomer(customerID)
+}
+
+func (SQLStore) ListOrders(filter OrderFilter) ([]Order, int, error) {
+	return ListOrders(filter)
+}
+
+func (SQLStore) GetOrderHistory(customerID int, filter OrderFilter) ([]OrderDetails, int, error) {
+	return GetOrderHistory(customerID, filter)
+}
+
+func (SQLStore) ReorderIntoCart(orderID, customerID int) (Reorder, error) {
+	return ReorderIntoCart(orderID, customerID)
+}
+
+func (SQLStore) UpdateOrderStatus(orderID int, status OrderStatus, actorUserID int) error {
+	return UpdateOrderStatus(orderID, status, actorUserID)
+}
+
+func (SQLStore) GetOrderStatusHistory(orderID int) ([]OrderStatusChange, error) {
+	return GetOrderStatusHistory(orderID)
+}
+
+func (SQLStore) CancelOrderByCustomer(orderID, customerID, userID int) error {
+	return CancelOrderByCustomer(orderID, customerID, userID)
+}
+
+func (SQLStore) CancelOrderByAdmin(orderID, adminUserID int, reason string) error {
+	return CancelOrderByAdmin(orderID, adminUserID, reason)
+}
+
+func (SQLStore) DeleteOrder(orderID int) error {
+	return DeleteOrder(orderID)
+}
+
+func (SQLStore) GetUndeliveredOrders() ([]UndeliveredOrder, error) {
+	return GetUndeliveredOrders()
+}
+
+func (SQLStore) GetTopPizzas(from, to time.Time, limit int) ([]PizzaSales, error) {
+	return GetTopPizzas(from, to, limit)
+}
+
+func (SQLStore) GetTopToppingChanges(days int, limit int) ([]ToppingChange, error) {
+	return GetTopToppingChanges(days, limit)
+}
+
+func (SQLStore) GetEarnings(groupBy EarningsGroup, filter EarningsFilter) ([]RevenueGroup, error) {
+	return GetEarnings(groupBy, filter)
+}
+
+// CartStore
+func (SQLStore) GetCart(customerID int) (Cart, error) {
+	return GetCart(customerID)
+}
+
+func (SQLStore) AddToCart(customerID int, line CartLine) (int, error) {
+	return AddToCart(customerID, line)
+}
+
+func (SQLStore) UpdateCartItemQuantity(customerID, itemID, quantity int) error {
+	return UpdateCartItemQuantity(customerID, itemID, quantity)
+}
+
+func (SQLStore) RemoveFromCart(customerID, itemID int) error {
+	return RemoveFromCart(customerID, itemID)
+}
+
+func (SQLStore) ClearCart(customerID int) error {
+	return ClearCart(customerID)
+}
+
+func (SQLStore) QuoteCart(customerID, userID int, postalCode string, discountCode *string) (PriceBreakdown, error) {
+	return QuoteCart(customerID, userID, postalCode, discountCode)
+}
+
+func (SQLStore) CheckoutCart(customerID, userID int, deliveryAddress, postalCode string, discountCode *string) (int, error) {
+	return CheckoutCart(customerID, userID, deliveryAddress, postalCode, discountCode)
+}
+
+// UserStore
+
+func (SQLStore) AddUser(username string, password string, role UserRole) error {
+	return AddUser(username, password, role)
+}
+
+func (SQLStore) TryAddCustomer(customer Customer) (bool, string) {
+	return TryAddCustomer(customer)
+}
+
+func (SQLStore) TryLogin(username string, password string) (bool, string) {
+	return TryLogin(username, password)
+}
+
+func (SQLStore) GetUserIDFromUsername(username string) (int, error) {
+	return GetUserIDFromUsername(username)
+}
+
+func (SQLStore) GetCustomerIDFromUserID(userID int) (int, error) {
+	return GetCustomerIDFromUserID(userID)
+}
+
+func (SQLStore) GetCustomerDetails(username string) (Customer, error) {
+	return GetCustomerDetails(username)
+}
+
+func (SQLStore) ListUsers(filter UserFilter) ([]map[string]interface{}, int, error) {
+	return ListUsers(filter)
+}
+
+func (SQLStore) DeleteUser(userID int) error {
+	return DeleteUser(userID)
+}
+
+func (SQLStore) GetLoyaltyProgress(userID int) (LoyaltyProgress, error) {
+	return GetLoyaltyProgress(userID)
+}
+
+func (SQLStore) CheckCustomerBirthday(userID int64) (bool, error) {
+	return CheckCustomerBirthday(userID)
+}
+
+func (SQLStore) CreateSession(username string) (Session, error) {
+	return CreateSession(username)
+}
+
+func (SQLStore) GetSession(token string) (Session, error) {
+	return GetSession(token)
+}
+
+func (SQLStore) DeleteSession(token string) error {
+	return DeleteSession(token)
+}
+
+func (SQLStore) DeleteExpiredSessions() error {
+	return DeleteExpiredSessions()
+}
+
+// DeliveryStore
+
+func (SQLStore) TryAddDeliveryPerson(person DeliveryPerson) (bool, string) {
+	return TryAddDeliveryPerson(person)
+}
+
+func (SQLStore) GetAllDeliveryPersons() ([]map[string]interface{}, error) {
+	return GetAllDeliveryPersons()
+}
+
+func (SQLStore) ListDeliveryPersons(filter DeliveryPersonFilter) ([]map[string]interface{}, int, error) {
+	return ListDeliveryPersons(filter)
+}
+
+func (SQLStore) DeleteDeliveryPerson(userID int) error {
+	return DeleteDeliveryPerson(userID)
+}
+
+func (SQLStore) GetDeliveryPersonIDFromUserID(userID int) (int, error) {
+	return GetDeliveryPersonIDFromUserID(userID)
+}
+
+func (SQLStore) GetAvailableDeliveries(zoneIDs []int) ([]Order, error) {
+	return GetAvailableDeliveries(zoneIDs)
+}
+
+func (SQLStore) GetAssignedDeliveries(deliveryPersonID int) ([]Order, error) {
+	return GetAssignedDeliveries(deliveryPersonID)
+}
+
+func (SQLStore) AssignDelivery(orderID, deliveryPersonID int) error {
+	return AssignDelivery(orderID, deliveryPersonID)
+}
+
+func (SQLStore) SetOrderDeliveryPerson(orderID, deliveryPersonID, adminUserID int) error {
+	return SetOrderDeliveryPerson(orderID, deliveryPersonID, adminUserID)
+}
+
+func (SQLStore) UpdateDeliveryStatus(orderID, userID int, status string) error {
+	return UpdateDeliveryStatus(orderID, userID, status)
+}
+
+func (SQLStore) GetDeliveryZones() ([]DeliveryZone, error) {
+	return GetDeliveryZones()
+}
+
+func (SQLStore) CreateDeliveryZone(z DeliveryZone) (int, error) {
+	return CreateDeliveryZone(z)
+}
+
+func (SQLStore) UpdateDeliveryZone(id int, z DeliveryZone) error {
+	return UpdateDeliveryZone(id, z)
+}
+
+func (SQLStore) DeleteDeliveryZone(id int) error {
+	return DeleteDeliveryZone(id)
+}
+
+func (SQLStore) GetDeliveryPersonZoneIDs(deliveryPersonID int) ([]int, error) {
+	return GetDeliveryPersonZoneIDs(deliveryPersonID)
+}
+
+func (SQLStore) SetDeliveryPersonZones(deliveryPersonID int, zoneIDs []int) error {
+	return SetDeliveryPersonZones(deliveryPersonID, zoneIDs)
+}
+
+func (SQLStore) GetDispatchPolicy() (DispatchPolicy, error) {
+	return GetDispatchPolicy()
+}
+
+func (SQLStore) UpdateDispatchPolicy(p DispatchPolicy, actorUserID int) error {
+	return UpdateDispatchPolicy(p, actorUserID)
+}
+
+func (SQLStore) DispatchReadyOrders(actorUserID int) (int, error) {
+	return DispatchReadyOrders(actorUserID)
+}
+
+// DiscountStore
+
+func (SQLStore) GetAllDiscountCodes() ([]DiscountCode, error) {
+	return GetAllDiscountCodes()
+}
+
+func (SQLStore) GetDiscountCodeByCode(code string) (DiscountCode, error) {
+	return GetDiscountCodeByCode(code)
+}
+
+func (SQLStore) HasUserUsedDiscount(userID int, discountCodeID int) (bool, error) {
+	return HasUserUsedDiscount(userID, discountCodeID)
+}
+
+func (SQLStore) CreateDiscountCode(dc DiscountCode) (int, error) {
+	return CreateDiscountCode(dc)
+}
+
+func (SQLStore) UpdateDiscountCode(id int, dc DiscountCode) error {
+	return UpdateDiscountCode(id, dc)
+}
+
+func (SQLStore) DeleteDiscountCode(id int) error {
+	return DeleteDiscountCode(id)
+}
+
+// KitchenStore
+
+func (SQLStore) GetKitchenQueue() ([]OrderDetails, error) {
+	return GetKitchenQueue()
+}
+
+func (SQLStore) StartOrderPizza(orderPizzaID int, actorUserID int) error {
+	return StartOrderPizza(orderPizzaID, actorUserID)
+}
+
+func (SQLStore) FinishOrderPizza(orderPizzaID int, actorUserID int) error {
+	return FinishOrderPizza(orderPizzaID, actorUserID)
+}
+
+func (SQLStore) MarkOrderReady(orderID int, actorUserID int) error {
+	return MarkOrderReady(orderID, actorUserID)
+}
+
+// PromotionStore
+
+func (SQLStore) GetAllPromotions() ([]Promotion, error) {
+	return GetAllPromotions()
+}
+
+func (SQLStore) CreatePromotion(p Promotion) (int, error) {
+	return CreatePromotion(p)
+}
+
+func (SQLStore) SetPromotionActive(id int, isActive bool) error {
+	return SetPromotionActive(id, isActive)
+}
+
+func (SQLStore) DeletePromotion(id int) error {
+	return DeletePromotion(id)
+}
+
+// VoucherStore
+
+func (SQLStore) CreateVoucherCampaign(c VoucherCampaign, count int, actorUserID int) (int, error) {
+	return CreateVoucherCampaign(c, count, actorUserID)
+}
+
+func (SQLStore) GetVoucherCampaigns() ([]VoucherCampaign, error) {
+	return GetVoucherCampaigns()
+}
+
+func (SQLStore) GetVoucherCampaign(id int) (VoucherCampaign, error) {
+	return GetVoucherCampaign(id)
+}
+
+func (SQLStore) GetVoucherCodes(campaignID int) ([]Voucher, error) {
+	return GetVoucherCodes(campaignID)
+}
+
+// PricingStore
+
+func (SQLStore) GetPricingConfig() (PricingConfig, error) {
+	return GetPricingConfig()
+}
+
+func (SQLStore) UpdatePricingConfig(cfg PricingConfig, actorUserID int) error {
+	return UpdatePricingConfig(cfg, actorUserID)
+}
+
+func (SQLStore) GetPricingConfigHistory(limit int) ([]PricingConfigChange, error) {
+	return GetPricingConfigHistory(limit)
+}
+
+// ExportStore
+
+func (SQLStore) ExportOrders(filter ExportFilter, fn func(OrderExportLine) error) error {
+	return ExportOrders(filter, fn)
+}
+
+func (SQLStore) ExportCustomers(filter ExportFilter, fn func(CustomerExport) error) error {
+	return ExportCustomers(filter, fn)
+}
+
+func (SQLStore) ExportDailySales(filter ExportFilter, fn func(DailySales) error) error {
+	return ExportDailySales(filter, fn)
+}
@@ -19,6 +19,7 @@ const (
 	AdminRole UserRole = iota
 	DeliveryRole
 	CustomerRole
+	KitchenRole
 )
 
 func (r UserRole) String() string {
@@ -29,10 +30,26 @@ func (r UserRole) String() string {
 		return "DELIVERY"
 	case CustomerRole:
 		return "CUSTOMER"
+	case KitchenRole:
+		return "KITCHEN"
 	}
 	panic(fmt.Sprintf("unhandled UserRole: %d", r))
 }
 
+func ParseUserRole(role string) (UserRole, error) {
+	switch role {
+	case "ADMIN":
+		return AdminRole, nil
+	case "DELIVERY":
+		return DeliveryRole, nil
+	case "CUSTOMER":
+		return CustomerRole, nil
+	case "KITCHEN":
+		return KitchenRole, nil
+	}
+	return 0, fmt.Errorf("unknown role: %s", role)
+}
+
 type Customer struct {
 	Username    string `json:"username"`
 	Password    string `json:"password"`
@@ -285,7 +302,7 @@ func GetUserRole(username string) (string, error) {
 	return "", errors.New("no such user")
 }
 
-func GetCustomerDetails(username string, password string) (Customer, error) {
+func GetCustomerDetails(username string) (Customer, error) {
 	exists, err := doesUserExist(username)
 	if err != nil {
 		return Customer{}, err
@@ -324,7 +341,6 @@ func GetCustomerDetails(username string, password string) (Customer, error) {
 		}
 
 		customer.Username = username
-		customer.Password = password
 		return customer, nil
 
 	} else {
@@ -335,7 +351,56 @@ func GetCustomerDetails(username string, password string) (Customer, error) {
 
 // Admin functions for user management
 
-func GetAllUsers() ([]map[string]interface{}, error) {
+// UserFilter narrows down and pages the admin user list. Blank fields don't filter.
+type UserFilter struct {
+	Role string
+	// Usernames or names containing it
+	Search string
+	// Customers whose postal code starts with it
+	PostalCode string
+	ListOptions
+}
+
+var userSorts = sortColumns{
+	"id":       "u.id",
+	"username": "u.username",
+	"role":     "u.role",
+	"name":     "COALESCE(c.name, dp.name)",
+}
+
+// ListUsers returns a page of the customers, couriers and kitchen staff matching the filter, newest
+// first unless it sorts them otherwise, and how many match across all pages. Admins aren't listed.
+func ListUsers(filter UserFilter) ([]map[string]interface{}, int, error) {
+	conditions := []string{"u.role != 'ADMIN'"}
+	var args []any
+	if filter.Role != "" {
+		conditions = append(conditions, "u.role = ?")
+		args = append(args, filter.Role)
+	}
+	if filter.Search != "" {
+		conditions = append(conditions, "(u.username LIKE ? OR c.name LIKE ? OR dp.name LIKE ?)")
+		search := "%" + filter.Search + "%"
+		args = append(args, search, search, search)
+	}
+	if filter.PostalCode != "" {
+		conditions = append(conditions, "c.postal_code LIKE ?")
+		args = append(args, filter.PostalCode+"%")
+	}
+	where := whereClause(conditions)
+
+	orderBy, err := filter.orderBy(userSorts, "u.id DESC", "u.id")
+	if err != nil {
+		return nil, 0, err
+	}
+	from := `user u
+		LEFT JOIN customer c ON u.id = c.user_id
+		LEFT JOIN delivery_person dp ON u.id = dp.user_id`
+	total, err := countRows(from, where, args)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	page, pageArgs := filter.page()
 	query := `
 		SELECT u.id, u.username, u.role, 
 			COALESCE(c.name, dp.name, 'N/A') as name,
@@ -343,15 +408,10 @@ func GetAllUsers() ([]map[string]interface{}, error) {
 			COALESCE(c.birth_date, '') as birth_date,
 			COALESCE(c.address, 'N/A') as address,
 			COALESCE(c.postal_code, 'N/A') as postal_code
-		FROM user u
-		LEFT JOIN customer c ON u.id = c.user_id
-		LEFT JOIN delivery_person dp ON u.id = dp.user_id
-		WHERE u.role != 'ADMIN'
-		ORDER BY u.id DESC
-	`
-	rows, err := DATABASE.Query(query)
+		FROM ` + from + where + orderBy + page
+	rows, err := DATABASE.Query(query, append(args, pageArgs...)...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
@@ -362,7 +422,7 @@ func GetAllUsers() ([]map[string]interface{}, error) {
 		var birthDate sql.NullString
 		err := rows.Scan(&id, &username, &role, &name, &gender, &birthDate, &address, &postalCode)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 
 		birthDateStr := ""
@@ -388,7 +448,7 @@ func GetAllUsers() ([]map[string]interface{}, error) {
 		users = []map[string]interface{}{}
 	}
 
-	return users, nil
+	return users, total, rows.Err()
 }
 
 func DeleteUser(userID int) error {
@@ -418,7 +478,11 @@ func DeleteUser(userID int) error {
 		err = tx.QueryRow("SELECT id FROM customer WHERE user_id = ?", userID).Scan(&customerID)
 		if err == nil {
 			// Delete orders and order items for this customer
-			_, err = tx.Exec("DELETE op FROM order_pizza op INNER JOIN `orders` o ON op.order_id = o.id WHERE o.customer_id = ?", customerID)
+			_, err = tx.Exec("DELETE FROM order_pizza WHERE order_id IN (SELECT id FROM `orders` WHERE customer_id = ?)", customerID)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec("DELETE FROM order_extra_item WHERE order_id IN (SELECT id FROM `orders` WHERE customer_id = ?)", customerID)
 			if err != nil {
 				return err
 			}
@@ -427,6 +491,10 @@ func DeleteUser(userID int) error {
 				return err
 			}
 		}
+		_, err = tx.Exec("DELETE FROM discount_usage WHERE user_id = ?", userID)
+		if err != nil {
+			return err
+		}
 		_, err = tx.Exec("DELETE FROM customer WHERE user_id = ?", userID)
 		if err != nil {
 			return err
@@ -449,25 +517,5 @@ func DeleteUser(userID int) error {
 
 // CheckCustomerBirthday checks if today is the customer's birthday
 func CheckCustomerBirthday(userID int64) (bool, error) {
-	var birthDate sql.NullTime
-	query := `
-		SELECT c.birth_date 
-		FROM customer c 
-		WHERE c.user_id = ?
-	`
-	err := DATABASE.QueryRow(query, userID).Scan(&birthDate)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return false, nil
-		}
-		return false, err
-	}
-
-	if !birthDate.Valid {
-		return false, nil
-	}
-
-	// Check if today's month and day match the birth date
-	now := time.Now()
-	return now.Month() == birthDate.Time.Month() && now.Day() == birthDate.Time.Day(), nil
+	return isCustomerBirthday(DATABASE, int(userID), time.Now())
 }
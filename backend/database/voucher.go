@@ -0,0 +1,283 @@
+package database
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	ErrVoucherCampaignNotFound = errors.New("voucher campaign not found")
+	ErrVoucherCampaignExists   = errors.New("a voucher campaign with this name already exists")
+	ErrInvalidVoucherCampaign  = errors.New("a voucher campaign needs a name, a prefix of up to 20 letters, digits and dashes, " +
+		"between 1 and 10000 codes, a percentage between 1 and 100 and an expiry in the future")
+)
+
+// MaxVouchersPerCampaign is the most codes one campaign can generate.
+const MaxVouchersPerCampaign = 10000
+
+// voucherAlphabet leaves out 0, 1, I and O, which are easily mixed up when a code is typed in.
+// It has 32 letters, so a random byte maps to one without favouring any.
+const voucherAlphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+
+// voucherCodeLength random letters give 32^10, about 10^15, possible codes per prefix.
+const voucherCodeLength = 10
+
+// voucherInsertBatch is how many codes one INSERT writes.
+const voucherInsertBatch = 500
+
+var voucherPrefix = regexp.MustCompile(`^[A-Z0-9-]{1,20}$`)
+
+// VoucherCampaign is a batch of single-use codes, with how many of them were redeemed.
+type VoucherCampaign struct {
+	ID                 int        `json:"id"`
+	Name               string     `json:"name"`
+	Prefix             string     `json:"prefix"`
+	DiscountPercentage int        `json:"discount_percentage"`
+	ValidUntil         *time.Time `json:"valid_until"`
+	CreatedBy          *string    `json:"created_by"`
+	CreatedAt          time.Time  `json:"created_at"`
+
+	// Redemptions count the orders that used a code, cancelled orders give theirs back
+	Codes     int     `json:"codes"`
+	Redeemed  int     `json:"redeemed"`
+	Customers int     `json:"customers"`
+	Revenue   float64 `json:"revenue"`
+}
+
+// RedemptionRate is the percentage of the codes that were redeemed.
+func (c VoucherCampaign) RedemptionRate() float64 {
+	if c.Codes == 0 {
+		return 0
+	}
+	return float64(c.Redeemed) * 100 / float64(c.Codes)
+}
+
+// Voucher is one code of a campaign, and the order that redeemed it.
+type Voucher struct {
+	Code       string     `json:"code"`
+	RedeemedAt *time.Time `json:"redeemed_at"`
+	OrderID    *int       `json:"order_id"`
+	Username   *string    `json:"username"`
+}
+
+// generateVoucherCode makes a code that can't be guessed from the other codes of its campaign.
+func generateVoucherCode(prefix string) (string, error) {
+	random := make([]byte, voucherCodeLength)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	for i, b := range random {
+		random[i] = voucherAlphabet[int(b)%len(voucherAlphabet)]
+	}
+	return prefix + "-" + string(random), nil
+}
+
+func validateVoucherCampaign(c VoucherCampaign, count int, now time.Time) error {
+	switch {
+	case strings.TrimSpace(c.Name) == "":
+		return ErrInvalidVoucherCampaign
+	case !voucherPrefix.MatchString(c.Prefix):
+		return ErrInvalidVoucherCampaign
+	case count < 1 || count > MaxVouchersPerCampaign:
+		return ErrInvalidVoucherCampaign
+	case c.DiscountPercentage < 1 || c.DiscountPercentage > 100:
+		return ErrInvalidVoucherCampaign
+	case c.ValidUntil != nil && !c.ValidUntil.After(now):
+		return ErrInvalidVoucherCampaign
+	}
+	return nil
+}
+
+// CreateVoucherCampaign generates count codes for the campaign. Every code is a percentage off the whole
+// order that one customer can use once, until the campaign's expiry.
+func CreateVoucherCampaign(c VoucherCampaign, count int, actorUserID int) (int, error) {
+	c.Prefix = strings.ToUpper(strings.TrimSpace(c.Prefix))
+	now := time.Now()
+	if err := validateVoucherCampaign(c, count, now); err != nil {
+		return 0, err
+	}
+
+	tx, err := DATABASE.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var existing int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM voucher_campaign WHERE name = ?`, strings.TrimSpace(c.Name)).Scan(&existing)
+	if err != nil {
+		return 0, err
+	}
+	if existing > 0 {
+		return 0, ErrVoucherCampaignExists
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO voucher_campaign (name, prefix, discount_percentage, valid_until, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, strings.TrimSpace(c.Name), c.Prefix, c.DiscountPercentage, c.ValidUntil, nullableUserID(actorUserID), now)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	// Codes already taken by earlier campaigns with the same prefix
+	taken := map[string]bool{}
+	rows, err := tx.Query(`SELECT code FROM discount_code WHERE code LIKE ?`, c.Prefix+"-%")
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		taken[code] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	codes := make([]string, 0, count)
+	for len(codes) < count {
+		code, err := generateVoucherCode(c.Prefix)
+		if err != nil {
+			return 0, err
+		}
+		if taken[code] {
+			continue
+		}
+		taken[code] = true
+		codes = append(codes, code)
+	}
+
+	for start := 0; start < len(codes); start += voucherInsertBatch {
+		batch := codes[start:min(start+voucherInsertBatch, len(codes))]
+		placeholders := make([]string, len(batch))
+		args := make([]any, 0, len(batch)*4)
+		for i, code := range batch {
+			placeholders[i] = "(?, 'PERCENTAGE', ?, 0, TRUE, ?, 1, 1, 'ORDER', ?)"
+			args = append(args, code, c.DiscountPercentage, c.ValidUntil, id)
+		}
+		_, err := tx.Exec(`
+			INSERT INTO discount_code (code, discount_type, discount_percentage, discount_amount, is_active,
+				valid_until, max_uses, max_uses_per_customer, scope, campaign_id)
+			VALUES `+strings.Join(placeholders, ", "), args...)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return int(id), tx.Commit()
+}
+
+const voucherCampaignColumns = `vc.id, vc.name, vc.prefix, vc.discount_percentage, vc.valid_until, u.username, vc.created_at,
+	(SELECT COUNT(*) FROM discount_code dc WHERE dc.campaign_id = vc.id),
+	(SELECT COUNT(*) FROM discount_usage du JOIN discount_code dc ON du.discount_code_id = dc.id
+		WHERE dc.campaign_id = vc.id),
+	(SELECT COUNT(DISTINCT du.user_id) FROM discount_usage du JOIN discount_code dc ON du.discount_code_id = dc.id
+		WHERE dc.campaign_id = vc.id),
+	(SELECT SUM(o.total_price) FROM discount_usage du JOIN discount_code dc ON du.discount_code_id = dc.id
+		JOIN orders o ON du.order_id = o.id WHERE dc.campaign_id = vc.id)`
+
+func scanVoucherCampaign(row interface{ Scan(...any) error }) (VoucherCampaign, error) {
+	var c VoucherCampaign
+	var validUntil sql.NullTime
+	var createdBy sql.NullString
+	var revenue sql.NullFloat64
+	err := row.Scan(&c.ID, &c.Name, &c.Prefix, &c.DiscountPercentage, &validUntil, &createdBy, &c.CreatedAt,
+		&c.Codes, &c.Redeemed, &c.Customers, &revenue)
+	if err != nil {
+		return VoucherCampaign{}, err
+	}
+	if validUntil.Valid {
+		c.ValidUntil = &validUntil.Time
+	}
+	if createdBy.Valid {
+		c.CreatedBy = &createdBy.String
+	}
+	if revenue.Valid {
+		c.Revenue = revenue.Float64
+	}
+	return c, nil
+}
+
+// GetVoucherCampaigns returns every campaign with its redemption statistics, newest first.
+func GetVoucherCampaigns() ([]VoucherCampaign, error) {
+	rows, err := DATABASE.Query(`SELECT ` + voucherCampaignColumns + `
+		FROM voucher_campaign vc
+		LEFT JOIN user u ON vc.created_by = u.id
+		ORDER BY vc.created_at DESC, vc.id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	campaigns := []VoucherCampaign{}
+	for rows.Next() {
+		c, err := scanVoucherCampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, c)
+	}
+	return campaigns, rows.Err()
+}
+
+func GetVoucherCampaign(id int) (VoucherCampaign, error) {
+	c, err := scanVoucherCampaign(DATABASE.QueryRow(`SELECT `+voucherCampaignColumns+`
+		FROM voucher_campaign vc
+		LEFT JOIN user u ON vc.created_by = u.id
+		WHERE vc.id = ?`, id))
+	if err == sql.ErrNoRows {
+		return VoucherCampaign{}, ErrVoucherCampaignNotFound
+	}
+	return c, err
+}
+
+// GetVoucherCodes returns the codes of a campaign and who redeemed them, in the order they were generated.
+func GetVoucherCodes(campaignID int) ([]Voucher, error) {
+	rows, err := DATABASE.Query(`
+		SELECT dc.code, du.used_at, du.order_id, u.username
+		FROM discount_code dc
+		LEFT JOIN discount_usage du ON du.discount_code_id = dc.id
+		LEFT JOIN user u ON du.user_id = u.id
+		WHERE dc.campaign_id = ?
+		ORDER BY dc.id
+	`, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vouchers := []Voucher{}
+	for rows.Next() {
+		var v Voucher
+		var redeemedAt sql.NullTime
+		var orderID sql.NullInt64
+		var username sql.NullString
+		if err := rows.Scan(&v.Code, &redeemedAt, &orderID, &username); err != nil {
+			return nil, err
+		}
+		if redeemedAt.Valid {
+			v.RedeemedAt = &redeemedAt.Time
+		}
+		if orderID.Valid {
+			id := int(orderID.Int64)
+			v.OrderID = &id
+		}
+		if username.Valid {
+			v.Username = &username.String
+		}
+		vouchers = append(vouchers, v)
+	}
+	return vouchers, rows.Err()
+}
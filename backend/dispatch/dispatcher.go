@@ -0,0 +1,54 @@
+// Package dispatch hands ready orders to couriers in the background, following the dispatch policy.
+package dispatch
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// DefaultInterval is how often the dispatcher looks for ready orders when DISPATCH_INTERVAL isn't set.
+const DefaultInterval = 15 * time.Second
+
+// Store assigns the orders, database.DeliveryStore implements it.
+type Store interface {
+	DispatchReadyOrders(actorUserID int) (int, error)
+}
+
+// Dispatcher runs a dispatch round every interval.
+type Dispatcher struct {
+	store    Store
+	interval time.Duration
+}
+
+func New(store Store, interval time.Duration) *Dispatcher {
+	return &Dispatcher{store: store, interval: interval}
+}
+
+// Run dispatches until ctx is done, so it runs in its own goroutine. A failed round is logged
+// and tried again on the next tick.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		d.dispatch()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch() {
+	// The status history has no one to show for the rounds the server runs by itself
+	assigned, err := d.store.DispatchReadyOrders(0)
+	if err != nil {
+		log.Println("Dispatch failed:", err)
+		return
+	}
+	if assigned > 0 {
+		log.Printf("Dispatched %d order(s)", assigned)
+	}
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	database "pizza_shop/backend/database"
+	"pizza_shop/backend/web"
+)
+
+// cartCustomerID is the customer whose cart the request is about. It answers the request itself
+// and returns ok false when the user isn't a customer.
+func (h *Handler) cartCustomerID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	customerID, err := h.Users.GetCustomerIDFromUserID(requestSession(r).UserID)
+	if err != nil {
+		web.WriteJSONError(w, http.StatusForbidden, "Customer not found")
+		return 0, false
+	}
+	return customerID, true
+}
+
+// writeCart answers with the customer's cart as it is now, after a change or on its own.
+func (h *Handler) writeCart(w http.ResponseWriter, customerID int, extra map[string]interface{}) {
+	cart, err := h.Carts.GetCart(customerID)
+	if err != nil {
+		fmt.Println("GetCart error:", err)
+		web.WriteJSONError(w, http.StatusInternalServerError, "Failed to get your cart")
+		return
+	}
+	response := map[string]interface{}{
+		"ok":   true,
+		"cart": cart,
+	}
+	for key, value := range extra {
+		response[key] = value
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func cartErrorCode(err error) int {
+	var outOfStock *database.OutOfStockError
+	var discountRejected *database.DiscountRejectedError
+	var deliveryRejected *database.DeliveryRejectedError
+	switch {
+	case errors.Is(err, database.ErrCartItemNotFound), errors.Is(err, database.ErrNotOnMenu):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrInvalidQuantity), errors.Is(err, database.ErrPizzaOptionNotFound),
+		errors.Is(err, database.ErrIngredientNotFound), errors.Is(err, database.ErrInvalidModifier),
+		errors.Is(err, database.ErrEmptyPizza), errors.Is(err, database.ErrCartEmpty),
+		errors.As(err, &discountRejected), errors.As(err, &deliveryRejected):
+		return http.StatusBadRequest
+	case errors.As(err, &outOfStock):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeCartError answers a change to the cart that failed.
+func writeCartError(w http.ResponseWriter, err error, what, fallback string) {
+	code := cartErrorCode(err)
+	if code == http.StatusInternalServerError {
+		fmt.Println(what, "error:", err)
+	}
+	web.WriteJSONError(w, code, cartErrorMessage(err, fallback))
+}
+
+// CartItemsHandler returns the customer's cart priced with the current menu.
+func (h *Handler) CartItemsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	customerID, ok := h.cartCustomerID(w, r)
+	if !ok {
+		return
+	}
+	h.writeCart(w, customerID, nil)
+}
+
+// AddToCartHandler puts a pizza or extra item in the customer's cart, see database.CartLine for the body.
+// The quantity defaults to 1.
+func (h *Handler) AddToCartHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var line database.CartLine
+	if err := json.NewDecoder(r.Body).Decode(&line); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	switch line.Type {
+	case "":
+		line.Type = "pizza"
+	case "pizza", "extra":
+	default:
+		web.WriteJSONError(w, http.StatusBadRequest, "type must be pizza or extra")
+		return
+	}
+	if line.Quantity == 0 {
+		line.Quantity = 1
+	}
+
+	customerID, ok := h.cartCustomerID(w, r)
+	if !ok {
+		return
+	}
+	itemID, err := h.Carts.AddToCart(customerID, line)
+	if err != nil {
+		writeCartError(w, err, "AddToCart", "Failed to add to your cart")
+		return
+	}
+	h.writeCart(w, customerID, map[string]interface{}{"item_id": itemID})
+}
+
+// UpdateCartItemHandler sets the quantity of a line of the customer's cart, 0 takes it out.
+func (h *Handler) UpdateCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ItemID   int `json:"item_id"`
+		Quantity int `json:"quantity"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	customerID, ok := h.cartCustomerID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Carts.UpdateCartItemQuantity(customerID, req.ItemID, req.Quantity); err != nil {
+		writeCartError(w, err, "UpdateCartItemQuantity", "Failed to update your cart")
+		return
+	}
+	h.writeCart(w, customerID, nil)
+}
+
+// RemoveFromCartHandler takes a line out of the customer's cart.
+func (h *Handler) RemoveFromCartHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ItemID int `json:"item_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	customerID, ok := h.cartCustomerID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Carts.RemoveFromCart(customerID, req.ItemID); err != nil {
+		writeCartError(w, err, "RemoveFromCart", "Failed to update your cart")
+		return
+	}
+	h.writeCart(w, customerID, nil)
+}
+
+// ClearCartHandler empties the customer's cart.
+func (h *Handler) ClearCartHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	customerID, ok := h.cartCustomerID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Carts.ClearCart(customerID); err != nil {
+		writeCartError(w, err, "ClearCart", "Failed to empty your cart")
+		return
+	}
+	h.writeCart(w, customerID, nil)
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	database "pizza_shop/backend/database"
+	"pizza_shop/backend/web"
+)
+
+// CustomPizzaPriceHandler prices a pizza with toppings added or removed, and tells whether it is still vegetarian or vegan.
+func (h *Handler) CustomPizzaPriceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		PizzaID   int                      `json:"pizza_id"`
+		SizeID    int                      `json:"size_id"`
+		CrustID   int                      `json:"crust_id"`
+		Modifiers []database.PizzaModifier `json:"modifiers"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	info, err := h.Pizzas.PriceCustomPizza(req.PizzaID, req.SizeID, req.CrustID, req.Modifiers)
+	if err != nil {
+		code := customPizzaErrorCode(err)
+		if code == http.StatusInternalServerError {
+			fmt.Println("PriceCustomPizza error:", err)
+			web.WriteJSONError(w, code, "Failed to price pizza")
+			return
+		}
+		web.WriteJSONError(w, code, err.Error())
+		return
+	}
+
+	price, _ := info.Cost.Float64()
+	type Msg struct {
+		Ok           bool    `json:"ok"`
+		Price        float64 `json:"price"`
+		IsVegetarian bool    `json:"is_vegetarian"`
+		IsVegan      bool    `json:"is_vegan"`
+	}
+	json.NewEncoder(w).Encode(Msg{Ok: true, Price: price, IsVegetarian: info.IsVegetarian, IsVegan: info.IsVegan})
+}
+
+func customPizzaErrorCode(err error) int {
+	switch {
+	case errors.Is(err, database.ErrIngredientNotFound), errors.Is(err, database.ErrPizzaOptionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrInvalidModifier), errors.Is(err, database.ErrEmptyPizza):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
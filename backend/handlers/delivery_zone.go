@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	database "pizza_shop/backend/database"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// parseDeliveryZoneForm reads the admin zone form. covers is "prefix" or "range", and says which postal code fields count.
+func parseDeliveryZoneForm(r *http.Request) (database.DeliveryZone, error) {
+	r.ParseForm()
+	z := database.DeliveryZone{
+		Name:     strings.TrimSpace(r.FormValue("name")),
+		IsActive: r.FormValue("is_active") == "on",
+	}
+	if r.FormValue("covers") == "range" {
+		from, to := r.FormValue("postal_code_from"), r.FormValue("postal_code_to")
+		z.PostalCodeFrom, z.PostalCodeTo = &from, &to
+	} else {
+		prefix := r.FormValue("postal_code_prefix")
+		z.PostalCodePrefix = &prefix
+	}
+
+	var err error
+	for _, field := range []struct {
+		name string
+		dest *decimal.Decimal
+	}{{"delivery_fee", &z.DeliveryFee}, {"min_order_value", &z.MinOrderValue}} {
+		value := r.FormValue(field.name)
+		if value == "" {
+			continue
+		}
+		if *field.dest, err = decimal.NewFromString(value); err != nil {
+			return z, fmt.Errorf("invalid %s", strings.ReplaceAll(field.name, "_", " "))
+		}
+	}
+	if z.EstimatedMinutes, err = strconv.Atoi(r.FormValue("estimated_minutes")); err != nil {
+		return z, fmt.Errorf("invalid estimated minutes")
+	}
+	return z, nil
+}
+
+func (h *Handler) AdminCreateDeliveryZoneHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	z, err := parseDeliveryZoneForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := h.Deliveries.CreateDeliveryZone(z); err != nil {
+		http.Error(w, err.Error(), deliveryZoneErrorCode(err))
+		return
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func (h *Handler) AdminUpdateDeliveryZoneHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	z, err := parseDeliveryZoneForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "ID required", http.StatusBadRequest)
+		return
+	}
+	if err := h.Deliveries.UpdateDeliveryZone(id, z); err != nil {
+		http.Error(w, err.Error(), deliveryZoneErrorCode(err))
+		return
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func (h *Handler) AdminDeleteDeliveryZoneHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.ParseForm()
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "ID required", http.StatusBadRequest)
+		return
+	}
+	if err := h.Deliveries.DeleteDeliveryZone(id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// AdminSetDeliveryPersonZonesHandler sets the zones a courier delivers in, id is the courier's user id.
+func (h *Handler) AdminSetDeliveryPersonZonesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.ParseForm()
+	userID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "ID required", http.StatusBadRequest)
+		return
+	}
+	zoneIDs := []int{}
+	for _, value := range r.Form["zone_ids"] {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Invalid zone", http.StatusBadRequest)
+			return
+		}
+		zoneIDs = append(zoneIDs, id)
+	}
+
+	deliveryPersonID, err := h.Deliveries.GetDeliveryPersonIDFromUserID(userID)
+	if err != nil {
+		http.Error(w, "Delivery person not found", http.StatusNotFound)
+		return
+	}
+	if err := h.Deliveries.SetDeliveryPersonZones(deliveryPersonID, zoneIDs); err != nil {
+		http.Error(w, err.Error(), deliveryZoneErrorCode(err))
+		return
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func deliveryZoneErrorCode(err error) int {
+	switch {
+	case errors.Is(err, database.ErrInvalidDeliveryZone):
+		return http.StatusBadRequest
+	case errors.Is(err, database.ErrDeliveryZoneNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// deliveryRejectionMessage tells the customer why we can't deliver their order.
+func deliveryRejectionMessage(e *database.DeliveryRejectedError) string {
+	switch {
+	case errors.Is(e.Err, database.ErrNoDeliveryZone):
+		return "Sorry, we don't deliver to postal code " + e.PostalCode
+	case errors.Is(e.Err, database.ErrDeliveryMinimumNotMet) && e.Zone != nil:
+		return fmt.Sprintf("Orders to %s need at least $%s of food and drinks", e.Zone.Name, e.Zone.MinOrderValue.StringFixed(2))
+	default:
+		return "Sorry, we can't deliver this order"
+	}
+}
+
+// deliveryZoneFormFields renders the rows of the create and edit forms of a delivery zone.
+func deliveryZoneFormFields(z database.DeliveryZone) string {
+	prefixChecked, rangeChecked := "checked", ""
+	prefix, from, to := "", "", ""
+	if z.PostalCodePrefix != nil {
+		prefix = *z.PostalCodePrefix
+	} else if z.PostalCodeFrom != nil && z.PostalCodeTo != nil {
+		prefixChecked, rangeChecked = "", "checked"
+		from, to = *z.PostalCodeFrom, *z.PostalCodeTo
+	}
+	activeChecked := ""
+	if z.IsActive {
+		activeChecked = "checked"
+	}
+
+	return fmt.Sprintf(`<tr><td><b>Name:</b></td><td><input type="text" name="name" value="%s" required></td></tr>
+<tr><td><label><input type="radio" name="covers" value="prefix" %s> <b>Postal codes starting with:</b></label></td>
+<td><input type="text" name="postal_code_prefix" value="%s" size="10"> (blank for all)</td></tr>
+<tr><td><label><input type="radio" name="covers" value="range" %s> <b>Postal codes from:</b></label></td>
+<td><input type="text" name="postal_code_from" value="%s" size="10"> to <input type="text" name="postal_code_to" value="%s" size="10"></td></tr>
+<tr><td><b>Delivery fee $:</b></td><td><input type="number" name="delivery_fee" value="%s" min="0" step="0.01"></td></tr>
+<tr><td><b>Minimum order $:</b></td><td><input type="number" name="min_order_value" value="%s" min="0" step="0.01"></td></tr>
+<tr><td><b>Estimated minutes:</b></td><td><input type="number" name="estimated_minutes" value="%d" min="1" required></td></tr>
+<tr><td><b>Active:</b></td><td><input type="checkbox" name="is_active" %s></td></tr>`,
+		z.Name, prefixChecked, prefix, rangeChecked, from, to, z.DeliveryFee.StringFixed(2), z.MinOrderValue.StringFixed(2),
+		z.EstimatedMinutes, activeChecked)
+}
+
+// deliveryPersonZonesForm renders the zones a courier delivers in, as a form to change them.
+func deliveryPersonZonesForm(userID any, zones []database.DeliveryZone, zoneIDs []int) string {
+	options := ""
+	for _, z := range zones {
+		selected := ""
+		if slices.Contains(zoneIDs, z.ID) {
+			selected = " selected"
+		}
+		options += fmt.Sprintf(`<option value="%d"%s>%s</option>`, z.ID, selected, z.Name)
+	}
+	return fmt.Sprintf(`<form method="POST" action="/admin/delivery/zones" style="display:inline;">
+<input type="hidden" name="id" value="%v">
+<select name="zone_ids" multiple size="3">%s</select>
+<input type="submit" value="Save Zones"></form>`, userID, options)
+}
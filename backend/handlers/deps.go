@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	database "pizza_shop/backend/database"
+)
+
+// Deps are the stores the handlers read and write through.
+// main wires in database.SQLStore, tests can pass in-memory fakes.
+type Deps struct {
+	Pizzas      database.PizzaStore
+	Ingredients database.IngredientStore
+	ExtraItems  database.ExtraItemStore
+	Orders      database.OrderStore
+	Carts       database.CartStore
+	Users       database.UserStore
+	Deliveries  database.DeliveryStore
+	Discounts   database.DiscountStore
+	Promotions  database.PromotionStore
+	Vouchers    database.VoucherStore
+	Kitchen     database.KitchenStore
+	Pricing     database.PricingStore
+	Exports     database.ExportStore
+}
+
+// Handler holds the dependencies, every http handler is a method on it.
+type Handler struct {
+	Deps
+}
+
+func New(deps Deps) *Handler {
+	return &Handler{Deps: deps}
+}
@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	database "pizza_shop/backend/database"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// datetimeLocalLayout is what <input type="datetime-local"> submits, in the shop's time zone.
+const datetimeLocalLayout = "2006-01-02T15:04"
+
+// parseDiscountCodeForm reads the discount code fields of the admin form. Blank limits mean there is none.
+func parseDiscountCodeForm(r *http.Request) (database.DiscountCode, error) {
+	r.ParseForm()
+	dc := database.DiscountCode{
+		Code:     strings.ToUpper(strings.TrimSpace(r.FormValue("code"))),
+		Type:     database.DiscountType(r.FormValue("discount_type")),
+		IsActive: r.FormValue("is_active") == "on",
+		Scope:    database.DiscountScope(r.FormValue("scope")),
+	}
+	if dc.Type == "" {
+		dc.Type = database.PercentageDiscount
+	}
+	if dc.Scope == "" {
+		dc.Scope = database.ScopeOrder
+	}
+
+	var err error
+	if dc.Type == database.FixedDiscount {
+		if dc.DiscountAmount, err = decimal.NewFromString(r.FormValue("amount")); err != nil {
+			return dc, fmt.Errorf("invalid amount")
+		}
+	} else if dc.DiscountPercentage, err = strconv.Atoi(r.FormValue("percentage")); err != nil {
+		return dc, fmt.Errorf("invalid percentage")
+	}
+
+	if value := r.FormValue("min_order_value"); value != "" {
+		if dc.MinOrderValue, err = decimal.NewFromString(value); err != nil {
+			return dc, fmt.Errorf("invalid minimum order value")
+		}
+	}
+	for _, field := range []struct {
+		name string
+		dest **time.Time
+	}{{"valid_from", &dc.ValidFrom}, {"valid_until", &dc.ValidUntil}} {
+		value := r.FormValue(field.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.ParseInLocation(datetimeLocalLayout, value, time.Local)
+		if err != nil {
+			return dc, fmt.Errorf("invalid %s", strings.ReplaceAll(field.name, "_", " "))
+		}
+		*field.dest = &t
+	}
+	for _, field := range []struct {
+		name string
+		dest **int
+	}{{"max_uses", &dc.MaxUses}, {"max_uses_per_customer", &dc.MaxUsesPerCustomer}} {
+		value := r.FormValue(field.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return dc, fmt.Errorf("invalid %s", strings.ReplaceAll(field.name, "_", " "))
+		}
+		*field.dest = &n
+	}
+	for _, field := range []struct {
+		name string
+		dest *[]int
+	}{{"pizza_ids", &dc.PizzaIDs}, {"extra_item_ids", &dc.ExtraItemIDs}} {
+		for _, value := range r.Form[field.name] {
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				return dc, fmt.Errorf("invalid %s", strings.ReplaceAll(field.name, "_", " "))
+			}
+			*field.dest = append(*field.dest, id)
+		}
+	}
+	return dc, nil
+}
+
+func discountErrorCode(err error) int {
+	switch {
+	case errors.Is(err, database.ErrInvalidDiscountCode):
+		return http.StatusBadRequest
+	case errors.Is(err, database.ErrDiscountCodeNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// discountRejection returns the reason a discount code was refused, "" if err isn't about the code.
+func discountRejection(err error) string {
+	var rejected *database.DiscountRejectedError
+	if errors.As(err, &rejected) {
+		return rejected.Reason()
+	}
+	return ""
+}
+
+// discountRejectionMessage tells the customer why they can't use the code.
+func discountRejectionMessage(e *database.DiscountRejectedError) string {
+	dc := e.Discount
+	switch e.Reason() {
+	case "NOT_FOUND":
+		return "Discount code " + e.Code + " doesn't exist"
+	case "INACTIVE":
+		return "This discount code is no longer active"
+	case "NOT_STARTED":
+		return "This discount code is valid from " + dc.ValidFrom.Format("Jan 2, 2006 15:04")
+	case "EXPIRED":
+		return "This discount code expired on " + dc.ValidUntil.Format("Jan 2, 2006 15:04")
+	case "USED_UP":
+		return "This discount code has been used up"
+	case "ALREADY_USED":
+		if dc.MaxUsesPerCustomer != nil && *dc.MaxUsesPerCustomer > 1 {
+			return fmt.Sprintf("You have already used this discount code %d times", *dc.MaxUsesPerCustomer)
+		}
+		return "You have already used this discount code"
+	case "MINIMUM_NOT_MET":
+		return "This discount code needs an order of at least $" + dc.MinOrderValue.StringFixed(2)
+	case "NOT_APPLICABLE":
+		switch dc.Scope {
+		case database.ScopePizzas:
+			return "This discount code only applies to pizzas, add one to your cart"
+		case database.ScopeDrinks:
+			return "This discount code only applies to drinks, add one to your cart"
+		case database.ScopeDesserts:
+			return "This discount code only applies to desserts, add one to your cart"
+		default:
+			return "This discount code doesn't apply to anything in your cart"
+		}
+	case "CONDITIONS_NOT_MET":
+		if e.Condition != nil {
+			return "This discount code only works " + describeCondition(*e.Condition)
+		}
+		return "Your order doesn't meet the conditions of this discount code"
+	default:
+		return "This discount code can't be used"
+	}
+}
+
+// describeDiscount is what the code takes off, e.g. "10% off drinks" or "$5.00 off".
+func describeDiscount(dc database.DiscountCode) string {
+	off := fmt.Sprintf("%d%% off", dc.DiscountPercentage)
+	if dc.Type == database.FixedDiscount {
+		off = "$" + dc.DiscountAmount.StringFixed(2) + " off"
+	}
+	switch dc.Scope {
+	case database.ScopePizzas:
+		return off + " pizzas"
+	case database.ScopeDrinks:
+		return off + " drinks"
+	case database.ScopeDesserts:
+		return off + " desserts"
+	case database.ScopeItems:
+		return off + " selected items"
+	default:
+		return off
+	}
+}
+
+// discountRules summarizes the limits of a code for the admin list.
+func discountRules(dc database.DiscountCode) string {
+	rules := []string{describeDiscount(dc)}
+	if dc.MinOrderValue.IsPositive() {
+		rules = append(rules, "orders from $"+dc.MinOrderValue.StringFixed(2))
+	}
+	if dc.ValidFrom != nil {
+		rules = append(rules, "from "+dc.ValidFrom.Format("2006-01-02 15:04"))
+	}
+	if dc.ValidUntil != nil {
+		rules = append(rules, "until "+dc.ValidUntil.Format("2006-01-02 15:04"))
+	}
+	if dc.MaxUses != nil {
+		rules = append(rules, fmt.Sprintf("%d in total", *dc.MaxUses))
+	}
+	if dc.MaxUsesPerCustomer != nil {
+		rules = append(rules, fmt.Sprintf("%d per customer", *dc.MaxUsesPerCustomer))
+	}
+	return strings.Join(rules, ", ")
+}
+
+// discountCodeFormFields renders the rows of the create and edit forms of a discount code.
+func discountCodeFormFields(dc database.DiscountCode, pizzas []database.PizzaWithPrice, extraItems []database.ExtraItem) string {
+	typeOptions := ""
+	for _, t := range []database.DiscountType{database.PercentageDiscount, database.FixedDiscount} {
+		selected := ""
+		if dc.Type == t {
+			selected = " selected"
+		}
+		typeOptions += fmt.Sprintf(`<option value="%s"%s>%s</option>`, t, selected, t)
+	}
+	scopeOptions := ""
+	for _, scope := range database.DiscountScopes {
+		selected := ""
+		if dc.Scope == scope {
+			selected = " selected"
+		}
+		scopeOptions += fmt.Sprintf(`<option value="%s"%s>%s</option>`, scope, selected, scope)
+	}
+	pizzaOptions := ""
+	for _, p := range pizzas {
+		selected := ""
+		if slices.Contains(dc.PizzaIDs, p.ID) {
+			selected = " selected"
+		}
+		pizzaOptions += fmt.Sprintf(`<option value="%d"%s>%s</option>`, p.ID, selected, p.Name)
+	}
+	extraOptions := ""
+	for _, e := range extraItems {
+		selected := ""
+		if slices.Contains(dc.ExtraItemIDs, e.ID) {
+			selected = " selected"
+		}
+		extraOptions += fmt.Sprintf(`<option value="%d"%s>%s (%s)</option>`, e.ID, selected, e.Name, e.Category)
+	}
+
+	percentage, amount := "", ""
+	if dc.Type == database.FixedDiscount {
+		amount = dc.DiscountAmount.StringFixed(2)
+	} else if dc.DiscountPercentage > 0 {
+		percentage = strconv.Itoa(dc.DiscountPercentage)
+	}
+	validFrom, validUntil := "", ""
+	if dc.ValidFrom != nil {
+		validFrom = dc.ValidFrom.In(time.Local).Format(datetimeLocalLayout)
+	}
+	if dc.ValidUntil != nil {
+		validUntil = dc.ValidUntil.In(time.Local).Format(datetimeLocalLayout)
+	}
+	maxUses, maxUsesPerCustomer := "", ""
+	if dc.MaxUses != nil {
+		maxUses = strconv.Itoa(*dc.MaxUses)
+	}
+	if dc.MaxUsesPerCustomer != nil {
+		maxUsesPerCustomer = strconv.Itoa(*dc.MaxUsesPerCustomer)
+	}
+	activeChecked := ""
+	if dc.IsActive {
+		activeChecked = "checked"
+	}
+
+	return fmt.Sprintf(`<tr><td><b>Code:</b></td><td><input type="text" name="code" value="%s" required></td></tr>
+<tr><td><b>Type:</b></td><td><select name="discount_type">%s</select></td></tr>
+<tr><td><b>Discount %%:</b></td><td><input type="number" name="percentage" value="%s" min="1" max="100"> (percentage codes)</td></tr>
+<tr><td><b>Amount $:</b></td><td><input type="number" name="amount" value="%s" min="0.01" step="0.01"> (fixed codes)</td></tr>
+<tr><td><b>Minimum order $:</b></td><td><input type="number" name="min_order_value" value="%s" min="0" step="0.01"></td></tr>
+<tr><td><b>Valid from:</b></td><td><input type="datetime-local" name="valid_from" value="%s"></td></tr>
+<tr><td><b>Valid until:</b></td><td><input type="datetime-local" name="valid_until" value="%s"></td></tr>
+<tr><td><b>Max uses:</b></td><td><input type="number" name="max_uses" value="%s" min="1"> (blank for unlimited)</td></tr>
+<tr><td><b>Max uses per customer:</b></td><td><input type="number" name="max_uses_per_customer" value="%s" min="1"> (blank for unlimited)</td></tr>
+<tr><td><b>Applies to:</b></td><td><select name="scope">%s</select></td></tr>
+<tr><td><b>Pizzas:</b></td><td><select name="pizza_ids" multiple size="4">%s</select> (ITEMS only)</td></tr>
+<tr><td><b>Extra items:</b></td><td><select name="extra_item_ids" multiple size="4">%s</select> (ITEMS only)</td></tr>
+<tr><td><b>Active:</b></td><td><input type="checkbox" name="is_active" %s></td></tr>`,
+		dc.Code, typeOptions, percentage, amount, dc.MinOrderValue.StringFixed(2), validFrom, validUntil,
+		maxUses, maxUsesPerCustomer, scopeOptions, pizzaOptions, extraOptions, activeChecked)
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	database "pizza_shop/backend/database"
+	"pizza_shop/backend/web"
+	"strconv"
+	"strings"
+)
+
+// AdminDispatchPolicyHandler returns how ready orders are handed to couriers.
+func (h *Handler) AdminDispatchPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	policy, err := h.Deliveries.GetDispatchPolicy()
+	if err != nil {
+		fmt.Println("GetDispatchPolicy error:", err)
+		web.WriteJSONError(w, http.StatusInternalServerError, "Failed to load dispatch policy")
+		return
+	}
+
+	type Msg struct {
+		Ok     bool                    `json:"ok"`
+		Policy database.DispatchPolicy `json:"policy"`
+	}
+	json.NewEncoder(w).Encode(Msg{Ok: true, Policy: policy})
+}
+
+// AdminUpdateDispatchPolicyHandler turns automatic dispatch on or off and sets the batch size and cooldown.
+func (h *Handler) AdminUpdateDispatchPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		AutoDispatch    bool `json:"auto_dispatch"`
+		MaxBatchSize    int  `json:"max_batch_size"`
+		CooldownMinutes int  `json:"cooldown_minutes"`
+	}
+
+	isForm := strings.Contains(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded")
+	if isForm {
+		// Form submission
+		r.ParseForm()
+		req.AutoDispatch = r.FormValue("auto_dispatch") == "on"
+		var err error
+		if req.MaxBatchSize, err = strconv.Atoi(r.FormValue("max_batch_size")); err != nil {
+			http.Error(w, "Invalid batch size", http.StatusBadRequest)
+			return
+		}
+		if req.CooldownMinutes, err = strconv.Atoi(r.FormValue("cooldown_minutes")); err != nil {
+			http.Error(w, "Invalid cooldown", http.StatusBadRequest)
+			return
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.WriteJSONError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	policy := database.DispatchPolicy{
+		AutoDispatch:    req.AutoDispatch,
+		MaxBatchSize:    req.MaxBatchSize,
+		CooldownMinutes: req.CooldownMinutes,
+	}
+	if err := h.Deliveries.UpdateDispatchPolicy(policy, requestSession(r).UserID); err != nil {
+		code := dispatchErrorCode(err)
+		errorMsg := "Failed to update dispatch policy"
+		if code != http.StatusInternalServerError {
+			errorMsg = err.Error()
+		} else {
+			fmt.Println("UpdateDispatchPolicy error:", err)
+		}
+		if isForm {
+			http.Error(w, errorMsg, code)
+		} else {
+			web.WriteJSONError(w, code, errorMsg)
+		}
+		return
+	}
+
+	if isForm {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+	type Msg struct {
+		Ok bool `json:"ok"`
+	}
+	json.NewEncoder(w).Encode(Msg{Ok: true})
+}
+
+// AdminDispatchNowHandler runs a dispatch round right away instead of waiting for the dispatcher.
+func (h *Handler) AdminDispatchNowHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	isForm := strings.Contains(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded")
+	assigned, err := h.Deliveries.DispatchReadyOrders(requestSession(r).UserID)
+	if err != nil {
+		fmt.Println("DispatchReadyOrders error:", err)
+		if isForm {
+			http.Error(w, "Failed to dispatch orders", http.StatusInternalServerError)
+		} else {
+			web.WriteJSONError(w, http.StatusInternalServerError, "Failed to dispatch orders")
+		}
+		return
+	}
+
+	if isForm {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+	type Msg struct {
+		Ok       bool `json:"ok"`
+		Assigned int  `json:"assigned"`
+	}
+	json.NewEncoder(w).Encode(Msg{Ok: true, Assigned: assigned})
+}
+
+func dispatchErrorCode(err error) int {
+	if errors.Is(err, database.ErrInvalidDispatchPolicy) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// dispatchPolicyForm renders the dispatch policy as a form to change it.
+func dispatchPolicyForm(p database.DispatchPolicy) string {
+	autoChecked := ""
+	if p.AutoDispatch {
+		autoChecked = "checked"
+	}
+	updated := ""
+	if p.UpdatedAt != nil {
+		updated = "<p>Last changed " + p.UpdatedAt.Format("2006-01-02 15:04")
+		if p.UpdatedBy != nil {
+			updated += " by " + *p.UpdatedBy
+		}
+		updated += "</p>"
+	}
+	return fmt.Sprintf(`<form method="POST" action="/admin/dispatch/update">
+<table><tr><td><b>Assign ready orders automatically:</b></td><td><input type="checkbox" name="auto_dispatch" %s></td></tr>
+<tr><td><b>Orders per courier:</b></td><td><input type="number" name="max_batch_size" value="%d" min="1" max="%d" required> (all to the same zone)</td></tr>
+<tr><td><b>Cooldown after a delivery (minutes):</b></td><td><input type="number" name="cooldown_minutes" value="%d" min="0" required></td></tr>
+<tr><td colspan="2"><input type="submit" value="Save Policy"></td></tr></table>
+</form>%s
+<form method="POST" action="/admin/dispatch/run"><input type="submit" value="Dispatch Now"></form>`,
+		autoChecked, p.MaxBatchSize, database.MaxBatchSize, p.CooldownMinutes, updated)
+}
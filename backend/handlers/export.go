@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	database "pizza_shop/backend/database"
+	"pizza_shop/backend/web"
+	"strconv"
+	"time"
+)
+
+// exportFlushEvery is how many rows an export writes before it pushes them to the client.
+const exportFlushEvery = 100
+
+// exportWriter writes the rows of an export as CSV or as NDJSON (a JSON object per line) while they
+// come out of the database. Nothing is sent until the first row, so an export that fails right
+// away can still answer with an error.
+type exportWriter struct {
+	w        http.ResponseWriter
+	ndjson   bool
+	filename string
+	columns  []string
+	csv      *csv.Writer
+	json     *json.Encoder
+	rows     int
+}
+
+// newExportWriter reads ?format= (csv, the default, or ndjson) and ?from= / ?to= (YYYY-MM-DD, inclusive).
+// It answers the request itself and returns ok false when they're invalid.
+func newExportWriter(w http.ResponseWriter, r *http.Request, name string, columns []string) (*exportWriter, database.ExportFilter, bool) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, database.ExportFilter{}, false
+	}
+
+	query := r.URL.Query()
+	e := &exportWriter{w: w, columns: columns}
+	switch query.Get("format") {
+	case "", "csv":
+	case "ndjson":
+		e.ndjson = true
+	default:
+		http.Error(w, "format must be csv or ndjson", http.StatusBadRequest)
+		return nil, database.ExportFilter{}, false
+	}
+
+	var filter database.ExportFilter
+	var err error
+	if filter.From, filter.To, err = web.ParseDateRange(query.Get("from"), query.Get("to")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, database.ExportFilter{}, false
+	}
+
+	e.filename = name
+	if from := query.Get("from"); from != "" {
+		e.filename += "-from-" + from
+	}
+	if to := query.Get("to"); to != "" {
+		e.filename += "-to-" + to
+	}
+	return e, filter, true
+}
+
+// start sends the headers, and the header row of a CSV.
+func (e *exportWriter) start() error {
+	if e.ndjson {
+		e.w.Header().Set("Content-Type", "application/x-ndjson")
+		e.w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.ndjson"`, e.filename))
+		e.json = json.NewEncoder(e.w)
+		return nil
+	}
+	e.w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	e.w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, e.filename))
+	e.csv = csv.NewWriter(e.w)
+	return e.csv.Write(e.columns)
+}
+
+// write adds a row, v as a JSON object or record as a CSV line with the columns of the export.
+func (e *exportWriter) write(v any, record []string) error {
+	if e.rows == 0 {
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+	var err error
+	if e.ndjson {
+		err = e.json.Encode(v)
+	} else {
+		err = e.csv.Write(record)
+	}
+	if err != nil {
+		return err
+	}
+	e.rows++
+	if e.rows%exportFlushEvery == 0 {
+		return e.flush()
+	}
+	return nil
+}
+
+func (e *exportWriter) flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if f, ok := e.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// finish ends the export. Once rows went out the status can't change anymore, so an error
+// halfway cuts the export short and is only logged.
+func (e *exportWriter) finish(err error, what string) {
+	if err != nil {
+		fmt.Println(what, "error:", err)
+		if e.rows == 0 {
+			http.Error(e.w, "Failed to export", http.StatusInternalServerError)
+		}
+		return
+	}
+	if e.rows == 0 {
+		if err := e.start(); err != nil {
+			fmt.Println(what, "error:", err)
+			return
+		}
+	}
+	if err := e.flush(); err != nil {
+		fmt.Println(what, "error:", err)
+	}
+}
+
+var orderExportColumns = []string{
+	"order_id", "timestamp", "status", "customer_id", "customer_name", "postal_code", "discount_code", "subtotal",
+	"promotion_discount", "loyalty_discount", "discount_percentage", "discount", "vat", "delivery_fee", "order_total", "item_type", "item", "size", "crust", "quantity", "free_quantity", "reward_quantity",
+	"unit_price", "vat_rate",
+}
+
+// AdminExportOrdersHandler exports the orders placed in the window, a row per pizza or extra item.
+func (h *Handler) AdminExportOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	out, filter, ok := newExportWriter(w, r, "orders", orderExportColumns)
+	if !ok {
+		return
+	}
+	err := h.Exports.ExportOrders(filter, func(l database.OrderExportLine) error {
+		return out.write(l, []string{
+			strconv.Itoa(l.OrderID), l.Timestamp.Format(time.RFC3339), l.Status, strconv.Itoa(l.CustomerID), l.CustomerName,
+			l.PostalCode, optionalString(l.DiscountCode), formatAmount(l.Subtotal), formatAmount(l.PromotionDiscount),
+			formatAmount(l.LoyaltyDiscount), strconv.Itoa(l.DiscountPercentage), formatAmount(l.Discount), formatAmount(l.VAT),
+			formatAmount(l.DeliveryFee), formatAmount(l.OrderTotal), l.ItemType, l.Item, optionalString(l.Size), optionalString(l.Crust),
+			strconv.Itoa(l.Quantity), strconv.Itoa(l.FreeQuantity), strconv.Itoa(l.RewardQuantity),
+			formatAmount(l.UnitPrice), strconv.FormatFloat(l.VATRate, 'f', -1, 64),
+		})
+	})
+	out.finish(err, "ExportOrders")
+}
+
+var customerExportColumns = []string{
+	"customer_id", "username", "name", "gender", "birth_date", "address", "postal_code", "pizza_counter",
+	"loyalty_rewards", "orders", "total_spent",
+}
+
+// AdminExportCustomersHandler exports the customers with their orders and spending in the window. With
+// a window only the customers that ordered in it are exported.
+func (h *Handler) AdminExportCustomersHandler(w http.ResponseWriter, r *http.Request) {
+	out, filter, ok := newExportWriter(w, r, "customers", customerExportColumns)
+	if !ok {
+		return
+	}
+	err := h.Exports.ExportCustomers(filter, func(c database.CustomerExport) error {
+		return out.write(c, []string{
+			strconv.Itoa(c.CustomerID), c.Username, c.Name, c.Gender, c.BirthDate, c.Address, c.PostalCode,
+			strconv.Itoa(c.PizzaCounter), strconv.Itoa(c.LoyaltyRewards), strconv.Itoa(c.Orders), formatAmount(c.TotalSpent),
+		})
+	})
+	out.finish(err, "ExportCustomers")
+}
+
+var salesExportColumns = []string{"date", "orders", "customers", "subtotal", "discounts", "vat", "delivery_fees", "revenue"}
+
+// AdminExportSalesHandler exports the sales per day in the window.
+func (h *Handler) AdminExportSalesHandler(w http.ResponseWriter, r *http.Request) {
+	out, filter, ok := newExportWriter(w, r, "sales", salesExportColumns)
+	if !ok {
+		return
+	}
+	err := h.Exports.ExportDailySales(filter, func(d database.DailySales) error {
+		return out.write(d, []string{
+			d.Date, strconv.Itoa(d.Orders), strconv.Itoa(d.Customers), formatAmount(d.Subtotal), formatAmount(d.Discounts),
+			formatAmount(d.VAT), formatAmount(d.DeliveryFees), formatAmount(d.Revenue),
+		})
+	})
+	out.finish(err, "ExportDailySales")
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
+
+func optionalString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -1,23 +1,25 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	database "pizza_shop/backend/database"
+	"pizza_shop/backend/web"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
-func IndexHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) IndexHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/login", http.StatusFound)
 }
 
-func HomeHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HomeHandler(w http.ResponseWriter, r *http.Request) {
 	html_string, err := os.ReadFile("frontend/home.html")
 	if err != nil {
 		panic(err)
@@ -25,16 +27,16 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintln(w, string(html_string))
 }
 
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
-		LoginPostHandler(w, r)
+		h.LoginPostHandler(w, r)
 	case http.MethodGet:
-		LoginGetHandler(w, r)
+		h.LoginGetHandler(w, r)
 	}
 }
 
-func LoginGetHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) LoginGetHandler(w http.ResponseWriter, r *http.Request) {
 	html_string, err := os.ReadFile("frontend/login.html")
 	if err != nil {
 		panic(err)
@@ -42,31 +44,35 @@ func LoginGetHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintln(w, string(html_string))
 }
 
-func AdminHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminHandler(w http.ResponseWriter, r *http.Request) {
 
-	username := r.URL.Query().Get("username")
-	password := r.URL.Query().Get("password")
-
-	if username != "" && password != "" {
-		ok, _ := database.TryLogin(username, password)
+	if r.Method == http.MethodPost {
+		r.ParseForm()
+		username := r.FormValue("username")
+		ok, role := h.Users.TryLogin(username, r.FormValue("password"))
 		if !ok {
 			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 			return
 		}
-		role, err := database.GetUserRole(username)
-		if err != nil || role != database.AdminRole.String() {
+		if role != database.AdminRole.String() {
 			http.Error(w, "Not an admin user", http.StatusForbidden)
 			return
 		}
-		http.SetCookie(w, &http.Cookie{Name: "X-Username", Value: username, Path: "/"})
-		http.SetCookie(w, &http.Cookie{Name: "X-Password", Value: password, Path: "/"})
-	} else {
-		userCookie, _ := r.Cookie("X-Username")
-		passCookie, _ := r.Cookie("X-Password")
-		if userCookie == nil || passCookie == nil {
-			html := `<html><head><title>Admin Login</title></head><body><center>
+		session, err := h.Users.CreateSession(username)
+		if err != nil {
+			http.Error(w, "Failed to create session", http.StatusInternalServerError)
+			return
+		}
+		setSessionCookie(w, session)
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	session, err := h.currentSession(r)
+	if err != nil {
+		html := `<html><head><title>Admin Login</title></head><body><center>
 <h1>Admin Panel Login</h1>
-<form method="GET" action="/admin">
+<form method="POST" action="/admin">
 <table>
 <tr><td><b>Username:</b></td><td><input type="text" name="username" required></td></tr>
 <tr><td><b>Password:</b></td><td><input type="password" name="password" required></td></tr>
@@ -74,57 +80,92 @@ func AdminHandler(w http.ResponseWriter, r *http.Request) {
 </table>
 </form>
 </center></body></html>`
-			fmt.Fprint(w, html)
-			return
-		}
-		username = userCookie.Value
-		password = passCookie.Value
-
-		// Verify cookie credentials
-		ok, _ := database.TryLogin(username, password)
-		if !ok {
-			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
-			return
-		}
-		role, err := database.GetUserRole(username)
-		if err != nil || role != database.AdminRole.String() {
-			http.Error(w, "Not an admin user", http.StatusForbidden)
-			return
-		}
+		fmt.Fprint(w, html)
+		return
 	}
-	users, _ := database.GetAllUsers()
-	orders, _ := database.GetAllOrders()
-	deliveryPersons, _ := database.GetAllDeliveryPersons()
-	pizzas, _ := database.GetAllPizzasWithPrice()
-	ingredients, _ := database.GetAllIngredients()
-
-	extraItems := []map[string]interface{}{}
-	rows, err := database.DATABASE.Query("SELECT id, name, category, price FROM extra_item ORDER BY category, name")
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var id int
-			var name, category string
-			var price float64
-			if rows.Scan(&id, &name, &category, &price) == nil {
-				extraItems = append(extraItems, map[string]interface{}{"id": id, "name": name, "category": category, "price": price})
-			}
-		}
+	if session.Role != database.AdminRole {
+		http.Error(w, "Not an admin user", http.StatusForbidden)
+		return
+	}
+	// The lists are paged, ?tab= says which one the filter, sort and offset in the query are for
+	var filterErrors []string
+	userQuery := tabQuery(r, "users")
+	userFilter, err := parseUserFilter(userQuery)
+	if err != nil {
+		filterErrors = append(filterErrors, err.Error())
+		userFilter, _ = parseUserFilter(url.Values{})
+	}
+	users, userTotal, err := h.Users.ListUsers(userFilter)
+	if err != nil {
+		filterErrors = append(filterErrors, err.Error())
+	}
+	orderQuery := tabQuery(r, "orders")
+	orderFilter, err := parseOrderFilter(orderQuery)
+	if err != nil {
+		filterErrors = append(filterErrors, err.Error())
+		orderFilter, _ = parseOrderFilter(url.Values{})
+	}
+	orders, orderTotal, err := h.Orders.ListOrders(orderFilter)
+	if err != nil {
+		filterErrors = append(filterErrors, err.Error())
+	}
+	courierQuery := tabQuery(r, "delivery")
+	courierFilter, err := parseDeliveryPersonFilter(courierQuery)
+	if err != nil {
+		filterErrors = append(filterErrors, err.Error())
+		courierFilter, _ = parseDeliveryPersonFilter(url.Values{})
+	}
+	couriers, courierTotal, err := h.Deliveries.ListDeliveryPersons(courierFilter)
+	if err != nil {
+		filterErrors = append(filterErrors, err.Error())
+	}
+	ingredientQuery := tabQuery(r, "ingredients")
+	ingredientFilter, err := parseIngredientFilter(ingredientQuery)
+	if err != nil {
+		filterErrors = append(filterErrors, err.Error())
+		ingredientFilter, _ = parseIngredientFilter(url.Values{})
 	}
+	ingredients, ingredientTotal, err := h.Ingredients.ListIngredients(ingredientFilter)
+	if err != nil {
+		filterErrors = append(filterErrors, err.Error())
+	}
+	// Every courier, to assign orders to
+	deliveryPersons, _ := h.Deliveries.GetAllDeliveryPersons()
+	pizzas, _ := h.Pizzas.GetAllPizzasWithPrice()
+	stockLevels, _ := h.Ingredients.GetStockLevels(false)
+	sizes, _ := h.Pizzas.GetPizzaOptions(database.SizeOption)
+	crusts, _ := h.Pizzas.GetPizzaOptions(database.CrustOption)
+	pricing, _ := h.Pricing.GetPricingConfig()
+	pricingHistory, _ := h.Pricing.GetPricingConfigHistory(20)
+
+	extraItems, _ := h.ExtraItems.GetAllExtraItems()
+	discountCodes, _ := h.Discounts.GetAllDiscountCodes()
+	promotions, _ := h.Promotions.GetAllPromotions()
+	campaigns, _ := h.Vouchers.GetVoucherCampaigns()
+	deliveryZones, _ := h.Deliveries.GetDeliveryZones()
+	dispatchPolicy, _ := h.Deliveries.GetDispatchPolicy()
+	once := 1
+	newDiscountCode := database.DiscountCode{Type: database.PercentageDiscount, IsActive: true, MaxUsesPerCustomer: &once, Scope: database.ScopeOrder}
 
 	html := `<html><head><title>Admin Panel</title></head><body><center>
 <h1>Admin Panel</h1>
+<form method="POST" action="/logout"><button type="submit">Log out</button></form>
 <hr>
 <button onclick="showTab('users-tab')">Users</button>
 <button onclick="showTab('orders-tab')">Orders</button>
 <button onclick="showTab('delivery-tab')">Delivery</button>
 <button onclick="showTab('pizzas-tab')">Pizzas</button>
+<button onclick="showTab('options-tab')">Sizes & Crusts</button>
+<button onclick="showTab('pricing-tab')">Pricing</button>
 <button onclick="showTab('ingredients-tab')">Ingredients</button>
+<button onclick="showTab('stock-tab')">Stock</button>
 <button onclick="showTab('extras-tab')">Desserts & Drinks</button>
 <button onclick="showTab('discounts-tab')">Discount Codes</button>
+<button onclick="showTab('promotions-tab')">Promotions</button>
+<button onclick="showTab('vouchers-tab')">Vouchers</button>
 <button onclick="showTab('reports-tab')">Reports</button>
 <hr>
-
+` + listErrorsHTML(filterErrors) + `
 <div id="users-tab" style="display:block;">
 <h2>Users</h2>
 <h3>Create User</h3>
@@ -132,12 +173,17 @@ func AdminHandler(w http.ResponseWriter, r *http.Request) {
 <table><tr><td><b>Username:</b></td><td><input type="text" name="username" required></td></tr>
 <tr><td><b>Password:</b></td><td><input type="password" name="password" required></td></tr>
 <tr><td><b>Role:</b></td><td>
-<select name="role"><option value="customer">Customer</option><option value="admin">Admin</option><option value="delivery_person">Delivery Person</option></select>
+<select name="role"><option value="customer">Customer</option><option value="admin">Admin</option><option value="delivery_person">Delivery Person</option><option value="kitchen">Kitchen</option></select>
 </td></tr>
 <tr><td colspan="2"><input type="submit" value="Create User"></td></tr></table>
 </form>
 <hr>
 <h3>All Users</h3>
+` + listFilterForm("users", userQuery, [][2]string{{"id", "ID"}, {"username", "Username"}, {"role", "Role"}, {"name", "Name"}}) +
+		filterSelect(userQuery, "role", "Any role", [][2]string{{"CUSTOMER", "Customer"}, {"DELIVERY", "Delivery"}, {"KITCHEN", "Kitchen"}}) + `
+` + filterInput(userQuery, "search", "text", "Username or name") + `
+` + filterInput(userQuery, "postal_code", "text", "Postal code starts with") + `
+` + listFilterFormEnd("users") + pagerHTML("users", userQuery, userFilter.ListOptions, len(users), userTotal) + `
 <table border="1"><tr><th>ID</th><th>Username</th><th>Role</th><th>Actions</th></tr>`
 
 	for _, u := range users {
@@ -151,33 +197,62 @@ func AdminHandler(w http.ResponseWriter, r *http.Request) {
 
 <div id="orders-tab" style="display:none;">
 <h2>Orders</h2>
+`
+
+	var statusFilterOptions, courierFilterOptions [][2]string
+	for _, status := range database.OrderStatuses {
+		statusFilterOptions = append(statusFilterOptions, [2]string{string(status), string(status)})
+	}
+	for _, dp := range deliveryPersons {
+		courierFilterOptions = append(courierFilterOptions, [2]string{fmt.Sprint(dp["delivery_person_id"]), fmt.Sprint(dp["name"])})
+	}
+	html += listFilterForm("orders", orderQuery, [][2]string{{"timestamp", "Date"}, {"id", "ID"}, {"status", "Status"}, {"customer", "Customer"}, {"postal_code", "Postal Code"}, {"total", "Total"}}) +
+		filterSelect(orderQuery, "status", "Any status", statusFilterOptions) + `
+from ` + filterInput(orderQuery, "from", "date", "") + ` to ` + filterInput(orderQuery, "to", "date", "") + `
+` + filterInput(orderQuery, "customer", "text", "Customer name") + `
+` + filterSelect(orderQuery, "delivery_person_id", "Any driver", courierFilterOptions) + `
+` + filterInput(orderQuery, "postal_code", "text", "Postal code starts with") + `
+` + listFilterFormEnd("orders") + pagerHTML("orders", orderQuery, orderFilter.ListOptions, len(orders), orderTotal) + `
 <table border="1"><tr><th>ID</th><th>Username</th><th>Status</th><th>Delivery Address</th><th>Postal Code</th><th>Driver</th><th>Actions</th></tr>`
 
 	for _, o := range orders {
 		// Get order details (pizzas and extras)
-		orderDetails, _ := database.GetOrderDetails(o.ID)
+		orderDetails, _ := h.Orders.GetOrderDetails(o.ID)
 		var itemsHTML string
 
 		if len(orderDetails.Pizzas) > 0 || len(orderDetails.ExtraItems) > 0 {
 			itemsHTML = "<b>Pizzas:</b><br>"
-			var pizzaTotal float64
 			for _, p := range orderDetails.Pizzas {
-				pizzaInfo, _ := database.GetPizzaInformation(p.PizzaName)
-				priceFloat, _ := pizzaInfo.Cost.Float64()
-				pizzaTotal += priceFloat * float64(p.Quantity)
-				itemsHTML += fmt.Sprintf("- %s (x%d) @ $%.2f = $%.2f<br>", p.PizzaName, p.Quantity, priceFloat, priceFloat*float64(p.Quantity))
+				itemsHTML += fmt.Sprintf("- %s (x%d) @ $%.2f = $%.2f<br>", p.Description(), p.Quantity, p.Price, p.Price*float64(p.Quantity))
 			}
 
-			var extrasTotal float64
 			if len(orderDetails.ExtraItems) > 0 {
 				itemsHTML += "<br><b>Extras:</b><br>"
 				for _, e := range orderDetails.ExtraItems {
-					extrasTotal += e.Price * float64(e.Quantity)
 					itemsHTML += fmt.Sprintf("- %s (x%d) @ $%.2f = $%.2f<br>", e.ExtraItemName, e.Quantity, e.Price, e.Price*float64(e.Quantity))
 				}
 			}
 
-			itemsHTML += fmt.Sprintf("<br><b>Total: $%.2f</b>", pizzaTotal+extrasTotal)
+			b := orderDetails.Breakdown
+			itemsHTML += fmt.Sprintf("<br>Subtotal: $%.2f<br>", b.Subtotal)
+			if b.PromotionDiscount > 0 {
+				itemsHTML += fmt.Sprintf("Promotion freebies: -$%.2f<br>", b.PromotionDiscount)
+			}
+			if b.LoyaltyDiscount > 0 {
+				itemsHTML += fmt.Sprintf("Loyalty reward: -$%.2f<br>", b.LoyaltyDiscount)
+			}
+			if b.Discount > 0 && b.DiscountPercentage > 0 {
+				itemsHTML += fmt.Sprintf("Discount (%d%%): -$%.2f<br>", b.DiscountPercentage, b.Discount)
+			} else if b.Discount > 0 {
+				itemsHTML += fmt.Sprintf("Discount: -$%.2f<br>", b.Discount)
+			}
+			if b.DeliveryZone != "" || b.DeliveryFee > 0 {
+				itemsHTML += fmt.Sprintf("Delivery %s: $%.2f<br>", b.DeliveryZone, b.DeliveryFee)
+			}
+			itemsHTML += fmt.Sprintf("<b>Total: $%.2f</b> (incl. $%.2f VAT)", b.Total, b.VAT)
+			if len(b.Promotions) > 0 {
+				itemsHTML += "<br>Promotions: " + strings.Join(b.Promotions, ", ")
+			}
 		}
 
 		// Prepare driver dropdown
@@ -203,6 +278,13 @@ func AdminHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		driverDropdown += `</select><input type="submit" value="Assign"></form>`
 
+		// Only offer the statuses the order can legally move to next
+		currentStatus := database.OrderStatus(o.Status)
+		statusOptions := fmt.Sprintf(`<option value="%s" selected>%s</option>`, currentStatus, currentStatus)
+		for _, next := range currentStatus.NextStatuses() {
+			statusOptions += fmt.Sprintf(`<option value="%s">%s</option>`, next, next)
+		}
+
 		driverDisplay := "None"
 		if o.DeliveryPersonName != nil {
 			driverDisplay = *o.DeliveryPersonName
@@ -212,34 +294,21 @@ func AdminHandler(w http.ResponseWriter, r *http.Request) {
 <button type="button" onclick="document.getElementById('order-details-%d').style.display = document.getElementById('order-details-%d').style.display === 'none' ? 'table-row' : 'none'">View Details</button>
 <form method="POST" action="/admin/orders/update-status" style="display:inline;">
 <input type="hidden" name="id" value="%d">
-<select name="status"><option value="IN_PROGRESS" %s>IN_PROGRESS</option><option value="DELIVERED" %s>DELIVERED</option><option value="FAILED" %s>FAILED</option></select>
+<select name="status">%s</select>
 <input type="submit" value="Update">
 </form>
+<form method="POST" action="/admin/orders/cancel" style="display:inline;">
+<input type="hidden" name="id" value="%d">
+<input type="text" name="reason" placeholder="Cancel reason" required>
+<input type="submit" value="Cancel order" onclick="return confirm('Cancel this order?')"></form>
 <form method="POST" action="/admin/orders/delete" style="display:inline;">
 <input type="hidden" name="id" value="%d">
 <input type="submit" value="Delete" onclick="return confirm('Delete this order?')"></form></td></tr>
 <tr id="order-details-%d" style="display:none;"><td colspan="7" style="background:#f0f0f0;padding:10px;">%s</td></tr>`,
 			o.ID, o.CustomerName, o.Status, o.DeliveryAddress, o.PostalCode, driverDisplay, driverDropdown,
 			o.ID, o.ID,
+			o.ID, statusOptions,
 			o.ID,
-			func() string {
-				if o.Status == "IN_PROGRESS" {
-					return "selected"
-				}
-				return ""
-			}(),
-			func() string {
-				if o.Status == "DELIVERED" {
-					return "selected"
-				}
-				return ""
-			}(),
-			func() string {
-				if o.Status == "FAILED" {
-					return "selected"
-				}
-				return ""
-			}(),
 			o.ID, o.ID, itemsHTML)
 	}
 
@@ -247,13 +316,64 @@ func AdminHandler(w http.ResponseWriter, r *http.Request) {
 
 <div id="delivery-tab" style="display:none;">
 <h2>Delivery Persons</h2>
-<table border="1"><tr><th>ID</th><th>Username</th><th>Vehicle Type</th><th>Actions</th></tr>`
-
-	for _, d := range deliveryPersons {
-		html += fmt.Sprintf(`<tr><td>%v</td><td>%v</td><td>%v</td><td>
+`
+
+	var zoneFilterOptions [][2]string
+	for _, z := range deliveryZones {
+		zoneFilterOptions = append(zoneFilterOptions, [2]string{strconv.Itoa(z.ID), z.Name})
+	}
+	html += listFilterForm("delivery", courierQuery, [][2]string{{"name", "Name"}, {"id", "ID"}, {"username", "Username"}, {"vehicle_type", "Vehicle Type"}}) +
+		filterInput(courierQuery, "search", "text", "Username or name") + `
+` + filterInput(courierQuery, "vehicle_type", "text", "Vehicle type") + `
+` + filterSelect(courierQuery, "zone_id", "Any zone", zoneFilterOptions) + `
+` + listFilterFormEnd("delivery") + pagerHTML("delivery", courierQuery, courierFilter.ListOptions, len(couriers), courierTotal) + `
+<table border="1"><tr><th>ID</th><th>Username</th><th>Vehicle Type</th><th>Zones</th><th>Actions</th></tr>`
+
+	for _, d := range couriers {
+		var zoneIDs []int
+		if userID, ok := d["id"].(int); ok {
+			if deliveryPersonID, err := h.Deliveries.GetDeliveryPersonIDFromUserID(userID); err == nil {
+				zoneIDs, _ = h.Deliveries.GetDeliveryPersonZoneIDs(deliveryPersonID)
+			}
+		}
+		html += fmt.Sprintf(`<tr><td>%v</td><td>%v</td><td>%v</td><td>%s</td><td>
 <form method="POST" action="/admin/delivery/delete" style="display:inline;">
 <input type="hidden" name="id" value="%v">
-<input type="submit" value="Delete"></form></td></tr>`, d["id"], d["username"], d["vehicle_type"], d["id"])
+<input type="submit" value="Delete"></form></td></tr>`, d["id"], d["username"], d["vehicle_type"], deliveryPersonZonesForm(d["id"], deliveryZones, zoneIDs), d["id"])
+	}
+
+	html += `</table>
+<hr>
+<h2>Dispatch</h2>
+<p>Ready orders go to the courier that has waited longest, oldest order first, together with other ready orders to the same zone.</p>` + dispatchPolicyForm(dispatchPolicy) + `
+<hr>
+<h2>Delivery Zones</h2>
+<p>Orders go to the zone covering their postal code, the one that looks at the most characters wins. Postal codes outside every zone can't order.</p>
+<h3>Create Zone</h3>
+<form method="POST" action="/admin/delivery-zones/create">
+<table>` + deliveryZoneFormFields(database.DeliveryZone{EstimatedMinutes: 30, IsActive: true}) + `
+<tr><td colspan="2"><input type="submit" value="Create Zone"></td></tr></table>
+</form>
+<h3>All Zones</h3>
+<table border="1"><tr><th>ID</th><th>Name</th><th>Postal Codes</th><th>Fee</th><th>Minimum Order</th><th>Estimated Time</th><th>Active</th><th>Actions</th></tr>`
+
+	for _, z := range deliveryZones {
+		active := "No"
+		if z.IsActive {
+			active = "Yes"
+		}
+		html += fmt.Sprintf(`<tr><td>%d</td><td>%s</td><td>%s</td><td>$%s</td><td>$%s</td><td>%d min</td><td>%s</td>
+<td><details><summary>Edit</summary>
+<form method="POST" action="/admin/delivery-zones/update">
+<input type="hidden" name="id" value="%d">
+<table>%s
+<tr><td colspan="2"><input type="submit" value="Update"></td></tr></table>
+</form></details>
+<form method="POST" action="/admin/delivery-zones/delete" style="display:inline;">
+<input type="hidden" name="id" value="%d">
+<input type="submit" value="Delete" onclick="return confirm('Delete this zone?')"></form></td></tr>`,
+			z.ID, z.Name, z.Covers(), z.DeliveryFee.StringFixed(2), z.MinOrderValue.StringFixed(2), z.EstimatedMinutes, active,
+			z.ID, deliveryZoneFormFields(z), z.ID)
 	}
 
 	html += `</table></div>
@@ -268,18 +388,114 @@ func AdminHandler(w http.ResponseWriter, r *http.Request) {
 </form>
 <hr>
 <h3>All Pizzas</h3>
-<table border="1"><tr><th>ID</th><th>Name</th><th>Ingredients</th><th>Price</th><th>Actions</th></tr>`
+<table border="1"><tr><th>ID</th><th>Name</th><th>Ingredients</th><th>Price</th><th>Available</th><th>Actions</th></tr>`
 
 	for _, p := range pizzas {
 		var ingredientNames []string
 		for _, ingr := range p.Ingredients {
 			ingredientNames = append(ingredientNames, ingr.Ingr.Name)
 		}
-		html += fmt.Sprintf(`<tr><td>%d</td><td>%s</td><td>%s</td><td>%.2f</td><td>
+		available := "Yes"
+		if !p.Available {
+			available = "<b>Out of stock</b>"
+		}
+		html += fmt.Sprintf(`<tr><td>%d</td><td>%s</td><td>%s</td><td>%.2f</td><td>%s</td><td>
 <form method="POST" action="/admin/pizza/delete" style="display:inline;">
 <input type="hidden" name="id" value="%d">
 <input type="submit" value="Delete"></form></td></tr>`,
-			p.ID, p.Name, strings.Join(ingredientNames, ", "), p.Price, p.ID)
+			p.ID, p.Name, strings.Join(ingredientNames, ", "), p.Price, available, p.ID)
+	}
+
+	html += `</table></div>
+
+<div id="options-tab" style="display:none;">
+<h2>Sizes & Crusts</h2>
+<p>A pizza costs (size dough + crust dough + ingredients &times; size multiplier &times; crust multiplier), plus the margin and VAT set under Pricing.
+The multipliers also scale the stock a pizza uses. The default size and crust are used when none is picked.</p>`
+
+	for _, group := range []struct {
+		kind    database.PizzaOptionKind
+		title   string
+		options []database.PizzaOption
+	}{{database.SizeOption, "Sizes", sizes}, {database.CrustOption, "Crusts", crusts}} {
+		html += fmt.Sprintf(`<h3>%s</h3>
+<table border="1"><tr><th>ID</th><th>Name</th><th>Dough Cost</th><th>Ingredient Multiplier</th><th>Default</th><th>Order</th><th>Actions</th></tr>`, group.title)
+		for _, opt := range group.options {
+			defaultChecked := ""
+			if opt.IsDefault {
+				defaultChecked = "checked"
+			}
+			html += fmt.Sprintf(`<tr>
+<form method="POST" action="/admin/pizza-options/save" style="display:inline;">
+<td>%d<input type="hidden" name="kind" value="%s"><input type="hidden" name="id" value="%d"></td>
+<td><input type="text" name="name" value="%s" required></td>
+<td><input type="number" name="dough_cost" value="%s" step="0.01" min="0" required style="width:80px;"></td>
+<td><input type="number" name="ingredient_multiplier" value="%s" step="0.01" min="0.01" required style="width:80px;"></td>
+<td><input type="checkbox" name="is_default" %s></td>
+<td><input type="number" name="sort_order" value="%d" style="width:50px;"></td>
+<td><input type="submit" value="Update">
+</form>
+<form method="POST" action="/admin/pizza-options/delete" style="display:inline;">
+<input type="hidden" name="kind" value="%s"><input type="hidden" name="id" value="%d">
+<input type="submit" value="Delete" onclick="return confirm('Delete this option?')"></form></td></tr>`,
+				opt.ID, group.kind, opt.ID, opt.Name, opt.DoughCost.StringFixed(2), opt.IngredientMultiplier.StringFixed(2),
+				defaultChecked, opt.SortOrder, group.kind, opt.ID)
+		}
+		html += fmt.Sprintf(`<tr>
+<form method="POST" action="/admin/pizza-options/save" style="display:inline;">
+<td>New<input type="hidden" name="kind" value="%s"></td>
+<td><input type="text" name="name" required></td>
+<td><input type="number" name="dough_cost" step="0.01" min="0" required style="width:80px;"></td>
+<td><input type="number" name="ingredient_multiplier" value="1.00" step="0.01" min="0.01" required style="width:80px;"></td>
+<td><input type="checkbox" name="is_default"></td>
+<td><input type="number" name="sort_order" value="0" style="width:50px;"></td>
+<td><input type="submit" value="Create"></form></td></tr></table>`, group.kind)
+	}
+
+	html += `</div>
+
+<div id="pricing-tab" style="display:none;">
+<h2>Pricing</h2>
+<p>Rates are fractions, 0.09 is 9%. A pizza costs its ingredients and dough (see Sizes & Crusts) &times; (1 + margin) &times; (1 + VAT),
+rounded to cents. Desserts and drinks are priced as entered, VAT included. Placed orders keep the rates they were charged with.</p>`
+
+	roundingOptions := ""
+	for _, mode := range database.RoundingModes {
+		selected := ""
+		if mode == pricing.RoundingMode {
+			selected = "selected"
+		}
+		roundingOptions += fmt.Sprintf(`<option value="%s" %s>%s</option>`, mode, selected, mode)
+	}
+	lastChange := "never"
+	if pricing.UpdatedAt != nil {
+		lastChange = pricing.UpdatedAt.Format("2006-01-02 15:04")
+		if pricing.UpdatedBy != nil {
+			lastChange += " by " + *pricing.UpdatedBy
+		}
+	}
+	html += fmt.Sprintf(`<form method="POST" action="/admin/pricing/update">
+<table><tr><td><b>Pizza Margin:</b></td><td><input type="number" name="pizza_margin_rate" value="%s" step="0.0001" min="0" max="1" required></td></tr>
+<tr><td><b>Pizza VAT:</b></td><td><input type="number" name="pizza_vat_rate" value="%s" step="0.0001" min="0" max="1" required></td></tr>
+<tr><td><b>Dessert VAT:</b></td><td><input type="number" name="dessert_vat_rate" value="%s" step="0.0001" min="0" max="1" required></td></tr>
+<tr><td><b>Drink VAT:</b></td><td><input type="number" name="drink_vat_rate" value="%s" step="0.0001" min="0" max="1" required></td></tr>
+<tr><td><b>Rounding:</b></td><td><select name="rounding_mode">%s</select></td></tr>
+<tr><td><b>Pizzas per Free Pizza:</b></td><td><input type="number" name="loyalty_pizzas_per_reward" value="%d" min="0" max="100" required> (0 turns loyalty off)</td></tr>
+<tr><td colspan="2"><input type="submit" value="Save Pricing" onclick="return confirm('Change the prices of the whole menu?')"></td></tr></table>
+</form>
+<p>Last changed: %s</p>
+<h3>History</h3>
+<table border="1"><tr><th>When</th><th>Setting</th><th>Old</th><th>New</th><th>By</th></tr>`,
+		pricing.PizzaMarginRate.StringFixed(4), pricing.PizzaVATRate.StringFixed(4), pricing.DessertVATRate.StringFixed(4),
+		pricing.DrinkVATRate.StringFixed(4), roundingOptions, pricing.LoyaltyPizzasPerReward, lastChange)
+
+	for _, change := range pricingHistory {
+		by := "-"
+		if change.Username != nil {
+			by = *change.Username
+		}
+		html += fmt.Sprintf(`<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			change.ChangedAt.Format("2006-01-02 15:04"), change.Setting, change.OldValue, change.NewValue, by)
 	}
 
 	html += `</table></div>
@@ -296,6 +512,11 @@ func AdminHandler(w http.ResponseWriter, r *http.Request) {
 </form>
 <hr>
 <h3>All Ingredients</h3>
+` + listFilterForm("ingredients", ingredientQuery, [][2]string{{"id", "ID"}, {"name", "Name"}, {"cost", "Cost"}}) +
+		filterInput(ingredientQuery, "search", "text", "Name") + `
+` + filterSelect(ingredientQuery, "has_meat", "Meat or not", [][2]string{{"true", "Has meat"}, {"false", "No meat"}}) + `
+` + filterSelect(ingredientQuery, "has_animal_products", "Animal products or not", [][2]string{{"true", "Has animal products"}, {"false", "No animal products"}}) + `
+` + listFilterFormEnd("ingredients") + pagerHTML("ingredients", ingredientQuery, ingredientFilter.ListOptions, len(ingredients), ingredientTotal) + `
 <table border="1"><tr><th>ID</th><th>Name</th><th>Cost (cents)</th><th>Has Meat</th><th>Has Animal Products</th><th>Actions</th></tr>`
 
 	for _, i := range ingredients {
@@ -326,6 +547,32 @@ func AdminHandler(w http.ResponseWriter, r *http.Request) {
 
 	html += `</table></div>
 
+<div id="stock-tab" style="display:none;">
+<h2>Stock</h2>
+<p>Lowest stock first. Pizzas with an ingredient below what one pizza needs are shown as out of stock on the menu.</p>
+<table border="1"><tr><th>Ingredient</th><th>Stock</th><th>Low Below</th><th>Pizzas Out</th><th>Restock</th><th>Settings</th></tr>`
+
+	for _, s := range stockLevels {
+		stock := fmt.Sprintf("%.2f %s", s.Stock, s.Unit)
+		if s.IsLow {
+			stock = "<b>" + stock + " (low)</b>"
+		}
+		html += fmt.Sprintf(`<tr><td>%s</td><td>%s</td><td>%.2f %s</td><td>%d</td><td>
+<form method="POST" action="/admin/ingredient/restock" style="display:inline;">
+<input type="hidden" name="ingredient_id" value="%d">
+<input type="number" name="amount" step="0.01" min="0.01" required style="width:80px;">
+<input type="submit" value="Restock"></form></td><td>
+<form method="POST" action="/admin/ingredient/stock-settings" style="display:inline;">
+<input type="hidden" name="ingredient_id" value="%d">
+Unit: <input type="text" name="unit" value="%s" required style="width:50px;">
+Low below: <input type="number" name="low_stock_threshold" value="%.2f" step="0.01" min="0" required style="width:80px;">
+Added portion: <input type="number" name="portion" value="%.2f" step="0.01" min="0.01" required style="width:70px;">
+<input type="submit" value="Save"></form></td></tr>`,
+			s.Name, stock, s.LowStockThreshold, s.Unit, s.UnavailablePizzas, s.IngredientID, s.IngredientID, s.Unit, s.LowStockThreshold, s.Portion)
+	}
+
+	html += `</table></div>
+
 <div id="extras-tab" style="display:none;">
 <h2>Desserts & Drinks</h2>
 <h3>Create Item</h3>
@@ -342,30 +589,30 @@ func AdminHandler(w http.ResponseWriter, r *http.Request) {
 	for _, e := range extraItems {
 		html += fmt.Sprintf(`<tr>
 <form method="POST" action="/admin/extra-items/update" style="display:inline;">
-<td>%v<input type="hidden" name="id" value="%v"></td>
-<td><input type="text" name="name" value="%v" required></td>
+<td>%d<input type="hidden" name="id" value="%d"></td>
+<td><input type="text" name="name" value="%s" required></td>
 <td><select name="category"><option value="dessert" %s>Dessert</option><option value="drink" %s>Drink</option></select></td>
 <td><input type="number" name="price" value="%.2f" step="0.01" required style="width:80px;"></td>
 <td><input type="submit" value="Update">
 <button type="button" onclick="this.closest('tr').querySelector('form').reset()">Cancel</button>
 </form>
 <form method="POST" action="/admin/extra-items/delete" style="display:inline;">
-<input type="hidden" name="id" value="%v">
+<input type="hidden" name="id" value="%d">
 <input type="submit" value="Delete" onclick="return confirm('Delete this item?')"></form></td></tr>`,
-			e["id"], e["id"], e["name"],
+			e.ID, e.ID, e.Name,
 			func() string {
-				if e["category"] == "dessert" {
+				if e.Category == "dessert" {
 					return "selected"
 				}
 				return ""
 			}(),
 			func() string {
-				if e["category"] == "drink" {
+				if e.Category == "drink" {
 					return "selected"
 				}
 				return ""
 			}(),
-			e["price"], e["id"])
+			e.Price, e.ID)
 	}
 
 	html += `</table></div>
@@ -374,42 +621,106 @@ func AdminHandler(w http.ResponseWriter, r *http.Request) {
 <h2>Discount Codes</h2>
 <h3>Create Discount Code</h3>
 <form method="POST" action="/admin/discount/create">
-<table><tr><td><b>Code:</b></td><td><input type="text" name="code" required></td></tr>
-<tr><td><b>Discount %:</b></td><td><input type="number" name="percentage" min="1" max="100" required></td></tr>
+<table>` + discountCodeFormFields(newDiscountCode, pizzas, extraItems) + `
 <tr><td colspan="2"><input type="submit" value="Create Code"></td></tr></table>
 </form>
 <hr>
 <h3>All Discount Codes</h3>
-<table border="1"><tr><th>ID</th><th>Code</th><th>Discount %</th><th>Active</th><th>Actions</th></tr>`
-
-	// Fetch discount codes
-	discountRows, err := database.DATABASE.Query("SELECT id, code, discount_percentage, is_active FROM discount_code ORDER BY code")
-	if err == nil {
-		defer discountRows.Close()
-		for discountRows.Next() {
-			var id, percentage int
-			var code string
-			var isActive bool
-			if discountRows.Scan(&id, &code, &percentage, &isActive) == nil {
-				activeChecked := ""
-				if isActive {
-					activeChecked = "checked"
-				}
-				html += fmt.Sprintf(`<tr>
-<form method="POST" action="/admin/discount/update" style="display:inline;">
-<td>%d<input type="hidden" name="id" value="%d"></td>
-<td><input type="text" name="code" value="%s" required></td>
-<td><input type="number" name="percentage" value="%d" min="1" max="100" required style="width:60px;"></td>
-<td><input type="checkbox" name="is_active" %s></td>
-<td><input type="submit" value="Update">
-<button type="button" onclick="this.closest('tr').querySelector('form').reset()">Cancel</button>
-</form>
+<table border="1"><tr><th>ID</th><th>Code</th><th>Rules</th><th>Used</th><th>Active</th><th>Actions</th></tr>`
+
+	for _, dc := range discountCodes {
+		active := "No"
+		if dc.IsActive {
+			active = "Yes"
+		}
+		html += fmt.Sprintf(`<tr><td>%d</td><td>%s</td><td>%s</td><td>%d</td><td>%s</td>
+<td><details><summary>Edit</summary>
+<form method="POST" action="/admin/discount/update">
+<input type="hidden" name="id" value="%d">
+<table>%s
+<tr><td colspan="2"><input type="submit" value="Update"></td></tr></table>
+</form></details>
 <form method="POST" action="/admin/discount/delete" style="display:inline;">
 <input type="hidden" name="id" value="%d">
 <input type="submit" value="Delete" onclick="return confirm('Delete this discount code?')"></form></td></tr>`,
-					id, id, code, percentage, activeChecked, id)
-			}
+			dc.ID, dc.Code, discountRules(dc), dc.TimesUsed, active, dc.ID, discountCodeFormFields(dc, pizzas, extraItems), dc.ID)
+	}
+
+	html += `</table></div>
+
+<div id="promotions-tab" style="display:none;">
+<h2>Promotions</h2>
+<h3>Create Promotion</h3>
+<form method="POST" action="/admin/promotions/create">
+<table>` + promotionFormFields(discountCodes, extraItems) + `
+<tr><td colspan="2"><input type="submit" value="Create Promotion"></td></tr></table>
+</form>
+<hr>
+<h3>All Promotions</h3>
+<table border="1"><tr><th>ID</th><th>Name</th><th>Code</th><th>When</th><th>Gives</th><th>Active</th><th>Actions</th></tr>`
+
+	for _, p := range promotions {
+		code := "-"
+		if p.DiscountCode != nil {
+			code = *p.DiscountCode
+		}
+		conditions := []string{}
+		for _, c := range p.Conditions {
+			conditions = append(conditions, describeCondition(c))
+		}
+		if len(conditions) == 0 {
+			conditions = append(conditions, "always")
+		}
+		effects := []string{}
+		for _, e := range p.Effects {
+			effects = append(effects, describeEffect(e, extraItems))
+		}
+		active, toggleLabel, toggleValue := "No", "Activate", "true"
+		if p.IsActive {
+			active, toggleLabel, toggleValue = "Yes", "Deactivate", "false"
+		}
+		html += fmt.Sprintf(`<tr><td>%d</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td>
+<td><form method="POST" action="/admin/promotions/set-active" style="display:inline;">
+<input type="hidden" name="id" value="%d"><input type="hidden" name="is_active" value="%s">
+<input type="submit" value="%s"></form>
+<form method="POST" action="/admin/promotions/delete" style="display:inline;">
+<input type="hidden" name="id" value="%d">
+<input type="submit" value="Delete" onclick="return confirm('Delete this promotion?')"></form></td></tr>`,
+			p.ID, p.Name, code, strings.Join(conditions, ", "), strings.Join(effects, ", "), active, p.ID, toggleValue, toggleLabel, p.ID)
+	}
+
+	html += fmt.Sprintf(`</table></div>
+
+<div id="vouchers-tab" style="display:none;">
+<h2>Voucher Campaigns</h2>
+<h3>Generate Vouchers</h3>
+<form method="POST" action="/admin/vouchers/create">
+<table>
+<tr><td><b>Campaign:</b></td><td><input type="text" name="name" required></td></tr>
+<tr><td><b>Prefix:</b></td><td><input type="text" name="prefix" maxlength="20" pattern="[A-Za-z0-9-]+" required> (e.g. SUMMER, codes look like SUMMER-7KQ2M9XH4D)</td></tr>
+<tr><td><b>Number of codes:</b></td><td><input type="number" name="count" min="1" max="%d" value="100" required></td></tr>
+<tr><td><b>Discount %%:</b></td><td><input type="number" name="percentage" min="1" max="100" required></td></tr>
+<tr><td><b>Valid until:</b></td><td><input type="datetime-local" name="valid_until"></td></tr>
+<tr><td colspan="2"><input type="submit" value="Generate"> Every code can be used once</td></tr>
+</table>
+</form>
+<hr>
+<h3>All Campaigns</h3>
+<table border="1"><tr><th>ID</th><th>Campaign</th><th>Discount</th><th>Valid until</th><th>Codes</th><th>Redeemed</th><th>Customers</th><th>Revenue</th><th>Created</th><th>Actions</th></tr>`, database.MaxVouchersPerCampaign)
+
+	for _, c := range campaigns {
+		validUntil := "-"
+		if c.ValidUntil != nil {
+			validUntil = c.ValidUntil.Format("2006-01-02 15:04")
 		}
+		createdBy := ""
+		if c.CreatedBy != nil {
+			createdBy = " by " + *c.CreatedBy
+		}
+		html += fmt.Sprintf(`<tr><td>%d</td><td>%s (%s-)</td><td>%d%%</td><td>%s</td><td>%d</td><td>%d (%.1f%%)</td><td>%d</td><td>$%.2f</td><td>%s%s</td>
+<td><a href="/admin/vouchers/export?campaign_id=%d">Export CSV</a></td></tr>`,
+			c.ID, c.Name, c.Prefix, c.DiscountPercentage, validUntil, c.Codes, c.Redeemed, c.RedemptionRate(), c.Customers, c.Revenue,
+			c.CreatedAt.Format("2006-01-02 15:04"), createdBy, c.ID)
 	}
 
 	html += `</table></div>
@@ -418,266 +729,181 @@ func AdminHandler(w http.ResponseWriter, r *http.Request) {
 <h2>📊 Staff Reports</h2>
 
 <h3>📦 Undelivered Orders</h3>
-<table border="1"><tr><th>Order ID</th><th>Customer</th><th>Address</th><th>Status</th><th>Timestamp</th><th>Items</th></tr>`
-
-	// Report 1: Undelivered Orders (IN_PROGRESS or OUT_FOR_DELIVERY)
-	undeliveredQuery := `
-		SELECT o.id, c.name, o.delivery_address, o.status, o.timestamp
-		FROM orders o
-		JOIN customer c ON o.customer_id = c.id
-		WHERE o.status IN ('IN_PROGRESS', 'OUT_FOR_DELIVERY')
-		ORDER BY o.timestamp DESC
-	`
-	undeliveredRows, err := database.DATABASE.Query(undeliveredQuery)
-	if err == nil {
-		defer undeliveredRows.Close()
-		for undeliveredRows.Next() {
-			var orderID int
-			var customerName, address, status string
-			var timestamp time.Time
-			if undeliveredRows.Scan(&orderID, &customerName, &address, &status, &timestamp) == nil {
-				// Get order items
-				itemsQuery := `
-					SELECT p.name, op.quantity 
-					FROM order_pizza op 
-					JOIN pizza p ON op.pizza_id = p.id 
-					WHERE op.order_id = ?
-				`
-				itemRows, _ := database.DATABASE.Query(itemsQuery, orderID)
-				var items []string
-				if itemRows != nil {
-					for itemRows.Next() {
-						var pizzaName string
-						var qty int
-						if itemRows.Scan(&pizzaName, &qty) == nil {
-							items = append(items, fmt.Sprintf("%s x%d", pizzaName, qty))
-						}
-					}
-					itemRows.Close()
-				}
-				itemsList := strings.Join(items, ", ")
-				if itemsList == "" {
-					itemsList = "No items"
-				}
+<table border="1"><tr><th>Order ID</th><th>Customer</th><th>Address</th><th>Postal Code</th><th>Status</th><th>Timestamp</th><th>Waiting</th><th>Items</th></tr>`
 
-				html += fmt.Sprintf(`<tr><td>%d</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
-					orderID, customerName, address, status, timestamp.Format("2006-01-02 15:04"), itemsList)
-			}
+	// Report 1: Undelivered Orders (not delivered, failed or cancelled yet)
+	undelivered, _ := h.Orders.GetUndeliveredOrders()
+	now := time.Now()
+	for _, o := range undelivered {
+		itemsList := strings.Join(o.Items, ", ")
+		if itemsList == "" {
+			itemsList = "No items"
 		}
+		html += fmt.Sprintf(`<tr><td>%d</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%d min</td><td>%s</td></tr>`,
+			o.OrderID, o.CustomerName, o.Address, o.PostalCode, o.Status, o.Timestamp.Format("2006-01-02 15:04"),
+			int(now.Sub(o.Timestamp).Minutes()), itemsList)
 	}
 
 	html += `</table><br><hr width="70%"><br>
 
-<h3>🏆 Top 3 Pizzas (Last 30 Days)</h3>
-<table border="1"><tr><th>Rank</th><th>Pizza</th><th>Total Sold</th></tr>`
+<h3>🏆 Top Pizzas</h3>
+<form onsubmit="return loadTopPizzas(this)">
+From <input type="date" name="from"> to <input type="date" name="to"> (last 30 days when blank),
+top <input type="number" name="n" value="3" min="1" max="100">
+<input type="submit" value="Show">
+</form>
+<p id="top-pizzas-error" style="color:red;"></p>
+<table border="1"><thead><tr><th>Rank</th><th>Pizza</th><th>Total Sold</th><th>Revenue</th></tr></thead><tbody id="top-pizzas">`
 
 	// Report 2: Top 3 Pizzas
-	topPizzasQuery := `
-		SELECT p.name, SUM(op.quantity) as total_sold
-		FROM order_pizza op
-		JOIN pizza p ON op.pizza_id = p.id
-		JOIN orders o ON op.order_id = o.id
-		WHERE o.timestamp >= DATE_SUB(NOW(), INTERVAL 30 DAY)
-		GROUP BY p.id, p.name
-		ORDER BY total_sold DESC
-		LIMIT 3
-	`
-	topPizzasRows, err := database.DATABASE.Query(topPizzasQuery)
-	if err == nil {
-		defer topPizzasRows.Close()
-		rank := 1
-		for topPizzasRows.Next() {
-			var pizzaName string
-			var totalSold int
-			if topPizzasRows.Scan(&pizzaName, &totalSold) == nil {
-				medal := "🥇"
-				if rank == 2 {
-					medal = "🥈"
-				} else if rank == 3 {
-					medal = "🥉"
-				}
-				html += fmt.Sprintf(`<tr><td>%s #%d</td><td><b>%s</b></td><td>%d</td></tr>`,
-					medal, rank, pizzaName, totalSold)
-				rank++
-			}
-		}
+	topPizzas, _ := h.Orders.GetTopPizzas(now.AddDate(0, 0, -30), now, 3)
+	for i, p := range topPizzas {
+		html += fmt.Sprintf(`<tr><td>#%d</td><td><b>%s</b></td><td>%d</td><td>$%.2f</td></tr>`,
+			i+1, p.Name, p.TotalSold, p.Revenue)
 	}
 
-	html += `</table><br><hr width="70%"><br>
+	html += `</tbody></table><br><hr width="70%"><br>
 
-<h3>💰 Revenue by Customer Gender</h3>
-<table border="1"><tr><th>Gender</th><th>Total Revenue</th><th>Orders</th><th>Avg Order Value</th></tr>`
-
-	// Report 3: Revenue by Gender
-	genderRevenueQuery := `
-		SELECT c.gender, COUNT(DISTINCT o.id) as order_count,
-		       SUM(
-		           (SELECT SUM(
-		               (SELECT ROUND(SUM(i.cost) * 1.4 * 1.09, 2)
-		                FROM pizza_ingredient pi
-		                JOIN ingredient i ON pi.ingredient_id = i.id
-		                WHERE pi.pizza_id = op.pizza_id) * op.quantity
-		           ) FROM order_pizza op WHERE op.order_id = o.id)
-		       ) as total_revenue
-		FROM orders o
-		JOIN customer c ON o.customer_id = c.id
-		GROUP BY c.gender
-		ORDER BY total_revenue DESC
-	`
-	genderRevenueRows, err := database.DATABASE.Query(genderRevenueQuery)
-	if err == nil {
-		defer genderRevenueRows.Close()
-		for genderRevenueRows.Next() {
-			var gender string
-			var orderCount int
-			var totalRevenue sql.NullFloat64
-			if genderRevenueRows.Scan(&gender, &orderCount, &totalRevenue) == nil {
-				revenue := 0.0
-				if totalRevenue.Valid {
-					revenue = totalRevenue.Float64
-				}
-				avgOrder := 0.0
-				if orderCount > 0 {
-					avgOrder = revenue / float64(orderCount)
-				}
-				html += fmt.Sprintf(`<tr><td>%s</td><td>$%.2f</td><td>%d</td><td>$%.2f</td></tr>`,
-					gender, revenue, orderCount, avgOrder)
-			}
+<h3>🍄 Most Requested Topping Changes (Last 30 Days)</h3>
+<table border="1"><tr><th>Ingredient</th><th>Change</th><th>Pizzas</th></tr>`
+
+	// Report 3: Topping changes
+	toppingChanges, _ := h.Orders.GetTopToppingChanges(30, 5)
+	for _, c := range toppingChanges {
+		change := "Added"
+		if c.Action == database.RemoveIngredient {
+			change = "Removed"
 		}
+		html += fmt.Sprintf(`<tr><td>%s</td><td>%s</td><td>%d</td></tr>`, c.Ingredient, change, c.TotalSold)
+	}
+
+	ageOptions := `<option value="">Any age</option>`
+	for _, bracket := range database.AgeBrackets {
+		ageOptions += fmt.Sprintf(`<option value="%s">%s</option>`, bracket, bracket)
 	}
 
 	html += `</table><br><hr width="70%"><br>
 
+<h3>💰 Earnings</h3>
+<p>Cancelled orders and failed deliveries don't count.</p>
+<form onsubmit="return loadEarnings(this)">
+By <select name="filter"><option value="gender">Gender</option><option value="age">Age Group</option><option value="postal">Postal Code</option></select>
+from <input type="date" name="from"> to <input type="date" name="to">
+<input type="text" name="gender" placeholder="Gender" size="8">
+<select name="age">` + ageOptions + `</select>
+<input type="text" name="postal_code" placeholder="Postal code starts with" size="18">
+<input type="submit" value="Show">
+</form>
+<p id="earnings-error" style="color:red;"></p>
+<table border="1"><thead><tr><th id="earnings-group">Gender</th><th>Total Revenue</th><th>Orders</th><th>Avg Order Value</th></tr></thead><tbody id="earnings">`
+
+	// Report 4: Revenue by Gender, the form above reloads it with other groups and filters
+	genderRevenue, _ := h.Orders.GetEarnings(database.EarningsByGender, database.EarningsFilter{})
+	html += revenueRowsHTML(genderRevenue)
+
+	html += `</tbody></table><br><hr width="70%"><br>
+
 <h3>👥 Revenue by Age Group</h3>
 <table border="1"><tr><th>Age Group</th><th>Total Revenue</th><th>Orders</th><th>Avg Order Value</th></tr>`
 
-	// Report 4: Revenue by Age Group
-	ageGroupRevenueQuery := `
-		SELECT 
-		    CASE 
-		        WHEN TIMESTAMPDIFF(YEAR, c.birth_date, CURDATE()) < 25 THEN 'Under 25'
-		        WHEN TIMESTAMPDIFF(YEAR, c.birth_date, CURDATE()) BETWEEN 25 AND 34 THEN '25-34'
-		        WHEN TIMESTAMPDIFF(YEAR, c.birth_date, CURDATE()) BETWEEN 35 AND 44 THEN '35-44'
-		        WHEN TIMESTAMPDIFF(YEAR, c.birth_date, CURDATE()) BETWEEN 45 AND 54 THEN '45-54'
-		        WHEN TIMESTAMPDIFF(YEAR, c.birth_date, CURDATE()) >= 55 THEN '55+'
-		        ELSE 'Unknown'
-		    END as age_group,
-		    COUNT(DISTINCT o.id) as order_count,
-		    SUM(
-		        (SELECT SUM(
-		            (SELECT ROUND(SUM(i.cost) * 1.4 * 1.09, 2)
-		             FROM pizza_ingredient pi
-		             JOIN ingredient i ON pi.ingredient_id = i.id
-		             WHERE pi.pizza_id = op.pizza_id) * op.quantity
-		        ) FROM order_pizza op WHERE op.order_id = o.id)
-		    ) as total_revenue
-		FROM orders o
-		JOIN customer c ON o.customer_id = c.id
-		WHERE c.birth_date IS NOT NULL
-		GROUP BY age_group
-		ORDER BY 
-		    CASE age_group
-		        WHEN 'Under 25' THEN 1
-		        WHEN '25-34' THEN 2
-		        WHEN '35-44' THEN 3
-		        WHEN '45-54' THEN 4
-		        WHEN '55+' THEN 5
-		        ELSE 6
-		    END
-	`
-	ageGroupRevenueRows, err := database.DATABASE.Query(ageGroupRevenueQuery)
-	if err == nil {
-		defer ageGroupRevenueRows.Close()
-		for ageGroupRevenueRows.Next() {
-			var ageGroup string
-			var orderCount int
-			var totalRevenue sql.NullFloat64
-			if ageGroupRevenueRows.Scan(&ageGroup, &orderCount, &totalRevenue) == nil {
-				revenue := 0.0
-				if totalRevenue.Valid {
-					revenue = totalRevenue.Float64
-				}
-				avgOrder := 0.0
-				if orderCount > 0 {
-					avgOrder = revenue / float64(orderCount)
-				}
-				html += fmt.Sprintf(`<tr><td>%s</td><td>$%.2f</td><td>%d</td><td>$%.2f</td></tr>`,
-					ageGroup, revenue, orderCount, avgOrder)
-			}
-		}
-	}
+	// Report 5: Revenue by Age Group
+	ageGroupRevenue, _ := h.Orders.GetEarnings(database.EarningsByAge, database.EarningsFilter{})
+	html += revenueRowsHTML(ageGroupRevenue)
 
 	html += `</table><br><hr width="70%"><br>
 
 <h3>📍 Revenue by Postal Code (Top 10)</h3>
 <table border="1"><tr><th>Postal Code</th><th>Total Revenue</th><th>Orders</th><th>Avg Order Value</th></tr>`
 
-	// Report 5: Revenue by Postal Code
-	postalCodeRevenueQuery := `
-		SELECT c.postal_code, COUNT(DISTINCT o.id) as order_count,
-		       SUM(
-		           (SELECT SUM(
-		               (SELECT ROUND(SUM(i.cost) * 1.4 * 1.09, 2)
-		                FROM pizza_ingredient pi
-		                JOIN ingredient i ON pi.ingredient_id = i.id
-		                WHERE pi.pizza_id = op.pizza_id) * op.quantity
-		           ) FROM order_pizza op WHERE op.order_id = o.id)
-		       ) as total_revenue
-		FROM orders o
-		JOIN customer c ON o.customer_id = c.id
-		GROUP BY c.postal_code
-		ORDER BY total_revenue DESC
-		LIMIT 10
-	`
-	postalCodeRevenueRows, err := database.DATABASE.Query(postalCodeRevenueQuery)
-	if err == nil {
-		defer postalCodeRevenueRows.Close()
-		for postalCodeRevenueRows.Next() {
-			var postalCode string
-			var orderCount int
-			var totalRevenue sql.NullFloat64
-			if postalCodeRevenueRows.Scan(&postalCode, &orderCount, &totalRevenue) == nil {
-				revenue := 0.0
-				if totalRevenue.Valid {
-					revenue = totalRevenue.Float64
-				}
-				avgOrder := 0.0
-				if orderCount > 0 {
-					avgOrder = revenue / float64(orderCount)
-				}
-				html += fmt.Sprintf(`<tr><td>%s</td><td>$%.2f</td><td>%d</td><td>$%.2f</td></tr>`,
-					postalCode, revenue, orderCount, avgOrder)
-			}
-		}
-	}
+	// Report 6: Revenue by Postal Code
+	postalCodeRevenue, _ := h.Orders.GetEarnings(database.EarningsByPostalCode, database.EarningsFilter{Limit: 10})
+	html += revenueRowsHTML(postalCodeRevenue)
 
-	html += `</table>
+	html += `</table><br><hr width="70%"><br>
+
+<h3>📤 Export</h3>
+<p>Downloads every row in the window, the whole history when the dates are blank.</p>
+<form method="GET" action="/admin/export/orders" onsubmit="this.action = '/admin/export/' + this.data.value">
+<select name="data"><option value="orders">Orders with line items</option><option value="customers">Customers</option><option value="sales">Daily sales</option></select>
+from <input type="date" name="from"> to <input type="date" name="to">
+<select name="format"><option value="csv">CSV</option><option value="ndjson">NDJSON</option></select>
+<input type="submit" value="Download">
+</form>
 </div>
 
 <script>
 function showTab(tabId) {
-  const tabs = ['users-tab', 'orders-tab', 'delivery-tab', 'pizzas-tab', 'ingredients-tab', 'extras-tab', 'discounts-tab', 'reports-tab'];
+  const tabs = ['users-tab', 'orders-tab', 'delivery-tab', 'pizzas-tab', 'options-tab', 'pricing-tab', 'ingredients-tab', 'stock-tab', 'extras-tab', 'discounts-tab', 'promotions-tab', 'vouchers-tab', 'reports-tab'];
   tabs.forEach(id => document.getElementById(id).style.display = (id === tabId) ? 'block' : 'none');
 }
+// Filtering or paging a list reloads the panel on its tab
+const openTab = new URLSearchParams(location.search).get('tab');
+if (openTab && document.getElementById(openTab + '-tab')) showTab(openTab + '-tab');
+
+// The report forms reload their table from the JSON report endpoints
+function reportQuery(form, names) {
+  const params = new URLSearchParams();
+  names.forEach(name => { if (form[name].value) params.set(name, form[name].value); });
+  return params.toString();
+}
+function loadTopPizzas(form) {
+  fetch('/admin/reports/top-pizzas?' + reportQuery(form, ['from', 'to', 'n'])).then(r => r.json()).then(data => {
+    document.getElementById('top-pizzas-error').textContent = data.ok ? '' : data.error;
+    if (!data.ok) return;
+    document.getElementById('top-pizzas').innerHTML = data.pizzas.map((p, i) =>
+      '<tr><td>#' + (i + 1) + '</td><td><b>' + p.name + '</b></td><td>' + p.quantity + '</td><td>$' + p.revenue.toFixed(2) + '</td></tr>').join('');
+  });
+  return false;
+}
+function loadEarnings(form) {
+  const filter = form.filter.value;
+  fetch('/admin/reports/earnings/' + filter + '?' + reportQuery(form, ['from', 'to', 'gender', 'age', 'postal_code'])).then(r => r.json()).then(data => {
+    document.getElementById('earnings-error').textContent = data.ok ? '' : data.error;
+    if (!data.ok) return;
+    document.getElementById('earnings-group').textContent = form.filter.options[form.filter.selectedIndex].text;
+    document.getElementById('earnings').innerHTML = data.earnings.concat([data.total]).map(e =>
+      '<tr><td>' + e.category + '</td><td>$' + e.revenue.toFixed(2) + '</td><td>' + e.orders + '</td><td>$' + e.average_order.toFixed(2) + '</td></tr>').join('');
+  });
+  return false;
+}
 </script>
 </center></body></html>`
 
 	fmt.Fprint(w, html)
 }
 
-func LoginPostHandler(w http.ResponseWriter, r *http.Request) {
-	success, username, _, err := isLoginOK(r)
+func revenueRowsHTML(groups []database.RevenueGroup) string {
+	html := ""
+	for _, g := range groups {
+		avgOrder := 0.0
+		if g.OrderCount > 0 {
+			avgOrder = g.Revenue / float64(g.OrderCount)
+		}
+		html += fmt.Sprintf(`<tr><td>%s</td><td>$%.2f</td><td>%d</td><td>$%.2f</td></tr>`,
+			g.Group, g.Revenue, g.OrderCount, avgOrder)
+	}
+	return html
+}
+
+func (h *Handler) LoginPostHandler(w http.ResponseWriter, r *http.Request) {
+	success, username, err := h.isLoginOK(r)
 
 	msg := ""
+	role := ""
 	if err != nil {
 		msg = err.Error()
 		success = false
 	}
 
-	role, err := database.GetUserRole(username)
-	if err != nil {
-		msg = err.Error()
-		success = false
+	if success {
+		session, err := h.Users.CreateSession(username)
+		if err != nil {
+			msg = "Something went wrong. Try again"
+			success = false
+		} else {
+			setSessionCookie(w, session)
+			role = session.Role.String()
+		}
 	}
 
 	type Msg struct {
@@ -693,7 +919,7 @@ func LoginPostHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, string(jsonMsg))
 }
 
-func isLoginOK(r *http.Request) (bool, string, string, error) {
+func (h *Handler) isLoginOK(r *http.Request) (bool, string, error) {
 	type User struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
@@ -701,34 +927,34 @@ func isLoginOK(r *http.Request) (bool, string, string, error) {
 	var user User
 	err := json.NewDecoder(r.Body).Decode(&user)
 	if err != nil {
-		return false, "", "", errors.New("invalid json")
+		return false, "", errors.New("invalid json")
 	}
-	success, msg := database.TryLogin(user.Username, user.Password)
+	success, msg := h.Users.TryLogin(user.Username, user.Password)
 
 	if !success {
-		return false, "", "", errors.New(msg)
+		return false, "", errors.New(msg)
 	} else {
-		return true, user.Username, user.Password, nil
+		return true, user.Username, nil
 	}
 }
 
-func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
-		RegisterPostHandler(w, r)
+		h.RegisterPostHandler(w, r)
 	case http.MethodGet:
-		RegisterGetHandler(w, r)
+		h.RegisterGetHandler(w, r)
 	}
 }
 
-func RegisterGetHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) RegisterGetHandler(w http.ResponseWriter, r *http.Request) {
 	html_string, err := os.ReadFile("frontend/register.html")
 	if err != nil {
 		panic(err)
 	}
 	fmt.Fprintln(w, string(html_string))
 }
-func RegisterPostHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) RegisterPostHandler(w http.ResponseWriter, r *http.Request) {
 
 	var customer database.Customer
 	err := json.NewDecoder(r.Body).Decode(&customer)
@@ -737,7 +963,15 @@ func RegisterPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	success, msg := database.TryAddCustomer(customer)
+	success, msg := h.Users.TryAddCustomer(customer)
+
+	// Log the new customer straight in
+	if success {
+		session, err := h.Users.CreateSession(customer.Username)
+		if err == nil {
+			setSessionCookie(w, session)
+		}
+	}
 
 	type Msg struct {
 		Ok  bool   `json:"ok"`
@@ -752,7 +986,7 @@ func RegisterPostHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, string(jsonMsg))
 }
 
-func PizzaHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) PizzaHandler(w http.ResponseWriter, r *http.Request) {
 	html_string, err := os.ReadFile("frontend/pizza.html")
 	if err != nil {
 		panic(err)
@@ -760,14 +994,41 @@ func PizzaHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintln(w, string(html_string))
 }
 
-func MenuHandler(w http.ResponseWriter, r *http.Request) {
-	pizzas, err := database.GetAllPizzas()
+func (h *Handler) MenuHandler(w http.ResponseWriter, r *http.Request) {
+	pizzas, err := h.Pizzas.GetAllPizzas()
 	if err != nil {
 		http.Error(w, "Failed to load pizzas", http.StatusInternalServerError)
 		return
 	}
 
+	sizes, err := h.Pizzas.GetPizzaOptions(database.SizeOption)
+	if err != nil {
+		http.Error(w, "Failed to load sizes", http.StatusInternalServerError)
+		return
+	}
+	crusts, err := h.Pizzas.GetPizzaOptions(database.CrustOption)
+	if err != nil {
+		http.Error(w, "Failed to load crusts", http.StatusInternalServerError)
+		return
+	}
+	sizeID, _ := strconv.Atoi(r.URL.Query().Get("size"))
+	crustID, _ := strconv.Atoi(r.URL.Query().Get("crust"))
+	if !hasPizzaOption(sizes, sizeID) || !hasPizzaOption(crusts, crustID) {
+		http.Error(w, "Unknown size or crust", http.StatusBadRequest)
+		return
+	}
+
 	fmt.Fprintln(w, "<h1>Pizza Menu</h1>")
+	// Prices are per size and crust, link to the menu in each of them
+	fmt.Fprint(w, "<p>Size:")
+	for _, size := range sizes {
+		fmt.Fprintf(w, ` <a href="/menu?size=%d&crust=%d">%s</a>`, size.ID, crustID, size.Name)
+	}
+	fmt.Fprint(w, "<br>Crust:")
+	for _, crust := range crusts {
+		fmt.Fprintf(w, ` <a href="/menu?size=%d&crust=%d">%s</a>`, sizeID, crust.ID, crust.Name)
+	}
+	fmt.Fprintln(w, "</p>")
 	fmt.Fprintln(w, `<table border="1" cellpadding="5" cellspacing="0">`)
 	fmt.Fprintln(w, "<tr><th>Pizza Name</th><th>Cost</th><th>Ingredients</th><th>Diet Info</th></tr>")
 
@@ -779,7 +1040,7 @@ func MenuHandler(w http.ResponseWriter, r *http.Request) {
 	pizzaInfos := []database.PizzaInformation{}
 
 	for _, pizza := range pizzas {
-		info, err := database.GetPizzaInformation(pizza.Name)
+		info, err := h.Pizzas.GetPizzaInformation(pizza.Name, sizeID, crustID)
 		if err != nil {
 			fmt.Fprintf(w, "<tr><td colspan='4'>Failed to load info for %s</td></tr>", pizza.Name)
 			continue
@@ -813,9 +1074,10 @@ func MenuHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		fmt.Fprintf(w,
-			"<tr><td>%s</td><td>%s €</td><td>%s</td><td>%s</td></tr>",
+			"<tr><td>%s</td><td>%s %s</td><td>%s</td><td>%s</td></tr>",
 			pizza.Name,
 			info.Cost.StringFixed(2),
+			database.CurrencySymbol,
 			strings.Join(ingredientNames, ", "),
 			diet,
 		)
@@ -824,7 +1086,7 @@ func MenuHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintln(w, "</table></body></html>")
 }
 
-func AccountHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AccountHandler(w http.ResponseWriter, r *http.Request) {
 	html_string, err := os.ReadFile("frontend/account.html")
 	if err != nil {
 		panic(err)
@@ -832,7 +1094,7 @@ func AccountHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintln(w, string(html_string))
 }
 
-func GetAccountDetailsHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetAccountDetailsHandler(w http.ResponseWriter, r *http.Request) {
 
 	type CustomerResult struct {
 		Ok       bool              `json:"ok"`
@@ -840,15 +1102,8 @@ func GetAccountDetailsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	customerResult := CustomerResult{Ok: false}
 
-	success, username, password, _ := isLoginOK(r)
-
-	if !success {
-		jsonMsg, _ := json.Marshal(customerResult)
-		fmt.Fprint(w, string(jsonMsg))
-		return
-	}
-
-	customer, err := database.GetCustomerDetails(username, password)
+	session := requestSession(r)
+	customer, err := h.Users.GetCustomerDetails(session.Username)
 	if err != nil {
 		jsonMsg, _ := json.Marshal(customerResult)
 		fmt.Fprint(w, string(jsonMsg))
@@ -860,40 +1115,9 @@ func GetAccountDetailsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // --- Admin APIs ---
-// Simple auth: expects JSON body with {username,password} that must be an ADMIN user
-type adminAuth struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
-}
-
-func isAdminFromHeaders(r *http.Request) bool {
-	user := r.Header.Get("X-Username")
-	pass := r.Header.Get("X-Password")
-
-	if user == "" || pass == "" {
-		userCookie, err1 := r.Cookie("X-Username")
-		passCookie, err2 := r.Cookie("X-Password")
-		if err1 == nil && err2 == nil {
-			user = userCookie.Value
-			pass = passCookie.Value
-		}
-	}
-
-	if user == "" || pass == "" {
-		return false
-	}
-	ok, _ := database.TryLogin(user, pass)
-	if !ok {
-		return false
-	}
-	role, err := database.GetUserRole(user)
-	if err != nil || role != database.AdminRole.String() {
-		return false
-	}
-	return true
-}
+// All admin endpoints require a session belonging to an ADMIN user, main.go wraps them in RequireRoles (middleware.go).
 
-func AdminCreateIngredientHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminCreateIngredientHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -910,22 +1134,6 @@ func AdminCreateIngredientHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "invalid json", http.StatusBadRequest)
 			return
 		}
-		a := adminAuth{Username: payload["username"].(string), Password: payload["password"].(string)}
-		ok, msg := func() (bool, string) {
-			ok, _ := database.TryLogin(a.Username, a.Password)
-			if !ok {
-				return false, "invalid credentials"
-			}
-			role, err := database.GetUserRole(a.Username)
-			if err != nil || role != database.AdminRole.String() {
-				return false, "not admin"
-			}
-			return true, ""
-		}()
-		if !ok {
-			http.Error(w, msg, http.StatusUnauthorized)
-			return
-		}
 		name, _ = payload["name"].(string)
 		switch v := payload["costCents"].(type) {
 		case float64:
@@ -939,10 +1147,6 @@ func AdminCreateIngredientHandler(w http.ResponseWriter, r *http.Request) {
 		hasMeat, _ = payload["hasMeat"].(bool)
 		hasAnimal, _ = payload["hasAnimalProducts"].(bool)
 	} else {
-		if !isAdminFromHeaders(r) {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
-		}
 		r.ParseForm()
 		name = r.FormValue("name")
 		fmt.Sscanf(r.FormValue("cost"), "%d", &costCents)
@@ -951,7 +1155,7 @@ func AdminCreateIngredientHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ingr := database.NewIngredient(name, costCents, hasMeat, hasAnimal)
-	_, err := database.CreateIngredient(ingr)
+	_, err := h.Ingredients.CreateIngredient(ingr)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -960,12 +1164,13 @@ func AdminCreateIngredientHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/admin", http.StatusSeeOther)
 }
 
-func AdminListIngredientsHandler(w http.ResponseWriter, r *http.Request) {
+// ListIngredientsHandler returns every ingredient, customers pick their toppings from it.
+func (h *Handler) ListIngredientsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	ingredients, err := database.GetAllIngredients()
+	ingredients, err := h.Ingredients.GetAllIngredients()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -973,13 +1178,45 @@ func AdminListIngredientsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(ingredients)
 }
 
-func AdminDeleteIngredientHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
+// AdminListIngredientsHandler returns a page of the ingredients, see parseIngredientFilter for the
+// query parameters.
+func (h *Handler) AdminListIngredientsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	if !isAdminFromHeaders(r) {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+
+	filter, err := parseIngredientFilter(r.URL.Query())
+	if err != nil {
+		web.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ingredients, total, err := h.Ingredients.ListIngredients(filter)
+	if err != nil {
+		code := listErrorCode(err)
+		errorMsg := "Failed to get ingredients"
+		if code != http.StatusInternalServerError {
+			errorMsg = err.Error()
+		} else {
+			fmt.Println("ListIngredients error:", err)
+		}
+		web.WriteJSONError(w, code, errorMsg)
+		return
+	}
+
+	type Msg struct {
+		Ok          bool                        `json:"ok"`
+		Ingredients []database.IngredientWithID `json:"ingredients"`
+		Total       int                         `json:"total"`
+		Limit       int                         `json:"limit"`
+		Offset      int                         `json:"offset"`
+	}
+	json.NewEncoder(w).Encode(Msg{Ok: true, Ingredients: ingredients, Total: total, Limit: filter.Limit, Offset: filter.Offset})
+}
+
+func (h *Handler) AdminDeleteIngredientHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
@@ -996,7 +1233,7 @@ func AdminDeleteIngredientHandler(w http.ResponseWriter, r *http.Request) {
 		fmt.Sscanf(ids, "%d", &id)
 	}
 
-	if err := database.DeleteIngredient(id); err != nil {
+	if err := h.Ingredients.DeleteIngredient(id); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -1008,15 +1245,11 @@ func AdminDeleteIngredientHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func AdminUpdateIngredientHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminUpdateIngredientHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	if !isAdminFromHeaders(r) {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
-	}
 
 	var id int
 	var name string
@@ -1051,8 +1284,7 @@ func AdminUpdateIngredientHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ingr := database.NewIngredient(name, costCents, hasMeat, hasAnimal)
-	query := "UPDATE ingredient SET name = ?, cost = ?, has_meat = ?, has_animal_products = ? WHERE id = ?"
-	_, err := database.DATABASE.Exec(query, ingr.Name, ingr.Cost.String(), ingr.HasMeat, ingr.HasAnimalProducts, id)
+	err := h.Ingredients.UpdateIngredient(id, ingr)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -1066,7 +1298,7 @@ func AdminUpdateIngredientHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func AdminCreatePizzaHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminCreatePizzaHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -1079,8 +1311,6 @@ func AdminCreatePizzaHandler(w http.ResponseWriter, r *http.Request) {
 	if strings.Contains(contentType, "application/json") {
 		// JSON API
 		var payload struct {
-			Username    string   `json:"username"`
-			Password    string   `json:"password"`
 			Name        string   `json:"name"`
 			Ingredients []string `json:"ingredients"`
 		}
@@ -1088,24 +1318,10 @@ func AdminCreatePizzaHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "invalid json", http.StatusBadRequest)
 			return
 		}
-		ok, _ := database.TryLogin(payload.Username, payload.Password)
-		if !ok {
-			http.Error(w, "invalid credentials", http.StatusUnauthorized)
-			return
-		}
-		role, err := database.GetUserRole(payload.Username)
-		if err != nil || role != database.AdminRole.String() {
-			http.Error(w, "not admin", http.StatusUnauthorized)
-			return
-		}
 		name = payload.Name
 		ingredients = payload.Ingredients
 	} else {
 		// Form data
-		if !isAdminFromHeaders(r) {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
-		}
 		r.ParseForm()
 		name = r.FormValue("name")
 		ingrStr := r.FormValue("ingredients")
@@ -1117,7 +1333,7 @@ func AdminCreatePizzaHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	_, err := database.CreatePizza(name, ingredients)
+	_, err := h.Pizzas.CreatePizza(name, ingredients)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -1131,12 +1347,13 @@ func AdminCreatePizzaHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func AdminListPizzasHandler(w http.ResponseWriter, r *http.Request) {
+// ListPizzasHandler returns the menu's pizzas with their prices and whether they are in stock, for the home page.
+func (h *Handler) ListPizzasHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	pizzas, err := database.GetAllPizzasWithPrice()
+	pizzas, err := h.Pizzas.GetAllPizzasWithPrice()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -1144,13 +1361,22 @@ func AdminListPizzasHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(pizzas)
 }
 
-func AdminDeletePizzaHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
+func (h *Handler) AdminListPizzasHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	if !isAdminFromHeaders(r) {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	pizzas, err := h.Pizzas.GetAllPizzasWithPrice()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(pizzas)
+}
+
+func (h *Handler) AdminDeletePizzaHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
@@ -1167,7 +1393,7 @@ func AdminDeletePizzaHandler(w http.ResponseWriter, r *http.Request) {
 		fmt.Sscanf(ids, "%d", &id)
 	}
 
-	if err := database.DeletePizza(id); err != nil {
+	if err := h.Pizzas.DeletePizza(id); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -1179,23 +1405,16 @@ func AdminDeletePizzaHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func CreateOrderHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) CreateOrderHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var req struct {
-		Username        string `json:"username"`
-		Password        string `json:"password"`
 		DeliveryAddress string `json:"delivery_address"`
 		PostalCode      string `json:"postal_code"`
 		DiscountCode    string `json:"discount_code"`
-		CartItems       []struct {
-			ID       int    `json:"id"`
-			Quantity int    `json:"quantity"`
-			Type     string `json:"type"` // "pizza" or "extra"
-		} `json:"cart_items"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1203,99 +1422,38 @@ func CreateOrderHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	success, _ := database.TryLogin(req.Username, req.Password)
-	if !success {
+	userID := requestSession(r).UserID
+
+	customerID, err := h.Users.GetCustomerIDFromUserID(userID)
+	if err != nil {
 		type Msg struct {
 			Ok    bool   `json:"ok"`
 			Error string `json:"error"`
 		}
-		json.NewEncoder(w).Encode(Msg{Ok: false, Error: "Invalid credentials"})
+		json.NewEncoder(w).Encode(Msg{Ok: false, Error: "Customer not found"})
 		return
 	}
 
-	userID, err := database.GetUserIDFromUsername(req.Username)
-	if err != nil {
-		type Msg struct {
-			Ok    bool   `json:"ok"`
-			Error string `json:"error"`
-		}
-		json.NewEncoder(w).Encode(Msg{Ok: false, Error: "User not found"})
-		return
-	}
-
-	customerID, err := database.GetCustomerIDFromUserID(userID)
-	if err != nil {
-		type Msg struct {
-			Ok    bool   `json:"ok"`
-			Error string `json:"error"`
-		}
-		json.NewEncoder(w).Encode(Msg{Ok: false, Error: "Customer not found"})
-		return
-	}
-
-	if len(req.CartItems) == 0 {
-		type Msg struct {
-			Ok    bool   `json:"ok"`
-			Error string `json:"error"`
-		}
-		json.NewEncoder(w).Encode(Msg{Ok: false, Error: "Cart is empty"})
-		return
-	}
-
-	// Separate pizzas and extra items
-	var pizzaItems []struct {
-		PizzaID  int
-		Quantity int
-	}
-	var extraItems []struct {
-		ExtraItemID int
-		Quantity    int
-	}
-
-	for _, item := range req.CartItems {
-		if item.Type == "extra" {
-			extraItems = append(extraItems, struct {
-				ExtraItemID int
-				Quantity    int
-			}{
-				ExtraItemID: item.ID,
-				Quantity:    item.Quantity,
-			})
-		} else {
-			// Default to pizza if type is missing or "pizza"
-			pizzaItems = append(pizzaItems, struct {
-				PizzaID  int
-				Quantity int
-			}{
-				PizzaID:  item.ID,
-				Quantity: item.Quantity,
-			})
-		}
-	}
-
-	orderID, err := database.CreateOrderWithTransaction(
+	// The order is what is in the customer's cart on the server, whatever the browser thinks is in it
+	orderID, err := h.Carts.CheckoutCart(
 		customerID,
 		userID,
 		req.DeliveryAddress,
 		req.PostalCode,
-		pizzaItems,
-		extraItems,
 		&req.DiscountCode,
 	)
 	if err != nil {
-		fmt.Println(err)
-		type Msg struct {
-			Ok    bool   `json:"ok"`
-			Error string `json:"error"`
+		// Like writeCartError, an empty cart or a rejected code is the customer's to fix, not ours
+		if cartErrorCode(err) == http.StatusInternalServerError {
+			fmt.Println("CheckoutCart error:", err)
 		}
-
-		// Check for specific errors
-		errorMsg := "Failed to create order"
-		if err.Error() == "discount code already used" {
-			errorMsg = "You have already used this discount code"
+		type Msg struct {
+			Ok     bool   `json:"ok"`
+			Error  string `json:"error"`
+			Reason string `json:"reason,omitempty"`
 		}
 
-		json.NewEncoder(w).Encode(Msg{Ok: false, Error: errorMsg})
+		json.NewEncoder(w).Encode(Msg{Ok: false, Error: cartErrorMessage(err, "Failed to create order"), Reason: discountRejection(err)})
 		return
 	}
 
@@ -1306,124 +1464,129 @@ func CreateOrderHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(Msg{Ok: true, OrderID: orderID})
 }
 
-func GetAvailableDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// cartErrorMessage tells the customer what is wrong with their cart, or fallback if it isn't their cart.
+func cartErrorMessage(err error, fallback string) string {
+	var outOfStock *database.OutOfStockError
+	var discountRejected *database.DiscountRejectedError
+	var deliveryRejected *database.DeliveryRejectedError
+	switch {
+	case errors.As(err, &discountRejected):
+		return discountRejectionMessage(discountRejected)
+	case errors.As(err, &deliveryRejected):
+		return deliveryRejectionMessage(deliveryRejected)
+	case errors.As(err, &outOfStock):
+		return "Sorry, we ran out of " + strings.Join(outOfStock.Ingredients, ", ") + ", please change your order"
+	case errors.Is(err, database.ErrPizzaOptionNotFound):
+		return "A pizza in your cart comes in a size or crust we no longer make"
+	case errors.Is(err, database.ErrIngredientNotFound):
+		return "A pizza in your cart has a topping we no longer have"
+	case errors.Is(err, database.ErrInvalidModifier):
+		return "A pizza in your cart has toppings that don't match its recipe, please customize it again"
+	case errors.Is(err, database.ErrEmptyPizza):
+		return "A pizza in your cart has no toppings left, please add at least one"
+	case errors.Is(err, database.ErrCartEmpty):
+		return "Cart is empty"
+	case errors.Is(err, database.ErrCartItemNotFound):
+		return "This is no longer in your cart"
+	case errors.Is(err, database.ErrNotOnMenu):
+		return "This is no longer on the menu"
+	case errors.Is(err, database.ErrInvalidQuantity):
+		return "The quantity must be at least 1"
+	default:
+		return fallback
 	}
+}
 
-	// Get credentials from cookies
-	var username, password string
-	userCookie, err := r.Cookie("user")
-	passCookie, err2 := r.Cookie("pass")
-
-	if err == nil && err2 == nil {
-		username = userCookie.Value
-		password = passCookie.Value
-	} else {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"ok":    false,
-			"error": "Not authenticated",
-		})
+// QuoteOrderHandler prices the customer's cart with the same pipeline checkout uses, so the cart shows the real total.
+func (h *Handler) QuoteOrderHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	success, _ := database.TryLogin(username, password)
-	if !success {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"ok":    false,
-			"error": "Invalid credentials",
-		})
+	var req struct {
+		DiscountCode string `json:"discount_code"`
+		PostalCode   string `json:"postal_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
 
-	// Verify user is a delivery person
-	role, err := database.GetUserRole(username)
-	if err != nil || role != database.DeliveryRole.String() {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"ok":    false,
-			"error": "Not authorized as delivery person",
-		})
+	customerID, ok := h.cartCustomerID(w, r)
+	if !ok {
 		return
 	}
-
-	// Get available deliveries
-	deliveries, err := database.GetAvailableDeliveries()
+	breakdown, err := h.Carts.QuoteCart(customerID, requestSession(r).UserID, req.PostalCode, &req.DiscountCode)
+	w.Header().Set("Content-Type", "application/json")
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"ok":    false,
-			"error": "Failed to get available deliveries",
+			"ok":     false,
+			"error":  cartErrorMessage(err, "Failed to price cart"),
+			"reason": discountRejection(err),
 		})
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"ok":     true,
-		"orders": deliveries,
+		"ok":        true,
+		"breakdown": breakdown,
 	})
 }
 
-func GetAssignedDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetAvailableDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Get credentials from cookies
-	var username, password string
-	userCookie, err := r.Cookie("user")
-	passCookie, err2 := r.Cookie("pass")
-
-	if err == nil && err2 == nil {
-		username = userCookie.Value
-		password = passCookie.Value
-	} else {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"ok":    false,
-			"error": "Not authenticated",
-		})
-		return
+	// ?zones=mine only shows the orders going to the courier's own zones
+	var zoneIDs []int
+	if r.URL.Query().Get("zones") == "mine" {
+		deliveryPersonID, err := h.Deliveries.GetDeliveryPersonIDFromUserID(requestSession(r).UserID)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"ok":    false,
+				"error": "Delivery person not found",
+			})
+			return
+		}
+		if zoneIDs, err = h.Deliveries.GetDeliveryPersonZoneIDs(deliveryPersonID); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"ok":    false,
+				"error": "Failed to get your delivery zones",
+			})
+			return
+		}
 	}
 
-	success, _ := database.TryLogin(username, password)
-	if !success {
+	// Get available deliveries
+	deliveries, err := h.Deliveries.GetAvailableDeliveries(zoneIDs)
+	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"ok":    false,
-			"error": "Invalid credentials",
+			"error": "Failed to get available deliveries",
 		})
 		return
 	}
 
-	// Verify user is a delivery person
-	role, err := database.GetUserRole(username)
-	if err != nil || role != database.DeliveryRole.String() {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"ok":    false,
-			"error": "Not authorized as delivery person",
-		})
-		return
-	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":     true,
+		"orders": deliveries,
+	})
+}
 
-	// Get user ID and delivery person ID
-	userID, err := database.GetUserIDFromUsername(username)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"ok":    false,
-			"error": "User not found",
-		})
+func (h *Handler) GetAssignedDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	deliveryPersonID, err := database.GetDeliveryPersonIDFromUserID(userID)
+	deliveryPersonID, err := h.Deliveries.GetDeliveryPersonIDFromUserID(requestSession(r).UserID)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -1434,7 +1597,7 @@ func GetAssignedDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get assigned deliveries
-	deliveries, err := database.GetAssignedDeliveries(deliveryPersonID)
+	deliveries, err := h.Deliveries.GetAssignedDeliveries(deliveryPersonID)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -1451,38 +1614,12 @@ func GetAssignedDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func AssignDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AssignDeliveryHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Verify delivery person authentication - check cookies
-	var username, password string
-	userCookie, err := r.Cookie("user")
-	passCookie, err2 := r.Cookie("pass")
-
-	if err == nil && err2 == nil {
-		username = userCookie.Value
-		password = passCookie.Value
-	} else {
-		http.Error(w, "Not authenticated", http.StatusUnauthorized)
-		return
-	}
-
-	success, _ := database.TryLogin(username, password)
-	if !success {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
-		return
-	}
-
-	// Verify user is a delivery person
-	role, err := database.GetUserRole(username)
-	if err != nil || role != database.DeliveryRole.String() {
-		http.Error(w, "Not authorized as delivery person", http.StatusForbidden)
-		return
-	}
-
 	// Parse request body
 	var req struct {
 		OrderID int `json:"order_id"`
@@ -1492,21 +1629,14 @@ func AssignDeliveryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get user ID and delivery person ID
-	userID, err := database.GetUserIDFromUsername(username)
-	if err != nil {
-		http.Error(w, "User not found", http.StatusInternalServerError)
-		return
-	}
-
-	deliveryPersonID, err := database.GetDeliveryPersonIDFromUserID(userID)
+	deliveryPersonID, err := h.Deliveries.GetDeliveryPersonIDFromUserID(requestSession(r).UserID)
 	if err != nil {
 		http.Error(w, "Delivery person not found", http.StatusInternalServerError)
 		return
 	}
 
 	// Assign delivery
-	err = database.AssignDelivery(req.OrderID, deliveryPersonID)
+	err = h.Deliveries.AssignDelivery(req.OrderID, deliveryPersonID)
 	if err == database.ErrOrderNotAvailable {
 		http.Error(w, "Order is not available", http.StatusBadRequest)
 		return
@@ -1520,7 +1650,11 @@ func AssignDeliveryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err == database.ErrDeliveryPersonBusy {
-		http.Error(w, "You already have an active delivery", http.StatusConflict)
+		http.Error(w, "You can't carry any more orders", http.StatusConflict)
+		return
+	}
+	if err == database.ErrDeliveryZoneMismatch {
+		http.Error(w, "This order goes to another zone than your other orders", http.StatusConflict)
 		return
 	}
 	if err != nil {
@@ -1532,38 +1666,12 @@ func AssignDeliveryHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, `{"status":"ok"}`)
 }
 
-func UpdateDeliveryStatusHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) UpdateDeliveryStatusHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Verify delivery person authentication - check cookies
-	var username, password string
-	userCookie, err := r.Cookie("user")
-	passCookie, err2 := r.Cookie("pass")
-
-	if err == nil && err2 == nil {
-		username = userCookie.Value
-		password = passCookie.Value
-	} else {
-		http.Error(w, "Not authenticated", http.StatusUnauthorized)
-		return
-	}
-
-	success, _ := database.TryLogin(username, password)
-	if !success {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
-		return
-	}
-
-	// Verify user is a delivery person
-	role, err := database.GetUserRole(username)
-	if err != nil || role != database.DeliveryRole.String() {
-		http.Error(w, "Not authorized as delivery person", http.StatusForbidden)
-		return
-	}
-
 	// Parse request body
 	var req struct {
 		OrderID int    `json:"order_id"`
@@ -1575,11 +1683,24 @@ func UpdateDeliveryStatusHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update delivery status
-	err = database.UpdateDeliveryStatus(req.OrderID, req.Status)
+	err := h.Deliveries.UpdateDeliveryStatus(req.OrderID, requestSession(r).UserID, req.Status)
 	if err == database.ErrInvalidStatus {
 		http.Error(w, "Invalid status. Must be 'DELIVERED' or 'FAILED'", http.StatusBadRequest)
 		return
 	}
+	if err == database.ErrOrderNotFound {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if err == database.ErrNotYourDelivery {
+		http.Error(w, "This order is not assigned to you", http.StatusForbidden)
+		return
+	}
+	var illegal *database.IllegalTransitionError
+	if errors.As(err, &illegal) {
+		http.Error(w, "Order is not out for delivery", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to update delivery status", http.StatusInternalServerError)
 		return
@@ -1589,43 +1710,13 @@ func UpdateDeliveryStatusHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, `{"status":"ok"}`)
 }
 
-func GetOrdersHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetOrdersHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var req struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
-		return
-	}
-
-	success, _ := database.TryLogin(req.Username, req.Password)
-	if !success {
-		type Msg struct {
-			Ok    bool   `json:"ok"`
-			Error string `json:"error"`
-		}
-		json.NewEncoder(w).Encode(Msg{Ok: false, Error: "Invalid credentials"})
-		return
-	}
-
-	userID, err := database.GetUserIDFromUsername(req.Username)
-	if err != nil {
-		type Msg struct {
-			Ok    bool   `json:"ok"`
-			Error string `json:"error"`
-		}
-		json.NewEncoder(w).Encode(Msg{Ok: false, Error: "User not found"})
-		return
-	}
-
-	customerID, err := database.GetCustomerIDFromUserID(userID)
+	customerID, err := h.Users.GetCustomerIDFromUserID(requestSession(r).UserID)
 	if err != nil {
 		type Msg struct {
 			Ok    bool   `json:"ok"`
@@ -1635,7 +1726,7 @@ func GetOrdersHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	orders, err := database.GetOrdersByCustomer(customerID)
+	orders, err := h.Orders.GetOrdersByCustomer(customerID)
 	if err != nil {
 		type Msg struct {
 			Ok    bool   `json:"ok"`
@@ -1652,16 +1743,14 @@ func GetOrdersHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(Msg{Ok: true, Orders: orders})
 }
 
-func GetOrderDetailsHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) CancelOrderHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var req struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-		OrderID  int    `json:"order_id"`
+		OrderID int `json:"order_id"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1669,57 +1758,70 @@ func GetOrderDetailsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	success, role := database.TryLogin(req.Username, req.Password)
-	if !success {
-		type Msg struct {
-			Ok    bool   `json:"ok"`
-			Error string `json:"error"`
-		}
-		json.NewEncoder(w).Encode(Msg{Ok: false, Error: "Invalid credentials"})
+	session := requestSession(r)
+	customerID, err := h.Users.GetCustomerIDFromUserID(session.UserID)
+	if err != nil {
+		web.WriteJSONError(w, http.StatusForbidden, "Customer not found")
 		return
 	}
 
-	details, err := database.GetOrderDetails(req.OrderID)
+	err = h.Orders.CancelOrderByCustomer(req.OrderID, customerID, session.UserID)
 	if err != nil {
-		fmt.Println("GetOrderDetails error:", err)
-		type Msg struct {
-			Ok    bool   `json:"ok"`
-			Error string `json:"error"`
+		var illegal *database.IllegalTransitionError
+		switch {
+		case errors.As(err, &illegal):
+			web.WriteJSONError(w, http.StatusConflict, "This order has already left the kitchen")
+		case errors.Is(err, database.ErrCancelWindowPassed):
+			web.WriteJSONError(w, http.StatusConflict, fmt.Sprintf("Orders can only be cancelled within %v of placing them", database.CancelWindow))
+		case errors.Is(err, database.ErrOrderAlreadyDispatched):
+			web.WriteJSONError(w, http.StatusConflict, "A delivery person already has this order")
+		case errors.Is(err, database.ErrOrderNotFound):
+			web.WriteJSONError(w, http.StatusNotFound, "Order not found")
+		default:
+			fmt.Println("CancelOrder error:", err)
+			web.WriteJSONError(w, http.StatusInternalServerError, "Failed to cancel order")
 		}
-		json.NewEncoder(w).Encode(Msg{Ok: false, Error: "Failed to get order details"})
 		return
 	}
 
-	// Admins can view any order, customers can only view their own
-	if role != "ADMIN" {
-		userID, err := database.GetUserIDFromUsername(req.Username)
-		if err != nil {
-			type Msg struct {
-				Ok    bool   `json:"ok"`
-				Error string `json:"error"`
-			}
-			json.NewEncoder(w).Encode(Msg{Ok: false, Error: "User not found"})
-			return
-		}
+	type Msg struct {
+		Ok bool `json:"ok"`
+	}
+	json.NewEncoder(w).Encode(Msg{Ok: true})
+}
 
-		customerID, err := database.GetCustomerIDFromUserID(userID)
-		if err != nil {
-			type Msg struct {
-				Ok    bool   `json:"ok"`
-				Error string `json:"error"`
-			}
-			json.NewEncoder(w).Encode(Msg{Ok: false, Error: "Customer not found"})
-			return
-		}
+func (h *Handler) GetOrderDetailsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-		if details.Order.CustomerID != customerID {
-			type Msg struct {
-				Ok    bool   `json:"ok"`
-				Error string `json:"error"`
-			}
-			json.NewEncoder(w).Encode(Msg{Ok: false, Error: "Unauthorized"})
-			return
+	var req struct {
+		OrderID int `json:"order_id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// Someone else's order looks the same as one that doesn't exist, so order IDs can't be probed
+	details, err := h.Orders.GetOrderDetails(req.OrderID)
+	if errors.Is(err, database.ErrOrderNotFound) {
+		web.WriteJSONError(w, http.StatusNotFound, "Order not found")
+		return
+	}
+	if err != nil {
+		fmt.Println("GetOrderDetails error:", err)
+		web.WriteJSONError(w, http.StatusInternalServerError, "Failed to get order details")
+		return
+	}
+	if allowed, err := h.canAccessOrder(requestSession(r), details.Order); !allowed {
+		if err != nil {
+			fmt.Println("canAccessOrder error:", err)
 		}
+		web.WriteJSONError(w, http.StatusNotFound, "Order not found")
+		return
 	}
 
 	type Msg struct {
@@ -1729,7 +1831,7 @@ func GetOrderDetailsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(Msg{Ok: true, Order: details})
 }
 
-func DeliveryPerson(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeliveryPerson(w http.ResponseWriter, r *http.Request) {
 	html_string, err := os.ReadFile("frontend/delivery_person.html")
 	if err != nil {
 		panic(err)
@@ -1737,40 +1839,47 @@ func DeliveryPerson(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintln(w, string(html_string))
 }
 
-func AdminGetAllUsersHandler(w http.ResponseWriter, r *http.Request) {
+// AdminGetAllUsersHandler returns a page of the users, see parseUserFilter for the query parameters.
+func (h *Handler) AdminGetAllUsersHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	users, err := database.GetAllUsers()
+	filter, err := parseUserFilter(r.URL.Query())
 	if err != nil {
-		type Msg struct {
-			Ok    bool   `json:"ok"`
-			Error string `json:"error"`
+		web.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	users, total, err := h.Users.ListUsers(filter)
+	if err != nil {
+		code := listErrorCode(err)
+		errorMsg := "Failed to get users"
+		if code != http.StatusInternalServerError {
+			errorMsg = err.Error()
+		} else {
+			fmt.Println("ListUsers error:", err)
 		}
-		json.NewEncoder(w).Encode(Msg{Ok: false, Error: "Failed to get users"})
+		web.WriteJSONError(w, code, errorMsg)
 		return
 	}
 
 	type Msg struct {
-		Ok    bool                     `json:"ok"`
-		Users []map[string]interface{} `json:"users"`
+		Ok     bool                     `json:"ok"`
+		Users  []map[string]interface{} `json:"users"`
+		Total  int                      `json:"total"`
+		Limit  int                      `json:"limit"`
+		Offset int                      `json:"offset"`
 	}
-	json.NewEncoder(w).Encode(Msg{Ok: true, Users: users})
+	json.NewEncoder(w).Encode(Msg{Ok: true, Users: users, Total: total, Limit: filter.Limit, Offset: filter.Offset})
 }
 
-func AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	if !isAdminFromHeaders(r) {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
 	var id int
 	if r.Method == http.MethodPost {
 		r.ParseForm()
@@ -1784,7 +1893,7 @@ func AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 		fmt.Sscanf(userID, "%d", &id)
 	}
 
-	err := database.DeleteUser(id)
+	err := h.Users.DeleteUser(id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -1801,7 +1910,7 @@ func AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(Msg{Ok: true})
 }
 
-func AdminCreateUserHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminCreateUserHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -1810,10 +1919,6 @@ func AdminCreateUserHandler(w http.ResponseWriter, r *http.Request) {
 	contentType := r.Header.Get("Content-Type")
 	if strings.Contains(contentType, "application/x-www-form-urlencoded") {
 		// Form submission from server-side rendered page
-		if !isAdminFromHeaders(r) {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
-		}
 		r.ParseForm()
 		username := r.FormValue("username")
 		password := r.FormValue("password")
@@ -1824,20 +1929,22 @@ func AdminCreateUserHandler(w http.ResponseWriter, r *http.Request) {
 				Username: username,
 				Password: password,
 			}
-			database.TryAddCustomer(customer)
+			h.Users.TryAddCustomer(customer)
 		} else if role == "delivery_person" {
 			deliveryPerson := database.DeliveryPerson{
 				Username: username,
 				Password: password,
 			}
-			database.TryAddDeliveryPerson(deliveryPerson)
+			h.Deliveries.TryAddDeliveryPerson(deliveryPerson)
+		} else if role == "kitchen" {
+			h.Users.AddUser(username, password, database.KitchenRole)
 		} else if role == "admin" {
 			// Create admin user (you may need to add this function)
 			customer := database.Customer{
 				Username: username,
 				Password: password,
 			}
-			database.TryAddCustomer(customer)
+			h.Users.TryAddCustomer(customer)
 		}
 		http.Redirect(w, r, "/admin", http.StatusSeeOther)
 		return
@@ -1845,17 +1952,15 @@ func AdminCreateUserHandler(w http.ResponseWriter, r *http.Request) {
 
 	// JSON API (backward compatibility)
 	var req struct {
-		AdminUsername string `json:"admin_username"`
-		AdminPassword string `json:"admin_password"`
-		UserType      string `json:"user_type"`
-		Username      string `json:"username"`
-		Password      string `json:"password"`
-		Name          string `json:"name"`
-		Gender        string `json:"gender"`
-		BirthDate     string `json:"birth_date"`
-		NoBirthDate   bool   `json:"no_birth_date"`
-		Address       string `json:"address"`
-		PostalCode    string `json:"postal_code"`
+		UserType    string `json:"user_type"`
+		Username    string `json:"username"`
+		Password    string `json:"password"`
+		Name        string `json:"name"`
+		Gender      string `json:"gender"`
+		BirthDate   string `json:"birth_date"`
+		NoBirthDate bool   `json:"no_birth_date"`
+		Address     string `json:"address"`
+		PostalCode  string `json:"postal_code"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1863,24 +1968,6 @@ func AdminCreateUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	success, role := database.TryLogin(req.AdminUsername, req.AdminPassword)
-	if !success {
-		type Msg struct {
-			Ok    bool   `json:"ok"`
-			Error string `json:"error"`
-		}
-		json.NewEncoder(w).Encode(Msg{Ok: false, Error: "Invalid admin credentials"})
-		return
-	}
-	if role != "ADMIN" {
-		type Msg struct {
-			Ok    bool   `json:"ok"`
-			Error string `json:"error"`
-		}
-		json.NewEncoder(w).Encode(Msg{Ok: false, Error: "User is not an admin (role: " + role + ")"})
-		return
-	}
-
 	if req.UserType == "customer" {
 		customer := database.Customer{
 			Username:    req.Username,
@@ -1892,7 +1979,7 @@ func AdminCreateUserHandler(w http.ResponseWriter, r *http.Request) {
 			Address:     req.Address,
 			PostCode:    req.PostalCode,
 		}
-		ok, msg := database.TryAddCustomer(customer)
+		ok, msg := h.Users.TryAddCustomer(customer)
 		type Msg struct {
 			Ok      bool   `json:"ok"`
 			Message string `json:"message,omitempty"`
@@ -1904,12 +1991,22 @@ func AdminCreateUserHandler(w http.ResponseWriter, r *http.Request) {
 			Password: req.Password,
 			Name:     req.Name,
 		}
-		ok, msg := database.TryAddDeliveryPerson(deliveryPerson)
+		ok, msg := h.Deliveries.TryAddDeliveryPerson(deliveryPerson)
 		type Msg struct {
 			Ok      bool   `json:"ok"`
 			Message string `json:"message,omitempty"`
 		}
 		json.NewEncoder(w).Encode(Msg{Ok: ok, Message: msg})
+	} else if req.UserType == "kitchen" {
+		type Msg struct {
+			Ok      bool   `json:"ok"`
+			Message string `json:"message,omitempty"`
+		}
+		if err := h.Users.AddUser(req.Username, req.Password, database.KitchenRole); err != nil {
+			json.NewEncoder(w).Encode(Msg{Ok: false, Message: err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(Msg{Ok: true})
 	} else {
 		type Msg struct {
 			Ok    bool   `json:"ok"`
@@ -1919,40 +2016,47 @@ func AdminCreateUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func AdminGetAllOrdersHandler(w http.ResponseWriter, r *http.Request) {
+// AdminGetAllOrdersHandler returns a page of the orders, see parseOrderFilter for the query parameters.
+func (h *Handler) AdminGetAllOrdersHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	orders, err := database.GetAllOrders()
+	filter, err := parseOrderFilter(r.URL.Query())
 	if err != nil {
-		type Msg struct {
-			Ok    bool   `json:"ok"`
-			Error string `json:"error"`
+		web.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	orders, total, err := h.Orders.ListOrders(filter)
+	if err != nil {
+		code := listErrorCode(err)
+		errorMsg := "Failed to get orders"
+		if code != http.StatusInternalServerError {
+			errorMsg = err.Error()
+		} else {
+			fmt.Println("ListOrders error:", err)
 		}
-		json.NewEncoder(w).Encode(Msg{Ok: false, Error: "Failed to get orders"})
+		web.WriteJSONError(w, code, errorMsg)
 		return
 	}
 
 	type Msg struct {
 		Ok     bool             `json:"ok"`
 		Orders []database.Order `json:"orders"`
+		Total  int              `json:"total"`
+		Limit  int              `json:"limit"`
+		Offset int              `json:"offset"`
 	}
-	json.NewEncoder(w).Encode(Msg{Ok: true, Orders: orders})
+	json.NewEncoder(w).Encode(Msg{Ok: true, Orders: orders, Total: total, Limit: filter.Limit, Offset: filter.Offset})
 }
 
-func AdminDeleteOrderHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminDeleteOrderHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	if !isAdminFromHeaders(r) {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
 	var id int
 	if r.Method == http.MethodPost {
 		r.ParseForm()
@@ -1966,7 +2070,7 @@ func AdminDeleteOrderHandler(w http.ResponseWriter, r *http.Request) {
 		fmt.Sscanf(orderID, "%d", &id)
 	}
 
-	err := database.DeleteOrder(id)
+	err := h.Orders.DeleteOrder(id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -1983,29 +2087,24 @@ func AdminDeleteOrderHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(Msg{Ok: true})
 }
 
-func AdminUpdateOrderStatusHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminUpdateOrderStatusHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	contentType := r.Header.Get("Content-Type")
-	var orderID int
-	var status string
+	actorID := requestSession(r).UserID
 
 	if strings.Contains(contentType, "application/x-www-form-urlencoded") {
 		// Form submission
-		if !isAdminFromHeaders(r) {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
 		r.ParseForm()
+		var orderID int
 		fmt.Sscanf(r.FormValue("id"), "%d", &orderID)
-		status = r.FormValue("status")
 
-		err := database.UpdateOrderStatus(orderID, status)
+		err := h.updateOrderStatus(orderID, r.FormValue("status"), actorID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), orderStatusErrorCode(err))
 			return
 		}
 		http.Redirect(w, r, "/admin", http.StatusSeeOther)
@@ -2014,10 +2113,8 @@ func AdminUpdateOrderStatusHandler(w http.ResponseWriter, r *http.Request) {
 
 	// JSON API
 	var req struct {
-		AdminUsername string `json:"admin_username"`
-		AdminPassword string `json:"admin_password"`
-		OrderID       int    `json:"order_id"`
-		Status        string `json:"status"`
+		OrderID int    `json:"order_id"`
+		Status  string `json:"status"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -2025,23 +2122,97 @@ func AdminUpdateOrderStatusHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	success, role := database.TryLogin(req.AdminUsername, req.AdminPassword)
-	if !success || role != "ADMIN" {
+	err := h.updateOrderStatus(req.OrderID, req.Status, actorID)
+	if err != nil {
 		type Msg struct {
 			Ok    bool   `json:"ok"`
 			Error string `json:"error"`
 		}
-		json.NewEncoder(w).Encode(Msg{Ok: false, Error: "Unauthorized"})
+		errorMsg := "Failed to update order"
+		if orderStatusErrorCode(err) != http.StatusInternalServerError {
+			errorMsg = err.Error()
+		}
+		json.NewEncoder(w).Encode(Msg{Ok: false, Error: errorMsg})
 		return
 	}
 
-	err := database.UpdateOrderStatus(req.OrderID, req.Status)
+	type Msg struct {
+		Ok bool `json:"ok"`
+	}
+	json.NewEncoder(w).Encode(Msg{Ok: true})
+}
+
+func (h *Handler) updateOrderStatus(orderID int, status string, actorID int) error {
+	newStatus, err := database.ParseOrderStatus(status)
 	if err != nil {
-		type Msg struct {
-			Ok    bool   `json:"ok"`
-			Error string `json:"error"`
+		return err
+	}
+	return h.Orders.UpdateOrderStatus(orderID, newStatus, actorID)
+}
+
+// orderStatusErrorCode maps the order lifecycle errors to HTTP status codes.
+func orderStatusErrorCode(err error) int {
+	var illegal *database.IllegalTransitionError
+	switch {
+	case errors.As(err, &illegal),
+		errors.Is(err, database.ErrCancelWindowPassed),
+		errors.Is(err, database.ErrOrderAlreadyDispatched):
+		return http.StatusConflict
+	case errors.Is(err, database.ErrInvalidStatus),
+		errors.Is(err, database.ErrCancelReasonRequired):
+		return http.StatusBadRequest
+	case errors.Is(err, database.ErrOrderNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *Handler) AdminCancelOrderHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	actorID := requestSession(r).UserID
+
+	if strings.Contains(contentType, "application/x-www-form-urlencoded") {
+		// Form submission
+		r.ParseForm()
+		orderID, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid order ID", http.StatusBadRequest)
+			return
 		}
-		json.NewEncoder(w).Encode(Msg{Ok: false, Error: "Failed to update order"})
+
+		err = h.Orders.CancelOrderByAdmin(orderID, actorID, strings.TrimSpace(r.FormValue("reason")))
+		if err != nil {
+			http.Error(w, err.Error(), orderStatusErrorCode(err))
+			return
+		}
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	// JSON API
+	var req struct {
+		OrderID int    `json:"order_id"`
+		Reason  string `json:"reason"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	err := h.Orders.CancelOrderByAdmin(req.OrderID, actorID, strings.TrimSpace(req.Reason))
+	if err != nil {
+		code := orderStatusErrorCode(err)
+		errorMsg := "Failed to cancel order"
+		if code != http.StatusInternalServerError {
+			errorMsg = err.Error()
+		}
+		web.WriteJSONError(w, code, errorMsg)
 		return
 	}
 
@@ -2051,40 +2222,48 @@ func AdminUpdateOrderStatusHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(Msg{Ok: true})
 }
 
-func AdminGetAllDeliveryPersonsHandler(w http.ResponseWriter, r *http.Request) {
+// AdminGetAllDeliveryPersonsHandler returns a page of the couriers, see parseDeliveryPersonFilter for the
+// query parameters.
+func (h *Handler) AdminGetAllDeliveryPersonsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	deliveryPersons, err := database.GetAllDeliveryPersons()
+	filter, err := parseDeliveryPersonFilter(r.URL.Query())
 	if err != nil {
-		type Msg struct {
-			Ok    bool   `json:"ok"`
-			Error string `json:"error"`
+		web.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	deliveryPersons, total, err := h.Deliveries.ListDeliveryPersons(filter)
+	if err != nil {
+		code := listErrorCode(err)
+		errorMsg := "Failed to get delivery persons"
+		if code != http.StatusInternalServerError {
+			errorMsg = err.Error()
+		} else {
+			fmt.Println("ListDeliveryPersons error:", err)
 		}
-		json.NewEncoder(w).Encode(Msg{Ok: false, Error: "Failed to get delivery persons"})
+		web.WriteJSONError(w, code, errorMsg)
 		return
 	}
 
 	type Msg struct {
 		Ok              bool                     `json:"ok"`
 		DeliveryPersons []map[string]interface{} `json:"delivery_persons"`
+		Total           int                      `json:"total"`
+		Limit           int                      `json:"limit"`
+		Offset          int                      `json:"offset"`
 	}
-	json.NewEncoder(w).Encode(Msg{Ok: true, DeliveryPersons: deliveryPersons})
+	json.NewEncoder(w).Encode(Msg{Ok: true, DeliveryPersons: deliveryPersons, Total: total, Limit: filter.Limit, Offset: filter.Offset})
 }
 
-func AdminDeleteDeliveryPersonHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminDeleteDeliveryPersonHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	if !isAdminFromHeaders(r) {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
 	var id int
 	if r.Method == http.MethodPost {
 		r.ParseForm()
@@ -2098,7 +2277,7 @@ func AdminDeleteDeliveryPersonHandler(w http.ResponseWriter, r *http.Request) {
 		fmt.Sscanf(userID, "%d", &id)
 	}
 
-	err := database.DeleteDeliveryPerson(id)
+	err := h.Deliveries.DeleteDeliveryPerson(id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -2115,53 +2294,27 @@ func AdminDeleteDeliveryPersonHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(Msg{Ok: true})
 }
 
-func ListExtraItemsHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) ListExtraItemsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	query := `SELECT id, name, category, price FROM extra_item ORDER BY category, name`
-	rows, err := database.DATABASE.Query(query)
+	items, err := h.ExtraItems.GetAllExtraItems()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var items []map[string]interface{}
-	for rows.Next() {
-		var id int
-		var name, category string
-		var price float64
-		err := rows.Scan(&id, &name, &category, &price)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		items = append(items, map[string]interface{}{
-			"id":       id,
-			"name":     name,
-			"category": category,
-			"price":    price,
-		})
-	}
 
 	json.NewEncoder(w).Encode(items)
 }
 
-func CreateExtraItemHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) CreateExtraItemHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	if !isAdminFromHeaders(r) {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
 	contentType := r.Header.Get("Content-Type")
 	var name, category string
 	var price float64
@@ -2194,8 +2347,7 @@ func CreateExtraItemHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := `INSERT INTO extra_item (name, category, price) VALUES (?, ?, ?)`
-	result, err := database.DATABASE.Exec(query, name, category, price)
+	id, err := h.ExtraItems.CreateExtraItem(name, category, price)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -2206,7 +2358,6 @@ func CreateExtraItemHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, _ := result.LastInsertId()
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"ok":       true,
@@ -2217,17 +2368,12 @@ func CreateExtraItemHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func UpdateExtraItemHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) UpdateExtraItemHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	if !isAdminFromHeaders(r) {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
 	contentType := r.Header.Get("Content-Type")
 	var id int
 	var name, category string
@@ -2263,8 +2409,7 @@ func UpdateExtraItemHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := `UPDATE extra_item SET name = ?, category = ?, price = ? WHERE id = ?`
-	_, err := database.DATABASE.Exec(query, name, category, price, id)
+	err := h.ExtraItems.UpdateExtraItem(id, name, category, price)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -2281,17 +2426,12 @@ func UpdateExtraItemHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func DeleteExtraItemHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeleteExtraItemHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	if !isAdminFromHeaders(r) {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
 	var id string
 	if r.Method == http.MethodPost {
 		r.ParseForm()
@@ -2300,13 +2440,13 @@ func DeleteExtraItemHandler(w http.ResponseWriter, r *http.Request) {
 		id = r.URL.Query().Get("id")
 	}
 
-	if id == "" {
+	itemID, err := strconv.Atoi(id)
+	if err != nil {
 		http.Error(w, "ID required", http.StatusBadRequest)
 		return
 	}
 
-	query := `DELETE FROM extra_item WHERE id = ?`
-	_, err := database.DATABASE.Exec(query, id)
+	err = h.ExtraItems.DeleteExtraItem(itemID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -2324,13 +2464,25 @@ func DeleteExtraItemHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // Discount code handlers
-func ValidateDiscountCodeHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+
+// ValidateDiscountCodeHandler checks a code against the customer's cart by pricing it the way checkout does,
+// so it gives the same reason checkout would for refusing it.
+func (h *Handler) ValidateDiscountCodeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	code := r.URL.Query().Get("code")
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	code := strings.ToUpper(strings.TrimSpace(req.Code))
 	if code == "" {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"ok":    false,
@@ -2339,44 +2491,31 @@ func ValidateDiscountCodeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get user ID from cookie
-	userCookie, err := r.Cookie("user")
-	if err != nil {
+	customerID, ok := h.cartCustomerID(w, r)
+	if !ok {
+		return
+	}
+	breakdown, err := h.Carts.QuoteCart(customerID, requestSession(r).UserID, "", &code)
+	var rejected *database.DiscountRejectedError
+	if errors.As(err, &rejected) {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"ok":      true,
 			"valid":   false,
-			"message": "Please login to use discount codes",
+			"reason":  rejected.Reason(),
+			"message": discountRejectionMessage(rejected),
 		})
 		return
 	}
-	username := userCookie.Value
-
-	userID, err := database.GetUserIDFromUsername(username)
 	if err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"ok":    true,
-			"valid": false,
-		})
-		return
-	}
-
-	var discountCodeID int
-	var discountPercentage int
-	var isActive bool
-	err = database.DATABASE.QueryRow(`SELECT id, discount_percentage, is_active FROM discount_code WHERE code = ?`, code).Scan(&discountCodeID, &discountPercentage, &isActive)
-
-	if err != nil || !isActive {
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"ok":      true,
+			"ok":      false,
 			"valid":   false,
-			"message": "Invalid or inactive discount code",
+			"message": cartErrorMessage(err, "Failed to check discount code"),
 		})
 		return
 	}
 
-	// Check if user has already used this discount code
-	var usageCount int
-	err = database.DATABASE.QueryRow(`SELECT COUNT(*) FROM discount_usage WHERE user_id = ? AND discount_code_id = ?`, userID, discountCodeID).Scan(&usageCount)
+	discountCode, err := h.Discounts.GetDiscountCodeByCode(code)
 	if err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"ok":    false,
@@ -2385,42 +2524,41 @@ func ValidateDiscountCodeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if usageCount > 0 {
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"ok":      true,
-			"valid":   false,
-			"message": "You have already used this discount code",
-		})
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-
 	response := map[string]interface{}{
 		"ok":                  true,
 		"valid":               true,
-		"discount_percentage": discountPercentage,
-		"discount_code_id":    discountCodeID,
+		"discount_code_id":    discountCode.ID,
+		"discount_percentage": breakdown.DiscountPercentage,
+		"discount":            breakdown.Discount,
+		"breakdown":           breakdown,
+		"message":             fmt.Sprintf("Discount code \"%s\" applied (%s)", code, describeDiscount(discountCode)),
 	}
 
-	// Special message for birthday discount
-	if code == "BIRTHDAY" {
-		response["message"] = "🎉 Birthday Special: Free cheapest pizza + free drink! 🎉"
-		response["is_birthday"] = true
+	// A code with a promotion gives what the promotion does instead
+	promotion, err := h.codePromotion(discountCode.ID)
+	if err != nil {
+		fmt.Println("codePromotion error:", err)
+	}
+	if promotion != nil {
+		response["message"] = "🎉 " + promotionMessage(*promotion) + " 🎉"
+		response["promotion"] = promotion.Name
+		response["is_birthday"] = promotion.HasCondition(database.BirthdayCondition)
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
 
 // CheckBirthdayDiscountHandler checks if it's the user's birthday
-func CheckBirthdayDiscountHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) CheckBirthdayDiscountHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Get username from cookie
-	userCookie, err := r.Cookie("user")
+	userID := requestSession(r).UserID
+
+	// Check if it's their birthday
+	isBirthday, err := h.Users.CheckCustomerBirthday(int64(userID))
 	if err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"ok":          false,
@@ -2428,20 +2566,17 @@ func CheckBirthdayDiscountHandler(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	username := userCookie.Value
 
-	// Get user ID from username
-	userID, err := database.GetUserIDFromUsername(username)
-	if err != nil {
+	if !isBirthday {
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"ok":          false,
+			"ok":          true,
 			"is_birthday": false,
 		})
 		return
 	}
 
-	// Check if it's their birthday
-	isBirthday, err := database.CheckCustomerBirthday(int64(userID))
+	// The birthday deal is the promotion with a birthday condition that customers get with a code
+	birthday, err := h.birthdayPromotion()
 	if err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"ok":          false,
@@ -2449,18 +2584,19 @@ func CheckBirthdayDiscountHandler(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-
-	if !isBirthday {
+	w.Header().Set("Content-Type", "application/json")
+	if birthday == nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"ok":          true,
-			"is_birthday": false,
+			"ok":           true,
+			"is_birthday":  true,
+			"already_used": false,
+			"message":      "🎉 Happy Birthday! 🎉",
 		})
 		return
 	}
 
 	// Check if they already used the birthday discount
-	var discountCodeID int
-	err = database.DATABASE.QueryRow(`SELECT id FROM discount_code WHERE code = 'BIRTHDAY'`).Scan(&discountCodeID)
+	used, err := h.Discounts.HasUserUsedDiscount(userID, *birthday.DiscountCodeID)
 	if err != nil {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"ok":          false,
@@ -2469,18 +2605,7 @@ func CheckBirthdayDiscountHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var usageCount int
-	err = database.DATABASE.QueryRow(`SELECT COUNT(*) FROM discount_usage WHERE user_id = ? AND discount_code_id = ?`, userID, discountCodeID).Scan(&usageCount)
-	if err != nil {
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"ok":          false,
-			"is_birthday": false,
-		})
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	if usageCount > 0 {
+	if used {
 		// Already used birthday discount
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"ok":           true,
@@ -2494,88 +2619,63 @@ func CheckBirthdayDiscountHandler(w http.ResponseWriter, r *http.Request) {
 			"ok":           true,
 			"is_birthday":  true,
 			"already_used": false,
-			"code":         "BIRTHDAY",
-			"message":      "🎉 Happy Birthday! Get your cheapest pizza + 1 free drink! 🎉",
+			"code":         *birthday.DiscountCode,
+			"message":      "🎉 Happy Birthday! " + promotionMessage(*birthday) + " 🎉",
 		})
 	}
 }
 
-func CreateDiscountCodeHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) CreateDiscountCodeHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	if !isAdminFromHeaders(r) {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	r.ParseForm()
-	code := r.FormValue("code")
-	var percentage int
-	fmt.Sscanf(r.FormValue("percentage"), "%d", &percentage)
-
-	if percentage < 1 || percentage > 100 {
-		http.Error(w, "Percentage must be between 1 and 100", http.StatusBadRequest)
+	dc, err := parseDiscountCodeForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	query := `INSERT INTO discount_code (code, discount_percentage, is_active) VALUES (?, ?, TRUE)`
-	_, err := database.DATABASE.Exec(query, code, percentage)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if _, err := h.Discounts.CreateDiscountCode(dc); err != nil {
+		http.Error(w, err.Error(), discountErrorCode(err))
 		return
 	}
 
 	http.Redirect(w, r, "/admin", http.StatusSeeOther)
 }
 
-func UpdateDiscountCodeHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) UpdateDiscountCodeHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	if !isAdminFromHeaders(r) {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	dc, err := parseDiscountCodeForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	r.ParseForm()
-	var id int
-	fmt.Sscanf(r.FormValue("id"), "%d", &id)
-	code := r.FormValue("code")
-	var percentage int
-	fmt.Sscanf(r.FormValue("percentage"), "%d", &percentage)
-	isActive := r.FormValue("is_active") == "on"
-
-	if percentage < 1 || percentage > 100 {
-		http.Error(w, "Percentage must be between 1 and 100", http.StatusBadRequest)
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "ID required", http.StatusBadRequest)
 		return
 	}
 
-	query := `UPDATE discount_code SET code = ?, discount_percentage = ?, is_active = ? WHERE id = ?`
-	_, err := database.DATABASE.Exec(query, code, percentage, isActive, id)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := h.Discounts.UpdateDiscountCode(id, dc); err != nil {
+		http.Error(w, err.Error(), discountErrorCode(err))
 		return
 	}
 
 	http.Redirect(w, r, "/admin", http.StatusSeeOther)
 }
 
-func DeleteDiscountCodeHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeleteDiscountCodeHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	if !isAdminFromHeaders(r) {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
 	var id string
 	if r.Method == http.MethodPost {
 		r.ParseForm()
@@ -2584,13 +2684,13 @@ func DeleteDiscountCodeHandler(w http.ResponseWriter, r *http.Request) {
 		id = r.URL.Query().Get("id")
 	}
 
-	if id == "" {
+	codeID, err := strconv.Atoi(id)
+	if err != nil {
 		http.Error(w, "ID required", http.StatusBadRequest)
 		return
 	}
 
-	query := `DELETE FROM discount_code WHERE id = ?`
-	_, err := database.DATABASE.Exec(query, id)
+	err = h.Discounts.DeleteDiscountCode(codeID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -2599,26 +2699,32 @@ func DeleteDiscountCodeHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/admin", http.StatusSeeOther)
 }
 
-func AssignDeliveryPersonHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AssignDeliveryPersonHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	if !isAdminFromHeaders(r) {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
 	r.ParseForm()
 	var orderID, deliveryPersonID int
 	fmt.Sscanf(r.FormValue("order_id"), "%d", &orderID)
 	fmt.Sscanf(r.FormValue("delivery_person_id"), "%d", &deliveryPersonID)
 
-	query := `UPDATE orders SET delivery_person_id = ? WHERE id = ?`
-	_, err := database.DATABASE.Exec(query, deliveryPersonID, orderID)
+	// The same checks as a courier picking the order up, the status history records the admin
+	err := h.Deliveries.SetOrderDeliveryPerson(orderID, deliveryPersonID, requestSession(r).UserID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, database.ErrOrderNotFound), errors.Is(err, database.ErrDeliveryPersonNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, database.ErrOrderNotAvailable):
+			http.Error(w, "Only ready orders whose pizzas are all baked can be assigned", http.StatusBadRequest)
+		case errors.Is(err, database.ErrOrderAlreadyAssigned), errors.Is(err, database.ErrDeliveryPersonUnavailable),
+			errors.Is(err, database.ErrDeliveryPersonBusy), errors.Is(err, database.ErrDeliveryZoneMismatch):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			fmt.Println("SetOrderDeliveryPerson error:", err)
+			http.Error(w, "Failed to assign the delivery person", http.StatusInternalServerError)
+		}
 		return
 	}
 
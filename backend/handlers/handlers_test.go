@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	database "pizza_shop/backend/database"
+)
+
+// The fakes embed the store interfaces, calling a method they don't implement panics.
+
+type fakeUsers struct {
+	database.UserStore
+	sessions  map[string]database.Session
+	customers map[int]int // user ID to customer ID
+}
+
+func (f *fakeUsers) GetSession(token string) (database.Session, error) {
+	session, ok := f.sessions[token]
+	if !ok {
+		return database.Session{}, database.ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (f *fakeUsers) DeleteSession(token string) error {
+	delete(f.sessions, token)
+	return nil
+}
+
+func (f *fakeUsers) GetCustomerIDFromUserID(userID int) (int, error) {
+	customerID, ok := f.customers[userID]
+	if !ok {
+		return 0, database.ErrCustomerNotFound
+	}
+	return customerID, nil
+}
+
+type fakeOrders struct {
+	database.OrderStore
+	orders map[int]database.OrderDetails
+}
+
+func (f *fakeOrders) GetOrderDetails(orderID int) (*database.OrderDetails, error) {
+	details, ok := f.orders[orderID]
+	if !ok {
+		return nil, database.ErrOrderNotFound
+	}
+	return &details, nil
+}
+
+type fakeCarts struct {
+	database.CartStore
+	carts      map[int]int // customer ID to the number of lines in their cart
+	checkedOut []int
+}
+
+func (f *fakeCarts) CheckoutCart(customerID, userID int, deliveryAddress, postalCode string, discountCode *string) (int, error) {
+	if f.carts[customerID] == 0 {
+		return 0, database.ErrCartEmpty
+	}
+	f.carts[customerID] = 0
+	f.checkedOut = append(f.checkedOut, customerID)
+	return 100 + len(f.checkedOut), nil
+}
+
+// newTestHandler has two customers, alice (user 1, customer 11) and bob (user 2, customer 12), and an admin
+// (user 3), logged in with their names as the session token.
+func newTestHandler() (*Handler, *fakeCarts) {
+	users := &fakeUsers{
+		sessions: map[string]database.Session{
+			"alice": {UserID: 1, Username: "alice", Role: database.CustomerRole},
+			"bob":   {UserID: 2, Username: "bob", Role: database.CustomerRole},
+			"admin": {UserID: 3, Username: "admin", Role: database.AdminRole},
+		},
+		customers: map[int]int{1: 11, 2: 12},
+	}
+	orders := &fakeOrders{orders: map[int]database.OrderDetails{
+		7: {Order: database.Order{ID: 7, CustomerID: 11, Status: "PLACED"}},
+	}}
+	carts := &fakeCarts{carts: map[int]int{11: 2}}
+	return New(Deps{Users: users, Orders: orders, Carts: carts}), carts
+}
+
+// serve sends body to the handler behind RequireRoles(roles...) as the user logged in with token.
+func serve(t *testing.T, h *Handler, handler http.HandlerFunc, roles []database.UserRole, token, body string) (int, map[string]any) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	if token != "" {
+		r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	}
+	w := httptest.NewRecorder()
+	h.RequireRoles(roles...)(handler)(w, r)
+
+	var response map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("response %q is not JSON: %v", w.Body.String(), err)
+	}
+	return w.Code, response
+}
+
+func TestCreateOrderHandlerChecksOutTheCart(t *testing.T) {
+	h, carts := newTestHandler()
+	customer := []database.UserRole{database.CustomerRole}
+	order := `{"delivery_address": "Main St 1", "postal_code": "1234AB"}`
+
+	code, response := serve(t, h, h.CreateOrderHandler, customer, "alice", order)
+	if code != http.StatusOK || response["ok"] != true || response["order_id"] != float64(101) {
+		t.Errorf("checkout: %d %v, want order 101", code, response)
+	}
+	if len(carts.checkedOut) != 1 || carts.checkedOut[0] != 11 {
+		t.Errorf("checked out the carts of %v, want alice's (11)", carts.checkedOut)
+	}
+
+	code, response = serve(t, h, h.CreateOrderHandler, customer, "alice", order)
+	if response["ok"] != false || response["error"] != "Cart is empty" {
+		t.Errorf("second checkout: %d %v, want Cart is empty", code, response)
+	}
+
+	code, _ = serve(t, h, h.CreateOrderHandler, customer, "", order)
+	if code != http.StatusUnauthorized {
+		t.Errorf("checkout without a session: %d, want 401", code)
+	}
+	code, _ = serve(t, h, h.CreateOrderHandler, customer, "admin", order)
+	if code != http.StatusForbidden {
+		t.Errorf("checkout as admin: %d, want 403", code)
+	}
+}
+
+func TestGetOrderDetailsHandlerOnlyShowsOwnOrders(t *testing.T) {
+	h, _ := newTestHandler()
+	anyone := []database.UserRole{database.CustomerRole, database.AdminRole}
+
+	for _, tt := range []struct {
+		token string
+		want  int
+	}{
+		{"alice", http.StatusOK},
+		{"admin", http.StatusOK},
+		{"bob", http.StatusNotFound},
+	} {
+		code, response := serve(t, h, h.GetOrderDetailsHandler, anyone, tt.token, `{"order_id": 7}`)
+		if code != tt.want {
+			t.Errorf("%s: %d %v, want %d", tt.token, code, response, tt.want)
+		}
+	}
+
+	// Someone else's order and a missing one get the same answer
+	_, someoneElses := serve(t, h, h.GetOrderDetailsHandler, anyone, "bob", `{"order_id": 7}`)
+	code, missing := serve(t, h, h.GetOrderDetailsHandler, anyone, "bob", `{"order_id": 8}`)
+	if code != http.StatusNotFound || fmt.Sprint(missing) != fmt.Sprint(someoneElses) {
+		t.Errorf("missing order: %d %v, want 404 %v", code, missing, someoneElses)
+	}
+}
+
+func TestCartErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{database.ErrCartEmpty, http.StatusBadRequest},
+		{fmt.Errorf("checkout: %w", &database.DiscountRejectedError{Code: "SAVE10", Err: database.ErrDiscountCodeNotFound}), http.StatusBadRequest},
+		{&database.DeliveryRejectedError{PostalCode: "00000"}, http.StatusBadRequest},
+		{&database.OutOfStockError{Ingredients: []string{"Mozzarella"}}, http.StatusConflict},
+		{database.ErrNotOnMenu, http.StatusNotFound},
+		{errors.New("connection refused"), http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		if got := cartErrorCode(test.err); got != test.want {
+			t.Errorf("cartErrorCode(%v) = %d, want %d", test.err, got, test.want)
+		}
+	}
+}
+
+func TestLogoutHandlerOnlyEndsTheSessionOnPost(t *testing.T) {
+	h, _ := newTestHandler()
+	logout := func(method string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/logout", nil)
+		r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: "alice"})
+		w := httptest.NewRecorder()
+		h.LogoutHandler(w, r)
+		return w
+	}
+
+	// What an <img src="/logout"> on another site sends
+	w := logout(http.MethodGet)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Set-Cookie") != "" {
+		t.Errorf("GET: %d, cookie %q, want a redirect that keeps the session", w.Code, w.Header().Get("Set-Cookie"))
+	}
+	if _, err := h.Users.GetSession("alice"); err != nil {
+		t.Errorf("GET ended the session: %v", err)
+	}
+
+	w = logout(http.MethodPost)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"ok":true`) {
+		t.Errorf("POST: %d %s", w.Code, w.Body.String())
+	}
+	if _, err := h.Users.GetSession("alice"); err == nil {
+		t.Error("POST kept the session")
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	database "pizza_shop/backend/database"
+	"pizza_shop/backend/web"
+)
+
+func (h *Handler) KitchenHandler(w http.ResponseWriter, r *http.Request) {
+	html_string, err := os.ReadFile("frontend/kitchen.html")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintln(w, string(html_string))
+}
+
+// KitchenQueueHandler lists the orders still to be made, oldest first.
+func (h *Handler) KitchenQueueHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	queue, err := h.Kitchen.GetKitchenQueue()
+	if err != nil {
+		fmt.Println("GetKitchenQueue error:", err)
+		web.WriteJSONError(w, http.StatusInternalServerError, "Failed to load the kitchen queue")
+		return
+	}
+
+	type Msg struct {
+		Ok     bool                    `json:"ok"`
+		Orders []database.OrderDetails `json:"orders"`
+	}
+	json.NewEncoder(w).Encode(Msg{Ok: true, Orders: queue})
+}
+
+// KitchenUpdateItemHandler marks one pizza line of an order as started or finished.
+func (h *Handler) KitchenUpdateItemHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		OrderPizzaID int    `json:"order_pizza_id"`
+		Action       string `json:"action"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	actorID := requestSession(r).UserID
+	var err error
+	switch req.Action {
+	case "start":
+		err = h.Kitchen.StartOrderPizza(req.OrderPizzaID, actorID)
+	case "finish":
+		err = h.Kitchen.FinishOrderPizza(req.OrderPizzaID, actorID)
+	default:
+		web.WriteJSONError(w, http.StatusBadRequest, "Action must be 'start' or 'finish'")
+		return
+	}
+	if err != nil {
+		writeKitchenError(w, err)
+		return
+	}
+
+	type Msg struct {
+		Ok bool `json:"ok"`
+	}
+	json.NewEncoder(w).Encode(Msg{Ok: true})
+}
+
+// KitchenOrderReadyHandler hands an order without pizzas over to delivery.
+func (h *Handler) KitchenOrderReadyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		OrderID int `json:"order_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Kitchen.MarkOrderReady(req.OrderID, requestSession(r).UserID); err != nil {
+		writeKitchenError(w, err)
+		return
+	}
+
+	type Msg struct {
+		Ok bool `json:"ok"`
+	}
+	json.NewEncoder(w).Encode(Msg{Ok: true})
+}
+
+func writeKitchenError(w http.ResponseWriter, err error) {
+	var illegal *database.IllegalTransitionError
+	switch {
+	case errors.Is(err, database.ErrKitchenItemNotFound), errors.Is(err, database.ErrOrderNotFound):
+		web.WriteJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, database.ErrKitchenItemState), errors.Is(err, database.ErrPizzasNotBaked):
+		web.WriteJSONError(w, http.StatusConflict, err.Error())
+	case errors.As(err, &illegal):
+		web.WriteJSONError(w, http.StatusConflict, fmt.Sprintf("Order is %s, the kitchen can't work on it", illegal.From))
+	default:
+		fmt.Println("Kitchen update error:", err)
+		web.WriteJSONError(w, http.StatusInternalServerError, "Failed to update the order")
+	}
+}
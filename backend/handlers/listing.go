@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	database "pizza_shop/backend/database"
+	"pizza_shop/backend/web"
+	"strconv"
+	"strings"
+)
+
+// parseListOptions reads the page and sort of an admin list: ?limit= (default 50, at most 500), ?offset=,
+// ?sort= and ?order= (asc or desc).
+func parseListOptions(query url.Values) (database.ListOptions, error) {
+	opts := database.ListOptions{Limit: database.DefaultListLimit, Sort: query.Get("sort")}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > database.MaxListLimit {
+			return opts, fmt.Errorf("limit must be between 1 and %d", database.MaxListLimit)
+		}
+		opts.Limit = limit
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return opts, errors.New("offset must be 0 or more")
+		}
+		opts.Offset = offset
+	}
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		return opts, errors.New("order must be asc or desc")
+	}
+	return opts, nil
+}
+
+// optionalID reads an id filter, blank is 0.
+func optionalID(query url.Values, name string) (int, error) {
+	value := query.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid %s", name)
+	}
+	return id, nil
+}
+
+// optionalBool reads a yes/no filter, blank is nil.
+func optionalBool(query url.Values, name string) (*bool, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be true or false", name)
+	}
+	return &b, nil
+}
+
+// parseOrderFilter reads ?status=, ?from=, ?to=, ?customer_id=, ?customer= (part of the name),
+// ?delivery_person_id=, ?postal_code= (a prefix) and the list options.
+func parseOrderFilter(query url.Values) (database.OrderFilter, error) {
+	var filter database.OrderFilter
+	var err error
+	if filter.ListOptions, err = parseListOptions(query); err != nil {
+		return filter, err
+	}
+	if status := query.Get("status"); status != "" {
+		if filter.Status, err = database.ParseOrderStatus(status); err != nil {
+			return filter, fmt.Errorf("unknown status %q", status)
+		}
+	}
+	if filter.From, filter.To, err = web.ParseDateRange(query.Get("from"), query.Get("to")); err != nil {
+		return filter, err
+	}
+	if filter.CustomerID, err = optionalID(query, "customer_id"); err != nil {
+		return filter, err
+	}
+	if filter.DeliveryPersonID, err = optionalID(query, "delivery_person_id"); err != nil {
+		return filter, err
+	}
+	filter.Customer = strings.TrimSpace(query.Get("customer"))
+	filter.PostalCode = strings.TrimSpace(query.Get("postal_code"))
+	return filter, nil
+}
+
+// parseUserFilter reads ?role=, ?search= (part of the username or name), ?postal_code= (a prefix)
+// and the list options.
+func parseUserFilter(query url.Values) (database.UserFilter, error) {
+	var filter database.UserFilter
+	var err error
+	if filter.ListOptions, err = parseListOptions(query); err != nil {
+		return filter, err
+	}
+	if role := query.Get("role"); role != "" {
+		parsed, err := database.ParseUserRole(role)
+		if err != nil {
+			return filter, fmt.Errorf("unknown role %q", role)
+		}
+		filter.Role = parsed.String()
+	}
+	filter.Search = strings.TrimSpace(query.Get("search"))
+	filter.PostalCode = strings.TrimSpace(query.Get("postal_code"))
+	return filter, nil
+}
+
+// parseDeliveryPersonFilter reads ?search= (part of the username or name), ?vehicle_type=, ?zone_id=
+// and the list options.
+func parseDeliveryPersonFilter(query url.Values) (database.DeliveryPersonFilter, error) {
+	var filter database.DeliveryPersonFilter
+	var err error
+	if filter.ListOptions, err = parseListOptions(query); err != nil {
+		return filter, err
+	}
+	if filter.ZoneID, err = optionalID(query, "zone_id"); err != nil {
+		return filter, err
+	}
+	filter.Search = strings.TrimSpace(query.Get("search"))
+	filter.VehicleType = strings.TrimSpace(query.Get("vehicle_type"))
+	return filter, nil
+}
+
+// parseIngredientFilter reads ?search= (part of the name), ?has_meat=, ?has_animal_products=
+// and the list options.
+func parseIngredientFilter(query url.Values) (database.IngredientFilter, error) {
+	var filter database.IngredientFilter
+	var err error
+	if filter.ListOptions, err = parseListOptions(query); err != nil {
+		return filter, err
+	}
+	if filter.HasMeat, err = optionalBool(query, "has_meat"); err != nil {
+		return filter, err
+	}
+	if filter.HasAnimalProducts, err = optionalBool(query, "has_animal_products"); err != nil {
+		return filter, err
+	}
+	filter.Search = strings.TrimSpace(query.Get("search"))
+	return filter, nil
+}
+
+// listErrorsHTML shows why the admin panel couldn't filter a list as asked.
+func listErrorsHTML(messages []string) string {
+	html := ""
+	for _, msg := range messages {
+		html += fmt.Sprintf(`<p style="color:red;">%s</p>`, template.HTMLEscapeString(msg))
+	}
+	return html
+}
+
+func listErrorCode(err error) int {
+	if errors.Is(err, database.ErrInvalidSort) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// tabQuery is the query string of the admin panel for the tab it names with ?tab=, the other tabs
+// get none so a filter on one list doesn't narrow down the others.
+func tabQuery(r *http.Request, tab string) url.Values {
+	query := r.URL.Query()
+	if query.Get("tab") != tab {
+		return url.Values{}
+	}
+	return query
+}
+
+// pagerHTML shows which rows of a list the admin panel shows, with links to the pages around it.
+// The links keep the filters and sort in query and reopen the tab.
+func pagerHTML(tab string, query url.Values, opts database.ListOptions, shown, total int) string {
+	if total == 0 {
+		return "<p>Nothing found.</p>"
+	}
+	link := func(offset int, label string) string {
+		q := url.Values{}
+		for key, values := range query {
+			q[key] = values
+		}
+		q.Set("tab", tab)
+		q.Set("offset", strconv.Itoa(offset))
+		return fmt.Sprintf(`<a href="/admin?%s">%s</a>`, q.Encode(), label)
+	}
+	html := fmt.Sprintf("<p>Showing %d-%d of %d", opts.Offset+1, opts.Offset+shown, total)
+	if shown == 0 {
+		html = fmt.Sprintf("<p>No more rows, there are %d", total)
+	}
+	if opts.Offset > 0 {
+		html += " " + link(max(opts.Offset-opts.Limit, 0), "&laquo; Previous")
+	}
+	if opts.Offset+shown < total {
+		html += " " + link(opts.Offset+opts.Limit, "Next &raquo;")
+	}
+	return html + "</p>"
+}
+
+// listFilterForm opens the GET form that filters a list of the admin panel, the filter fields go between
+// it and listFilterFormEnd. sorts are the sort keys with their labels.
+func listFilterForm(tab string, query url.Values, sorts [][2]string) string {
+	return fmt.Sprintf(`<form method="GET" action="/admin"><input type="hidden" name="tab" value="%s">
+Sort by %s %s
+`, tab, filterSelect(query, "sort", "Default order", sorts),
+		filterSelect(query, "order", "Ascending", [][2]string{{"desc", "Descending"}}))
+}
+
+func listFilterFormEnd(tab string) string {
+	return fmt.Sprintf(`<input type="submit" value="Filter"> <a href="/admin?tab=%s">Clear</a></form>`, tab)
+}
+
+// filterInput is a text field of a filter form, filled in with the filter the list shows.
+func filterInput(query url.Values, name, inputType, placeholder string) string {
+	return fmt.Sprintf(`<input type="%s" name="%s" value="%s" placeholder="%s">`,
+		inputType, name, template.HTMLEscapeString(query.Get(name)), placeholder)
+}
+
+// filterSelect is a dropdown of a filter form, options are the values with their labels.
+func filterSelect(query url.Values, name, anyLabel string, options [][2]string) string {
+	html := fmt.Sprintf(`<select name="%s"><option value="">%s</option>`, name, anyLabel)
+	for _, o := range options {
+		selected := ""
+		if query.Get(name) == o[0] {
+			selected = "selected"
+		}
+		html += fmt.Sprintf(`<option value="%s" %s>%s</option>`, template.HTMLEscapeString(o[0]), selected, template.HTMLEscapeString(o[1]))
+	}
+	return html + "</select>"
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	database "pizza_shop/backend/database"
+	"pizza_shop/backend/web"
+)
+
+// LoyaltyHandler shows the customer how many pizzas are left until their next free one, and the free pizzas they have.
+// An earned free pizza is taken off the next order automatically.
+func (h *Handler) LoyaltyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	progress, err := h.Users.GetLoyaltyProgress(requestSession(r).UserID)
+	if err != nil {
+		if errors.Is(err, database.ErrCustomerNotFound) {
+			web.WriteJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		fmt.Println("GetLoyaltyProgress error:", err)
+		web.WriteJSONError(w, http.StatusInternalServerError, "Failed to load loyalty progress")
+		return
+	}
+
+	type Msg struct {
+		Ok      bool                     `json:"ok"`
+		Loyalty database.LoyaltyProgress `json:"loyalty"`
+	}
+	json.NewEncoder(w).Encode(Msg{Ok: true, Loyalty: progress})
+}
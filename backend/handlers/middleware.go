@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	database "pizza_shop/backend/database"
+	"pizza_shop/backend/web"
+	"slices"
+)
+
+type sessionContextKey struct{}
+
+// RequireRoles only lets requests through when the caller is logged in with one of the given roles.
+// The resolved session is stored in the request context, see requestSession.
+func (h *Handler) RequireRoles(roles ...database.UserRole) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			session, err := h.currentSession(r)
+			if err != nil {
+				web.WriteJSONError(w, http.StatusUnauthorized, "Not authenticated")
+				return
+			}
+			if !slices.Contains(roles, session.Role) {
+				web.WriteJSONError(w, http.StatusForbidden, "Not allowed for role "+session.Role.String())
+				return
+			}
+			ctx := context.WithValue(r.Context(), sessionContextKey{}, session)
+			next(w, r.WithContext(ctx))
+		}
+	}
+}
+
+// requestSession returns the session RequireRoles attached to the request.
+// Only call it from handlers that are registered behind RequireRoles.
+func requestSession(r *http.Request) database.Session {
+	session, ok := r.Context().Value(sessionContextKey{}).(database.Session)
+	if !ok {
+		panic("requestSession called on a route without RequireRoles")
+	}
+	return session
+}
+
+// canAccessOrder reports whether the caller may read an order. Admins see every order,
+// customers only their own and delivery persons only the ones assigned to them.
+func (h *Handler) canAccessOrder(session database.Session, order database.Order) (bool, error) {
+	switch session.Role {
+	case database.AdminRole:
+		return true, nil
+	case database.CustomerRole:
+		customerID, err := h.Users.GetCustomerIDFromUserID(session.UserID)
+		if err != nil {
+			return false, err
+		}
+		return order.CustomerID == customerID, nil
+	case database.DeliveryRole:
+		deliveryPersonID, err := h.Deliveries.GetDeliveryPersonIDFromUserID(session.UserID)
+		if err != nil {
+			return false, err
+		}
+		return order.DeliveryPersonID != nil && *order.DeliveryPersonID == deliveryPersonID, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	database "pizza_shop/backend/database"
+	"pizza_shop/backend/web"
+)
+
+// parseOrderHistoryFilter reads ?status=, ?from=, ?to= and the list options. The filters on other
+// customers, couriers and postal codes are left out, a customer only sees their own orders anyway.
+func parseOrderHistoryFilter(query url.Values) (database.OrderFilter, error) {
+	var filter database.OrderFilter
+	var err error
+	if filter.ListOptions, err = parseListOptions(query); err != nil {
+		return filter, err
+	}
+	if status := query.Get("status"); status != "" {
+		if filter.Status, err = database.ParseOrderStatus(status); err != nil {
+			return filter, fmt.Errorf("unknown status %q", status)
+		}
+	}
+	if filter.From, filter.To, err = web.ParseDateRange(query.Get("from"), query.Get("to")); err != nil {
+		return filter, err
+	}
+	if filter.Sort == "" {
+		// Newest first, the way a customer reads their history
+		filter.Sort, filter.Desc = "timestamp", true
+	}
+	return filter, nil
+}
+
+// OrderHistoryHandler returns a page of the customer's orders with their lines, totals and status
+// timeline, see parseOrderHistoryFilter for the query parameters.
+func (h *Handler) OrderHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	customerID, err := h.Users.GetCustomerIDFromUserID(requestSession(r).UserID)
+	if err != nil {
+		web.WriteJSONError(w, http.StatusForbidden, "Customer not found")
+		return
+	}
+	filter, err := parseOrderHistoryFilter(r.URL.Query())
+	if err != nil {
+		web.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	orders, total, err := h.Orders.GetOrderHistory(customerID, filter)
+	if err != nil {
+		code := listErrorCode(err)
+		errorMsg := "Failed to get orders"
+		if code != http.StatusInternalServerError {
+			errorMsg = err.Error()
+		} else {
+			fmt.Println("GetOrderHistory error:", err)
+		}
+		web.WriteJSONError(w, code, errorMsg)
+		return
+	}
+
+	type Msg struct {
+		Ok     bool                    `json:"ok"`
+		Orders []database.OrderDetails `json:"orders"`
+		Total  int                     `json:"total"`
+		Limit  int                     `json:"limit"`
+		Offset int                     `json:"offset"`
+	}
+	json.NewEncoder(w).Encode(Msg{Ok: true, Orders: orders, Total: total, Limit: filter.Limit, Offset: filter.Offset})
+}
+
+// ReorderHandler adds one of the customer's past orders to their cart at today's prices, and tells
+// what changed since. Nothing is ordered yet.
+func (h *Handler) ReorderHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		OrderID int `json:"order_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	customerID, err := h.Users.GetCustomerIDFromUserID(requestSession(r).UserID)
+	if err != nil {
+		web.WriteJSONError(w, http.StatusForbidden, "Customer not found")
+		return
+	}
+
+	reorder, err := h.Orders.ReorderIntoCart(req.OrderID, customerID)
+	if err != nil {
+		if errors.Is(err, database.ErrOrderNotFound) {
+			web.WriteJSONError(w, http.StatusNotFound, "Order not found")
+			return
+		}
+		fmt.Println("ReorderIntoCart error:", err)
+		web.WriteJSONError(w, http.StatusInternalServerError, "Failed to rebuild the order")
+		return
+	}
+
+	type Msg struct {
+		Ok bool `json:"ok"`
+		database.Reorder
+	}
+	json.NewEncoder(w).Encode(Msg{Ok: true, Reorder: reorder})
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	database "pizza_shop/backend/database"
+	"pizza_shop/backend/web"
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// PizzaOptionsHandler lists the sizes and crusts pizzas come in.
+func (h *Handler) PizzaOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sizes, err := h.Pizzas.GetPizzaOptions(database.SizeOption)
+	if err != nil {
+		fmt.Println("GetPizzaOptions error:", err)
+		web.WriteJSONError(w, http.StatusInternalServerError, "Failed to load sizes")
+		return
+	}
+	crusts, err := h.Pizzas.GetPizzaOptions(database.CrustOption)
+	if err != nil {
+		fmt.Println("GetPizzaOptions error:", err)
+		web.WriteJSONError(w, http.StatusInternalServerError, "Failed to load crusts")
+		return
+	}
+
+	type Msg struct {
+		Ok     bool                   `json:"ok"`
+		Sizes  []database.PizzaOption `json:"sizes"`
+		Crusts []database.PizzaOption `json:"crusts"`
+	}
+	json.NewEncoder(w).Encode(Msg{Ok: true, Sizes: sizes, Crusts: crusts})
+}
+
+// AdminSavePizzaOptionHandler creates a size or crust, or updates it when an id is given.
+func (h *Handler) AdminSavePizzaOptionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Kind                 string          `json:"kind"`
+		ID                   int             `json:"id"`
+		Name                 string          `json:"name"`
+		DoughCost            decimal.Decimal `json:"dough_cost"`
+		IngredientMultiplier decimal.Decimal `json:"ingredient_multiplier"`
+		IsDefault            bool            `json:"is_default"`
+		SortOrder            int             `json:"sort_order"`
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	isForm := strings.Contains(contentType, "application/x-www-form-urlencoded")
+	if isForm {
+		// Form submission
+		r.ParseForm()
+		var err error
+		req.Kind = r.FormValue("kind")
+		if id := r.FormValue("id"); id != "" {
+			if req.ID, err = strconv.Atoi(id); err != nil {
+				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				return
+			}
+		}
+		req.Name = r.FormValue("name")
+		if req.DoughCost, err = decimal.NewFromString(r.FormValue("dough_cost")); err != nil {
+			http.Error(w, "Invalid dough cost", http.StatusBadRequest)
+			return
+		}
+		if req.IngredientMultiplier, err = decimal.NewFromString(r.FormValue("ingredient_multiplier")); err != nil {
+			http.Error(w, "Invalid ingredient multiplier", http.StatusBadRequest)
+			return
+		}
+		req.IsDefault = r.FormValue("is_default") == "on"
+		fmt.Sscanf(r.FormValue("sort_order"), "%d", &req.SortOrder)
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	kind, err := database.ParsePizzaOptionKind(req.Kind)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opt := database.PizzaOption{
+		Name:                 strings.TrimSpace(req.Name),
+		DoughCost:            req.DoughCost,
+		IngredientMultiplier: req.IngredientMultiplier,
+		IsDefault:            req.IsDefault,
+		SortOrder:            req.SortOrder,
+	}
+
+	id := req.ID
+	if id == 0 {
+		id, err = h.Pizzas.CreatePizzaOption(kind, opt)
+	} else {
+		err = h.Pizzas.UpdatePizzaOption(kind, id, opt)
+	}
+	if err != nil {
+		code := pizzaOptionErrorCode(err)
+		errorMsg := "Failed to save " + string(kind)
+		if code != http.StatusInternalServerError {
+			errorMsg = err.Error()
+		} else {
+			fmt.Println("Save pizza option error:", err)
+		}
+		if isForm {
+			http.Error(w, errorMsg, code)
+		} else {
+			web.WriteJSONError(w, code, errorMsg)
+		}
+		return
+	}
+
+	if isForm {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+	type Msg struct {
+		Ok bool `json:"ok"`
+		ID int  `json:"id"`
+	}
+	json.NewEncoder(w).Encode(Msg{Ok: true, ID: id})
+}
+
+// AdminDeletePizzaOptionHandler removes a size or crust that has never been ordered.
+func (h *Handler) AdminDeletePizzaOptionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.ParseForm()
+	kind, err := database.ParsePizzaOptionKind(r.FormValue("kind"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Pizzas.DeletePizzaOption(kind, id); err != nil {
+		if errors.Is(err, database.ErrPizzaOptionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		// Most likely it is on an order already
+		http.Error(w, "Failed to delete "+string(kind)+", it can't be removed once it has been ordered", http.StatusConflict)
+		return
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func pizzaOptionErrorCode(err error) int {
+	switch {
+	case errors.Is(err, database.ErrPizzaOptionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrInvalidPizzaOption):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// hasPizzaOption reports whether id is one of the options, 0 always is (the default).
+func hasPizzaOption(options []database.PizzaOption, id int) bool {
+	if id == 0 {
+		return true
+	}
+	for _, opt := range options {
+		if opt.ID == id {
+			return true
+		}
+	}
+	return false
+}
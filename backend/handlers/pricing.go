@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	database "pizza_shop/backend/database"
+	"pizza_shop/backend/web"
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// AdminPricingHandler returns the current pricing rules and the latest changes to them.
+func (h *Handler) AdminPricingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cfg, err := h.Pricing.GetPricingConfig()
+	if err != nil {
+		fmt.Println("GetPricingConfig error:", err)
+		web.WriteJSONError(w, http.StatusInternalServerError, "Failed to load pricing config")
+		return
+	}
+	history, err := h.Pricing.GetPricingConfigHistory(50)
+	if err != nil {
+		fmt.Println("GetPricingConfigHistory error:", err)
+		web.WriteJSONError(w, http.StatusInternalServerError, "Failed to load pricing history")
+		return
+	}
+
+	type Msg struct {
+		Ok      bool                           `json:"ok"`
+		Config  database.PricingConfig         `json:"config"`
+		History []database.PricingConfigChange `json:"history"`
+	}
+	json.NewEncoder(w).Encode(Msg{Ok: true, Config: cfg, History: history})
+}
+
+// AdminUpdatePricingHandler replaces the margin, VAT rates, rounding mode and loyalty threshold. Rates are fractions, 0.09 is 9%.
+func (h *Handler) AdminUpdatePricingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		PizzaMarginRate        decimal.Decimal       `json:"pizza_margin_rate"`
+		PizzaVATRate           decimal.Decimal       `json:"pizza_vat_rate"`
+		DessertVATRate         decimal.Decimal       `json:"dessert_vat_rate"`
+		DrinkVATRate           decimal.Decimal       `json:"drink_vat_rate"`
+		RoundingMode           database.RoundingMode `json:"rounding_mode"`
+		LoyaltyPizzasPerReward int                   `json:"loyalty_pizzas_per_reward"`
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	isForm := strings.Contains(contentType, "application/x-www-form-urlencoded")
+	if isForm {
+		// Form submission
+		r.ParseForm()
+		for _, field := range []struct {
+			name string
+			dest *decimal.Decimal
+		}{
+			{"pizza_margin_rate", &req.PizzaMarginRate},
+			{"pizza_vat_rate", &req.PizzaVATRate},
+			{"dessert_vat_rate", &req.DessertVATRate},
+			{"drink_vat_rate", &req.DrinkVATRate},
+		} {
+			value, err := decimal.NewFromString(r.FormValue(field.name))
+			if err != nil {
+				http.Error(w, "Invalid "+strings.ReplaceAll(field.name, "_", " "), http.StatusBadRequest)
+				return
+			}
+			*field.dest = value
+		}
+		req.RoundingMode = database.RoundingMode(r.FormValue("rounding_mode"))
+		var err error
+		if req.LoyaltyPizzasPerReward, err = strconv.Atoi(r.FormValue("loyalty_pizzas_per_reward")); err != nil {
+			http.Error(w, "Invalid pizzas per loyalty reward", http.StatusBadRequest)
+			return
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	cfg := database.PricingConfig{
+		PizzaMarginRate:        req.PizzaMarginRate,
+		PizzaVATRate:           req.PizzaVATRate,
+		DessertVATRate:         req.DessertVATRate,
+		DrinkVATRate:           req.DrinkVATRate,
+		RoundingMode:           req.RoundingMode,
+		LoyaltyPizzasPerReward: req.LoyaltyPizzasPerReward,
+	}
+	if err := h.Pricing.UpdatePricingConfig(cfg, requestSession(r).UserID); err != nil {
+		code := pricingErrorCode(err)
+		errorMsg := "Failed to update pricing"
+		if code != http.StatusInternalServerError {
+			errorMsg = err.Error()
+		} else {
+			fmt.Println("UpdatePricingConfig error:", err)
+		}
+		if isForm {
+			http.Error(w, errorMsg, code)
+		} else {
+			web.WriteJSONError(w, code, errorMsg)
+		}
+		return
+	}
+
+	if isForm {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+	type Msg struct {
+		Ok bool `json:"ok"`
+	}
+	json.NewEncoder(w).Encode(Msg{Ok: true})
+}
+
+func pricingErrorCode(err error) int {
+	if errors.Is(err, database.ErrInvalidPricingConfig) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	database "pizza_shop/backend/database"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parsePromotionForm reads the admin promotion form. It has one field per kind of condition and effect,
+// a blank field leaves that one out.
+func parsePromotionForm(r *http.Request) (database.Promotion, error) {
+	r.ParseForm()
+	p := database.Promotion{
+		Name:        strings.TrimSpace(r.FormValue("name")),
+		Description: strings.TrimSpace(r.FormValue("description")),
+		IsActive:    r.FormValue("is_active") == "on",
+	}
+	if value := r.FormValue("discount_code_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return p, fmt.Errorf("invalid discount code")
+		}
+		p.DiscountCodeID = &id
+	}
+
+	if r.FormValue("cond_birthday") == "on" {
+		p.Conditions = append(p.Conditions, database.PromotionCondition{Kind: database.BirthdayCondition})
+	}
+	if value := r.FormValue("cond_day_of_week"); value != "" {
+		day, err := strconv.Atoi(value)
+		if err != nil {
+			return p, fmt.Errorf("invalid day of week")
+		}
+		p.Conditions = append(p.Conditions, database.PromotionCondition{Kind: database.DayOfWeekCondition, DayOfWeek: &day})
+	}
+	if category := r.FormValue("cond_cart_category"); category != "" {
+		quantity, err := strconv.Atoi(r.FormValue("cond_cart_quantity"))
+		if err != nil {
+			return p, fmt.Errorf("invalid cart quantity")
+		}
+		p.Conditions = append(p.Conditions, database.PromotionCondition{Kind: database.CartContainsCondition, Category: category, Quantity: quantity})
+	}
+
+	if category := r.FormValue("effect_free_cheapest"); category != "" {
+		p.Effects = append(p.Effects, database.PromotionEffect{Kind: database.FreeCheapestEffect, Category: category})
+	}
+	// "category:drink" for the cheapest drink, "item:6" for extra item 6
+	if value := r.FormValue("effect_free_item"); value != "" {
+		effect := database.PromotionEffect{Kind: database.AddFreeItemEffect}
+		if id, ok := strings.CutPrefix(value, "item:"); ok {
+			extraItemID, err := strconv.Atoi(id)
+			if err != nil {
+				return p, fmt.Errorf("invalid free item")
+			}
+			effect.ExtraItemID = &extraItemID
+		} else {
+			effect.Category = strings.TrimPrefix(value, "category:")
+		}
+		p.Effects = append(p.Effects, effect)
+	}
+	if value := r.FormValue("effect_percent_off"); value != "" {
+		percentage, err := strconv.Atoi(value)
+		if err != nil {
+			return p, fmt.Errorf("invalid percentage")
+		}
+		p.Effects = append(p.Effects, database.PromotionEffect{Kind: database.PercentOffEffect, Category: r.FormValue("effect_percent_category"), Percentage: percentage})
+	}
+	return p, nil
+}
+
+func (h *Handler) AdminCreatePromotionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	p, err := parsePromotionForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := h.Promotions.CreatePromotion(p); err != nil {
+		code := promotionErrorCode(err)
+		if code == http.StatusInternalServerError {
+			fmt.Println("CreatePromotion error:", err)
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// AdminSetPromotionActiveHandler switches a promotion on or off.
+func (h *Handler) AdminSetPromotionActiveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.ParseForm()
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "ID required", http.StatusBadRequest)
+		return
+	}
+	if err := h.Promotions.SetPromotionActive(id, r.FormValue("is_active") == "true"); err != nil {
+		http.Error(w, err.Error(), promotionErrorCode(err))
+		return
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func (h *Handler) AdminDeletePromotionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.ParseForm()
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "ID required", http.StatusBadRequest)
+		return
+	}
+	if err := h.Promotions.DeletePromotion(id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// codePromotion finds the active promotion a discount code gives, nil if it gives its own discount.
+func (h *Handler) codePromotion(discountCodeID int) (*database.Promotion, error) {
+	promotions, err := h.Promotions.GetAllPromotions()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range promotions {
+		if p.IsActive && p.DiscountCodeID != nil && *p.DiscountCodeID == discountCodeID {
+			return &p, nil
+		}
+	}
+	return nil, nil
+}
+
+// birthdayPromotion finds the active birthday deal customers get with a code, nil if there is none.
+func (h *Handler) birthdayPromotion() (*database.Promotion, error) {
+	promotions, err := h.Promotions.GetAllPromotions()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range promotions {
+		if p.IsActive && p.DiscountCode != nil && p.HasCondition(database.BirthdayCondition) {
+			return &p, nil
+		}
+	}
+	return nil, nil
+}
+
+// promotionMessage is what customers are told a promotion gives, its description or else its effects.
+func promotionMessage(p database.Promotion) string {
+	if p.Description != "" {
+		return p.Description
+	}
+	effects := make([]string, len(p.Effects))
+	for i, e := range p.Effects {
+		effects[i] = describeEffect(e, nil)
+	}
+	return p.Name + ": " + strings.Join(effects, ", ")
+}
+
+func promotionErrorCode(err error) int {
+	switch {
+	case errors.Is(err, database.ErrInvalidPromotion):
+		return http.StatusBadRequest
+	case errors.Is(err, database.ErrPromotionNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// categoryPlural is a promotion category as it reads in a sentence, "" is any item.
+func categoryPlural(category string) string {
+	if category == "" {
+		return "items"
+	}
+	return category + "s"
+}
+
+// describeCondition is a condition as the customer reads it, e.g. "on Tuesdays".
+func describeCondition(c database.PromotionCondition) string {
+	switch c.Kind {
+	case database.BirthdayCondition:
+		return "on your birthday"
+	case database.DayOfWeekCondition:
+		if c.DayOfWeek == nil {
+			return "on some days"
+		}
+		return "on " + time.Weekday(*c.DayOfWeek).String() + "s"
+	case database.CartContainsCondition:
+		return fmt.Sprintf("with at least %d %s in the cart", c.Quantity, categoryPlural(c.Category))
+	default:
+		return string(c.Kind)
+	}
+}
+
+func describeEffect(e database.PromotionEffect, extraItems []database.ExtraItem) string {
+	switch e.Kind {
+	case database.FreeCheapestEffect:
+		return "cheapest " + e.Category + " free"
+	case database.AddFreeItemEffect:
+		if e.ExtraItemID != nil {
+			for _, item := range extraItems {
+				if item.ID == *e.ExtraItemID {
+					return "free " + item.Name
+				}
+			}
+			return fmt.Sprintf("free extra item %d", *e.ExtraItemID)
+		}
+		return "free " + e.Category
+	case database.PercentOffEffect:
+		if e.Category == "" {
+			return fmt.Sprintf("%d%% off", e.Percentage)
+		}
+		return fmt.Sprintf("%d%% off %s", e.Percentage, categoryPlural(e.Category))
+	default:
+		return string(e.Kind)
+	}
+}
+
+// promotionFormFields renders the rows of the admin form to create a promotion.
+func promotionFormFields(discountCodes []database.DiscountCode, extraItems []database.ExtraItem) string {
+	codeOptions := `<option value="">None, applies by itself</option>`
+	for _, dc := range discountCodes {
+		codeOptions += fmt.Sprintf(`<option value="%d">%s</option>`, dc.ID, dc.Code)
+	}
+	dayOptions := `<option value="">Any day</option>`
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		dayOptions += fmt.Sprintf(`<option value="%d">%s</option>`, day, day)
+	}
+	categoryOptions := ""
+	for _, category := range database.PromotionCategories {
+		categoryOptions += fmt.Sprintf(`<option value="%s">%s</option>`, category, categoryPlural(category))
+	}
+	freeItemOptions := `<option value="">None</option><option value="category:drink">Cheapest drink</option><option value="category:dessert">Cheapest dessert</option>`
+	for _, item := range extraItems {
+		freeItemOptions += fmt.Sprintf(`<option value="item:%d">%s</option>`, item.ID, item.Name)
+	}
+
+	return fmt.Sprintf(`<tr><td><b>Name:</b></td><td><input type="text" name="name" required></td></tr>
+<tr><td><b>Message:</b></td><td><input type="text" name="description" size="50"> (shown to customers)</td></tr>
+<tr><td><b>Code:</b></td><td><select name="discount_code_id">%s</select> (replaces the code's own discount)</td></tr>
+<tr><td colspan="2"><b>Conditions</b> (all must hold)</td></tr>
+<tr><td>Customer's birthday:</td><td><input type="checkbox" name="cond_birthday"></td></tr>
+<tr><td>Day of week:</td><td><select name="cond_day_of_week">%s</select></td></tr>
+<tr><td>Cart contains at least:</td><td><input type="number" name="cond_cart_quantity" min="1" value="1" style="width:60px;">
+<select name="cond_cart_category"><option value="">-</option>%s</select></td></tr>
+<tr><td colspan="2"><b>Effects</b></td></tr>
+<tr><td>Cheapest item free:</td><td><select name="effect_free_cheapest"><option value="">None</option>%s</select></td></tr>
+<tr><td>Add a free item:</td><td><select name="effect_free_item">%s</select></td></tr>
+<tr><td>Percent off:</td><td><input type="number" name="effect_percent_off" min="1" max="100" style="width:60px;">
+<select name="effect_percent_category"><option value="">whole order</option>%s</select></td></tr>
+<tr><td><b>Active:</b></td><td><input type="checkbox" name="is_active" checked></td></tr>`,
+		codeOptions, dayOptions, categoryOptions, categoryOptions, freeItemOptions, categoryOptions)
+}
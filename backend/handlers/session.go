@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	database "pizza_shop/backend/database"
+	"strings"
+)
+
+const sessionCookieName = "session"
+
+// currentSession resolves the session cookie to the logged in user and their role.
+func (h *Handler) currentSession(r *http.Request) (database.Session, error) {
+	if session, ok := r.Context().Value(sessionContextKey{}).(database.Session); ok {
+		return session, nil
+	}
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return database.Session{}, database.ErrSessionNotFound
+	}
+	return h.Users.GetSession(cookie.Value)
+}
+
+func setSessionCookie(w http.ResponseWriter, session database.Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    session.Token,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// SessionHandler tells the frontend who is logged in, so pages don't have to keep credentials around.
+func (h *Handler) SessionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	session, err := h.currentSession(r)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok": false,
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":       true,
+		"username": session.Username,
+		"role":     session.Role.String(),
+		"isAdmin":  session.Role == database.AdminRole,
+	})
+}
+
+// LogoutHandler ends the session. Only a POST does, so another site can't log the user out with a link or an
+// image, a GET just goes to the login page. The pages log out with a form, scripts get JSON back.
+func (h *Handler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		h.Users.DeleteSession(cookie.Value)
+	}
+	clearSessionCookie(w)
+
+	if strings.Contains(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		http.Redirect(w, r, "/login?logout=1", http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok": true,
+	})
+}
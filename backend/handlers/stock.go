@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	database "pizza_shop/backend/database"
+	"pizza_shop/backend/web"
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// AdminStockHandler lists the stock of every ingredient, ?low=1 only the ones at or below their threshold.
+func (h *Handler) AdminStockHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	onlyLow := r.URL.Query().Get("low") == "1"
+	levels, err := h.Ingredients.GetStockLevels(onlyLow)
+	if err != nil {
+		fmt.Println("GetStockLevels error:", err)
+		web.WriteJSONError(w, http.StatusInternalServerError, "Failed to load stock levels")
+		return
+	}
+
+	type Msg struct {
+		Ok    bool                  `json:"ok"`
+		Stock []database.StockLevel `json:"stock"`
+	}
+	json.NewEncoder(w).Encode(Msg{Ok: true, Stock: levels})
+}
+
+// AdminRestockIngredientHandler adds a delivery to an ingredient's stock.
+func (h *Handler) AdminRestockIngredientHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if strings.Contains(contentType, "application/x-www-form-urlencoded") {
+		// Form submission
+		r.ParseForm()
+		ingredientID, err := strconv.Atoi(r.FormValue("ingredient_id"))
+		if err != nil {
+			http.Error(w, "Invalid ingredient ID", http.StatusBadRequest)
+			return
+		}
+		amount, err := decimal.NewFromString(r.FormValue("amount"))
+		if err != nil {
+			http.Error(w, "Invalid amount", http.StatusBadRequest)
+			return
+		}
+		if err := h.Ingredients.RestockIngredient(ingredientID, amount); err != nil {
+			http.Error(w, err.Error(), stockErrorCode(err))
+			return
+		}
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	// JSON API
+	var req struct {
+		IngredientID int             `json:"ingredient_id"`
+		Amount       decimal.Decimal `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := h.Ingredients.RestockIngredient(req.IngredientID, req.Amount); err != nil {
+		writeStockError(w, err)
+		return
+	}
+
+	type Msg struct {
+		Ok bool `json:"ok"`
+	}
+	json.NewEncoder(w).Encode(Msg{Ok: true})
+}
+
+// AdminStockSettingsHandler sets the unit, low-stock threshold and added-topping portion of an ingredient.
+func (h *Handler) AdminStockSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if strings.Contains(contentType, "application/x-www-form-urlencoded") {
+		// Form submission
+		r.ParseForm()
+		ingredientID, err := strconv.Atoi(r.FormValue("ingredient_id"))
+		if err != nil {
+			http.Error(w, "Invalid ingredient ID", http.StatusBadRequest)
+			return
+		}
+		threshold, err := decimal.NewFromString(r.FormValue("low_stock_threshold"))
+		if err != nil {
+			http.Error(w, "Invalid threshold", http.StatusBadRequest)
+			return
+		}
+		portion, err := decimal.NewFromString(r.FormValue("portion"))
+		if err != nil {
+			http.Error(w, "Invalid portion", http.StatusBadRequest)
+			return
+		}
+		err = h.Ingredients.UpdateStockSettings(ingredientID, strings.TrimSpace(r.FormValue("unit")), threshold, portion)
+		if err != nil {
+			http.Error(w, err.Error(), stockErrorCode(err))
+			return
+		}
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	// JSON API
+	var req struct {
+		IngredientID      int             `json:"ingredient_id"`
+		Unit              string          `json:"unit"`
+		LowStockThreshold decimal.Decimal `json:"low_stock_threshold"`
+		Portion           decimal.Decimal `json:"portion"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	err := h.Ingredients.UpdateStockSettings(req.IngredientID, strings.TrimSpace(req.Unit), req.LowStockThreshold, req.Portion)
+	if err != nil {
+		writeStockError(w, err)
+		return
+	}
+
+	type Msg struct {
+		Ok bool `json:"ok"`
+	}
+	json.NewEncoder(w).Encode(Msg{Ok: true})
+}
+
+// AdminPizzaIngredientAmountHandler sets how much of an ingredient one pizza uses.
+func (h *Handler) AdminPizzaIngredientAmountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		PizzaID      int             `json:"pizza_id"`
+		IngredientID int             `json:"ingredient_id"`
+		Amount       decimal.Decimal `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := h.Ingredients.SetPizzaIngredientAmount(req.PizzaID, req.IngredientID, req.Amount); err != nil {
+		writeStockError(w, err)
+		return
+	}
+
+	type Msg struct {
+		Ok bool `json:"ok"`
+	}
+	json.NewEncoder(w).Encode(Msg{Ok: true})
+}
+
+func stockErrorCode(err error) int {
+	switch {
+	case errors.Is(err, database.ErrIngredientNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrInvalidStockAmount):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeStockError(w http.ResponseWriter, err error) {
+	code := stockErrorCode(err)
+	if code == http.StatusInternalServerError {
+		fmt.Println("Stock update error:", err)
+		web.WriteJSONError(w, code, "Failed to update stock")
+		return
+	}
+	web.WriteJSONError(w, code, err.Error())
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	database "pizza_shop/backend/database"
+	"pizza_shop/backend/web"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AdminCreateVoucherCampaignHandler generates a batch of single-use voucher codes, from the admin form or as JSON.
+func (h *Handler) AdminCreateVoucherCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Name               string     `json:"name"`
+		Prefix             string     `json:"prefix"`
+		Count              int        `json:"count"`
+		DiscountPercentage int        `json:"discount_percentage"`
+		ValidUntil         *time.Time `json:"valid_until"`
+	}
+
+	isForm := strings.Contains(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded")
+	if isForm {
+		// Form submission
+		r.ParseForm()
+		req.Name = r.FormValue("name")
+		req.Prefix = r.FormValue("prefix")
+		var err error
+		if req.Count, err = strconv.Atoi(r.FormValue("count")); err != nil {
+			http.Error(w, "Invalid number of codes", http.StatusBadRequest)
+			return
+		}
+		if req.DiscountPercentage, err = strconv.Atoi(r.FormValue("percentage")); err != nil {
+			http.Error(w, "Invalid percentage", http.StatusBadRequest)
+			return
+		}
+		if value := r.FormValue("valid_until"); value != "" {
+			t, err := time.ParseInLocation(datetimeLocalLayout, value, time.Local)
+			if err != nil {
+				http.Error(w, "Invalid expiry", http.StatusBadRequest)
+				return
+			}
+			req.ValidUntil = &t
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.WriteJSONError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	campaign := database.VoucherCampaign{
+		Name:               req.Name,
+		Prefix:             req.Prefix,
+		DiscountPercentage: req.DiscountPercentage,
+		ValidUntil:         req.ValidUntil,
+	}
+	id, err := h.Vouchers.CreateVoucherCampaign(campaign, req.Count, requestSession(r).UserID)
+	if err != nil {
+		code := voucherErrorCode(err)
+		errorMsg := "Failed to generate vouchers"
+		if code != http.StatusInternalServerError {
+			errorMsg = err.Error()
+		} else {
+			fmt.Println("CreateVoucherCampaign error:", err)
+		}
+		if isForm {
+			http.Error(w, errorMsg, code)
+		} else {
+			web.WriteJSONError(w, code, errorMsg)
+		}
+		return
+	}
+
+	if isForm {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+	type Msg struct {
+		Ok         bool `json:"ok"`
+		CampaignID int  `json:"campaign_id"`
+	}
+	json.NewEncoder(w).Encode(Msg{Ok: true, CampaignID: id})
+}
+
+// AdminVoucherStatsHandler returns the redemption statistics of every campaign, or of the one in ?campaign_id=.
+func (h *Handler) AdminVoucherStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var campaigns []database.VoucherCampaign
+	if value := r.URL.Query().Get("campaign_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			web.WriteJSONError(w, http.StatusBadRequest, "Invalid campaign_id")
+			return
+		}
+		campaign, err := h.Vouchers.GetVoucherCampaign(id)
+		if err != nil {
+			code := voucherErrorCode(err)
+			if code == http.StatusInternalServerError {
+				fmt.Println("GetVoucherCampaign error:", err)
+			}
+			web.WriteJSONError(w, code, "Failed to load voucher campaign")
+			return
+		}
+		campaigns = append(campaigns, campaign)
+	} else {
+		var err error
+		if campaigns, err = h.Vouchers.GetVoucherCampaigns(); err != nil {
+			fmt.Println("GetVoucherCampaigns error:", err)
+			web.WriteJSONError(w, http.StatusInternalServerError, "Failed to load voucher campaigns")
+			return
+		}
+	}
+
+	type CampaignStats struct {
+		database.VoucherCampaign
+		RedemptionRate float64 `json:"redemption_rate"`
+	}
+	type Msg struct {
+		Ok        bool            `json:"ok"`
+		Campaigns []CampaignStats `json:"campaigns"`
+	}
+	msg := Msg{Ok: true, Campaigns: make([]CampaignStats, len(campaigns))}
+	for i, c := range campaigns {
+		msg.Campaigns[i] = CampaignStats{VoucherCampaign: c, RedemptionRate: c.RedemptionRate()}
+	}
+	json.NewEncoder(w).Encode(msg)
+}
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// AdminExportVouchersHandler downloads the codes of a campaign as CSV, with the order that redeemed each one.
+func (h *Handler) AdminExportVouchersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("campaign_id"))
+	if err != nil {
+		http.Error(w, "campaign_id required", http.StatusBadRequest)
+		return
+	}
+	campaign, err := h.Vouchers.GetVoucherCampaign(id)
+	if err != nil {
+		http.Error(w, err.Error(), voucherErrorCode(err))
+		return
+	}
+	vouchers, err := h.Vouchers.GetVoucherCodes(id)
+	if err != nil {
+		fmt.Println("GetVoucherCodes error:", err)
+		http.Error(w, "Failed to load vouchers", http.StatusInternalServerError)
+		return
+	}
+
+	validUntil := ""
+	if campaign.ValidUntil != nil {
+		validUntil = campaign.ValidUntil.Format(time.RFC3339)
+	}
+	filename := strings.Trim(unsafeFilenameChars.ReplaceAllString(campaign.Name, "_"), "_")
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="vouchers-%d-%s.csv"`, campaign.ID, filename))
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"code", "discount_percentage", "valid_until", "redeemed_at", "order_id", "username"})
+	for _, v := range vouchers {
+		redeemedAt, orderID, username := "", "", ""
+		if v.RedeemedAt != nil {
+			redeemedAt = v.RedeemedAt.Format(time.RFC3339)
+		}
+		if v.OrderID != nil {
+			orderID = strconv.Itoa(*v.OrderID)
+		}
+		if v.Username != nil {
+			username = *v.Username
+		}
+		out.Write([]string{v.Code, strconv.Itoa(campaign.DiscountPercentage), validUntil, redeemedAt, orderID, username})
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		fmt.Println("Export vouchers error:", err)
+	}
+}
+
+func voucherErrorCode(err error) int {
+	switch {
+	case errors.Is(err, database.ErrInvalidVoucherCampaign):
+		return http.StatusBadRequest
+	case errors.Is(err, database.ErrVoucherCampaignExists):
+		return http.StatusConflict
+	case errors.Is(err, database.ErrVoucherCampaignNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
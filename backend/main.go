@@ -1,35 +1,101 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"net/http"
+	"os"
 	database "pizza_shop/backend/database"
+	"pizza_shop/backend/dispatch"
 	"pizza_shop/backend/handlers"
+	"pizza_shop/backend/reports"
+	"strconv"
+	"time"
 )
 
 const PORT = "8080"
 
 func main() {
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1:])
+		return
+	}
+
 	database.Init()
 	defer database.Close()
 
-	http.HandleFunc("/", handlers.IndexHandler)
-	http.HandleFunc("/login", handlers.LoginHandler)
-	http.HandleFunc("/register", handlers.RegisterHandler)
-	http.HandleFunc("/pizza", handlers.PizzaHandler)
-	http.HandleFunc("/home", handlers.HomeHandler)
-	http.HandleFunc("/menu", handlers.MenuHandler)
-	http.HandleFunc("/account", handlers.AccountHandler)
-	http.HandleFunc("/getAccountDetails", handlers.GetAccountDetailsHandler)
-
-	http.HandleFunc("/admin", handlers.AdminHandler)
-	http.HandleFunc("/admin/ingredient/create", handlers.AdminCreateIngredientHandler)
-	http.HandleFunc("/admin/ingredient/list", handlers.AdminListIngredientsHandler)
-	http.HandleFunc("/admin/ingredient/update", handlers.AdminUpdateIngredientHandler)
-	http.HandleFunc("/admin/ingredient/delete", handlers.AdminDeleteIngredientHandler)
-	http.HandleFunc("/admin/pizza/create", handlers.AdminCreatePizzaHandler)
-	http.HandleFunc("/admin/pizza/list", handlers.AdminListPizzasHandler)
-	http.HandleFunc("/admin/pizza/delete", handlers.AdminDeletePizzaHandler)
+	store := database.NewSQLStore()
+	h := handlers.New(handlers.Deps{
+		Pizzas:      store,
+		Ingredients: store,
+		ExtraItems:  store,
+		Orders:      store,
+		Carts:       store,
+		Users:       store,
+		Deliveries:  store,
+		Discounts:   store,
+		Promotions:  store,
+		Vouchers:    store,
+		Kitchen:     store,
+		Pricing:     store,
+		Exports:     store,
+	})
+
+	if err := store.DeleteExpiredSessions(); err != nil {
+		log.Println("Failed to clean up expired sessions:", err)
+	}
+
+	// Assigns ready orders to couriers while the dispatch policy has automatic dispatch on
+	interval := dispatch.DefaultInterval
+	if value := os.Getenv("DISPATCH_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("Invalid DISPATCH_INTERVAL %q", value)
+		}
+		interval = parsed
+	}
+	go dispatch.New(store, interval).Run(context.Background())
+
+	// Allowed roles per route. Routes registered without one of these are public.
+	admin := h.RequireRoles(database.AdminRole)
+	customer := h.RequireRoles(database.CustomerRole)
+	delivery := h.RequireRoles(database.DeliveryRole)
+	kitchen := h.RequireRoles(database.KitchenRole, database.AdminRole)
+	anyUser := h.RequireRoles(database.AdminRole, database.DeliveryRole, database.CustomerRole)
+
+	http.HandleFunc("/", h.IndexHandler)
+	http.HandleFunc("/login", h.LoginHandler)
+	http.HandleFunc("/logout", h.LogoutHandler)
+	http.HandleFunc("/session", h.SessionHandler)
+	http.HandleFunc("/register", h.RegisterHandler)
+	http.HandleFunc("/pizza", h.PizzaHandler)
+	http.HandleFunc("/home", h.HomeHandler)
+	http.HandleFunc("/menu", h.MenuHandler)
+	http.HandleFunc("/pizza/list", h.ListPizzasHandler)
+	http.HandleFunc("/pizza/options", h.PizzaOptionsHandler)
+	http.HandleFunc("/pizza/price", h.CustomPizzaPriceHandler)
+	http.HandleFunc("/ingredient/list", h.ListIngredientsHandler)
+	http.HandleFunc("/account", h.AccountHandler)
+	http.HandleFunc("/getAccountDetails", customer(h.GetAccountDetailsHandler))
+
+	// The admin panel renders its own login form, so it checks the role itself.
+	http.HandleFunc("/admin", h.AdminHandler)
+	http.HandleFunc("/admin/ingredient/create", admin(h.AdminCreateIngredientHandler))
+	http.HandleFunc("/admin/ingredient/list", admin(h.AdminListIngredientsHandler))
+	http.HandleFunc("/admin/ingredient/update", admin(h.AdminUpdateIngredientHandler))
+	http.HandleFunc("/admin/ingredient/delete", admin(h.AdminDeleteIngredientHandler))
+	http.HandleFunc("/admin/ingredient/restock", admin(h.AdminRestockIngredientHandler))
+	http.HandleFunc("/admin/ingredient/stock-settings", admin(h.AdminStockSettingsHandler))
+	http.HandleFunc("/admin/stock", admin(h.AdminStockHandler))
+	http.HandleFunc("/admin/pizza/create", admin(h.AdminCreatePizzaHandler))
+	http.HandleFunc("/admin/pizza/list", admin(h.AdminListPizzasHandler))
+	http.HandleFunc("/admin/pizza/delete", admin(h.AdminDeletePizzaHandler))
+	http.HandleFunc("/admin/pizza/ingredient-amount", admin(h.AdminPizzaIngredientAmountHandler))
+	http.HandleFunc("/admin/pizza-options/save", admin(h.AdminSavePizzaOptionHandler))
+	http.HandleFunc("/admin/pizza-options/delete", admin(h.AdminDeletePizzaOptionHandler))
+	http.HandleFunc("/admin/pricing", admin(h.AdminPricingHandler))
+	http.HandleFunc("/admin/pricing/update", admin(h.AdminUpdatePricingHandler))
 	http.HandleFunc("/cart", func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, "frontend/cart.html")
 	})
@@ -37,40 +103,138 @@ func main() {
 		http.ServeFile(w, r, "frontend/order-confirmation.html")
 	})
 
-	http.HandleFunc("/order/create", handlers.CreateOrderHandler)
-	http.HandleFunc("/order/list", handlers.GetOrdersHandler)
-	http.HandleFunc("/order/details", handlers.GetOrderDetailsHandler)
-	http.HandleFunc("/extra-items/list", handlers.ListExtraItemsHandler)
-
-	http.HandleFunc("/admin/extra-items/create", handlers.CreateExtraItemHandler)
-	http.HandleFunc("/admin/extra-items/update", handlers.UpdateExtraItemHandler)
-	http.HandleFunc("/admin/extra-items/delete", handlers.DeleteExtraItemHandler)
-	http.HandleFunc("/admin/users/list", handlers.AdminGetAllUsersHandler)
-	http.HandleFunc("/admin/users/delete", handlers.AdminDeleteUserHandler)
-	http.HandleFunc("/admin/users/create", handlers.AdminCreateUserHandler)
-	http.HandleFunc("/admin/orders/list", handlers.AdminGetAllOrdersHandler)
-	http.HandleFunc("/admin/orders/delete", handlers.AdminDeleteOrderHandler)
-	http.HandleFunc("/admin/orders/update-status", handlers.AdminUpdateOrderStatusHandler)
-	http.HandleFunc("/admin/delivery/list", handlers.AdminGetAllDeliveryPersonsHandler)
-	http.HandleFunc("/admin/delivery/delete", handlers.AdminDeleteDeliveryPersonHandler)
-
-	http.HandleFunc("/admin/discount/create", handlers.CreateDiscountCodeHandler)
-	http.HandleFunc("/admin/discount/update", handlers.UpdateDiscountCodeHandler)
-	http.HandleFunc("/admin/discount/delete", handlers.DeleteDiscountCodeHandler)
-	http.HandleFunc("/admin/orders/assign-delivery", handlers.AssignDeliveryPersonHandler)
-
-	http.HandleFunc("/api/validate-discount", handlers.ValidateDiscountCodeHandler)
-	http.HandleFunc("/api/extra-items", handlers.ListExtraItemsHandler)
-	http.HandleFunc("/api/check-birthday", handlers.CheckBirthdayDiscountHandler)
-
-	http.HandleFunc("/delivery_person", handlers.DeliveryPerson)
+	http.HandleFunc("/cart/items", customer(h.CartItemsHandler))
+	http.HandleFunc("/cart/add", customer(h.AddToCartHandler))
+	http.HandleFunc("/cart/update", customer(h.UpdateCartItemHandler))
+	http.HandleFunc("/cart/remove", customer(h.RemoveFromCartHandler))
+	http.HandleFunc("/cart/clear", customer(h.ClearCartHandler))
+	http.HandleFunc("/order/create", customer(h.CreateOrderHandler))
+	http.HandleFunc("/order/quote", customer(h.QuoteOrderHandler))
+	http.HandleFunc("/order/list", customer(h.GetOrdersHandler))
+	http.HandleFunc("/order/history", customer(h.OrderHistoryHandler))
+	http.HandleFunc("/order/reorder", customer(h.ReorderHandler))
+	http.HandleFunc("/order/cancel", customer(h.CancelOrderHandler))
+	http.HandleFunc("/order/details", anyUser(h.GetOrderDetailsHandler))
+	http.HandleFunc("/extra-items/list", h.ListExtraItemsHandler)
+
+	http.HandleFunc("/admin/extra-items/create", admin(h.CreateExtraItemHandler))
+	http.HandleFunc("/admin/extra-items/update", admin(h.UpdateExtraItemHandler))
+	http.HandleFunc("/admin/extra-items/delete", admin(h.DeleteExtraItemHandler))
+	http.HandleFunc("/admin/users/list", admin(h.AdminGetAllUsersHandler))
+	http.HandleFunc("/admin/users/delete", admin(h.AdminDeleteUserHandler))
+	http.HandleFunc("/admin/users/create", admin(h.AdminCreateUserHandler))
+	http.HandleFunc("/admin/orders/list", admin(h.AdminGetAllOrdersHandler))
+	http.HandleFunc("/admin/orders/delete", admin(h.AdminDeleteOrderHandler))
+	http.HandleFunc("/admin/orders/update-status", admin(h.AdminUpdateOrderStatusHandler))
+	http.HandleFunc("/admin/orders/cancel", admin(h.AdminCancelOrderHandler))
+	http.HandleFunc("/admin/delivery/list", admin(h.AdminGetAllDeliveryPersonsHandler))
+	http.HandleFunc("/admin/delivery/delete", admin(h.AdminDeleteDeliveryPersonHandler))
+	http.HandleFunc("/admin/delivery/zones", admin(h.AdminSetDeliveryPersonZonesHandler))
+	http.HandleFunc("/admin/delivery-zones/create", admin(h.AdminCreateDeliveryZoneHandler))
+	http.HandleFunc("/admin/delivery-zones/update", admin(h.AdminUpdateDeliveryZoneHandler))
+	http.HandleFunc("/admin/delivery-zones/delete", admin(h.AdminDeleteDeliveryZoneHandler))
+	http.HandleFunc("/admin/dispatch", admin(h.AdminDispatchPolicyHandler))
+	http.HandleFunc("/admin/dispatch/update", admin(h.AdminUpdateDispatchPolicyHandler))
+	http.HandleFunc("/admin/dispatch/run", admin(h.AdminDispatchNowHandler))
+
+	http.HandleFunc("/admin/discount/create", admin(h.CreateDiscountCodeHandler))
+	http.HandleFunc("/admin/discount/update", admin(h.UpdateDiscountCodeHandler))
+	http.HandleFunc("/admin/discount/delete", admin(h.DeleteDiscountCodeHandler))
+	http.HandleFunc("/admin/promotions/create", admin(h.AdminCreatePromotionHandler))
+	http.HandleFunc("/admin/promotions/set-active", admin(h.AdminSetPromotionActiveHandler))
+	http.HandleFunc("/admin/promotions/delete", admin(h.AdminDeletePromotionHandler))
+	http.HandleFunc("/admin/vouchers/create", admin(h.AdminCreateVoucherCampaignHandler))
+	http.HandleFunc("/admin/vouchers/stats", admin(h.AdminVoucherStatsHandler))
+	http.HandleFunc("/admin/vouchers/export", admin(h.AdminExportVouchersHandler))
+	http.HandleFunc("/admin/orders/assign-delivery", admin(h.AssignDeliveryPersonHandler))
+
+	reportsHandler := reports.New(store)
+	http.HandleFunc("/admin/reports/undelivered", admin(reportsHandler.UndeliveredHandler))
+	http.HandleFunc("/admin/reports/top-pizzas", admin(reportsHandler.TopPizzasHandler))
+	http.HandleFunc("/admin/reports/earnings/{filter}", admin(reportsHandler.EarningsHandler))
+	http.HandleFunc("/admin/export/orders", admin(h.AdminExportOrdersHandler))
+	http.HandleFunc("/admin/export/customers", admin(h.AdminExportCustomersHandler))
+	http.HandleFunc("/admin/export/sales", admin(h.AdminExportSalesHandler))
+
+	http.HandleFunc("/api/validate-discount", customer(h.ValidateDiscountCodeHandler))
+	http.HandleFunc("/api/extra-items", h.ListExtraItemsHandler)
+	http.HandleFunc("/api/check-birthday", customer(h.CheckBirthdayDiscountHandler))
+	http.HandleFunc("/loyalty", customer(h.LoyaltyHandler))
+
+	http.HandleFunc("/delivery_person", h.DeliveryPerson)
 
 	// Delivery person endpoints
-	http.HandleFunc("/delivery/available", handlers.GetAvailableDeliveriesHandler)
-	http.HandleFunc("/delivery/assigned", handlers.GetAssignedDeliveriesHandler)
-	http.HandleFunc("/delivery/assign", handlers.AssignDeliveryHandler)
-	http.HandleFunc("/delivery/update-status", handlers.UpdateDeliveryStatusHandler)
+	http.HandleFunc("/delivery/available", delivery(h.GetAvailableDeliveriesHandler))
+	http.HandleFunc("/delivery/assigned", delivery(h.GetAssignedDeliveriesHandler))
+	http.HandleFunc("/delivery/assign", delivery(h.AssignDeliveryHandler))
+	http.HandleFunc("/delivery/update-status", delivery(h.UpdateDeliveryStatusHandler))
+
+	http.HandleFunc("/kitchen", h.KitchenHandler)
+
+	// Kitchen endpoints
+	http.HandleFunc("/kitchen/queue", kitchen(h.KitchenQueueHandler))
+	http.HandleFunc("/kitchen/items/update", kitchen(h.KitchenUpdateItemHandler))
+	http.HandleFunc("/kitchen/orders/ready", kitchen(h.KitchenOrderReadyHandler))
 
 	fmt.Printf("Server running on http://localhost:%s\n", PORT)
 	http.ListenAndServe(fmt.Sprintf(":%s", PORT), nil)
 }
+
+const usage = `usage:
+  main                      start the server (applies pending migrations)
+  main migrate up           apply all pending migrations
+  main migrate down [n]     roll back the last n migrations (default 1)
+  main migrate status       list migrations and whether they are applied
+  main seed                 fill an empty database with the dev menu and accounts`
+
+func runCommand(args []string) {
+	database.Connect()
+	defer database.Close()
+
+	switch {
+	case args[0] == "migrate" && len(args) >= 2 && args[1] == "up":
+		applied, err := database.MigrateUp()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Applied %d migration(s)\n", applied)
+
+	case args[0] == "migrate" && len(args) >= 2 && args[1] == "down":
+		steps := 1
+		if len(args) >= 3 {
+			var err error
+			steps, err = strconv.Atoi(args[2])
+			if err != nil || steps < 1 {
+				log.Fatal("down expects a positive number of steps")
+			}
+		}
+		rolledBack, err := database.MigrateDown(steps)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Rolled back %d migration(s)\n", rolledBack)
+
+	case args[0] == "migrate" && len(args) >= 2 && args[1] == "status":
+		statuses, err := database.GetMigrationStatus()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, state)
+		}
+
+	case args[0] == "seed":
+		if _, err := database.MigrateUp(); err != nil {
+			log.Fatal(err)
+		}
+		database.SeedDevData()
+
+	default:
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+}
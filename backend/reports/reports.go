@@ -0,0 +1,233 @@
+// Package reports serves the admin reports as JSON: undelivered orders, the best selling pizzas and earnings.
+package reports
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	database "pizza_shop/backend/database"
+	"pizza_shop/backend/web"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTopPizzas and DefaultWindowDays are what the top pizzas report shows without ?n= and ?from=.
+const (
+	DefaultTopPizzas  = 3
+	DefaultWindowDays = 30
+	maxTopPizzas      = 100
+)
+
+// Store runs the report queries, database.OrderStore implements it.
+type Store interface {
+	GetUndeliveredOrders() ([]database.UndeliveredOrder, error)
+	GetTopPizzas(from, to time.Time, limit int) ([]database.PizzaSales, error)
+	GetEarnings(groupBy database.EarningsGroup, filter database.EarningsFilter) ([]database.RevenueGroup, error)
+}
+
+// Handler serves the reports, main registers its methods as admin routes.
+type Handler struct {
+	store Store
+	now   func() time.Time
+}
+
+func New(store Store) *Handler {
+	return &Handler{store: store, now: time.Now}
+}
+
+// UndeliveredOrder is a row of the undelivered orders report.
+type UndeliveredOrder struct {
+	ID              int       `json:"id"`
+	CustomerName    string    `json:"customer_name"`
+	Status          string    `json:"status"`
+	Timestamp       time.Time `json:"timestamp"`
+	AgeMinutes      int       `json:"age_minutes"`
+	DeliveryAddress string    `json:"delivery_address"`
+	PostalCode      string    `json:"postal_code"`
+	Items           []string  `json:"items"`
+}
+
+// PizzaSales is a row of the top pizzas report.
+type PizzaSales struct {
+	Name     string  `json:"name"`
+	Quantity int     `json:"quantity"`
+	Revenue  float64 `json:"revenue"`
+}
+
+// Earnings is a row of the earnings report, category is the gender, age bracket or postal code.
+type Earnings struct {
+	Category     string  `json:"category"`
+	Orders       int     `json:"orders"`
+	Revenue      float64 `json:"revenue"`
+	AverageOrder float64 `json:"average_order"`
+}
+
+// UndeliveredHandler lists the orders that are neither delivered, failed nor cancelled, newest first,
+// with how long ago they were placed.
+func (h *Handler) UndeliveredHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	orders, err := h.store.GetUndeliveredOrders()
+	if err != nil {
+		fmt.Println("GetUndeliveredOrders error:", err)
+		web.WriteJSONError(w, http.StatusInternalServerError, "Failed to load undelivered orders")
+		return
+	}
+
+	now := h.now()
+	type Msg struct {
+		Ok     bool               `json:"ok"`
+		Orders []UndeliveredOrder `json:"orders"`
+	}
+	msg := Msg{Ok: true, Orders: make([]UndeliveredOrder, len(orders))}
+	for i, o := range orders {
+		msg.Orders[i] = UndeliveredOrder{
+			ID:              o.OrderID,
+			CustomerName:    o.CustomerName,
+			Status:          o.Status,
+			Timestamp:       o.Timestamp,
+			AgeMinutes:      int(now.Sub(o.Timestamp).Minutes()),
+			DeliveryAddress: o.Address,
+			PostalCode:      o.PostalCode,
+			Items:           o.Items,
+		}
+	}
+	writeJSON(w, msg)
+}
+
+// TopPizzasHandler returns the ?n= best selling pizzas (default 3) of the orders placed between ?from= and ?to=,
+// both YYYY-MM-DD and inclusive. The window defaults to the last 30 days.
+func (h *Handler) TopPizzasHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := DefaultTopPizzas
+	if value := query.Get("n"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxTopPizzas {
+			web.WriteJSONError(w, http.StatusBadRequest, fmt.Sprintf("n must be between 1 and %d", maxTopPizzas))
+			return
+		}
+		limit = n
+	}
+	from, to, err := web.ParseDateRange(query.Get("from"), query.Get("to"))
+	if err != nil {
+		web.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	now := h.now()
+	if to == nil {
+		to = &now
+	}
+	if from == nil {
+		start := to.AddDate(0, 0, -DefaultWindowDays)
+		from = &start
+	}
+
+	pizzas, err := h.store.GetTopPizzas(*from, *to, limit)
+	if err != nil {
+		fmt.Println("GetTopPizzas error:", err)
+		web.WriteJSONError(w, http.StatusInternalServerError, "Failed to load top pizzas")
+		return
+	}
+
+	type Msg struct {
+		Ok     bool         `json:"ok"`
+		From   time.Time    `json:"from"`
+		To     time.Time    `json:"to"`
+		Pizzas []PizzaSales `json:"pizzas"`
+	}
+	msg := Msg{Ok: true, From: *from, To: *to, Pizzas: make([]PizzaSales, len(pizzas))}
+	for i, p := range pizzas {
+		msg.Pizzas[i] = PizzaSales{Name: p.Name, Quantity: p.TotalSold, Revenue: p.Revenue}
+	}
+	writeJSON(w, msg)
+}
+
+// EarningsHandler adds up the earnings by the {filter} in the path: gender, age or postal. The orders can be
+// narrowed down with ?from= and ?to= (YYYY-MM-DD, inclusive), ?gender=, ?age= (one of the age brackets)
+// and ?postal_code= (a prefix). Cancelled orders and failed deliveries don't count.
+func (h *Handler) EarningsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	groupBy := database.EarningsGroup(r.PathValue("filter"))
+	if !slices.Contains(database.EarningsGroups, groupBy) {
+		web.WriteJSONError(w, http.StatusNotFound, "Unknown earnings filter, use gender, age or postal")
+		return
+	}
+	filter, err := ParseEarningsFilter(r)
+	if err != nil {
+		web.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	groups, err := h.store.GetEarnings(groupBy, filter)
+	if err != nil {
+		fmt.Println("GetEarnings error:", err)
+		web.WriteJSONError(w, http.StatusInternalServerError, "Failed to load earnings")
+		return
+	}
+
+	type Msg struct {
+		Ok       bool       `json:"ok"`
+		GroupBy  string     `json:"group_by"`
+		Earnings []Earnings `json:"earnings"`
+		Total    Earnings   `json:"total"`
+	}
+	msg := Msg{Ok: true, GroupBy: string(groupBy), Earnings: make([]Earnings, len(groups)), Total: Earnings{Category: "Total"}}
+	for i, g := range groups {
+		msg.Earnings[i] = newEarnings(g.Group, g.OrderCount, g.Revenue)
+		msg.Total.Orders += g.OrderCount
+		msg.Total.Revenue += g.Revenue
+	}
+	msg.Total = newEarnings(msg.Total.Category, msg.Total.Orders, msg.Total.Revenue)
+	writeJSON(w, msg)
+}
+
+// newEarnings rounds the amounts to cents, adding up floats leaves them a little off.
+func newEarnings(category string, orders int, revenue float64) Earnings {
+	e := Earnings{Category: category, Orders: orders, Revenue: math.Round(revenue*100) / 100}
+	if orders > 0 {
+		e.AverageOrder = math.Round(revenue/float64(orders)*100) / 100
+	}
+	return e
+}
+
+// ParseEarningsFilter reads the filters of the earnings report from the query string.
+func ParseEarningsFilter(r *http.Request) (database.EarningsFilter, error) {
+	query := r.URL.Query()
+	var filter database.EarningsFilter
+	var err error
+	if filter.From, filter.To, err = web.ParseDateRange(query.Get("from"), query.Get("to")); err != nil {
+		return filter, err
+	}
+	filter.Gender = strings.TrimSpace(query.Get("gender"))
+	filter.AgeBracket = query.Get("age")
+	if filter.AgeBracket != "" && !slices.Contains(database.AgeBrackets, filter.AgeBracket) {
+		return filter, fmt.Errorf("age must be one of %s", strings.Join(database.AgeBrackets, ", "))
+	}
+	filter.PostalCode = strings.TrimSpace(query.Get("postal_code"))
+	if value := query.Get("limit"); value != "" {
+		if filter.Limit, err = strconv.Atoi(value); err != nil || filter.Limit < 0 {
+			return filter, fmt.Errorf("invalid limit")
+		}
+	}
+	return filter, nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
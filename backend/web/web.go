@@ -0,0 +1,46 @@
+// Package web has what the handlers and reports packages both need to answer requests.
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// DateLayout is what <input type="date"> submits, days start at midnight in the shop's time zone.
+const DateLayout = "2006-01-02"
+
+// WriteJSONError answers with the status and {"ok": false, "error": msg}.
+func WriteJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":    false,
+		"error": msg,
+	})
+}
+
+// ParseDateRange reads a from and to date (YYYY-MM-DD), to is inclusive so the range ends at the
+// midnight after it. A blank date is nil.
+func ParseDateRange(fromValue, toValue string) (from, to *time.Time, err error) {
+	if fromValue != "" {
+		t, err := time.ParseInLocation(DateLayout, fromValue, time.Local)
+		if err != nil {
+			return nil, nil, errors.New("invalid from date, use YYYY-MM-DD")
+		}
+		from = &t
+	}
+	if toValue != "" {
+		t, err := time.ParseInLocation(DateLayout, toValue, time.Local)
+		if err != nil {
+			return nil, nil, errors.New("invalid to date, use YYYY-MM-DD")
+		}
+		t = t.AddDate(0, 0, 1)
+		to = &t
+	}
+	if from != nil && to != nil && !from.Before(*to) {
+		return nil, nil, errors.New("from must not be after to")
+	}
+	return from, to, nil
+}
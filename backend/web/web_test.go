@@ -0,0 +1,22 @@
+package web
+
+import "testing"
+
+func TestParseDateRange(t *testing.T) {
+	from, to, err := ParseDateRange("2026-10-01", "2026-10-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from.Format(DateLayout) != "2026-10-01" || to.Format(DateLayout) != "2026-10-02" {
+		t.Errorf("range %v - %v, want the whole of 2026-10-01", from, to)
+	}
+
+	if from, to, err := ParseDateRange("", ""); from != nil || to != nil || err != nil {
+		t.Errorf("blank dates: %v %v %v, want nil", from, to, err)
+	}
+	for _, dates := range [][2]string{{"01-10-2026", ""}, {"", "tomorrow"}, {"2026-10-02", "2026-10-01"}} {
+		if _, _, err := ParseDateRange(dates[0], dates[1]); err == nil {
+			t.Errorf("%q to %q parsed", dates[0], dates[1])
+		}
+	}
+}
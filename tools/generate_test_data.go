@@ -1,12 +1,16 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
+	"slices"
 	"time"
 
 	"pizza_shop/backend/database"
+
+	"github.com/shopspring/decimal"
 )
 
 var firstNames = []string{
@@ -31,8 +35,6 @@ var streets = []string{
 
 var genders = []string{"Male", "Female", "Non-binary", "Prefer not to say"}
 
-var statuses = []string{"IN_PROGRESS", "OUT_FOR_DELIVERY", "DELIVERED", "FAILED"}
-
 func randomString(options []string) string {
 	return options[rand.Intn(len(options))]
 }
@@ -193,6 +195,11 @@ func generateOrders(customerIDs []int, count int) {
 		log.Fatalf("Failed to get extra items: %v\n", err)
 	}
 
+	ingredients, err := database.GetAllIngredients()
+	if err != nil {
+		log.Fatalf("Failed to get ingredients: %v\n", err)
+	}
+
 	// Order dates: last 2 years
 	now := time.Now()
 	twoYearsAgo := now.AddDate(-2, 0, 0)
@@ -229,34 +236,23 @@ func generateOrders(customerIDs []int, count int) {
 		}
 
 		numPizzas := 1 + rand.Intn(4)
-		var pizzaItems []struct {
-			PizzaID  int
-			Quantity int
-		}
+		var pizzaItems []database.PizzaOrderItem
 
 		for j := 0; j < numPizzas; j++ {
 			pizza := pizzas[rand.Intn(len(pizzas))]
+			variant := pizza.Variants[rand.Intn(len(pizza.Variants))]
 			quantity := 1 + rand.Intn(3)
-			pizzaItems = append(pizzaItems, struct {
-				PizzaID  int
-				Quantity int
-			}{pizza.ID, quantity})
+			pizzaItems = append(pizzaItems, database.PizzaOrderItem{PizzaID: pizza.ID, SizeID: variant.SizeID, CrustID: variant.CrustID, Quantity: quantity, Modifiers: randomModifiers(pizza, ingredients)})
 		}
 
-		var extraItemsToOrder []struct {
-			ExtraItemID int
-			Quantity    int
-		}
+		var extraItemsToOrder []database.ExtraOrderItem
 
 		if len(extraItems) > 0 && rand.Float32() < 0.6 {
 			numExtras := 1 + rand.Intn(3)
 			for j := 0; j < numExtras && j < len(extraItems); j++ {
 				extraItem := extraItems[rand.Intn(len(extraItems))]
 				quantity := 1 + rand.Intn(2)
-				extraItemsToOrder = append(extraItemsToOrder, struct {
-					ExtraItemID int
-					Quantity    int
-				}{extraItem.ID, quantity})
+				extraItemsToOrder = append(extraItemsToOrder, database.ExtraOrderItem{ExtraItemID: extraItem.ID, Quantity: quantity})
 			}
 		}
 
@@ -270,6 +266,23 @@ func generateOrders(customerIDs []int, count int) {
 			nil,
 		)
 
+		// Two years of orders need more than the seeded stock, play supplier and try again
+		var outOfStock *database.OutOfStockError
+		if errors.As(err, &outOfStock) {
+			if err := restockAll(); err != nil {
+				log.Fatalf("Failed to restock ingredients: %v\n", err)
+			}
+			orderID, err = database.CreateOrderWithTransaction(
+				customerID,
+				userID,
+				customer.Address,
+				customer.PostCode,
+				pizzaItems,
+				extraItemsToOrder,
+				nil,
+			)
+		}
+
 		if err != nil {
 			log.Printf("Failed to create order: %v\n", err)
 			continue
@@ -277,18 +290,18 @@ func generateOrders(customerIDs []int, count int) {
 
 		// Random status weighted towards DELIVERED
 		statusRand := rand.Float32()
-		var status string
+		var status database.OrderStatus
 		if statusRand < 0.80 { // 80% delivered
-			status = "DELIVERED"
-		} else if statusRand < 0.90 { // 10% in progress
-			status = "IN_PROGRESS"
+			status = database.OrderDelivered
+		} else if statusRand < 0.90 { // 10% waiting for a courier
+			status = database.OrderReady
 		} else if statusRand < 0.95 { // 5% out for delivery
-			status = "OUT_FOR_DELIVERY"
+			status = database.OrderOutForDelivery
 		} else { // 5% failed
-			status = "FAILED"
+			status = database.OrderFailed
 		}
 
-		err = database.UpdateOrderStatus(orderID, status)
+		err = advanceOrderTo(orderID, status)
 		if err != nil {
 			log.Printf("Failed to update order status: %v\n", err)
 		}
@@ -303,6 +316,14 @@ func generateOrders(customerIDs []int, count int) {
 		if err != nil {
 			log.Printf("Failed to update order timestamp: %v\n", err)
 		}
+		_, err = database.DATABASE.Exec(
+			"UPDATE order_status_history SET changed_at = ? WHERE order_id = ?",
+			orderDate,
+			orderID,
+		)
+		if err != nil {
+			log.Printf("Failed to update order status history: %v\n", err)
+		}
 
 		if (i+1)%50 == 0 {
 			fmt.Printf("  ✓ Created %d orders...\n", i+1)
@@ -311,6 +332,88 @@ func generateOrders(customerIDs []int, count int) {
 	fmt.Printf("  ✓ Created %d orders total\n", count)
 }
 
+// advanceOrderTo walks a freshly placed order through the kitchen and the lifecycle until it reaches target.
+// Every target is past the kitchen, so all pizzas get baked first.
+func advanceOrderTo(orderID int, target database.OrderStatus) error {
+	details, err := database.GetOrderDetails(orderID)
+	if err != nil {
+		return err
+	}
+	for _, pizza := range details.Pizzas {
+		if err := database.StartOrderPizza(pizza.ID, 0); err != nil {
+			return err
+		}
+		if err := database.FinishOrderPizza(pizza.ID, 0); err != nil {
+			return err
+		}
+	}
+	if err := database.MarkOrderReady(orderID, 0); err != nil {
+		return err
+	}
+
+	current := database.OrderReady
+	for current != target {
+		next := current.NextStatuses()
+		if len(next) == 0 {
+			return fmt.Errorf("can't reach %s from %s", target, current)
+		}
+		step := next[0]
+		if slices.Contains(next, target) {
+			step = target
+		}
+		if err := database.UpdateOrderStatus(orderID, step, 0); err != nil {
+			return err
+		}
+		current = step
+	}
+	return nil
+}
+
+// randomModifiers customizes about a quarter of the pizzas: an extra topping, one taken off, or both.
+// Pizzas without a recipe ("Build your own") always get one to three toppings.
+func randomModifiers(pizza database.PizzaWithPrice, ingredients []database.IngredientWithID) []database.PizzaModifier {
+	var modifiers []database.PizzaModifier
+	used := map[int]bool{}
+
+	if len(pizza.Ingredients) == 0 {
+		for n := 1 + rand.Intn(3); n > 0; n-- {
+			ingr := ingredients[rand.Intn(len(ingredients))]
+			if !used[ingr.ID] {
+				used[ingr.ID] = true
+				modifiers = append(modifiers, database.PizzaModifier{IngredientID: ingr.ID, Action: database.AddIngredient})
+			}
+		}
+		return modifiers
+	}
+
+	if rand.Float32() < 0.15 && len(pizza.Ingredients) > 1 {
+		removed := pizza.Ingredients[rand.Intn(len(pizza.Ingredients))]
+		used[removed.ID] = true
+		modifiers = append(modifiers, database.PizzaModifier{IngredientID: removed.ID, Action: database.RemoveIngredient})
+	}
+	if rand.Float32() < 0.15 {
+		added := ingredients[rand.Intn(len(ingredients))]
+		if !used[added.ID] {
+			modifiers = append(modifiers, database.PizzaModifier{IngredientID: added.ID, Action: database.AddIngredient})
+		}
+	}
+	return modifiers
+}
+
+// restockAll tops every ingredient up by another 10 kg (or 10000 of whatever its unit is).
+func restockAll() error {
+	ingredients, err := database.GetAllIngredients()
+	if err != nil {
+		return err
+	}
+	for _, ingr := range ingredients {
+		if err := database.RestockIngredient(ingr.ID, decimal.NewFromInt(10000)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func main() {
 	rand.Seed(time.Now().UnixNano())
 
@@ -320,6 +423,9 @@ func main() {
 	database.Init()
 	defer database.Close()
 
+	// Orders need a menu, so a brand new database (e.g. a fresh SQLite file) gets the dev seed first.
+	database.SeedDevData()
+
 	fmt.Println("Connected to database!")
 	fmt.Println()
 
@@ -327,10 +433,10 @@ func main() {
 	fmt.Printf("\n✓ Created %d customers\n\n", len(customerIDs))
 
 	generateDeliveryPeople(10)
-	fmt.Println("\n✓ Created 10 delivery people\n")
+	fmt.Print("\n✓ Created 10 delivery people\n\n")
 
 	generateOrders(customerIDs, 500)
-	fmt.Println("\n✓ Created 500 orders\n")
+	fmt.Print("\n✓ Created 500 orders\n\n")
 
 	fmt.Println("=== Test Data Generation Complete! ===")
 	fmt.Println()